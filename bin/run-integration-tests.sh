@@ -29,6 +29,21 @@ function cleanup() {
 	if [ -f $LOG_FILE ]; then
 		rm $LOG_FILE
 	fi	
+	if [ -f $BREACHED_PASSWORDS_FILE ]; then
+		rm $BREACHED_PASSWORDS_FILE
+	fi
+	if [ -f $JWT_KEY_FILE ]; then
+		rm $JWT_KEY_FILE
+	fi
+	if [ -f $OIDC_CLIENTS_FILE ]; then
+		rm $OIDC_CLIENTS_FILE
+	fi
+	if [ -f $ATTRIBUTE_SCHEMA_FILE ]; then
+		rm $ATTRIBUTE_SCHEMA_FILE
+	fi
+	if [ -f $REALMS_FILE ]; then
+		rm $REALMS_FILE
+	fi
 }
 
 function run_suites() {
@@ -42,6 +57,29 @@ function run_suites() {
 
 	fi
 
+	# config
+	run_test_suite "--auth-email=true --require-current-password=true --webauthn-rp-id=localhost --webauthn-origins=http://localhost" ".+Integration.+__SuiteRequireCurrentPassword" $*
+	run_test_suite "--auth-email=true --password-history=3" ".+Integration.+__SuitePasswordHistory" $*
+	run_test_suite "--auth-email=true --login-identifier=login_name_or_email" ".+Integration.+__SuiteLoginNameOrEmail" $*
+	run_test_suite "--auth-email=true --login-links=true" ".+Integration.+__SuiteLoginLinks" $*
+	run_test_suite "--auth-email=true --audit-retention=0" ".+Integration.+__SuiteHistoryDisabled" $*
+
+	echo -n "breached-secret" | sha1sum | awk '{ print toupper($1) ":1" }' > $BREACHED_PASSWORDS_FILE
+	run_test_suite "--auth-email=true --breached-passwords=sha1-file --breached-passwords-path=$BREACHED_PASSWORDS_FILE" ".+Integration.+__SuiteBreachedPasswords" $*
+	run_test_suite "--auth-email=true --webauthn-rp-id=localhost --webauthn-origins=http://localhost" ".+Integration.+__SuiteWebAuthn" $*
+
+	openssl genpkey -algorithm ed25519 -out $JWT_KEY_FILE 2> /dev/null
+	run_test_suite "--auth-email=true --jwt-key-files=$JWT_KEY_FILE" ".+Integration.+__SuiteAccessTokens" $*
+
+	echo '{"clients": [{"client_id": "test", "client_secret": "test-secret", "redirect_uris": ["http://localhost:9999/callback"]}]}' > $OIDC_CLIENTS_FILE
+	run_test_suite "--auth-email=true --jwt-key-files=$JWT_KEY_FILE --oidc-issuer=http://localhost:8080 --oidc-clients=$OIDC_CLIENTS_FILE" ".+Integration.+__SuiteOIDC" $*
+
+	echo '{"attributes": [{"name": "locale", "type": "string", "required": true, "max_length": 10}, {"name": "avatar_url", "type": "string", "public": true}, {"name": "marketing_opt_in", "type": "boolean"}]}' > $ATTRIBUTE_SCHEMA_FILE
+	run_test_suite "--auth-email=true --attribute-schema=$ATTRIBUTE_SCHEMA_FILE" ".+Integration.+__SuiteAttributes" $*
+
+	echo '{"realms": [{"name": "shop", "auth_email": false}, {"name": "forum"}]}' > $REALMS_FILE
+	run_test_suite "--auth-email=true --realms=$REALMS_FILE" ".+Integration.+__SuiteRealms" $*
+
 	# storages
 	run_test_suite "--auth-email=true" ".+Integration.+__Suite(All|AuthEmailTrue)" $*
 	run_test_suite "--auth-email=false" ".+Integration.+__Suite(All|AuthEmailFalse)" $*
@@ -59,6 +97,11 @@ function run_suites() {
 }
 
 LOG_FILE=/tmp/userd-test.log
+BREACHED_PASSWORDS_FILE=/tmp/userd-test-breached-passwords.txt
+JWT_KEY_FILE=/tmp/userd-test-jwt-key.pem
+OIDC_CLIENTS_FILE=/tmp/userd-test-oidc-clients.json
+ATTRIBUTE_SCHEMA_FILE=/tmp/userd-test-attribute-schema.json
+REALMS_FILE=/tmp/userd-test-realms.json
 DEFAULT_ARGS=${DEFAULT_ARGS:-}
 
 cleanup
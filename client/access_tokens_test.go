@@ -0,0 +1,105 @@
+package client
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIntegrationAccessToken__SuiteAccessTokens(t *testing.T) {
+	user := Builder.givenNewVerifiedUser(t)
+
+	if err := ApiSetTokenClaims(user.userID, map[string]interface{}{"roles": []string{"admin"}}); err != nil {
+		t.Fatalf("Failed to set token claims: %v", err)
+	}
+
+	result, err := ApiAuthenticateWithAccessToken(user.LoginName, Password)
+	if err != nil {
+		t.Fatalf("Failed to authenticate with access token: %v", err)
+	}
+	if result.UserID != user.userID || result.SessionID != "" || !result.AccessTokenExpires.After(time.Now()) {
+		t.Fatalf("Unexpected result %#v", result)
+	}
+
+	claims := verifyAccessToken(t, result.AccessToken)
+	if claims["sub"] != user.userID || claims["email_verified"] != true {
+		t.Fatalf("Unexpected claims %#v", claims)
+	}
+	if roles, ok := claims["roles"].([]interface{}); !ok || len(roles) != 1 || roles[0] != "admin" {
+		t.Fatalf("Expected custom claim roles, got %#v", claims)
+	}
+}
+
+func TestIntegrationSetTokenClaimsRejectsRegisteredClaims__SuiteAccessTokens(t *testing.T) {
+	user := Builder.givenNewVerifiedUser(t)
+
+	if err := ApiSetTokenClaims(user.userID, map[string]interface{}{"sub": "someone-else"}); err == nil {
+		t.Fatalf("Expected the registered claim sub to be rejected")
+	}
+}
+
+func TestIntegrationSessionWithAccessToken__SuiteAccessTokens(t *testing.T) {
+	user := Builder.givenNewVerifiedUser(t)
+
+	var result ApiSession
+	call := AuthenticateWithTokensCall{JsonCall{&result}, AuthenticateCall{Name: user.LoginName, Password: Password, Session: true, AccessToken: true}}
+	if _, err := Execute(Endpoint("authenticate"), call); err != nil {
+		t.Fatalf("Failed to authenticate: %v", err)
+	}
+	if result.Token == "" || result.RefreshToken == "" || result.AccessToken == "" {
+		t.Fatalf("Expected session tokens and access token, got %#v", result)
+	}
+	verifyAccessToken(t, result.AccessToken)
+}
+
+// verifyAccessToken checks the EdDSA signature of the token with the published keys and returns its claims.
+func verifyAccessToken(t *testing.T, token string) map[string]interface{} {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		t.Fatalf("Invalid token %s", token)
+	}
+
+	var header struct {
+		Algorithm string `json:"alg"`
+		KeyID     string `json:"kid"`
+	}
+	var claims map[string]interface{}
+	decodeSegment(t, parts[0], &header)
+	decodeSegment(t, parts[1], &claims)
+
+	keys, err := ApiJWKS()
+	if err != nil {
+		t.Fatalf("Failed to get JWKS: %v", err)
+	}
+	for _, key := range keys {
+		if key.KeyID != header.KeyID {
+			continue
+		}
+		if key.Algorithm != "EdDSA" || header.Algorithm != "EdDSA" {
+			t.Fatalf("Expected EdDSA key, got %#v", key)
+		}
+
+		publicKey, _ := base64.RawURLEncoding.DecodeString(key.X)
+		signature, _ := base64.RawURLEncoding.DecodeString(parts[2])
+		if !ed25519.Verify(ed25519.PublicKey(publicKey), []byte(parts[0]+"."+parts[1]), signature) {
+			t.Fatalf("Invalid signature of token %s", token)
+		}
+		return claims
+	}
+
+	t.Fatalf("Key %s is not published", header.KeyID)
+	return nil
+}
+
+func decodeSegment(t *testing.T, segment string, v interface{}) {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		t.Fatalf("Invalid token segment: %v", err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		t.Fatalf("Invalid token segment: %v", err)
+	}
+}
@@ -0,0 +1,54 @@
+package client
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestIntegrationDisabledUserCannotAuthenticate__SuiteAll(t *testing.T) {
+	user := Builder.givenNewVerifiedUser(t)
+
+	if err := ApiDisableUser(user.userID, "spam"); err != nil {
+		t.Fatalf("Failed to disable user: %v", err)
+	}
+
+	_, err := ApiAuthenticate(user.LoginName, Password)
+	if err == nil {
+		t.Fatalf("Expected user-disabled error, got nil")
+	}
+
+	expected := "{\"msg\":\"The user account is disabled.\"}"
+	if strings.TrimSpace(err.Error()) != expected {
+		t.Fatalf("Expected '%s', got '%s'", expected, err.Error())
+	}
+
+	if _, err := ApiNewResetPasswordToken(user.Email); err == nil {
+		t.Fatalf("Expected disabled user to not receive a reset token")
+	}
+}
+
+func TestIntegrationEnableUser__SuiteAll(t *testing.T) {
+	user := Builder.givenNewVerifiedUser(t)
+
+	if err := ApiLockUser(user.userID, "investigation"); err != nil {
+		t.Fatalf("Failed to lock user: %v", err)
+	}
+
+	apiUser, err := ApiGetUser(user.userID)
+	if err != nil {
+		t.Fatalf("Failed to read user: %v", err)
+	}
+	if apiUser.Status != "locked" || apiUser.StatusReason != "investigation" {
+		t.Fatalf("Expected status 'locked' (investigation), got '%s' (%s)", apiUser.Status, apiUser.StatusReason)
+	}
+
+	if err := ApiEnableUser(user.userID, ""); err != nil {
+		t.Fatalf("Failed to enable user: %v", err)
+	}
+
+	if userID, err := ApiAuthenticate(user.LoginName, Password); err != nil {
+		t.Fatalf("Failed to auth: %v", err)
+	} else if userID != user.userID {
+		t.Fatalf("Authenticated as wrong user, got '%s', expected '%s'", userID, user.userID)
+	}
+}
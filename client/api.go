@@ -9,6 +9,9 @@ import (
 	"log"
 	"net/http"
 	"net/url"
+	"strconv"
+	"strings"
+	"time"
 )
 
 var UnexpectedStatusCode = errors.New("Service returned unexpected status code.")
@@ -23,6 +26,11 @@ func Endpoint(action string) string {
 	return endpoint + action
 }
 
+// GroupEndpoint returns the URL of a group action, which lives next to the user actions.
+func GroupEndpoint(action string) string {
+	return strings.TrimSuffix(endpoint, "user/") + "group/" + action
+}
+
 func ApiCreateUser(profileName, email, loginName, loginPassword string) (string, error) {
 	params := url.Values{}
 	params.Add("profile_name", profileName)
@@ -33,11 +41,56 @@ func ApiCreateUser(profileName, email, loginName, loginPassword string) (string,
 	return postFormAndExpectAndReturnBodyString("create", params, http.StatusCreated)
 }
 
+// ApiCreateUserWithAttributes creates a user with custom attributes, see --attribute-schema.
+func ApiCreateUserWithAttributes(profileName, email, loginName, loginPassword string, attributes map[string]interface{}) (string, error) {
+	data, err := json.Marshal(attributes)
+	if err != nil {
+		return "", errgo.Mask(err)
+	}
+
+	params := url.Values{}
+	params.Add("profile_name", profileName)
+	params.Add("email", email)
+	params.Add("login_name", loginName)
+	params.Add("login_password", loginPassword)
+	params.Add("attributes", string(data))
+
+	return postFormAndExpectAndReturnBodyString("create", params, http.StatusCreated)
+}
+
 type ApiUser struct {
 	ProfileName   string `json:"profile_name"`
 	LoginName     string `json:"login_name"`
 	Email         string `json:"email"`
 	EmailVerified bool   `json:"email_verified"`
+	PendingEmail  string `json:"pending_email"`
+	TOTPEnabled   bool   `json:"totp_enabled"`
+	Status        string `json:"status"`
+	StatusReason  string `json:"status_reason"`
+
+	// PasswordBreached is only set if userd runs with --breached-passwords-flag-users
+	PasswordBreached bool `json:"password_breached"`
+
+	SecondaryEmails     []ApiEmailAddress       `json:"secondary_emails"`
+	Phone               string                  `json:"phone"`
+	PhoneVerified       bool                    `json:"phone_verified"`
+	EmailOTPEnabled     bool                    `json:"email_otp_enabled"`
+	WebAuthnCredentials []ApiWebAuthnCredential `json:"webauthn_credentials"`
+
+	Attributes map[string]interface{} `json:"attributes"`
+	Groups     []string               `json:"groups"`
+}
+
+type ApiEmailAddress struct {
+	Email    string `json:"email"`
+	Verified bool   `json:"verified"`
+}
+
+type ApiWebAuthnCredential struct {
+	ID       string     `json:"id"`
+	Name     string     `json:"name"`
+	Created  time.Time  `json:"created"`
+	LastUsed *time.Time `json:"last_used"`
 }
 
 func ApiGetUser(userID string) (ApiUser, error) {
@@ -75,6 +128,11 @@ func postFormAndExpectAndReturnBodyString(action string, params url.Values, expe
 
 	if resp.StatusCode != expectedStatusCode {
 		log.Printf("URL 'POST %s' returned code %d, expected %d", Endpoint(action), resp.StatusCode, expectedStatusCode)
+		if resp.StatusCode == http.StatusBadRequest {
+			if _, err := (PasswordPolicyReader{}).ResponseBadRequest(resp); IsApiPasswordPolicyViolation(err) {
+				return "", err
+			}
+		}
 		return "", UnexpectedStatusCode
 	}
 
@@ -120,6 +178,40 @@ func (call BodyReader) ResponseBadRequest(resp *http.Response) (interface{}, err
 
 // ------------------------
 
+// ApiPasswordPolicyViolation is returned if a new password violates the password policy. Rules contains the names
+// of the violated rules, e.g. "min_length" or "breached".
+type ApiPasswordPolicyViolation struct {
+	Msg   string   `json:"msg"`
+	Rules []string `json:"rules"`
+}
+
+func (e *ApiPasswordPolicyViolation) Error() string {
+	return e.Msg
+}
+
+func IsApiPasswordPolicyViolation(err error) bool {
+	_, ok := errgo.Cause(err).(*ApiPasswordPolicyViolation)
+	return ok
+}
+
+// PasswordPolicyReader can be embedded into calls setting a password to return an *ApiPasswordPolicyViolation.
+type PasswordPolicyReader struct{}
+
+func (call PasswordPolicyReader) ResponseBadRequest(resp *http.Response) (interface{}, error) {
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+
+	var violation ApiPasswordPolicyViolation
+	if err := json.Unmarshal(data, &violation); err == nil && len(violation.Rules) > 0 {
+		return nil, &violation
+	}
+	return nil, errors.New(string(data))
+}
+
+// ------------------------
+
 func ApiVerifyEmail(userID string) error {
 	_, err := Execute(Endpoint("verify_email"), VerifyEmailCall{UserID: userID})
 	return errgo.Mask(err)
@@ -145,10 +237,21 @@ func (call VerifyEmailCall) ResponseNoContent(resp *http.Response) (interface{},
 
 // ------------------------
 
+// ApiSecondFactorRequired is returned by ApiAuthenticate and ApiFinishWebAuthnLogin if the user must complete the
+// authentication with ApiCompleteAuthentication.
+type ApiSecondFactorRequired struct {
+	Challenge string   `json:"challenge"`
+	Methods   []string `json:"methods"`
+}
+
+func (e *ApiSecondFactorRequired) Error() string {
+	return "A second factor is required to authenticate."
+}
+
 func ApiAuthenticate(loginName, loginPassword string) (string, error) {
 	userID, err := Execute(Endpoint("authenticate"), AuthenticateCall{Name: loginName, Password: loginPassword})
 	if err != nil {
-		return "", errgo.Mask(err)
+		return "", errgo.Mask(err, errgo.Any)
 	}
 	return userID.(string), nil
 }
@@ -157,15 +260,382 @@ type AuthenticateCall struct {
 	BodyReader
 	Name     string
 	Password string
+
+	Session     bool
+	AccessToken bool
+	Groups      bool
 }
 
 func (call AuthenticateCall) PostForm() url.Values {
 	p := url.Values{}
 	p.Set("name", call.Name)
 	p.Set("password", call.Password)
+	if call.Session {
+		p.Set("session", "true")
+	}
+	if call.AccessToken {
+		p.Set("access_token", "true")
+	}
+	if call.Groups {
+		p.Set("groups", "true")
+	}
+	return p
+}
+
+func (call AuthenticateCall) ResponseAccepted(resp *http.Response) (interface{}, error) {
+	var required ApiSecondFactorRequired
+	if err := json.NewDecoder(resp.Body).Decode(&required); err != nil {
+		return nil, errgo.Mask(err)
+	}
+	return nil, &required
+}
+
+// ------------------------
+
+type ApiSession struct {
+	UserID              string    `json:"user_id"`
+	SessionID           string    `json:"session_id"`
+	Token               string    `json:"token"`
+	TokenExpires        time.Time `json:"token_expires"`
+	RefreshToken        string    `json:"refresh_token"`
+	RefreshTokenExpires time.Time `json:"refresh_token_expires"`
+
+	AccessToken        string    `json:"access_token"`
+	AccessTokenExpires time.Time `json:"access_token_expires"`
+
+	Groups []string `json:"groups"`
+}
+
+// ApiAuthenticateWithSession authenticates like ApiAuthenticate and creates a session for the user.
+func ApiAuthenticateWithSession(loginName, loginPassword string) (ApiSession, error) {
+	var result ApiSession
+	call := AuthenticateWithTokensCall{JsonCall{&result}, AuthenticateCall{Name: loginName, Password: loginPassword, Session: true}}
+	if _, err := Execute(Endpoint("authenticate"), call); err != nil {
+		return result, errgo.Mask(err, errgo.Any)
+	}
+	return result, nil
+}
+
+// ApiAuthenticateWithAccessToken authenticates like ApiAuthenticate and returns a signed access token. Only UserID,
+// AccessToken and AccessTokenExpires are set.
+func ApiAuthenticateWithAccessToken(loginName, loginPassword string) (ApiSession, error) {
+	var result ApiSession
+	call := AuthenticateWithTokensCall{JsonCall{&result}, AuthenticateCall{Name: loginName, Password: loginPassword, AccessToken: true}}
+	if _, err := Execute(Endpoint("authenticate"), call); err != nil {
+		return result, errgo.Mask(err, errgo.Any)
+	}
+	return result, nil
+}
+
+// AuthenticateWithTokensCall decodes the JSON response of an authentication with session=true or access_token=true.
+type AuthenticateWithTokensCall struct {
+	JsonCall
+	AuthenticateCall
+}
+
+type ApiSessionInfo struct {
+	UserID       string     `json:"user_id"`
+	SessionID    string     `json:"session_id"`
+	TokenExpires time.Time  `json:"token_expires"`
+	Created      time.Time  `json:"created"`
+	Refreshed    *time.Time `json:"refreshed"`
+	Expires      time.Time  `json:"expires"`
+}
+
+func ApiValidateSession(token string) (ApiSessionInfo, error) {
+	var result ApiSessionInfo
+	_, err := Execute(Endpoint("validate_session"), SessionCall{JsonCall: JsonCall{&result}, Token: token})
+	return result, errgo.Mask(err)
+}
+
+// ApiRefreshSession returns new tokens for the session. The refresh token can not be used again.
+func ApiRefreshSession(refreshToken string) (ApiSession, error) {
+	var result ApiSession
+	_, err := Execute(Endpoint("refresh_session"), SessionCall{JsonCall: JsonCall{&result}, RefreshToken: refreshToken})
+	return result, errgo.Mask(err)
+}
+
+func ApiRevokeSession(sessionID string) error {
+	_, err := Execute(Endpoint("revoke_session"), SessionCall{SessionID: sessionID})
+	return errgo.Mask(err)
+}
+
+// ApiListSessions returns the sessions of the user. The tokens are not included.
+func ApiListSessions(userID string) ([]ApiSessionInfo, error) {
+	params := url.Values{}
+	params.Add("id", userID)
+
+	resp, err := getAndExpect("sessions", params, http.StatusOK)
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+
+	var result struct {
+		Sessions []ApiSessionInfo `json:"sessions"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&result)
+	return result.Sessions, err
+}
+
+type ApiHistoryEntry struct {
+	Tag       string    `json:"tag"`
+	Timestamp time.Time `json:"timestamp"`
+	Actor     string    `json:"actor"`
+	RequestID string    `json:"request_id"`
+	Fields    []string  `json:"fields"`
+}
+
+// ApiUserHistory returns the change history of the user, newest first, and the total number of entries.
+func ApiUserHistory(userID string, offset, limit int) ([]ApiHistoryEntry, int, error) {
+	params := url.Values{}
+	params.Add("id", userID)
+	params.Add("offset", strconv.Itoa(offset))
+	params.Add("limit", strconv.Itoa(limit))
+
+	resp, err := getAndExpect("history", params, http.StatusOK)
+	if err != nil {
+		return nil, 0, errgo.Mask(err)
+	}
+
+	var result struct {
+		Entries []ApiHistoryEntry `json:"entries"`
+		Total   int               `json:"total"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&result)
+	return result.Entries, result.Total, err
+}
+
+// ApiUserExport contains all personal data stored about a user, see ApiExportUser.
+type ApiUserExport struct {
+	UserID   string    `json:"user_id"`
+	Exported time.Time `json:"exported"`
+	User     struct {
+		ApiUser
+		TokenClaims map[string]interface{} `json:"token_claims"`
+	} `json:"user"`
+	History  []ApiHistoryEntry `json:"history"`
+	Sessions []ApiSessionInfo  `json:"sessions"`
+}
+
+// ApiExportUser returns the user without secrets, the change history and the active sessions.
+func ApiExportUser(userID string) (ApiUserExport, error) {
+	params := url.Values{}
+	params.Add("id", userID)
+
+	var result ApiUserExport
+	resp, err := getAndExpect("export", params, http.StatusOK)
+	if err != nil {
+		return result, errgo.Mask(err)
+	}
+	err = json.NewDecoder(resp.Body).Decode(&result)
+	return result, err
+}
+
+// ApiRevokeAllSessions returns the number of revoked sessions.
+func ApiRevokeAllSessions(userID string) (int, error) {
+	var result struct {
+		Revoked int `json:"revoked"`
+	}
+	_, err := Execute(Endpoint("revoke_all_sessions"), SessionCall{JsonCall: JsonCall{&result}, UserID: userID})
+	return result.Revoked, errgo.Mask(err)
+}
+
+type SessionCall struct {
+	JsonCall
+	UserID       string
+	SessionID    string
+	Token        string
+	RefreshToken string
+}
+
+func (call SessionCall) PostForm() url.Values {
+	p := url.Values{}
+	for key, value := range map[string]string{
+		"id":            call.UserID,
+		"session_id":    call.SessionID,
+		"token":         call.Token,
+		"refresh_token": call.RefreshToken,
+	} {
+		if value != "" {
+			p.Set(key, value)
+		}
+	}
+	return p
+}
+
+func (call SessionCall) ResponseNoContent(resp *http.Response) (interface{}, error) {
+	return nil, nil
+}
+
+// ------------------------
+
+// ApiSetTokenClaims replaces the custom claims of the user's access tokens.
+func ApiSetTokenClaims(userID string, claims map[string]interface{}) error {
+	data, err := json.Marshal(claims)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	_, err = Execute(Endpoint("set_token_claims"), SetTokenClaimsCall{ID: userID, Claims: string(data)})
+	return errgo.Mask(err)
+}
+
+type SetTokenClaimsCall struct {
+	ID     string
+	Claims string
+}
+
+func (call SetTokenClaimsCall) PostForm() url.Values {
+	p := url.Values{}
+	p.Set("id", call.ID)
+	p.Set("claims", call.Claims)
+	return p
+}
+
+func (call SetTokenClaimsCall) ResponseNoContent(resp *http.Response) (interface{}, error) {
+	return nil, nil
+}
+
+// ApiChangeAttributes sets the given custom attributes of the user, nil values remove an attribute.
+func ApiChangeAttributes(userID string, attributes map[string]interface{}) error {
+	data, err := json.Marshal(attributes)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	_, err = Execute(Endpoint("change_attributes"), ChangeAttributesCall{ID: userID, Attributes: string(data)})
+	return errgo.Mask(err)
+}
+
+type ChangeAttributesCall struct {
+	ID         string
+	Attributes string
+}
+
+func (call ChangeAttributesCall) PostForm() url.Values {
+	p := url.Values{}
+	p.Set("id", call.ID)
+	p.Set("attributes", call.Attributes)
+	return p
+}
+
+func (call ChangeAttributesCall) ResponseNoContent(resp *http.Response) (interface{}, error) {
+	return nil, nil
+}
+
+// ApiPublicAttributes returns the public custom attributes of the user.
+func ApiPublicAttributes(userID string) (map[string]interface{}, error) {
+	var result map[string]interface{}
+
+	params := url.Values{}
+	params.Add("id", userID)
+
+	resp, err := getAndExpect("public_attributes", params, http.StatusOK)
+	if err != nil {
+		return result, errgo.Mask(err)
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&result)
+	return result, err
+}
+
+type ApiJSONWebKey struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Algorithm string `json:"alg"`
+	N         string `json:"n"`
+	E         string `json:"e"`
+	Curve     string `json:"crv"`
+	X         string `json:"x"`
+}
+
+// ApiJWKS returns the public keys of the access tokens from /.well-known/jwks.json.
+func ApiJWKS() ([]ApiJSONWebKey, error) {
+	jwksURL := strings.TrimSuffix(endpoint, "/v1/user/") + "/.well-known/jwks.json"
+	resp, err := http.Get(jwksURL)
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		log.Printf("URL 'GET %s' returned code %d, expected %d", jwksURL, resp.StatusCode, http.StatusOK)
+		return nil, UnexpectedStatusCode
+	}
+
+	var result struct {
+		Keys []ApiJSONWebKey `json:"keys"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&result)
+	return result.Keys, err
+}
+
+// ------------------------
+
+func ApiCompleteAuthentication(challenge, code string) (string, error) {
+	userID, err := Execute(Endpoint("complete_authentication"), CompleteAuthenticationCall{Challenge: challenge, Code: code})
+	if err != nil {
+		return "", errgo.Mask(err)
+	}
+	return userID.(string), nil
+}
+
+type CompleteAuthenticationCall struct {
+	BodyReader
+	Challenge string
+	Code      string
+}
+
+func (call CompleteAuthenticationCall) PostForm() url.Values {
+	p := url.Values{}
+	p.Set("challenge", call.Challenge)
+	p.Set("code", call.Code)
+	return p
+}
+
+// ------------------------
+
+// ApiNewLoginLinkToken returns the token to be sent by email for ApiAuthenticateWithLoginLink.
+func ApiNewLoginLinkToken(email string) (string, error) {
+	var result struct {
+		Token string `json:"token"`
+	}
+	_, err := Execute(Endpoint("new_login_link_token"), LoginLinkCall{JsonCall: JsonCall{&result}, Email: email})
+	return result.Token, errgo.Mask(err)
+}
+
+type LoginLinkCall struct {
+	JsonCall
+	Email string
+}
+
+func (call LoginLinkCall) PostForm() url.Values {
+	p := url.Values{}
+	p.Set("email", call.Email)
+	return p
+}
+
+// ApiAuthenticateWithLoginLink returns the ID of the user or an *ApiSecondFactorRequired.
+func ApiAuthenticateWithLoginLink(token string) (string, error) {
+	userID, err := Execute(Endpoint("authenticate_with_login_link"), LoginLinkAuthenticationCall{Token: token})
+	if err != nil {
+		return "", errgo.Mask(err, errgo.Any)
+	}
+	return userID.(string), nil
+}
+
+type LoginLinkAuthenticationCall struct {
+	BodyReader
+	Token string
+}
+
+func (call LoginLinkAuthenticationCall) PostForm() url.Values {
+	p := url.Values{}
+	p.Set("token", call.Token)
 	return p
 }
 
+func (call LoginLinkAuthenticationCall) ResponseAccepted(resp *http.Response) (interface{}, error) {
+	return AuthenticateCall{}.ResponseAccepted(resp)
+}
+
 // ------------------------
 
 func ApiChangeProfileName(userID, profileName string) error {
@@ -191,24 +661,64 @@ func (call ChangeProfileNameCall) ResponseNoContent(resp *http.Response) (interf
 
 // ------------------------
 
-func ApiChangeEmail(userID, newEmail string) error {
-	_, err := Execute(Endpoint("change_email"), ChangeEmailCall{ID: userID, Email: newEmail})
-	return errgo.Mask(err)
+type ApiEmailChange struct {
+	Token       string `json:"token"`
+	CancelToken string `json:"cancel_token"`
+}
+
+// ApiChangeEmail requests to change the email. The change must be confirmed with ApiConfirmEmailChange.
+func ApiChangeEmail(userID, newEmail string) (ApiEmailChange, error) {
+	var result ApiEmailChange
+	_, err := Execute(Endpoint("change_email"), ChangeEmailCall{ID: userID, Email: newEmail, JsonCall: JsonCall{&result}})
+	return result, errgo.Mask(err)
+}
+
+func ApiChangeEmailWithCurrentPassword(userID, currentPassword, newEmail string) (ApiEmailChange, error) {
+	var result ApiEmailChange
+	_, err := Execute(Endpoint("change_email"), ChangeEmailCall{ID: userID, CurrentPassword: currentPassword, Email: newEmail, JsonCall: JsonCall{&result}})
+	return result, errgo.Mask(err)
 }
 
 type ChangeEmailCall struct {
-	ID    string
-	Email string
+	JsonCall
+	ID              string
+	CurrentPassword string
+	Email           string
 }
 
 func (call ChangeEmailCall) PostForm() url.Values {
 	p := url.Values{}
 	p.Set("id", call.ID)
 	p.Set("email", call.Email)
+	if call.CurrentPassword != "" {
+		p.Set("current_password", call.CurrentPassword)
+	}
 	return p
 }
 
-func (call ChangeEmailCall) ResponseNoContent(resp *http.Response) (interface{}, error) {
+// ------------------------
+
+func ApiConfirmEmailChange(token string) error {
+	_, err := Execute(Endpoint("confirm_email_change"), EmailChangeTokenCall{token})
+	return errgo.Mask(err)
+}
+
+func ApiCancelEmailChange(cancelToken string) error {
+	_, err := Execute(Endpoint("cancel_email_change"), EmailChangeTokenCall{cancelToken})
+	return errgo.Mask(err)
+}
+
+type EmailChangeTokenCall struct {
+	Token string
+}
+
+func (call EmailChangeTokenCall) PostForm() url.Values {
+	p := url.Values{}
+	p.Set("token", call.Token)
+	return p
+}
+
+func (call EmailChangeTokenCall) ResponseNoContent(resp *http.Response) (interface{}, error) {
 	return nil, nil
 }
 
@@ -216,13 +726,20 @@ func (call ChangeEmailCall) ResponseNoContent(resp *http.Response) (interface{},
 
 func ApiChangeLoginCredentials(userID, name, password string) error {
 	_, err := Execute(Endpoint("change_login_credentials"), ChangeLoginCredentialsCall{ID: userID, Login: name, Password: password})
-	return errgo.Mask(err)
+	return errgo.Mask(err, errgo.Any)
+}
+
+func ApiChangeLoginCredentialsWithCurrentPassword(userID, currentPassword, name, password string) error {
+	_, err := Execute(Endpoint("change_login_credentials"), ChangeLoginCredentialsCall{ID: userID, CurrentPassword: currentPassword, Login: name, Password: password})
+	return errgo.Mask(err, errgo.Any)
 }
 
 type ChangeLoginCredentialsCall struct {
-	ID       string
-	Login    string
-	Password string
+	PasswordPolicyReader
+	ID              string
+	CurrentPassword string
+	Login           string
+	Password        string
 }
 
 func (call ChangeLoginCredentialsCall) PostForm() url.Values {
@@ -230,6 +747,9 @@ func (call ChangeLoginCredentialsCall) PostForm() url.Values {
 	p.Set("id", call.ID)
 	p.Set("name", call.Login)
 	p.Set("password", call.Password)
+	if call.CurrentPassword != "" {
+		p.Set("current_password", call.CurrentPassword)
+	}
 	return p
 }
 
@@ -269,11 +789,12 @@ func (call NewResetPasswordToken) ResponseOK(resp *http.Response) (interface{},
 // ------------------------
 
 func ApiResetLoginCredentials(token, login_name, login_password string) error {
-	_, err := Execute(Endpoint("reset_login_credentials"), ResetLoginCredentials{token, login_name, login_password})
-	return errgo.Mask(err)
+	_, err := Execute(Endpoint("reset_login_credentials"), ResetLoginCredentials{Token: token, LoginName: login_name, LoginPassword: login_password})
+	return errgo.Mask(err, errgo.Any)
 }
 
 type ResetLoginCredentials struct {
+	PasswordPolicyReader
 	Token         string
 	LoginName     string
 	LoginPassword string
@@ -292,3 +813,605 @@ func (call ResetLoginCredentials) ResponseNoContent(resp *http.Response) (interf
 }
 
 // ------------------------
+
+func ApiDisableUser(userID, reason string) error {
+	_, err := Execute(Endpoint("disable"), ChangeStatusCall{ID: userID, Reason: reason})
+	return errgo.Mask(err)
+}
+
+func ApiLockUser(userID, reason string) error {
+	_, err := Execute(Endpoint("lock"), ChangeStatusCall{ID: userID, Reason: reason})
+	return errgo.Mask(err)
+}
+
+func ApiEnableUser(userID, reason string) error {
+	_, err := Execute(Endpoint("enable"), ChangeStatusCall{ID: userID, Reason: reason})
+	return errgo.Mask(err)
+}
+
+// ApiEraseUser removes all personal data of the user, only the ID is kept.
+func ApiEraseUser(userID string) error {
+	_, err := Execute(Endpoint("erase"), ChangeStatusCall{ID: userID})
+	return errgo.Mask(err)
+}
+
+type ChangeStatusCall struct {
+	ID     string
+	Reason string
+}
+
+func (call ChangeStatusCall) PostForm() url.Values {
+	p := url.Values{}
+	p.Set("id", call.ID)
+	p.Set("reason", call.Reason)
+	return p
+}
+
+func (call ChangeStatusCall) ResponseNoContent(resp *http.Response) (interface{}, error) {
+	return nil, nil
+}
+
+// ------------------------
+
+func ApiNewEmailVerificationToken(userID string) (string, error) {
+	token, err := Execute(Endpoint("new_email_verification_token"), NewEmailVerificationTokenCall{userID})
+	if err != nil {
+		return "", errgo.Mask(err)
+	}
+	return token.(string), nil
+}
+
+type NewEmailVerificationTokenCall struct {
+	ID string
+}
+
+func (call NewEmailVerificationTokenCall) PostForm() url.Values {
+	p := url.Values{}
+	p.Set("id", call.ID)
+	return p
+}
+
+func (call NewEmailVerificationTokenCall) ResponseOK(resp *http.Response) (interface{}, error) {
+	target := map[string]interface{}{}
+
+	if err := json.NewDecoder(resp.Body).Decode(&target); err != nil {
+		return "", errgo.Mask(err)
+	}
+	return target["token"], nil
+}
+
+// ------------------------
+
+func ApiVerifyEmailWithToken(token string) error {
+	_, err := Execute(Endpoint("verify_email_with_token"), VerifyEmailWithTokenCall{token})
+	return errgo.Mask(err)
+}
+
+type VerifyEmailWithTokenCall struct {
+	Token string
+}
+
+func (call VerifyEmailWithTokenCall) PostForm() url.Values {
+	p := url.Values{}
+	p.Set("token", call.Token)
+	return p
+}
+
+func (call VerifyEmailWithTokenCall) ResponseNoContent(resp *http.Response) (interface{}, error) {
+	return nil, nil
+}
+
+// ------------------------
+
+// ApiAddEmail adds a secondary email address and returns the token to verify it with ApiVerifyEmailWithToken.
+func ApiAddEmail(userID, email string) (string, error) {
+	var result struct {
+		Token string `json:"token"`
+	}
+	_, err := Execute(Endpoint("add_email"), EmailCall{JsonCall: JsonCall{&result}, ID: userID, Email: email})
+	return result.Token, errgo.Mask(err)
+}
+
+func ApiAddEmailWithCurrentPassword(userID, currentPassword, email string) (string, error) {
+	var result struct {
+		Token string `json:"token"`
+	}
+	_, err := Execute(Endpoint("add_email"), EmailCall{JsonCall: JsonCall{&result}, ID: userID, CurrentPassword: currentPassword, Email: email})
+	return result.Token, errgo.Mask(err)
+}
+
+func ApiRemoveEmail(userID, email string) error {
+	_, err := Execute(Endpoint("remove_email"), EmailCall{ID: userID, Email: email})
+	return errgo.Mask(err)
+}
+
+func ApiSetPrimaryEmail(userID, email string) error {
+	_, err := Execute(Endpoint("set_primary_email"), EmailCall{ID: userID, Email: email})
+	return errgo.Mask(err)
+}
+
+func ApiSetPrimaryEmailWithCurrentPassword(userID, currentPassword, email string) error {
+	_, err := Execute(Endpoint("set_primary_email"), EmailCall{ID: userID, CurrentPassword: currentPassword, Email: email})
+	return errgo.Mask(err)
+}
+
+// ApiCheckAndVerifyEmail marks the given primary or secondary address of the user as verified.
+func ApiCheckAndVerifyEmail(userID, email string) error {
+	_, err := Execute(Endpoint("verify_email"), VerifyEmailCall{UserID: userID, Email: email})
+	return errgo.Mask(err)
+}
+
+type EmailCall struct {
+	JsonCall
+	ID              string
+	CurrentPassword string
+	Email           string
+}
+
+func (call EmailCall) PostForm() url.Values {
+	p := url.Values{}
+	p.Set("id", call.ID)
+	p.Set("email", call.Email)
+	if call.CurrentPassword != "" {
+		p.Set("current_password", call.CurrentPassword)
+	}
+	return p
+}
+
+func (call EmailCall) ResponseNoContent(resp *http.Response) (interface{}, error) {
+	return nil, nil
+}
+
+// ------------------------
+
+// ApiChangePhone sets the phone number of the user and returns the code sent by SMS to verify it.
+func ApiChangePhone(userID, phone string) (string, error) {
+	var result struct {
+		Code string `json:"code"`
+	}
+	_, err := Execute(Endpoint("change_phone"), PhoneCall{JsonCall: JsonCall{&result}, ID: userID, Phone: phone})
+	return result.Code, errgo.Mask(err)
+}
+
+func ApiChangePhoneWithCurrentPassword(userID, currentPassword, phone string) (string, error) {
+	var result struct {
+		Code string `json:"code"`
+	}
+	_, err := Execute(Endpoint("change_phone"), PhoneCall{JsonCall: JsonCall{&result}, ID: userID, CurrentPassword: currentPassword, Phone: phone})
+	return result.Code, errgo.Mask(err)
+}
+
+func ApiVerifyPhone(userID, code string) error {
+	_, err := Execute(Endpoint("verify_phone"), PhoneCall{ID: userID, Code: code})
+	return errgo.Mask(err)
+}
+
+func ApiRemovePhone(userID string) error {
+	_, err := Execute(Endpoint("remove_phone"), PhoneCall{ID: userID})
+	return errgo.Mask(err)
+}
+
+// ApiNewPhoneResetCode returns the code sent by SMS to reset the password, see ApiExchangePhoneResetCode.
+func ApiNewPhoneResetCode(phone string) (string, error) {
+	var result struct {
+		Code string `json:"code"`
+	}
+	_, err := Execute(Endpoint("new_phone_reset_code"), PhoneCall{JsonCall: JsonCall{&result}, Phone: phone})
+	return result.Code, errgo.Mask(err)
+}
+
+// ApiExchangePhoneResetCode returns a token for ApiResetPassword or ApiResetLoginCredentials.
+func ApiExchangePhoneResetCode(phone, code string) (string, error) {
+	var result struct {
+		Token string `json:"token"`
+	}
+	_, err := Execute(Endpoint("exchange_phone_reset_code"), PhoneCall{JsonCall: JsonCall{&result}, Phone: phone, Code: code})
+	return result.Token, errgo.Mask(err)
+}
+
+type PhoneCall struct {
+	JsonCall
+	ID              string
+	CurrentPassword string
+	Phone           string
+	Code            string
+}
+
+func (call PhoneCall) PostForm() url.Values {
+	p := url.Values{}
+	if call.ID != "" {
+		p.Set("id", call.ID)
+	}
+	if call.CurrentPassword != "" {
+		p.Set("current_password", call.CurrentPassword)
+	}
+	if call.Phone != "" {
+		p.Set("phone", call.Phone)
+	}
+	if call.Code != "" {
+		p.Set("code", call.Code)
+	}
+	return p
+}
+
+func (call PhoneCall) ResponseNoContent(resp *http.Response) (interface{}, error) {
+	return nil, nil
+}
+
+// ------------------------
+
+func ApiChangePassword(userID, password string) error {
+	_, err := Execute(Endpoint("change_password"), ChangePasswordCall{ID: userID, Password: password})
+	return errgo.Mask(err, errgo.Any)
+}
+
+func ApiChangePasswordWithCurrentPassword(userID, currentPassword, password string) error {
+	_, err := Execute(Endpoint("change_password"), ChangePasswordCall{ID: userID, CurrentPassword: currentPassword, Password: password})
+	return errgo.Mask(err, errgo.Any)
+}
+
+type ChangePasswordCall struct {
+	PasswordPolicyReader
+	ID              string
+	CurrentPassword string
+	Password        string
+}
+
+func (call ChangePasswordCall) PostForm() url.Values {
+	p := url.Values{}
+	p.Set("id", call.ID)
+	p.Set("password", call.Password)
+	if call.CurrentPassword != "" {
+		p.Set("current_password", call.CurrentPassword)
+	}
+	return p
+}
+
+func (call ChangePasswordCall) ResponseNoContent(resp *http.Response) (interface{}, error) {
+	return nil, nil
+}
+
+// ------------------------
+
+func ApiChangeLoginName(userID, name string) error {
+	_, err := Execute(Endpoint("change_login_name"), ChangeLoginNameCall{ID: userID, Login: name})
+	return errgo.Mask(err)
+}
+
+func ApiChangeLoginNameWithCurrentPassword(userID, currentPassword, name string) error {
+	_, err := Execute(Endpoint("change_login_name"), ChangeLoginNameCall{ID: userID, CurrentPassword: currentPassword, Login: name})
+	return errgo.Mask(err)
+}
+
+type ChangeLoginNameCall struct {
+	ID              string
+	CurrentPassword string
+	Login           string
+}
+
+func (call ChangeLoginNameCall) PostForm() url.Values {
+	p := url.Values{}
+	p.Set("id", call.ID)
+	p.Set("name", call.Login)
+	if call.CurrentPassword != "" {
+		p.Set("current_password", call.CurrentPassword)
+	}
+	return p
+}
+
+func (call ChangeLoginNameCall) ResponseNoContent(resp *http.Response) (interface{}, error) {
+	return nil, nil
+}
+
+// ------------------------
+
+func ApiResetPassword(token, login_password string) error {
+	_, err := Execute(Endpoint("reset_password"), ResetPassword{Token: token, LoginPassword: login_password})
+	return errgo.Mask(err, errgo.Any)
+}
+
+type ResetPassword struct {
+	PasswordPolicyReader
+	Token         string
+	LoginPassword string
+}
+
+func (call ResetPassword) PostForm() url.Values {
+	p := url.Values{}
+	p.Set("token", call.Token)
+	p.Set("login_password", call.LoginPassword)
+	return p
+}
+
+func (call ResetPassword) ResponseNoContent(resp *http.Response) (interface{}, error) {
+	return nil, nil
+}
+
+// ------------------------
+
+type ApiTOTPEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+func ApiEnrollTOTP(userID string) (ApiTOTPEnrollment, error) {
+	var result ApiTOTPEnrollment
+	_, err := Execute(Endpoint("enroll_totp"), TOTPCall{JsonCall: JsonCall{&result}, ID: userID})
+	return result, errgo.Mask(err)
+}
+
+// ApiConfirmTOTP enables TOTP and returns the recovery codes.
+func ApiConfirmTOTP(userID, code string) ([]string, error) {
+	var result struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+	_, err := Execute(Endpoint("confirm_totp"), TOTPCall{JsonCall: JsonCall{&result}, ID: userID, Code: code})
+	return result.RecoveryCodes, errgo.Mask(err)
+}
+
+func ApiDisableTOTP(userID string) error {
+	_, err := Execute(Endpoint("disable_totp"), TOTPCall{ID: userID})
+	return errgo.Mask(err)
+}
+
+func ApiDisableTOTPWithCurrentPassword(userID, currentPassword string) error {
+	_, err := Execute(Endpoint("disable_totp"), TOTPCall{ID: userID, CurrentPassword: currentPassword})
+	return errgo.Mask(err)
+}
+
+// ApiEnableEmailOTP requires a code sent to the primary email for every authentication of the user.
+func ApiEnableEmailOTP(userID string) error {
+	_, err := Execute(Endpoint("enable_email_otp"), TOTPCall{ID: userID})
+	return errgo.Mask(err)
+}
+
+func ApiDisableEmailOTP(userID string) error {
+	_, err := Execute(Endpoint("disable_email_otp"), TOTPCall{ID: userID})
+	return errgo.Mask(err)
+}
+
+func ApiDisableEmailOTPWithCurrentPassword(userID, currentPassword string) error {
+	_, err := Execute(Endpoint("disable_email_otp"), TOTPCall{ID: userID, CurrentPassword: currentPassword})
+	return errgo.Mask(err)
+}
+
+type TOTPCall struct {
+	JsonCall
+	ID              string
+	Code            string
+	CurrentPassword string
+}
+
+func (call TOTPCall) PostForm() url.Values {
+	p := url.Values{}
+	p.Set("id", call.ID)
+	if call.CurrentPassword != "" {
+		p.Set("current_password", call.CurrentPassword)
+	}
+	if call.Code != "" {
+		p.Set("code", call.Code)
+	}
+	return p
+}
+
+func (call TOTPCall) ResponseNoContent(resp *http.Response) (interface{}, error) {
+	return nil, nil
+}
+
+// ------------------------
+
+// ApiBeginWebAuthnRegistration returns the options to pass as publicKey to navigator.credentials.create().
+func ApiBeginWebAuthnRegistration(userID string) (json.RawMessage, error) {
+	return ApiBeginWebAuthnRegistrationWithCurrentPassword(userID, "")
+}
+
+func ApiBeginWebAuthnRegistrationWithCurrentPassword(userID, currentPassword string) (json.RawMessage, error) {
+	var result struct {
+		PublicKey json.RawMessage `json:"publicKey"`
+	}
+	_, err := Execute(Endpoint("begin_webauthn_registration"), WebAuthnCall{JsonCall: JsonCall{&result}, ID: userID, CurrentPassword: currentPassword})
+	return result.PublicKey, errgo.Mask(err)
+}
+
+// ApiFinishWebAuthnRegistration stores the new credential and returns its ID. All values are base64url encoded.
+func ApiFinishWebAuthnRegistration(userID, name, clientDataJSON, attestationObject string) (string, error) {
+	return ApiFinishWebAuthnRegistrationWithCurrentPassword(userID, "", name, clientDataJSON, attestationObject)
+}
+
+func ApiFinishWebAuthnRegistrationWithCurrentPassword(userID, currentPassword, name, clientDataJSON, attestationObject string) (string, error) {
+	var result struct {
+		CredentialID string `json:"credential_id"`
+	}
+	_, err := Execute(Endpoint("finish_webauthn_registration"), WebAuthnCall{
+		JsonCall:          JsonCall{&result},
+		ID:                userID,
+		CurrentPassword:   currentPassword,
+		Name:              name,
+		ClientDataJSON:    clientDataJSON,
+		AttestationObject: attestationObject,
+	})
+	return result.CredentialID, errgo.Mask(err)
+}
+
+func ApiRemoveWebAuthnCredential(userID, credentialID string) error {
+	_, err := Execute(Endpoint("remove_webauthn_credential"), WebAuthnCall{ID: userID, CredentialID: credentialID})
+	return errgo.Mask(err)
+}
+
+func ApiRemoveWebAuthnCredentialWithCurrentPassword(userID, currentPassword, credentialID string) error {
+	_, err := Execute(Endpoint("remove_webauthn_credential"), WebAuthnCall{ID: userID, CurrentPassword: currentPassword, CredentialID: credentialID})
+	return errgo.Mask(err)
+}
+
+// ApiBeginWebAuthnLogin returns the options to pass as publicKey to navigator.credentials.get().
+func ApiBeginWebAuthnLogin(loginName string) (json.RawMessage, error) {
+	var result struct {
+		PublicKey json.RawMessage `json:"publicKey"`
+	}
+	_, err := Execute(Endpoint("begin_webauthn_login"), WebAuthnCall{JsonCall: JsonCall{&result}, Name: loginName})
+	return result.PublicKey, errgo.Mask(err)
+}
+
+type WebAuthnCall struct {
+	JsonCall
+	ID                string
+	CurrentPassword   string
+	Name              string
+	CredentialID      string
+	ClientDataJSON    string
+	AttestationObject string
+}
+
+func (call WebAuthnCall) PostForm() url.Values {
+	p := url.Values{}
+	for key, value := range map[string]string{
+		"id":                 call.ID,
+		"current_password":   call.CurrentPassword,
+		"name":               call.Name,
+		"credential_id":      call.CredentialID,
+		"client_data_json":   call.ClientDataJSON,
+		"attestation_object": call.AttestationObject,
+	} {
+		if value != "" {
+			p.Set(key, value)
+		}
+	}
+	return p
+}
+
+func (call WebAuthnCall) ResponseNoContent(resp *http.Response) (interface{}, error) {
+	return nil, nil
+}
+
+// ApiFinishWebAuthnLogin returns the ID of the authenticated user. All values except the credential ID are base64url encoded.
+func ApiFinishWebAuthnLogin(credentialID, clientDataJSON, authenticatorData, signature string) (string, error) {
+	userID, err := Execute(Endpoint("finish_webauthn_login"), FinishWebAuthnLoginCall{
+		CredentialID:      credentialID,
+		ClientDataJSON:    clientDataJSON,
+		AuthenticatorData: authenticatorData,
+		Signature:         signature,
+	})
+	if err != nil {
+		return "", errgo.Mask(err, errgo.Any)
+	}
+	return userID.(string), nil
+}
+
+type FinishWebAuthnLoginCall struct {
+	BodyReader
+	CredentialID      string
+	ClientDataJSON    string
+	AuthenticatorData string
+	Signature         string
+}
+
+func (call FinishWebAuthnLoginCall) ResponseAccepted(resp *http.Response) (interface{}, error) {
+	return AuthenticateCall{}.ResponseAccepted(resp)
+}
+
+func (call FinishWebAuthnLoginCall) PostForm() url.Values {
+	p := url.Values{}
+	p.Set("credential_id", call.CredentialID)
+	p.Set("client_data_json", call.ClientDataJSON)
+	p.Set("authenticator_data", call.AuthenticatorData)
+	p.Set("signature", call.Signature)
+	return p
+}
+
+// ------------------------
+
+// ------------------------
+
+type ApiGroup struct {
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Permissions []string  `json:"permissions"`
+	Members     []string  `json:"members"`
+	Created     time.Time `json:"created"`
+}
+
+func ApiCreateGroup(name, description string, permissions []string) error {
+	data, err := json.Marshal(permissions)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	_, err = Execute(GroupEndpoint("create"), GroupCall{Name: name, Description: description, Permissions: string(data)})
+	return errgo.Mask(err)
+}
+
+func ApiGetGroup(name string) (ApiGroup, error) {
+	var result ApiGroup
+	_, err := Execute(GroupEndpoint("get")+"?"+url.Values{"name": {name}}.Encode(), JsonCall{&result})
+	return result, errgo.Mask(err)
+}
+
+func ApiDeleteGroup(name string) error {
+	_, err := Execute(GroupEndpoint("delete"), GroupCall{Name: name})
+	return errgo.Mask(err)
+}
+
+func ApiSetGroupPermissions(name string, permissions []string) error {
+	data, err := json.Marshal(permissions)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	_, err = Execute(GroupEndpoint("set_permissions"), GroupCall{Name: name, Permissions: string(data)})
+	return errgo.Mask(err)
+}
+
+func ApiAddGroupMember(name, userID string) error {
+	_, err := Execute(GroupEndpoint("add_member"), GroupCall{Name: name, UserID: userID})
+	return errgo.Mask(err)
+}
+
+func ApiRemoveGroupMember(name, userID string) error {
+	_, err := Execute(GroupEndpoint("remove_member"), GroupCall{Name: name, UserID: userID})
+	return errgo.Mask(err)
+}
+
+type GroupCall struct {
+	Name        string
+	Description string
+	Permissions string
+	UserID      string
+}
+
+func (call GroupCall) PostForm() url.Values {
+	p := url.Values{}
+	p.Set("name", call.Name)
+	if call.Description != "" {
+		p.Set("description", call.Description)
+	}
+	if call.Permissions != "" {
+		p.Set("permissions", call.Permissions)
+	}
+	if call.UserID != "" {
+		p.Set("id", call.UserID)
+	}
+	return p
+}
+
+func (call GroupCall) ResponseCreated(resp *http.Response) (interface{}, error) {
+	return nil, nil
+}
+
+func (call GroupCall) ResponseNoContent(resp *http.Response) (interface{}, error) {
+	return nil, nil
+}
+
+func ApiUserGroups(userID string) ([]string, error) {
+	var result struct {
+		Groups []string `json:"groups"`
+	}
+	_, err := Execute(Endpoint("groups")+"?"+url.Values{"id": {userID}}.Encode(), JsonCall{&result})
+	return result.Groups, errgo.Mask(err)
+}
+
+func ApiHasPermission(userID, permission string) (bool, error) {
+	var result struct {
+		Granted bool `json:"granted"`
+	}
+	params := url.Values{"id": {userID}, "permission": {permission}}
+	_, err := Execute(Endpoint("has_permission")+"?"+params.Encode(), JsonCall{&result})
+	return result.Granted, errgo.Mask(err)
+}
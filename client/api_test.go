@@ -91,11 +91,45 @@ func TestIntegrationChangeLoginCredentials__SuiteAll(t *testing.T) {
 	}
 }
 
+func TestIntegrationChangePassword__SuiteAll(t *testing.T) {
+	userResult := Builder.givenNewVerifiedUser(t)
+
+	if err := ApiChangePassword(userResult.userID, "new_secret"); err != nil {
+		t.Fatalf("Failed to change password: %v", err)
+	}
+
+	userID, err := ApiAuthenticate(userResult.LoginName, "new_secret")
+	if err != nil {
+		t.Fatalf("Failed to authenticate: %v", err)
+	}
+	if userID != userResult.userID {
+		t.Fatalf("Logged into the wrong user!")
+	}
+}
+
+func TestIntegrationChangeLoginName__SuiteAll(t *testing.T) {
+	userResult := Builder.givenNewVerifiedUser(t)
+	newName := Builder.Fake.UserName()
+
+	if err := ApiChangeLoginName(userResult.userID, newName); err != nil {
+		t.Fatalf("Failed to change login name: %v", err)
+	}
+
+	userID, err := ApiAuthenticate(newName, Password)
+	if err != nil {
+		t.Fatalf("Failed to authenticate: %v", err)
+	}
+	if userID != userResult.userID {
+		t.Fatalf("Logged into the wrong user!")
+	}
+}
+
 func TestIntegrationChangeEmail__SuiteAll(t *testing.T) {
 	userResult := Builder.givenNewVerifiedUser(t)
 	newEmail := Builder.Fake.Email()
 
-	if err := ApiChangeEmail(userResult.userID, newEmail); err != nil {
+	change, err := ApiChangeEmail(userResult.userID, newEmail)
+	if err != nil {
 		t.Fatalf("Failed to change email: %v", err)
 	}
 
@@ -103,9 +137,49 @@ func TestIntegrationChangeEmail__SuiteAll(t *testing.T) {
 	if err != nil {
 		t.Fatalf("Failed to read user: %v", err)
 	}
+	if user.Email != userResult.Email || user.PendingEmail != newEmail {
+		t.Fatalf("Expected email '%s' with pending '%s', but got '%s' with pending '%s'", userResult.Email, newEmail, user.Email, user.PendingEmail)
+	}
+
+	if err := ApiConfirmEmailChange(change.Token); err != nil {
+		t.Fatalf("Failed to confirm email change: %v", err)
+	}
+
+	user, err = ApiGetUser(userResult.userID)
+	if err != nil {
+		t.Fatalf("Failed to read user: %v", err)
+	}
 	if user.Email != newEmail {
 		t.Fatalf("Expected new email '%s', but got '%s'", newEmail, user.Email)
 	}
+	if !user.EmailVerified {
+		t.Fatalf("Expected confirmed email to be verified")
+	}
+}
+
+func TestIntegrationCancelEmailChange__SuiteAll(t *testing.T) {
+	userResult := Builder.givenNewVerifiedUser(t)
+
+	change, err := ApiChangeEmail(userResult.userID, Builder.Fake.Email())
+	if err != nil {
+		t.Fatalf("Failed to change email: %v", err)
+	}
+
+	if err := ApiCancelEmailChange(change.CancelToken); err != nil {
+		t.Fatalf("Failed to cancel email change: %v", err)
+	}
+
+	if err := ApiConfirmEmailChange(change.Token); err == nil {
+		t.Fatalf("Expected confirmation to fail after cancelling")
+	}
+
+	user, err := ApiGetUser(userResult.userID)
+	if err != nil {
+		t.Fatalf("Failed to read user: %v", err)
+	}
+	if user.Email != userResult.Email || user.PendingEmail != "" {
+		t.Fatalf("Expected email '%s' without pending change, but got '%s' with pending '%s'", userResult.Email, user.Email, user.PendingEmail)
+	}
 }
 
 func TestIntegrationAuthSucceedsUnverified__SuiteAuthEmailFalse(t *testing.T) {
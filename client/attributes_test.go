@@ -0,0 +1,78 @@
+package client
+
+import (
+	"testing"
+)
+
+func TestIntegrationCreateUserWithAttributes__SuiteAttributes(t *testing.T) {
+	user := givenUserWithAttributes(t, map[string]interface{}{"locale": "de-DE", "avatar_url": "https://example.com/a.png"})
+
+	result, err := ApiGetUser(user.userID)
+	if err != nil {
+		t.Fatalf("Failed to get user: %v", err)
+	}
+	if result.Attributes["locale"] != "de-DE" || result.Attributes["avatar_url"] != "https://example.com/a.png" {
+		t.Fatalf("Unexpected attributes %#v", result.Attributes)
+	}
+
+	public, err := ApiPublicAttributes(user.userID)
+	if err != nil {
+		t.Fatalf("Failed to get public attributes: %v", err)
+	}
+	if len(public) != 1 || public["avatar_url"] != "https://example.com/a.png" {
+		t.Fatalf("Expected only the public avatar_url, got %#v", public)
+	}
+}
+
+func TestIntegrationChangeAttributes__SuiteAttributes(t *testing.T) {
+	user := givenUserWithAttributes(t, map[string]interface{}{"locale": "de-DE", "avatar_url": "https://example.com/a.png"})
+
+	if err := ApiChangeAttributes(user.userID, map[string]interface{}{"marketing_opt_in": true, "avatar_url": nil}); err != nil {
+		t.Fatalf("Failed to change attributes: %v", err)
+	}
+
+	result, err := ApiGetUser(user.userID)
+	if err != nil {
+		t.Fatalf("Failed to get user: %v", err)
+	}
+	if len(result.Attributes) != 2 || result.Attributes["locale"] != "de-DE" || result.Attributes["marketing_opt_in"] != true {
+		t.Fatalf("Unexpected attributes %#v", result.Attributes)
+	}
+}
+
+func TestIntegrationChangeAttributesRejectsInvalidValues__SuiteAttributes(t *testing.T) {
+	user := givenUserWithAttributes(t, map[string]interface{}{"locale": "de-DE"})
+
+	for _, attributes := range []map[string]interface{}{
+		{"unknown": "value"},
+		{"locale": "a-locale-which-is-too-long"},
+		{"marketing_opt_in": "yes"},
+		{"locale": nil},
+	} {
+		if err := ApiChangeAttributes(user.userID, attributes); err == nil {
+			t.Fatalf("Expected %#v to be rejected", attributes)
+		}
+	}
+}
+
+func TestIntegrationCreateUserRequiresAttributes__SuiteAttributes(t *testing.T) {
+	_, err := ApiCreateUserWithAttributes(Builder.Fake.UserName(), Builder.Fake.FreeEmail(), Builder.Fake.UserName(), Password, nil)
+	if err == nil {
+		t.Fatalf("Expected the required attribute locale to be missing")
+	}
+}
+
+func givenUserWithAttributes(t *testing.T, attributes map[string]interface{}) ApiCreateUserResult {
+	user := ApiCreateUserResult{
+		Email:     Builder.Fake.FreeEmail(),
+		UserName:  Builder.Fake.UserName(),
+		LoginName: Builder.Fake.UserName(),
+	}
+
+	var err error
+	user.userID, err = ApiCreateUserWithAttributes(user.UserName, user.Email, user.LoginName, Password, attributes)
+	if err != nil {
+		t.Fatalf("Failed to create user with attributes: %v", err)
+	}
+	return user
+}
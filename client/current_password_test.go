@@ -0,0 +1,173 @@
+package client
+
+import (
+	"../service/webauthn"
+
+	"encoding/json"
+	"testing"
+)
+
+func TestIntegrationChangePasswordWithCurrentPassword__SuiteAll(t *testing.T) {
+	user := Builder.givenNewVerifiedUser(t)
+
+	if err := ApiChangePasswordWithCurrentPassword(user.userID, "wrong_secret", "new_secret"); err == nil {
+		t.Fatalf("Expected change with wrong current password to fail")
+	}
+
+	if err := ApiChangePasswordWithCurrentPassword(user.userID, Password, "new_secret"); err != nil {
+		t.Fatalf("Failed to change password: %v", err)
+	}
+
+	if userID, err := ApiAuthenticate(user.LoginName, "new_secret"); err != nil {
+		t.Fatalf("Failed to authenticate: %v", err)
+	} else if userID != user.userID {
+		t.Fatalf("Authenticated as wrong user, got '%s', expected '%s'", userID, user.userID)
+	}
+}
+
+func TestIntegrationChangeLoginNameRequiresCurrentPassword__SuiteRequireCurrentPassword(t *testing.T) {
+	user := Builder.givenNewVerifiedUser(t)
+	newName := Builder.Fake.UserName()
+
+	if err := ApiChangeLoginName(user.userID, newName); err == nil {
+		t.Fatalf("Expected change without current password to fail")
+	}
+
+	if err := ApiChangeLoginNameWithCurrentPassword(user.userID, Password, newName); err != nil {
+		t.Fatalf("Failed to change login name: %v", err)
+	}
+}
+
+func TestIntegrationDisableTOTPRequiresCurrentPassword__SuiteRequireCurrentPassword(t *testing.T) {
+	user := Builder.givenNewVerifiedUser(t)
+	givenEnabledTOTP(t, user)
+
+	if err := ApiDisableTOTP(user.userID); err == nil {
+		t.Fatalf("Expected disabling TOTP without current password to fail")
+	}
+	if err := ApiDisableTOTPWithCurrentPassword(user.userID, "wrong_secret"); err == nil {
+		t.Fatalf("Expected disabling TOTP with wrong current password to fail")
+	}
+
+	if err := ApiDisableTOTPWithCurrentPassword(user.userID, Password); err != nil {
+		t.Fatalf("Failed to disable TOTP: %v", err)
+	}
+}
+
+func TestIntegrationAddAndSetPrimaryEmailRequireCurrentPassword__SuiteRequireCurrentPassword(t *testing.T) {
+	user := Builder.givenNewVerifiedUser(t)
+	work := Builder.Fake.FreeEmail()
+
+	if _, err := ApiAddEmail(user.userID, work); err == nil {
+		t.Fatalf("Expected adding an email without current password to fail")
+	}
+	if _, err := ApiAddEmailWithCurrentPassword(user.userID, "wrong_secret", work); err == nil {
+		t.Fatalf("Expected adding an email with wrong current password to fail")
+	}
+
+	token, err := ApiAddEmailWithCurrentPassword(user.userID, Password, work)
+	if err != nil {
+		t.Fatalf("Failed to add email: %v", err)
+	}
+	if err := ApiVerifyEmailWithToken(token); err != nil {
+		t.Fatalf("Failed to verify email: %v", err)
+	}
+
+	if err := ApiSetPrimaryEmail(user.userID, work); err == nil {
+		t.Fatalf("Expected setting the primary email without current password to fail")
+	}
+	if err := ApiSetPrimaryEmailWithCurrentPassword(user.userID, "wrong_secret", work); err == nil {
+		t.Fatalf("Expected setting the primary email with wrong current password to fail")
+	}
+
+	if err := ApiSetPrimaryEmailWithCurrentPassword(user.userID, Password, work); err != nil {
+		t.Fatalf("Failed to set primary email: %v", err)
+	}
+	if result, err := ApiGetUser(user.userID); err != nil || result.Email != work {
+		t.Fatalf("Expected %s to be the primary email, got %#v, %v", work, result, err)
+	}
+}
+
+func TestIntegrationChangePhoneRequiresCurrentPassword__SuiteRequireCurrentPassword(t *testing.T) {
+	user := Builder.givenNewVerifiedUser(t)
+	phone := newPhoneNumber()
+
+	if _, err := ApiChangePhone(user.userID, phone); err == nil {
+		t.Fatalf("Expected changing the phone without current password to fail")
+	}
+	if _, err := ApiChangePhoneWithCurrentPassword(user.userID, "wrong_secret", phone); err == nil {
+		t.Fatalf("Expected changing the phone with wrong current password to fail")
+	}
+
+	code, err := ApiChangePhoneWithCurrentPassword(user.userID, Password, phone)
+	if err != nil {
+		t.Fatalf("Failed to change phone: %v", err)
+	}
+	if err := ApiVerifyPhone(user.userID, code); err != nil {
+		t.Fatalf("Failed to verify phone: %v", err)
+	}
+}
+
+func TestIntegrationDisableEmailOTPRequiresCurrentPassword__SuiteRequireCurrentPassword(t *testing.T) {
+	user := Builder.givenNewVerifiedUser(t)
+	if err := ApiEnableEmailOTP(user.userID); err != nil {
+		t.Fatalf("Failed to enable email codes: %v", err)
+	}
+
+	if err := ApiDisableEmailOTP(user.userID); err == nil {
+		t.Fatalf("Expected disabling email codes without current password to fail")
+	}
+	if err := ApiDisableEmailOTPWithCurrentPassword(user.userID, "wrong_secret"); err == nil {
+		t.Fatalf("Expected disabling email codes with wrong current password to fail")
+	}
+
+	if err := ApiDisableEmailOTPWithCurrentPassword(user.userID, Password); err != nil {
+		t.Fatalf("Failed to disable email codes: %v", err)
+	}
+	if apiUser, err := ApiGetUser(user.userID); err != nil || apiUser.EmailOTPEnabled {
+		t.Fatalf("Expected email codes to be disabled, got %#v, %v", apiUser, err)
+	}
+}
+
+func TestIntegrationWebAuthnCredentialsRequireCurrentPassword__SuiteRequireCurrentPassword(t *testing.T) {
+	user := Builder.givenNewVerifiedUser(t)
+	authenticator := webauthn.NewSoftAuthenticator(webAuthnRPID, webAuthnOrigin)
+
+	if _, err := ApiBeginWebAuthnRegistration(user.userID); err == nil {
+		t.Fatalf("Expected beginning a registration without current password to fail")
+	}
+	if _, err := ApiBeginWebAuthnRegistrationWithCurrentPassword(user.userID, "wrong_secret"); err == nil {
+		t.Fatalf("Expected beginning a registration with wrong current password to fail")
+	}
+
+	data, err := ApiBeginWebAuthnRegistrationWithCurrentPassword(user.userID, Password)
+	if err != nil {
+		t.Fatalf("Failed to begin registration: %v", err)
+	}
+	var options webauthn.CreationOptions
+	if err := json.Unmarshal(data, &options); err != nil {
+		t.Fatalf("Failed to decode creation options: %v", err)
+	}
+	response, err := authenticator.Register(options)
+	if err != nil {
+		t.Fatalf("Authenticator failed to register: %v", err)
+	}
+
+	if _, err := ApiFinishWebAuthnRegistration(user.userID, "Test Key", response.ClientDataJSON, response.AttestationObject); err == nil {
+		t.Fatalf("Expected finishing a registration without current password to fail")
+	}
+	credentialID, err := ApiFinishWebAuthnRegistrationWithCurrentPassword(user.userID, Password, "Test Key", response.ClientDataJSON, response.AttestationObject)
+	if err != nil {
+		t.Fatalf("Failed to finish registration: %v", err)
+	}
+
+	if err := ApiRemoveWebAuthnCredential(user.userID, credentialID); err == nil {
+		t.Fatalf("Expected removing a credential without current password to fail")
+	}
+	if err := ApiRemoveWebAuthnCredentialWithCurrentPassword(user.userID, "wrong_secret", credentialID); err == nil {
+		t.Fatalf("Expected removing a credential with wrong current password to fail")
+	}
+	if err := ApiRemoveWebAuthnCredentialWithCurrentPassword(user.userID, Password, credentialID); err != nil {
+		t.Fatalf("Failed to remove credential: %v", err)
+	}
+}
@@ -0,0 +1,128 @@
+package client
+
+import (
+	"github.com/juju/errgo"
+
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIntegrationAuthenticateWithEmailCode__SuiteAll(t *testing.T) {
+	user := Builder.givenNewVerifiedUser(t)
+	if err := ApiEnableEmailOTP(user.userID); err != nil {
+		t.Fatalf("Failed to enable email codes: %v", err)
+	}
+
+	challenge := whenAuthenticatingRequiresSecondFactor(t, user)
+	code := thenEmailCodeWasSent(t, user)
+
+	wrongCode := "000000"
+	if code == wrongCode {
+		wrongCode = "111111"
+	}
+	if _, err := ApiCompleteAuthentication(challenge, wrongCode); err == nil {
+		t.Fatalf("Expected wrong code to be rejected")
+	}
+	if userID, err := ApiCompleteAuthentication(challenge, code); err != nil || userID != user.userID {
+		t.Fatalf("Expected to complete the authentication, got %s, %v", userID, err)
+	}
+	if _, err := ApiCompleteAuthentication(challenge, code); err == nil {
+		t.Fatalf("Expected the challenge to be usable only once")
+	}
+}
+
+func TestIntegrationEmailCodeAttemptsAreLimitedAcrossChallenges__SuiteAll(t *testing.T) {
+	user := Builder.givenNewVerifiedUser(t)
+	if err := ApiEnableEmailOTP(user.userID); err != nil {
+		t.Fatalf("Failed to enable email codes: %v", err)
+	}
+
+	challenge := whenAuthenticatingRequiresSecondFactor(t, user)
+	for i := 0; i < 4; i++ {
+		ApiCompleteAuthentication(challenge, "000000")
+	}
+	challenge = whenAuthenticatingRequiresSecondFactor(t, user)
+	code := thenEmailCodeWasSent(t, user)
+	wrongCode := "000000"
+	if code == wrongCode {
+		wrongCode = "111111"
+	}
+	ApiCompleteAuthentication(challenge, wrongCode)
+
+	if _, err := ApiCompleteAuthentication(challenge, code); err == nil {
+		t.Fatalf("Expected the new code to be invalid after 5 wrong codes in total")
+	}
+	if _, err := ApiAuthenticate(user.LoginName, Password); err == nil {
+		t.Fatalf("Expected no new code after 5 wrong codes")
+	} else if _, ok := errgo.Cause(err).(*ApiSecondFactorRequired); ok {
+		t.Fatalf("Expected no new code after 5 wrong codes, got %v", err)
+	}
+}
+
+func TestIntegrationDisableEmailCodes__SuiteAll(t *testing.T) {
+	user := Builder.givenNewVerifiedUser(t)
+	if err := ApiEnableEmailOTP(user.userID); err != nil {
+		t.Fatalf("Failed to enable email codes: %v", err)
+	}
+	if apiUser, err := ApiGetUser(user.userID); err != nil || !apiUser.EmailOTPEnabled {
+		t.Fatalf("Expected email codes to be enabled, got %#v, %v", apiUser, err)
+	}
+
+	if err := ApiDisableEmailOTP(user.userID); err != nil {
+		t.Fatalf("Failed to disable email codes: %v", err)
+	}
+	if _, err := ApiAuthenticate(user.LoginName, Password); err != nil {
+		t.Fatalf("Expected no second factor, got %v", err)
+	}
+}
+
+func TestIntegrationEmailCodesRequireVerifiedEmail__SuiteAll(t *testing.T) {
+	user := Builder.givenNewUser(t)
+
+	if err := ApiEnableEmailOTP(user.userID); err == nil {
+		t.Fatalf("Expected an unverified email to be rejected")
+	}
+}
+
+// thenEmailCodeWasSent returns the code of the last user.email_otp_code event for the user from the feed.
+// Events are published asynchronously, so the feed is polled for a moment.
+func thenEmailCodeWasSent(t *testing.T, user ApiCreateUserResult) string {
+	for i := 0; i < 20; i++ {
+		if code := lastEmailCode(t, user.userID); code != "" {
+			return code
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	t.Fatalf("Expected an email code for user %s in the feed", user.userID)
+	return ""
+}
+
+func lastEmailCode(t *testing.T, userID string) string {
+	resp, err := http.Get(strings.TrimSuffix(endpoint, "user/") + "feed")
+	if err != nil {
+		t.Fatalf("Failed to read the feed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var code string
+	decoder := json.NewDecoder(resp.Body)
+	for decoder.More() {
+		var item struct {
+			Tag     string `json:"tag"`
+			Message struct {
+				UserID string `json:"user_id"`
+				Code   string `json:"code"`
+			} `json:"message"`
+		}
+		if err := decoder.Decode(&item); err != nil {
+			t.Fatalf("Failed to decode the feed: %v", err)
+		}
+		if item.Tag == "user.email_otp_code" && item.Message.UserID == userID {
+			code = item.Message.Code
+		}
+	}
+	return code
+}
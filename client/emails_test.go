@@ -0,0 +1,111 @@
+package client
+
+import (
+	"testing"
+)
+
+func TestIntegrationAddAndVerifySecondaryEmail__SuiteAll(t *testing.T) {
+	user := Builder.givenNewVerifiedUser(t)
+	work := Builder.Fake.FreeEmail()
+
+	token, err := ApiAddEmail(user.userID, work)
+	if err != nil {
+		t.Fatalf("Failed to add email: %v", err)
+	}
+	if result, err := ApiGetUser(user.userID); err != nil || len(result.SecondaryEmails) != 1 || result.SecondaryEmails[0] != (ApiEmailAddress{work, false}) {
+		t.Fatalf("Expected the unverified secondary email, got %#v, %v", result.SecondaryEmails, err)
+	}
+	if err := ApiSetPrimaryEmail(user.userID, work); err == nil {
+		t.Fatalf("Expected an unverified email not to become primary")
+	}
+
+	if err := ApiVerifyEmailWithToken(token); err != nil {
+		t.Fatalf("Failed to verify email: %v", err)
+	}
+	result, err := ApiGetUser(user.userID)
+	if err != nil || result.Email != user.Email || !result.EmailVerified || result.SecondaryEmails[0] != (ApiEmailAddress{work, true}) {
+		t.Fatalf("Expected the verified secondary email, got %#v, %v", result, err)
+	}
+}
+
+func TestIntegrationSetPrimaryEmail__SuiteAll(t *testing.T) {
+	user := Builder.givenNewVerifiedUser(t)
+	work := Builder.Fake.FreeEmail()
+
+	if _, err := ApiAddEmail(user.userID, work); err != nil {
+		t.Fatalf("Failed to add email: %v", err)
+	}
+	if err := ApiCheckAndVerifyEmail(user.userID, work); err != nil {
+		t.Fatalf("Failed to verify email: %v", err)
+	}
+	if err := ApiSetPrimaryEmail(user.userID, work); err != nil {
+		t.Fatalf("Failed to set primary email: %v", err)
+	}
+
+	result, err := ApiGetUser(user.userID)
+	if err != nil || result.Email != work || !result.EmailVerified || result.SecondaryEmails[0] != (ApiEmailAddress{user.Email, true}) {
+		t.Fatalf("Expected the addresses to be swapped, got %#v, %v", result, err)
+	}
+
+	if err := ApiRemoveEmail(user.userID, work); err == nil {
+		t.Fatalf("Expected the primary email not to be removable")
+	}
+	if err := ApiRemoveEmail(user.userID, user.Email); err != nil {
+		t.Fatalf("Failed to remove email: %v", err)
+	}
+	if result, err := ApiGetUser(user.userID); err != nil || len(result.SecondaryEmails) != 0 {
+		t.Fatalf("Expected no secondary emails, got %#v, %v", result, err)
+	}
+
+	// The removed address is free again
+	if _, err := ApiCreateUser("Other", user.Email, Builder.Fake.UserName(), Password); err != nil {
+		t.Fatalf("Failed to create user with the removed email: %v", err)
+	}
+}
+
+func TestIntegrationSecondaryEmailMustBeUnique__SuiteAll(t *testing.T) {
+	user := Builder.givenNewUser(t)
+	other := Builder.givenNewUser(t)
+
+	if _, err := ApiAddEmail(user.userID, other.Email); err == nil {
+		t.Fatalf("Expected the email of another user to be rejected")
+	}
+	if _, err := ApiAddEmail(user.userID, user.Email); err == nil {
+		t.Fatalf("Expected the primary email to be rejected")
+	}
+
+	work := Builder.Fake.FreeEmail()
+	if _, err := ApiAddEmail(user.userID, work); err != nil {
+		t.Fatalf("Failed to add email: %v", err)
+	}
+	if _, err := ApiCreateUser("Other", work, Builder.Fake.UserName(), Password); err == nil {
+		t.Fatalf("Expected the secondary email to be taken")
+	}
+}
+
+func TestIntegrationResetPasswordWithSecondaryEmail__SuiteAll(t *testing.T) {
+	user := Builder.givenNewVerifiedUser(t)
+	work := Builder.Fake.FreeEmail()
+
+	token, err := ApiAddEmail(user.userID, work)
+	if err != nil {
+		t.Fatalf("Failed to add email: %v", err)
+	}
+	if _, err := ApiNewResetPasswordToken(work); err == nil {
+		t.Fatalf("Expected an unverified email to be rejected")
+	}
+
+	if err := ApiVerifyEmailWithToken(token); err != nil {
+		t.Fatalf("Failed to verify email: %v", err)
+	}
+	resetToken, err := ApiNewResetPasswordToken(work)
+	if err != nil {
+		t.Fatalf("Failed to create reset token: %v", err)
+	}
+	if err := ApiResetPassword(resetToken, "new-secret"); err != nil {
+		t.Fatalf("Failed to reset password: %v", err)
+	}
+	if userID, err := ApiAuthenticate(user.LoginName, "new-secret"); err != nil || userID != user.userID {
+		t.Fatalf("Expected to authenticate with the new password, got %s, %v", userID, err)
+	}
+}
@@ -0,0 +1,75 @@
+package client
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestIntegrationEraseUser__SuiteAll(t *testing.T) {
+	user := Builder.givenNewVerifiedUser(t)
+	session := givenSession(t, user)
+
+	if err := ApiEraseUser(user.userID); err != nil {
+		t.Fatalf("Failed to erase the user: %v", err)
+	}
+
+	apiUser, err := ApiGetUser(user.userID)
+	if err != nil {
+		t.Fatalf("Expected a tombstone of the user, got %v", err)
+	}
+	if apiUser.Status != "erased" || apiUser.Email != "" || apiUser.LoginName != "" || apiUser.ProfileName != "" {
+		t.Fatalf("Expected the personal data to be removed, got %#v", apiUser)
+	}
+
+	if _, err := ApiAuthenticate(user.LoginName, Password); err == nil {
+		t.Fatalf("Expected the erased user to be unable to authenticate")
+	}
+	if _, err := ApiValidateSession(session.Token); err == nil {
+		t.Fatalf("Expected the sessions to be revoked")
+	}
+	if err := ApiEraseUser(user.userID); err == nil {
+		t.Fatalf("Expected an erased user to be unchangeable")
+	}
+}
+
+func TestIntegrationEraseUserFreesEmailAndLoginName__SuiteAll(t *testing.T) {
+	user := Builder.givenNewUser(t)
+	if err := ApiEraseUser(user.userID); err != nil {
+		t.Fatalf("Failed to erase the user: %v", err)
+	}
+
+	if _, err := ApiCreateUser(user.UserName, user.Email, user.LoginName, Password); err != nil {
+		t.Fatalf("Expected email and login name to be available again, got %v", err)
+	}
+}
+
+func TestIntegrationEraseUserRemovesFeedItems__SuiteAll(t *testing.T) {
+	user := Builder.givenNewVerifiedUser(t)
+	if err := ApiEraseUser(user.userID); err != nil {
+		t.Fatalf("Failed to erase the user: %v", err)
+	}
+
+	resp, err := http.Get(strings.TrimSuffix(endpoint, "user/") + "feed")
+	if err != nil {
+		t.Fatalf("Failed to read the feed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	decoder := json.NewDecoder(resp.Body)
+	for decoder.More() {
+		var item struct {
+			Tag     string `json:"tag"`
+			Message struct {
+				UserID string `json:"user_id"`
+			} `json:"message"`
+		}
+		if err := decoder.Decode(&item); err != nil {
+			t.Fatalf("Failed to decode the feed: %v", err)
+		}
+		if item.Message.UserID == user.userID && item.Tag != "user.erased" {
+			t.Fatalf("Expected the events of the erased user to be removed from the feed, got %s", item.Tag)
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package client
+
+import (
+	"testing"
+)
+
+func TestIntegrationExportUser__SuiteAll(t *testing.T) {
+	user := Builder.givenNewVerifiedUser(t)
+	session := givenSession(t, user)
+
+	export, err := ApiExportUser(user.userID)
+	if err != nil {
+		t.Fatalf("Failed to export the user: %v", err)
+	}
+	if export.UserID != user.userID || export.User.Email != user.Email || export.User.LoginName != user.LoginName {
+		t.Fatalf("Expected the user record, got %#v", export.User)
+	}
+	if len(export.Sessions) != 1 || export.Sessions[0].SessionID != session.SessionID {
+		t.Fatalf("Expected the active session, got %#v", export.Sessions)
+	}
+	if len(export.History) == 0 || export.History[len(export.History)-1].Tag != "user.created" {
+		t.Fatalf("Expected the change history, got %#v", export.History)
+	}
+
+	if _, err := ApiExportUser("unknown-user"); err == nil {
+		t.Fatalf("Expected an unknown user to be rejected")
+	}
+}
@@ -0,0 +1,95 @@
+package client
+
+import (
+	"testing"
+)
+
+func TestIntegrationGroupPermissions__SuiteAll(t *testing.T) {
+	user := Builder.givenNewVerifiedUser(t)
+	name := givenGroup(t, "wiki.edit")
+
+	if granted, err := ApiHasPermission(user.userID, "wiki.edit"); err != nil || granted {
+		t.Fatalf("Expected no permission before joining the group, got %v, %v", granted, err)
+	}
+
+	if err := ApiAddGroupMember(name, user.userID); err != nil {
+		t.Fatalf("Failed to add member: %v", err)
+	}
+	if granted, err := ApiHasPermission(user.userID, "wiki.edit"); err != nil || !granted {
+		t.Fatalf("Expected permission wiki.edit, got %v, %v", granted, err)
+	}
+	if granted, err := ApiHasPermission(user.userID, "wiki.admin"); err != nil || granted {
+		t.Fatalf("Expected no permission wiki.admin, got %v, %v", granted, err)
+	}
+
+	if err := ApiSetGroupPermissions(name, []string{"wiki.admin"}); err != nil {
+		t.Fatalf("Failed to set permissions: %v", err)
+	}
+	if granted, err := ApiHasPermission(user.userID, "wiki.admin"); err != nil || !granted {
+		t.Fatalf("Expected permission wiki.admin, got %v, %v", granted, err)
+	}
+
+	if err := ApiRemoveGroupMember(name, user.userID); err != nil {
+		t.Fatalf("Failed to remove member: %v", err)
+	}
+	if granted, err := ApiHasPermission(user.userID, "wiki.admin"); err != nil || granted {
+		t.Fatalf("Expected no permission after leaving the group, got %v, %v", granted, err)
+	}
+}
+
+func TestIntegrationGroupMembership__SuiteAll(t *testing.T) {
+	user := Builder.givenNewVerifiedUser(t)
+	name := givenGroup(t)
+
+	if err := ApiAddGroupMember(name, user.userID); err != nil {
+		t.Fatalf("Failed to add member: %v", err)
+	}
+
+	group, err := ApiGetGroup(name)
+	if err != nil {
+		t.Fatalf("Failed to get group: %v", err)
+	}
+	if len(group.Members) != 1 || group.Members[0] != user.userID {
+		t.Fatalf("Unexpected members %#v", group.Members)
+	}
+
+	groups, err := ApiUserGroups(user.userID)
+	if err != nil || len(groups) != 1 || groups[0] != name {
+		t.Fatalf("Expected the user to be in group %s, got %#v, %v", name, groups, err)
+	}
+
+	var result ApiSession
+	call := AuthenticateWithTokensCall{JsonCall{&result}, AuthenticateCall{Name: user.LoginName, Password: Password, Groups: true}}
+	if _, err := Execute(Endpoint("authenticate"), call); err != nil {
+		t.Fatalf("Failed to authenticate: %v", err)
+	}
+	if result.UserID != user.userID || len(result.Groups) != 1 || result.Groups[0] != name {
+		t.Fatalf("Expected the groups in the authentication result, got %#v", result)
+	}
+
+	if err := ApiDeleteGroup(name); err != nil {
+		t.Fatalf("Failed to delete group: %v", err)
+	}
+	if groups, err := ApiUserGroups(user.userID); err != nil || len(groups) != 0 {
+		t.Fatalf("Expected the membership to be removed, got %#v, %v", groups, err)
+	}
+	if _, err := ApiGetGroup(name); err == nil {
+		t.Fatalf("Expected the group to be deleted")
+	}
+}
+
+func TestIntegrationCreateGroupRejectsDuplicates__SuiteAll(t *testing.T) {
+	name := givenGroup(t)
+
+	if err := ApiCreateGroup(name, "", nil); err == nil {
+		t.Fatalf("Expected the second group %s to be rejected", name)
+	}
+}
+
+func givenGroup(t *testing.T, permissions ...string) string {
+	name := "group-" + Builder.Fake.UserName()
+	if err := ApiCreateGroup(name, "A test group", permissions); err != nil {
+		t.Fatalf("Failed to create group %s: %v", name, err)
+	}
+	return name
+}
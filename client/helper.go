@@ -35,6 +35,10 @@ type OKHandler interface {
 	ResponseOK(resp *http.Response) (interface{}, error)
 }
 
+type AcceptedHandler interface {
+	ResponseAccepted(resp *http.Response) (interface{}, error)
+}
+
 type NoContentHandler interface {
 	ResponseNoContent(resp *http.Response) (interface{}, error)
 }
@@ -104,6 +108,10 @@ func Execute(url string, call Call) (interface{}, error) {
 		if c, ok := call.(CreatedHandler); ok {
 			return c.ResponseCreated(response)
 		}
+	case http.StatusAccepted:
+		if c, ok := call.(AcceptedHandler); ok {
+			return c.ResponseAccepted(response)
+		}
 	case http.StatusNoContent:
 		if c, ok := call.(NoContentHandler); ok {
 			return c.ResponseNoContent(response)
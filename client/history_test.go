@@ -0,0 +1,59 @@
+package client
+
+import (
+	"testing"
+)
+
+func TestIntegrationUserHistory__SuiteAll(t *testing.T) {
+	user := Builder.givenNewUser(t)
+
+	if err := ApiChangeProfileName(user.userID, "Changed"); err != nil {
+		t.Fatalf("Failed to change the profile name: %v", err)
+	}
+
+	entries, total, err := ApiUserHistory(user.userID, 0, 10)
+	if err != nil {
+		t.Fatalf("Failed to get the history: %v", err)
+	}
+	if total != 2 || len(entries) != 2 {
+		t.Fatalf("Expected 2 entries, got %d of %d", len(entries), total)
+	}
+	if entries[0].Tag != "user.change_profile_name" || entries[1].Tag != "user.created" {
+		t.Fatalf("Expected the newest entry first, got %#v", entries)
+	}
+	if len(entries[0].Fields) != 1 || entries[0].Fields[0] != "profile_name" {
+		t.Fatalf("Expected the changed field profile_name, got %#v", entries[0].Fields)
+	}
+}
+
+func TestIntegrationUserHistoryPagination__SuiteAll(t *testing.T) {
+	user := Builder.givenNewUser(t)
+	for _, name := range []string{"First", "Second", "Third"} {
+		if err := ApiChangeProfileName(user.userID, name); err != nil {
+			t.Fatalf("Failed to change the profile name: %v", err)
+		}
+	}
+
+	entries, total, err := ApiUserHistory(user.userID, 3, 2)
+	if err != nil {
+		t.Fatalf("Failed to get the history: %v", err)
+	}
+	if total != 4 || len(entries) != 1 || entries[0].Tag != "user.created" {
+		t.Fatalf("Expected only the oldest entry of 4, got %#v of %d", entries, total)
+	}
+
+	if _, _, err := ApiUserHistory(user.userID, 0, 1000); err == nil {
+		t.Fatalf("Expected a too large limit to be rejected")
+	}
+	if _, _, err := ApiUserHistory("unknown-user", 0, 10); err == nil {
+		t.Fatalf("Expected an unknown user to be rejected")
+	}
+}
+
+func TestIntegrationUserHistoryDisabled__SuiteHistoryDisabled(t *testing.T) {
+	user := Builder.givenNewUser(t)
+
+	if _, _, err := ApiUserHistory(user.userID, 0, 10); err == nil {
+		t.Fatalf("Expected the history to be disabled")
+	}
+}
@@ -0,0 +1,40 @@
+package client
+
+import (
+	"testing"
+)
+
+func TestIntegrationAuthenticateWithEmailOrLoginName__SuiteLoginNameOrEmail(t *testing.T) {
+	user := Builder.givenNewVerifiedUser(t)
+
+	if userID, err := ApiAuthenticate(user.Email, Password); err != nil || userID != user.userID {
+		t.Fatalf("Expected to authenticate with the email, got %s, %v", userID, err)
+	}
+	if userID, err := ApiAuthenticate(user.LoginName, Password); err != nil || userID != user.userID {
+		t.Fatalf("Expected to authenticate with the login name, got %s, %v", userID, err)
+	}
+	if _, err := ApiAuthenticate(user.Email, "wrong"); err == nil {
+		t.Fatalf("Expected the wrong password to be rejected")
+	}
+}
+
+func TestIntegrationLoginNameCanNotShadowEmail__SuiteLoginNameOrEmail(t *testing.T) {
+	user := Builder.givenNewVerifiedUser(t)
+
+	// a second user tries to pick the email of the first one as login name
+	if _, err := ApiCreateUser("Other", Builder.Fake.FreeEmail(), user.Email, "other-secret"); err == nil {
+		t.Fatalf("Expected the email of another user to be rejected as login name")
+	}
+
+	other := Builder.givenNewVerifiedUser(t)
+	if err := ApiChangeLoginName(other.userID, user.Email); err == nil {
+		t.Fatalf("Expected the email of another user to be rejected as new login name")
+	}
+	if err := ApiChangeLoginCredentials(other.userID, user.Email, "other-secret"); err == nil {
+		t.Fatalf("Expected the email of another user to be rejected as new login credentials")
+	}
+
+	if userID, err := ApiAuthenticate(user.Email, Password); err != nil || userID != user.userID {
+		t.Fatalf("Expected the email to identify its user, got %s, %v", userID, err)
+	}
+}
@@ -0,0 +1,74 @@
+package client
+
+import (
+	"github.com/juju/errgo"
+
+	"testing"
+)
+
+func TestIntegrationLoginLinksDisabledByDefault__SuiteAll(t *testing.T) {
+	user := Builder.givenNewVerifiedUser(t)
+
+	if _, err := ApiNewLoginLinkToken(user.Email); err == nil {
+		t.Fatalf("Expected login links to be disabled")
+	}
+}
+
+func TestIntegrationAuthenticateWithLoginLink__SuiteLoginLinks(t *testing.T) {
+	// userd runs with --auth-email=true, the link itself proves the email
+	user := Builder.givenNewUser(t)
+
+	token, err := ApiNewLoginLinkToken(user.Email)
+	if err != nil {
+		t.Fatalf("Failed to create login link: %v", err)
+	}
+	if userID, err := ApiAuthenticateWithLoginLink(token); err != nil || userID != user.userID {
+		t.Fatalf("Expected to authenticate with the login link, got %s, %v", userID, err)
+	}
+	if _, err := ApiAuthenticateWithLoginLink(token); err == nil {
+		t.Fatalf("Expected the login link to be usable only once")
+	}
+
+	if _, err := ApiNewLoginLinkToken(Builder.Fake.FreeEmail()); err == nil {
+		t.Fatalf("Expected an unknown email to be rejected")
+	}
+}
+
+func TestIntegrationLoginLinkRequiresSecondFactor__SuiteLoginLinks(t *testing.T) {
+	user := Builder.givenNewVerifiedUser(t)
+	_, recoveryCodes := givenEnabledTOTP(t, user)
+
+	token, err := ApiNewLoginLinkToken(user.Email)
+	if err != nil {
+		t.Fatalf("Failed to create login link: %v", err)
+	}
+	_, err = ApiAuthenticateWithLoginLink(token)
+	required, ok := errgo.Cause(err).(*ApiSecondFactorRequired)
+	if !ok {
+		t.Fatalf("Expected a second factor to be required, got %v", err)
+	}
+
+	if userID, err := ApiCompleteAuthentication(required.Challenge, recoveryCodes[0]); err != nil || userID != user.userID {
+		t.Fatalf("Expected to complete the authentication, got %s, %v", userID, err)
+	}
+}
+
+func TestIntegrationNewLoginLinkReplacesPrevious__SuiteLoginLinks(t *testing.T) {
+	user := Builder.givenNewVerifiedUser(t)
+
+	first, err := ApiNewLoginLinkToken(user.Email)
+	if err != nil {
+		t.Fatalf("Failed to create login link: %v", err)
+	}
+	second, err := ApiNewLoginLinkToken(user.Email)
+	if err != nil {
+		t.Fatalf("Failed to create login link: %v", err)
+	}
+
+	if _, err := ApiAuthenticateWithLoginLink(first); err == nil {
+		t.Fatalf("Expected the previous login link to be invalid")
+	}
+	if userID, err := ApiAuthenticateWithLoginLink(second); err != nil || userID != user.userID {
+		t.Fatalf("Expected to authenticate with the new login link, got %s, %v", userID, err)
+	}
+}
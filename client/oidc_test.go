@@ -0,0 +1,183 @@
+package client
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// Must match the clients file of the SuiteOIDC in bin/run-integration-tests.sh
+const (
+	oidcClientID     = "test"
+	oidcClientSecret = "test-secret"
+	oidcRedirectURI  = "http://localhost:9999/callback"
+	oidcCodeVerifier = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+)
+
+var csrfTokenPattern = regexp.MustCompile(`name="csrf_token" value="([^"]+)"`)
+
+func TestIntegrationOIDCAuthorizationCodeFlow__SuiteOIDC(t *testing.T) {
+	user := Builder.givenNewVerifiedUser(t)
+
+	var discovery struct {
+		Issuer        string `json:"issuer"`
+		TokenEndpoint string `json:"token_endpoint"`
+	}
+	getOIDCJSON(t, "/.well-known/openid-configuration", &discovery)
+	if discovery.Issuer != oidcIssuer() || discovery.TokenEndpoint != oidcIssuer()+"/oauth2/token" {
+		t.Fatalf("Unexpected discovery document %#v", discovery)
+	}
+
+	code := givenOIDCCode(t, user)
+	tokens := exchangeOIDCCode(t, code, http.StatusOK)
+	if tokens["token_type"] != "Bearer" || tokens["id_token"] == nil || tokens["refresh_token"] == nil {
+		t.Fatalf("Unexpected token response %#v", tokens)
+	}
+
+	claims := verifyAccessToken(t, tokens["id_token"].(string))
+	if claims["sub"] != user.userID || claims["aud"] != oidcClientID || claims["nonce"] != "nonce" || claims["email"] != user.Email {
+		t.Fatalf("Unexpected ID token claims %#v", claims)
+	}
+
+	req, _ := http.NewRequest("GET", oidcIssuer()+"/oauth2/userinfo", nil)
+	req.Header.Set("Authorization", "Bearer "+tokens["access_token"].(string))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to get userinfo: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var userInfo map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&userInfo); err != nil || userInfo["preferred_username"] != user.LoginName {
+		t.Fatalf("Unexpected userinfo %#v (%v)", userInfo, err)
+	}
+
+	// A code can only be used once
+	exchangeOIDCCode(t, code, http.StatusBadRequest)
+}
+
+func TestIntegrationOIDCRejectsUnknownRedirectURI__SuiteOIDC(t *testing.T) {
+	resp, err := http.Get(oidcIssuer() + "/oauth2/authorize?" + url.Values{
+		"response_type": {"code"},
+		"client_id":     {oidcClientID},
+		"redirect_uri":  {"http://attacker.example.com/callback"},
+		"scope":         {"openid"},
+	}.Encode())
+	if err != nil {
+		t.Fatalf("Failed to get login page: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("Expected 400 for unknown redirect_uri, got %d", resp.StatusCode)
+	}
+}
+
+// givenOIDCCode logs the user in on the hosted login page and returns the authorization code.
+func givenOIDCCode(t *testing.T, user ApiCreateUserResult) string {
+	challenge := sha256.Sum256([]byte(oidcCodeVerifier))
+	params := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {oidcClientID},
+		"redirect_uri":          {oidcRedirectURI},
+		"scope":                 {"openid profile email"},
+		"state":                 {"state"},
+		"nonce":                 {"nonce"},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+
+	resp, err := http.Get(oidcIssuer() + "/oauth2/authorize?" + params.Encode())
+	if err != nil {
+		t.Fatalf("Failed to get login page: %v", err)
+	}
+	page := readBody(t, resp)
+	match := csrfTokenPattern.FindStringSubmatch(page)
+	if resp.StatusCode != http.StatusOK || match == nil {
+		t.Fatalf("Unexpected login page (%d): %s", resp.StatusCode, page)
+	}
+
+	params.Set("csrf_token", match[1])
+	params.Set("login_name", user.LoginName)
+	params.Set("password", Password)
+
+	req, _ := http.NewRequest("POST", oidcIssuer()+"/oauth2/authorize", strings.NewReader(params.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	for _, cookie := range resp.Cookies() {
+		req.AddCookie(cookie)
+	}
+
+	noRedirects := &http.Client{CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err = noRedirects.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to login: %v", err)
+	}
+	resp.Body.Close()
+
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if resp.StatusCode != http.StatusFound || err != nil || !strings.HasPrefix(location.String(), oidcRedirectURI) {
+		t.Fatalf("Expected redirect to the client, got %d %s", resp.StatusCode, resp.Header.Get("Location"))
+	}
+	if location.Query().Get("state") != "state" || location.Query().Get("code") == "" {
+		t.Fatalf("Unexpected redirect %s", location)
+	}
+	return location.Query().Get("code")
+}
+
+func exchangeOIDCCode(t *testing.T, code string, expectedStatusCode int) map[string]interface{} {
+	req, _ := http.NewRequest("POST", oidcIssuer()+"/oauth2/token", strings.NewReader(url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {oidcRedirectURI},
+		"code_verifier": {oidcCodeVerifier},
+	}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(oidcClientID, oidcClientSecret)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to exchange code: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != expectedStatusCode {
+		t.Fatalf("Expected status %d from the token endpoint, got %d", expectedStatusCode, resp.StatusCode)
+	}
+
+	var result map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatalf("Invalid token response: %v", err)
+	}
+	return result
+}
+
+func getOIDCJSON(t *testing.T, path string, v interface{}) {
+	resp, err := http.Get(oidcIssuer() + path)
+	if err != nil {
+		t.Fatalf("Failed to get %s: %v", path, err)
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		t.Fatalf("Invalid response of %s: %v", path, err)
+	}
+}
+
+func oidcIssuer() string {
+	return strings.TrimSuffix(endpoint, "/v1/user/")
+}
+
+func readBody(t *testing.T, resp *http.Response) string {
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("Failed to read response: %v", err)
+	}
+	return string(body)
+}
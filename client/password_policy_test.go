@@ -0,0 +1,57 @@
+package client
+
+import (
+	"github.com/juju/errgo"
+
+	"strings"
+	"testing"
+)
+
+func TestIntegrationCreateUserRejectsTooLongPassword__SuiteAll(t *testing.T) {
+	password := strings.Repeat("x", 73)
+
+	_, err := ApiCreateUser(Builder.Fake.UserName(), Builder.Fake.FreeEmail(), Builder.Fake.UserName(), password)
+	thenPasswordViolates(t, err, "max_length")
+}
+
+func TestIntegrationCreateUserRejectsPasswordWithLoginName__SuiteAll(t *testing.T) {
+	loginName := Builder.Fake.UserName()
+
+	_, err := ApiCreateUser(Builder.Fake.UserName(), Builder.Fake.FreeEmail(), loginName, "my-"+loginName+"-secret")
+	thenPasswordViolates(t, err, "contains_login_name")
+}
+
+func TestIntegrationCreateUserRejectsBreachedPassword__SuiteBreachedPasswords(t *testing.T) {
+	_, err := ApiCreateUser(Builder.Fake.UserName(), Builder.Fake.FreeEmail(), Builder.Fake.UserName(), "breached-secret")
+	thenPasswordViolates(t, err, "breached")
+}
+
+func TestIntegrationChangePasswordRejectsRecentPassword__SuitePasswordHistory(t *testing.T) {
+	user := Builder.givenNewVerifiedUser(t)
+
+	thenPasswordViolates(t, ApiChangePassword(user.userID, Password), "reused")
+
+	if err := ApiChangePassword(user.userID, "new_secret"); err != nil {
+		t.Fatalf("Failed to change password: %v", err)
+	}
+
+	thenPasswordViolates(t, ApiChangePassword(user.userID, Password), "reused")
+
+	token, err := ApiNewResetPasswordToken(user.Email)
+	if err != nil {
+		t.Fatalf("Failed to create reset token: %v", err)
+	}
+	thenPasswordViolates(t, ApiResetPassword(token, Password), "reused")
+}
+
+func thenPasswordViolates(t *testing.T, err error, rule string) {
+	if !IsApiPasswordPolicyViolation(err) {
+		t.Fatalf("Expected a password policy violation, got %v", err)
+	}
+	for _, violated := range errgo.Cause(err).(*ApiPasswordPolicyViolation).Rules {
+		if violated == rule {
+			return
+		}
+	}
+	t.Fatalf("Expected the rule %s to be violated, got %v", rule, err)
+}
@@ -0,0 +1,129 @@
+package client
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIntegrationChangeAndVerifyPhone__SuiteAll(t *testing.T) {
+	user := Builder.givenNewUser(t)
+	phone := newPhoneNumber()
+
+	if _, err := ApiChangePhone(user.userID, "030 1234567"); err == nil {
+		t.Fatalf("Expected a number without country code to be rejected")
+	}
+
+	code, err := ApiChangePhone(user.userID, phone)
+	if err != nil {
+		t.Fatalf("Failed to change phone: %v", err)
+	}
+	normalized := strings.Replace(phone, " ", "", -1)
+	if result, err := ApiGetUser(user.userID); err != nil || result.Phone != normalized || result.PhoneVerified {
+		t.Fatalf("Expected the unverified phone %s, got %#v, %v", normalized, result, err)
+	}
+
+	if err := ApiVerifyPhone(user.userID, "wrong"); err == nil {
+		t.Fatalf("Expected the wrong code to be rejected")
+	}
+	if err := ApiVerifyPhone(user.userID, code); err != nil {
+		t.Fatalf("Failed to verify phone: %v", err)
+	}
+	if result, err := ApiGetUser(user.userID); err != nil || !result.PhoneVerified {
+		t.Fatalf("Expected the verified phone, got %#v, %v", result, err)
+	}
+
+	other := Builder.givenNewUser(t)
+	if _, err := ApiChangePhone(other.userID, phone); err == nil {
+		t.Fatalf("Expected the phone to be taken")
+	}
+
+	if err := ApiRemovePhone(user.userID); err != nil {
+		t.Fatalf("Failed to remove phone: %v", err)
+	}
+	if _, err := ApiChangePhone(other.userID, phone); err != nil {
+		t.Fatalf("Expected the removed phone to be free, got %v", err)
+	}
+}
+
+func TestIntegrationPhoneCodeAttemptsAreLimited__SuiteAll(t *testing.T) {
+	user := Builder.givenNewUser(t)
+
+	code, err := ApiChangePhone(user.userID, newPhoneNumber())
+	if err != nil {
+		t.Fatalf("Failed to change phone: %v", err)
+	}
+	for i := 0; i < 5; i++ {
+		ApiVerifyPhone(user.userID, "wrong")
+	}
+	if err := ApiVerifyPhone(user.userID, code); err == nil {
+		t.Fatalf("Expected the code to be invalid after 5 wrong attempts")
+	}
+	if _, err := ApiChangePhone(user.userID, newPhoneNumber()); err == nil {
+		t.Fatalf("Expected no new code before the last one has expired")
+	}
+}
+
+func TestIntegrationNewPhoneCodeKeepsAttempts__SuiteAll(t *testing.T) {
+	user := Builder.givenNewUser(t)
+	phone := newPhoneNumber()
+
+	if _, err := ApiChangePhone(user.userID, phone); err != nil {
+		t.Fatalf("Failed to change phone: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		ApiVerifyPhone(user.userID, "000000")
+	}
+
+	code, err := ApiChangePhone(user.userID, phone)
+	if err != nil {
+		t.Fatalf("Failed to request a new code: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		ApiVerifyPhone(user.userID, "000000")
+	}
+	if err := ApiVerifyPhone(user.userID, code); err == nil {
+		t.Fatalf("Expected the new code to be invalid after 5 wrong attempts in total")
+	}
+}
+
+func TestIntegrationResetPasswordWithPhone__SuiteAll(t *testing.T) {
+	user := Builder.givenNewVerifiedUser(t)
+	phone := newPhoneNumber()
+
+	code, err := ApiChangePhone(user.userID, phone)
+	if err != nil {
+		t.Fatalf("Failed to change phone: %v", err)
+	}
+	if _, err := ApiNewPhoneResetCode(phone); err == nil {
+		t.Fatalf("Expected an unverified phone to be rejected")
+	}
+	if err := ApiVerifyPhone(user.userID, code); err != nil {
+		t.Fatalf("Failed to verify phone: %v", err)
+	}
+
+	resetCode, err := ApiNewPhoneResetCode(phone)
+	if err != nil {
+		t.Fatalf("Failed to create reset code: %v", err)
+	}
+	token, err := ApiExchangePhoneResetCode(phone, resetCode)
+	if err != nil {
+		t.Fatalf("Failed to exchange reset code: %v", err)
+	}
+	if _, err := ApiExchangePhoneResetCode(phone, resetCode); err == nil {
+		t.Fatalf("Expected the reset code to be usable only once")
+	}
+
+	if err := ApiResetPassword(token, "new-secret"); err != nil {
+		t.Fatalf("Failed to reset password: %v", err)
+	}
+	if userID, err := ApiAuthenticate(user.LoginName, "new-secret"); err != nil || userID != user.userID {
+		t.Fatalf("Expected to authenticate with the new password, got %s, %v", userID, err)
+	}
+}
+
+// newPhoneNumber returns an unused german phone number in international format.
+func newPhoneNumber() string {
+	return fmt.Sprintf("+49 30 %08d", time.Now().UnixNano()%100000000)
+}
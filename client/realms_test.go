@@ -0,0 +1,60 @@
+package client
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestIntegrationSameEmailInEveryRealm__SuiteRealms(t *testing.T) {
+	email := Builder.Fake.FreeEmail()
+	loginName := Builder.Fake.UserName()
+
+	userID, err := ApiCreateUser("Default", email, loginName, Password)
+	if err != nil {
+		t.Fatalf("Failed to create user in the default realm: %v", err)
+	}
+
+	var shopUserID string
+	inRealm("shop", func() {
+		if shopUserID, err = ApiCreateUser("Shop", email, loginName, Password); err != nil {
+			t.Fatalf("Failed to create user with the same email in realm shop: %v", err)
+		}
+		if _, err := ApiCreateUser("Shop", email, Builder.Fake.UserName(), Password); err == nil {
+			t.Fatalf("Expected the email to be taken in realm shop")
+		}
+		if _, err := ApiGetUser(userID); err == nil {
+			t.Fatalf("Expected the user of the default realm to be unknown in realm shop")
+		}
+	})
+
+	if _, err := ApiGetUser(shopUserID); err == nil {
+		t.Fatalf("Expected the user of realm shop to be unknown in the default realm")
+	}
+	if user, err := ApiGetUser(userID); err != nil || user.ProfileName != "Default" {
+		t.Fatalf("Expected the user of the default realm, got %#v, %v", user, err)
+	}
+}
+
+func TestIntegrationRealmOverridesAuthEmail__SuiteRealms(t *testing.T) {
+	// userd runs with --auth-email=true, the realm shop doesn't require a verified email
+	inRealm("shop", func() {
+		user := Builder.givenNewUser(t)
+		if userID, err := ApiAuthenticate(user.LoginName, Password); err != nil || userID != user.userID {
+			t.Fatalf("Expected to authenticate without verified email in realm shop, got %s, %v", userID, err)
+		}
+	})
+
+	user := Builder.givenNewUser(t)
+	if _, err := ApiAuthenticate(user.LoginName, Password); err == nil {
+		t.Fatalf("Expected the default realm to require a verified email")
+	}
+}
+
+// inRealm runs f with the API endpoint of the realm.
+func inRealm(realm string, f func()) {
+	previous := endpoint
+	defer SetEndpoint(previous)
+
+	SetEndpoint(strings.TrimSuffix(previous, "/v1/user/") + "/realms/" + realm + "/v1/user/")
+	f()
+}
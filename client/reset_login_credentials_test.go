@@ -24,3 +24,22 @@ func TestIntegrationUserLoginCredentialsForgotten__SuiteAll(t *testing.T) {
 		t.Fatalf("Authenticated as wrong user. expected '%s' != actual '%s'", user.userID, userID)
 	}
 }
+
+func TestIntegrationUserPasswordForgotten__SuiteAll(t *testing.T) {
+	user := Builder.givenNewVerifiedUser(t)
+
+	token, err := ApiNewResetPasswordToken(user.Email)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if err := ApiResetPassword(token, "new_secret"); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if userID, err := ApiAuthenticate(user.LoginName, "new_secret"); err != nil {
+		t.Fatalf("error %v", err)
+	} else if userID != user.userID {
+		t.Fatalf("Authenticated as wrong user. expected '%s' != actual '%s'", user.userID, userID)
+	}
+}
@@ -0,0 +1,105 @@
+package client
+
+import (
+	"testing"
+)
+
+func TestIntegrationAuthenticateWithSession__SuiteAll(t *testing.T) {
+	user := Builder.givenNewVerifiedUser(t)
+	session := givenSession(t, user)
+
+	info, err := ApiValidateSession(session.Token)
+	if err != nil {
+		t.Fatalf("Failed to validate session: %v", err)
+	}
+	if info.UserID != user.userID || info.SessionID != session.SessionID {
+		t.Fatalf("Unexpected session %#v", info)
+	}
+
+	if _, err := ApiValidateSession("unknown-token"); err == nil {
+		t.Fatalf("Expected unknown token to be rejected")
+	}
+}
+
+func TestIntegrationRefreshSession__SuiteAll(t *testing.T) {
+	user := Builder.givenNewVerifiedUser(t)
+	session := givenSession(t, user)
+
+	refreshed, err := ApiRefreshSession(session.RefreshToken)
+	if err != nil {
+		t.Fatalf("Failed to refresh session: %v", err)
+	}
+	if refreshed.SessionID != session.SessionID || refreshed.Token == session.Token || refreshed.RefreshToken == session.RefreshToken {
+		t.Fatalf("Expected new tokens for the same session, got %#v", refreshed)
+	}
+
+	if _, err := ApiValidateSession(session.Token); err == nil {
+		t.Fatalf("Expected the previous token to be invalid")
+	}
+	if _, err := ApiValidateSession(refreshed.Token); err != nil {
+		t.Fatalf("Failed to validate refreshed session: %v", err)
+	}
+
+	// Reusing a refresh token revokes the session
+	if _, err := ApiRefreshSession(session.RefreshToken); err == nil {
+		t.Fatalf("Expected the previous refresh token to be rejected")
+	}
+	if _, err := ApiValidateSession(refreshed.Token); err == nil {
+		t.Fatalf("Expected the session to be revoked after refresh token reuse")
+	}
+}
+
+func TestIntegrationRevokeSessions__SuiteAll(t *testing.T) {
+	user := Builder.givenNewVerifiedUser(t)
+	first := givenSession(t, user)
+	second := givenSession(t, user)
+	third := givenSession(t, user)
+
+	if sessions, err := ApiListSessions(user.userID); err != nil {
+		t.Fatalf("Failed to list sessions: %v", err)
+	} else if len(sessions) != 3 {
+		t.Fatalf("Expected 3 sessions, got %d", len(sessions))
+	}
+
+	if err := ApiRevokeSession(first.SessionID); err != nil {
+		t.Fatalf("Failed to revoke session: %v", err)
+	}
+	if _, err := ApiValidateSession(first.Token); err == nil {
+		t.Fatalf("Expected revoked session to be invalid")
+	}
+	if _, err := ApiValidateSession(second.Token); err != nil {
+		t.Fatalf("Expected other sessions to stay valid: %v", err)
+	}
+
+	if count, err := ApiRevokeAllSessions(user.userID); err != nil {
+		t.Fatalf("Failed to revoke all sessions: %v", err)
+	} else if count != 2 {
+		t.Fatalf("Expected 2 revoked sessions, got %d", count)
+	}
+	if _, err := ApiValidateSession(third.Token); err == nil {
+		t.Fatalf("Expected all sessions to be revoked")
+	}
+}
+
+func TestIntegrationLockUserRevokesSessions__SuiteAll(t *testing.T) {
+	user := Builder.givenNewVerifiedUser(t)
+	session := givenSession(t, user)
+
+	if err := ApiLockUser(user.userID, "investigation"); err != nil {
+		t.Fatalf("Failed to lock user: %v", err)
+	}
+	if _, err := ApiValidateSession(session.Token); err == nil {
+		t.Fatalf("Expected session of locked user to be invalid")
+	}
+}
+
+func givenSession(t *testing.T, user ApiCreateUserResult) ApiSession {
+	session, err := ApiAuthenticateWithSession(user.LoginName, Password)
+	if err != nil {
+		t.Fatalf("Failed to authenticate with session: %v", err)
+	}
+	if session.UserID != user.userID || session.Token == "" || session.RefreshToken == "" {
+		t.Fatalf("Unexpected session %#v", session)
+	}
+	return session
+}
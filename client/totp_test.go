@@ -0,0 +1,124 @@
+package client
+
+import (
+	"../service/totp"
+
+	"github.com/juju/errgo"
+
+	"testing"
+	"time"
+)
+
+func TestIntegrationAuthenticateWithTOTP__SuiteAll(t *testing.T) {
+	user := Builder.givenNewVerifiedUser(t)
+	secret, _ := givenEnabledTOTP(t, user)
+
+	challenge := whenAuthenticatingRequiresSecondFactor(t, user)
+
+	if _, err := ApiCompleteAuthentication(challenge, "000000"); err == nil {
+		t.Fatalf("Expected wrong code to be rejected")
+	}
+
+	// The current code was already used by ApiConfirmTOTP, so use the next one
+	code, err := totp.Code(secret, totp.Counter(time.Now())+1)
+	if err != nil {
+		t.Fatalf("Failed to generate code: %v", err)
+	}
+
+	if userID, err := ApiCompleteAuthentication(challenge, code); err != nil {
+		t.Fatalf("Failed to complete authentication: %v", err)
+	} else if userID != user.userID {
+		t.Fatalf("Authenticated as wrong user, got '%s', expected '%s'", userID, user.userID)
+	}
+}
+
+func TestIntegrationAuthenticateWithRecoveryCode__SuiteAll(t *testing.T) {
+	user := Builder.givenNewVerifiedUser(t)
+	_, recoveryCodes := givenEnabledTOTP(t, user)
+
+	challenge := whenAuthenticatingRequiresSecondFactor(t, user)
+	if userID, err := ApiCompleteAuthentication(challenge, recoveryCodes[0]); err != nil {
+		t.Fatalf("Failed to complete authentication: %v", err)
+	} else if userID != user.userID {
+		t.Fatalf("Authenticated as wrong user, got '%s', expected '%s'", userID, user.userID)
+	}
+
+	challenge = whenAuthenticatingRequiresSecondFactor(t, user)
+	if _, err := ApiCompleteAuthentication(challenge, recoveryCodes[0]); err == nil {
+		t.Fatalf("Expected recovery code to be usable only once")
+	}
+}
+
+func TestIntegrationSecondFactorAttemptsAreLimitedAcrossChallenges__SuiteAll(t *testing.T) {
+	user := Builder.givenNewVerifiedUser(t)
+	secret, _ := givenEnabledTOTP(t, user)
+
+	challenge := whenAuthenticatingRequiresSecondFactor(t, user)
+	for i := 0; i < 3; i++ {
+		ApiCompleteAuthentication(challenge, "000000")
+	}
+	challenge = whenAuthenticatingRequiresSecondFactor(t, user)
+	for i := 0; i < 2; i++ {
+		ApiCompleteAuthentication(challenge, "000000")
+	}
+
+	code, err := totp.Code(secret, totp.Counter(time.Now())+1)
+	if err != nil {
+		t.Fatalf("Failed to generate code: %v", err)
+	}
+	if _, err := ApiCompleteAuthentication(challenge, code); err == nil {
+		t.Fatalf("Expected the new challenge to be invalid after 5 wrong codes in total")
+	}
+
+	_, err = ApiAuthenticate(user.LoginName, Password)
+	if _, ok := errgo.Cause(err).(*ApiSecondFactorRequired); ok || err == nil {
+		t.Fatalf("Expected no new challenge after 5 wrong codes, got %v", err)
+	}
+}
+
+func TestIntegrationDisableTOTP__SuiteAll(t *testing.T) {
+	user := Builder.givenNewVerifiedUser(t)
+	givenEnabledTOTP(t, user)
+
+	if err := ApiDisableTOTP(user.userID); err != nil {
+		t.Fatalf("Failed to disable TOTP: %v", err)
+	}
+
+	if userID, err := ApiAuthenticate(user.LoginName, Password); err != nil {
+		t.Fatalf("Failed to authenticate: %v", err)
+	} else if userID != user.userID {
+		t.Fatalf("Authenticated as wrong user, got '%s', expected '%s'", userID, user.userID)
+	}
+}
+
+// givenEnabledTOTP enrolls and confirms TOTP for the user and returns the secret and recovery codes.
+func givenEnabledTOTP(t *testing.T, user ApiCreateUserResult) (string, []string) {
+	enrollment, err := ApiEnrollTOTP(user.userID)
+	if err != nil {
+		t.Fatalf("Failed to enroll TOTP: %v", err)
+	}
+
+	code, err := totp.Code(enrollment.Secret, totp.Counter(time.Now()))
+	if err != nil {
+		t.Fatalf("Failed to generate code: %v", err)
+	}
+
+	recoveryCodes, err := ApiConfirmTOTP(user.userID, code)
+	if err != nil {
+		t.Fatalf("Failed to confirm TOTP: %v", err)
+	}
+	if len(recoveryCodes) == 0 {
+		t.Fatalf("Expected recovery codes")
+	}
+	return enrollment.Secret, recoveryCodes
+}
+
+// whenAuthenticatingRequiresSecondFactor authenticates with the password and returns the challenge.
+func whenAuthenticatingRequiresSecondFactor(t *testing.T, user ApiCreateUserResult) string {
+	_, err := ApiAuthenticate(user.LoginName, Password)
+	required, ok := errgo.Cause(err).(*ApiSecondFactorRequired)
+	if !ok {
+		t.Fatalf("Expected a second factor to be required, got %v", err)
+	}
+	return required.Challenge
+}
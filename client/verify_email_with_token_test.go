@@ -0,0 +1,30 @@
+package client
+
+import (
+	"testing"
+)
+
+func TestIntegrationVerifyEmailWithToken__SuiteAll(t *testing.T) {
+	user := Builder.givenNewUser(t)
+
+	token, err := ApiNewEmailVerificationToken(user.userID)
+	if err != nil {
+		t.Fatalf("Failed to create token: %v", err)
+	}
+
+	if err := ApiVerifyEmailWithToken(token); err != nil {
+		t.Fatalf("Failed to verify email: %v", err)
+	}
+
+	apiUser, err := ApiGetUser(user.userID)
+	if err != nil {
+		t.Fatalf("Failed to read user: %v", err)
+	}
+	if !apiUser.EmailVerified {
+		t.Fatalf("Expected email to be verified")
+	}
+
+	if err := ApiVerifyEmailWithToken(token); err == nil {
+		t.Fatalf("Expected token to be usable only once")
+	}
+}
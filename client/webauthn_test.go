@@ -0,0 +1,183 @@
+package client
+
+import (
+	"../service/webauthn"
+
+	"github.com/juju/errgo"
+
+	"encoding/json"
+	"testing"
+)
+
+// These tests need userd to run with --webauthn-rp-id=localhost --webauthn-origins=http://localhost
+const (
+	webAuthnRPID   = "localhost"
+	webAuthnOrigin = "http://localhost"
+)
+
+func TestIntegrationWebAuthnLogin__SuiteWebAuthn(t *testing.T) {
+	user := Builder.givenNewVerifiedUser(t)
+	authenticator := webauthn.NewSoftAuthenticator(webAuthnRPID, webAuthnOrigin)
+	credentialID := givenWebAuthnCredential(t, user, authenticator)
+
+	apiUser, err := ApiGetUser(user.userID)
+	if err != nil {
+		t.Fatalf("Failed to get user: %v", err)
+	}
+	if len(apiUser.WebAuthnCredentials) != 1 || apiUser.WebAuthnCredentials[0].ID != credentialID {
+		t.Fatalf("Expected the credential to be listed, got %#v", apiUser.WebAuthnCredentials)
+	}
+
+	for i := 0; i < 2; i++ {
+		if userID, err := whenLoggingInWithWebAuthn(t, user, authenticator); err != nil {
+			t.Fatalf("Failed to login with WebAuthn: %v", err)
+		} else if userID != user.userID {
+			t.Fatalf("Authenticated as wrong user, got '%s', expected '%s'", userID, user.userID)
+		}
+	}
+}
+
+func TestIntegrationWebAuthnPackedAttestation__SuiteWebAuthn(t *testing.T) {
+	user := Builder.givenNewVerifiedUser(t)
+	authenticator := webauthn.NewSoftAuthenticator(webAuthnRPID, webAuthnOrigin)
+	authenticator.Attestation = webauthn.SoftAttestationPackedX5C
+	givenWebAuthnCredential(t, user, authenticator)
+
+	if _, err := whenLoggingInWithWebAuthn(t, user, authenticator); err != nil {
+		t.Fatalf("Failed to login with WebAuthn: %v", err)
+	}
+}
+
+func TestIntegrationWebAuthnRejectsClonedAuthenticator__SuiteWebAuthn(t *testing.T) {
+	user := Builder.givenNewVerifiedUser(t)
+	authenticator := webauthn.NewSoftAuthenticator(webAuthnRPID, webAuthnOrigin)
+	givenWebAuthnCredential(t, user, authenticator)
+	clone := authenticator.Clone()
+
+	if _, err := whenLoggingInWithWebAuthn(t, user, authenticator); err != nil {
+		t.Fatalf("Failed to login with WebAuthn: %v", err)
+	}
+	if _, err := whenLoggingInWithWebAuthn(t, user, clone); err == nil {
+		t.Fatalf("Expected login with an older signature counter to be rejected")
+	}
+}
+
+func TestIntegrationWebAuthnRejectsWrongOrigin__SuiteWebAuthn(t *testing.T) {
+	user := Builder.givenNewVerifiedUser(t)
+	authenticator := webauthn.NewSoftAuthenticator(webAuthnRPID, webAuthnOrigin)
+	givenWebAuthnCredential(t, user, authenticator)
+
+	authenticator.Origin = "http://phishing.example"
+	if _, err := whenLoggingInWithWebAuthn(t, user, authenticator); err == nil {
+		t.Fatalf("Expected login from another origin to be rejected")
+	}
+}
+
+func TestIntegrationRemoveWebAuthnCredential__SuiteWebAuthn(t *testing.T) {
+	user := Builder.givenNewVerifiedUser(t)
+	authenticator := webauthn.NewSoftAuthenticator(webAuthnRPID, webAuthnOrigin)
+	credentialID := givenWebAuthnCredential(t, user, authenticator)
+
+	if err := ApiRemoveWebAuthnCredential(user.userID, credentialID); err != nil {
+		t.Fatalf("Failed to remove credential: %v", err)
+	}
+	if _, err := ApiBeginWebAuthnLogin(user.LoginName); err == nil {
+		t.Fatalf("Expected login without credentials to be rejected")
+	}
+}
+
+func TestIntegrationWebAuthnWithoutUserVerificationRequiresSecondFactor__SuiteWebAuthn(t *testing.T) {
+	user := Builder.givenNewVerifiedUser(t)
+	authenticator := webauthn.NewSoftAuthenticator(webAuthnRPID, webAuthnOrigin)
+	givenWebAuthnCredential(t, user, authenticator)
+	_, recoveryCodes := givenEnabledTOTP(t, user)
+
+	authenticator.UserVerified = false
+	_, err := whenLoggingInWithWebAuthn(t, user, authenticator)
+	required, ok := errgo.Cause(err).(*ApiSecondFactorRequired)
+	if !ok {
+		t.Fatalf("Expected a second factor to be required, got %v", err)
+	}
+	if userID, err := ApiCompleteAuthentication(required.Challenge, recoveryCodes[0]); err != nil || userID != user.userID {
+		t.Fatalf("Expected to complete the authentication, got %s, %v", userID, err)
+	}
+
+	authenticator.UserVerified = true
+	if userID, err := whenLoggingInWithWebAuthn(t, user, authenticator); err != nil || userID != user.userID {
+		t.Fatalf("Expected a verified user to need no second factor, got %s, %v", userID, err)
+	}
+}
+
+func TestIntegrationWebAuthnLoginDoesNotReplaceRegistration__SuiteWebAuthn(t *testing.T) {
+	user := Builder.givenNewVerifiedUser(t)
+	authenticator := webauthn.NewSoftAuthenticator(webAuthnRPID, webAuthnOrigin)
+	givenWebAuthnCredential(t, user, authenticator)
+
+	data, err := ApiBeginWebAuthnRegistration(user.userID)
+	if err != nil {
+		t.Fatalf("Failed to begin registration: %v", err)
+	}
+	var options webauthn.CreationOptions
+	if err := json.Unmarshal(data, &options); err != nil {
+		t.Fatalf("Failed to decode creation options: %v", err)
+	}
+
+	// Anybody knowing the login name can begin a login
+	if _, err := whenLoggingInWithWebAuthn(t, user, authenticator); err != nil {
+		t.Fatalf("Failed to login with WebAuthn: %v", err)
+	}
+
+	second := webauthn.NewSoftAuthenticator(webAuthnRPID, webAuthnOrigin)
+	response, err := second.Register(options)
+	if err != nil {
+		t.Fatalf("Authenticator failed to register: %v", err)
+	}
+	if _, err := ApiFinishWebAuthnRegistration(user.userID, "Second Key", response.ClientDataJSON, response.AttestationObject); err != nil {
+		t.Fatalf("Expected the registration to survive the login, got %v", err)
+	}
+}
+
+func givenWebAuthnCredential(t *testing.T, user ApiCreateUserResult, authenticator *webauthn.SoftAuthenticator) string {
+	data, err := ApiBeginWebAuthnRegistration(user.userID)
+	if err != nil {
+		t.Fatalf("Failed to begin registration: %v", err)
+	}
+
+	var options webauthn.CreationOptions
+	if err := json.Unmarshal(data, &options); err != nil {
+		t.Fatalf("Failed to decode creation options: %v", err)
+	}
+
+	response, err := authenticator.Register(options)
+	if err != nil {
+		t.Fatalf("Authenticator failed to register: %v", err)
+	}
+
+	credentialID, err := ApiFinishWebAuthnRegistration(user.userID, "Test Key", response.ClientDataJSON, response.AttestationObject)
+	if err != nil {
+		t.Fatalf("Failed to finish registration: %v", err)
+	}
+	if credentialID != response.CredentialID {
+		t.Fatalf("Unexpected credential ID '%s', expected '%s'", credentialID, response.CredentialID)
+	}
+	return credentialID
+}
+
+func whenLoggingInWithWebAuthn(t *testing.T, user ApiCreateUserResult, authenticator *webauthn.SoftAuthenticator) (string, error) {
+	data, err := ApiBeginWebAuthnLogin(user.LoginName)
+	if err != nil {
+		t.Fatalf("Failed to begin login: %v", err)
+	}
+
+	var options webauthn.RequestOptions
+	if err := json.Unmarshal(data, &options); err != nil {
+		t.Fatalf("Failed to decode request options: %v", err)
+	}
+
+	response, err := authenticator.Authenticate(options)
+	if err != nil {
+		t.Fatalf("Authenticator failed to sign: %v", err)
+	}
+
+	return ApiFinishWebAuthnLogin(response.CredentialID, response.ClientDataJSON, response.AuthenticatorData, response.Signature)
+}
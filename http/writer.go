@@ -33,8 +33,9 @@ func WriteJSONErrorPage(resp http.ResponseWriter, code int, message string) {
 }
 
 func WriteJSONResponse(resp http.ResponseWriter, code int, data interface{}) {
+	// Headers can not be changed after WriteHeader
+	resp.Header().Set("Content-Type", "application/json; charset=UTF8")
 	resp.WriteHeader(code)
-	resp.Header().Add("content-Type", "application/json; charset=UTF8")
 
 	if err := json.NewEncoder(resp).Encode(data); err != nil {
 		panic(err)
@@ -4,13 +4,20 @@ import (
 	"./middlewares"
 	"./middlewares/v1"
 	"./service"
+	"./service/attributes"
+	"./service/breach"
 	"./service/eventstream"
 	"./service/hasher"
 	"./service/idfactory"
+	"./service/jwt"
+	"./service/oidc"
+	"./service/passwordpolicy"
+	"./service/realm"
 
 	"./service/storage"
 
 	httpcli "./http/cli"
+	oidcprovider "./middlewares/oidc"
 
 	flag "github.com/ogier/pflag"
 
@@ -32,12 +39,27 @@ var (
 	storageEtcdLogFile     = flag.String("storage-etcd-log", "", "Filepath to write etcd debug log. Use - for stdout.")
 	storageEtcdSyncCluster = flag.Bool("storage-etcd-sync-cluster", false, "Call SyncCluster initially to fetch all available nodes.")
 	storageEtcdTtl         = flag.Uint64("storage-etcd-ttl", 0, "The TTL to use when creating entries in Etcd. 0 = no ttl")
+	storageRedisPrefix     = flag.String("storage-redis-prefix", "", "A prefix to include into all redis keys.")
+	storageRedisLayout     = flag.String("storage-redis-layout", "plain", "How to name the redis keys: plain or hashtag (Redis Cluster). hashtag puts all keys into one slot, so userd is not sharded.")
 )
 
-func UserStorage() service.UserStorage {
+func RedisKeyLayout() storage.RedisKeyLayout {
+	switch *storageRedisLayout {
+	case "plain":
+		return storage.RedisLayoutPlain
+	case "hashtag":
+		return storage.RedisLayoutHashTag
+	default:
+		log.Fatalf("Unknown --storage-redis-layout value: %s", *storageRedisLayout)
+		return storage.RedisLayoutPlain
+	}
+}
+
+// UserStorage returns the storage of the users of a realm, "" is the default realm.
+func UserStorage(realm string) service.UserStorage {
 	switch *backendStorage {
 	case "redis":
-		return storage.NewRedisStorage(RedisPool())
+		return storage.NewRedisStorage(RedisPool(), storage.RealmPrefix(*storageRedisPrefix, realm, ":"), RedisKeyLayout())
 	case "etcd":
 		var etcdLog *log.Logger
 
@@ -55,7 +77,7 @@ func UserStorage() service.UserStorage {
 		}
 
 		peers := strings.Split(*storageEtcdPeers, ",")
-		return storage.NewEtcdStorage(peers, *storageEtcdPrefix, *storageEtcdTtl, *storageEtcdSyncCluster, *storageEtcdLogCURL, etcdLog)
+		return storage.NewEtcdStorage(peers, storage.RealmPrefix(*storageEtcdPrefix, realm, "/"), *storageEtcdTtl, *storageEtcdSyncCluster, *storageEtcdLogCURL, etcdLog)
 	case "memory":
 		return storage.NewLocalStorage()
 	default:
@@ -64,6 +86,54 @@ func UserStorage() service.UserStorage {
 	}
 }
 
+// GroupStorage stores the groups in the backend of the users.
+func GroupStorage(userStorage service.UserStorage) service.GroupStorage {
+	groupStorage, ok := userStorage.(service.GroupStorage)
+	if !ok {
+		log.Fatalf("The --storage %s does not support groups", *backendStorage)
+	}
+	return groupStorage
+}
+
+// SessionStorage uses the same backend and realm as UserStorage.
+func SessionStorage(realm string) service.SessionStorage {
+	switch *backendStorage {
+	case "redis":
+		return storage.NewRedisSessionStorage(RedisPool(), storage.RealmPrefix(*storageRedisPrefix, realm, ":"), RedisKeyLayout())
+	case "etcd":
+		peers := strings.Split(*storageEtcdPeers, ",")
+		return storage.NewEtcdSessionStorage(peers, storage.RealmPrefix(*storageEtcdPrefix, realm, "/"), *storageEtcdSyncCluster, false, nil)
+	case "memory":
+		return storage.NewLocalSessionStorage()
+	default:
+		log.Fatalf("Unknown --storage value: %s", *backendStorage)
+		return nil
+	}
+}
+
+var (
+	auditRetention = flag.Uint("audit-retention", 90, "How long are the entries of the change history kept (days). 0 disables the history.")
+)
+
+// AuditStorage keeps the change history in the backend of the sessions. Returns nil if the history is disabled.
+func AuditStorage(realm string) service.AuditStorage {
+	if *auditRetention == 0 {
+		return nil
+	}
+	switch *backendStorage {
+	case "redis":
+		return storage.NewRedisAuditStorage(RedisPool(), storage.RealmPrefix(*storageRedisPrefix, realm, ":"), RedisKeyLayout())
+	case "etcd":
+		peers := strings.Split(*storageEtcdPeers, ",")
+		return storage.NewEtcdAuditStorage(peers, storage.RealmPrefix(*storageEtcdPrefix, realm, "/"), *storageEtcdSyncCluster, false, nil)
+	case "memory":
+		return storage.NewLocalAuditStorage()
+	default:
+		log.Fatalf("Unknown --storage value: %s", *backendStorage)
+		return nil
+	}
+}
+
 // ------------------------------------------------------------------------------
 
 var (
@@ -97,6 +167,134 @@ func PasswordHasher() service.PasswordHasher {
 
 // ------------------------------------------------------------------------------
 
+var (
+	passwordMinLength          = flag.Int("password-min-length", 1, "Minimum number of characters of new passwords.")
+	passwordMaxLength          = flag.Int("password-max-length", passwordpolicy.BcryptMaxLength, "Maximum number of bytes of new passwords. bcrypt ignores anything after 72 bytes.")
+	passwordRequireLowercase   = flag.Bool("password-require-lowercase", false, "Must new passwords contain a lowercase letter.")
+	passwordRequireUppercase   = flag.Bool("password-require-uppercase", false, "Must new passwords contain an uppercase letter.")
+	passwordRequireDigit       = flag.Bool("password-require-digit", false, "Must new passwords contain a digit.")
+	passwordRequireSymbol      = flag.Bool("password-require-symbol", false, "Must new passwords contain a symbol or punctuation.")
+	passwordMinStrength        = flag.Int("password-min-strength", 0, "Minimum estimated strength of new passwords in bits. 0 = no check")
+	passwordRejectPersonalData = flag.Bool("password-reject-personal-data", true, "Reject new passwords containing the login name or email.")
+	passwordHistory            = flag.Int("password-history", 0, "Reject new passwords matching one of the last N passwords, including the current one. 0 = no check")
+)
+
+func PasswordPolicy() service.PasswordPolicy {
+	policy := passwordpolicy.NewPolicy()
+	policy.MinLength = *passwordMinLength
+	policy.MaxLength = *passwordMaxLength
+	policy.RequireLowercase = *passwordRequireLowercase
+	policy.RequireUppercase = *passwordRequireUppercase
+	policy.RequireDigit = *passwordRequireDigit
+	policy.RequireSymbol = *passwordRequireSymbol
+	policy.MinStrength = float64(*passwordMinStrength)
+	policy.RejectPersonalData = *passwordRejectPersonalData
+	return policy
+}
+
+// ------------------------------------------------------------------------------
+
+var (
+	switchBreachedPasswords = flag.String("breached-passwords", "none", "Reject passwords known from data breaches: none, sha1-file or prefix-dir")
+	breachedPasswordsPath   = flag.String("breached-passwords-path", "", "The sorted SHA-1 file or the directory of k-anonymity range files.")
+	breachedPasswordsFlag   = flag.Bool("breached-passwords-flag-users", false, "Check the password on every authentication and flag the user if it is breached.")
+)
+
+func BreachedPasswords() service.BreachedPasswords {
+	switch *switchBreachedPasswords {
+	case "none":
+		return breach.NewNone()
+	case "sha1-file":
+		list, err := breach.NewSHA1File(*breachedPasswordsPath)
+		if err != nil {
+			log.Fatalf("Failed to open --breached-passwords-path: %v", err)
+		}
+		return list
+	case "prefix-dir":
+		list, err := breach.NewPrefixDirectory(*breachedPasswordsPath)
+		if err != nil {
+			log.Fatalf("Failed to open --breached-passwords-path: %v", err)
+		}
+		return list
+	default:
+		log.Fatalf("Unknown --breached-passwords value: %s", *switchBreachedPasswords)
+		return nil
+	}
+}
+
+// ------------------------------------------------------------------------------
+
+var (
+	jwtKeyFiles     = flag.String("jwt-key-files", "", "PEM files with the RSA or Ed25519 keys to sign access tokens (comma separated). The first one signs, the others are only published. Empty disables access tokens.")
+	jwtKeyCheckTime = flag.Uint("jwt-key-check-interval", 60, "How often are the key files checked for changes (seconds)")
+	jwtIssuer       = flag.String("jwt-issuer", "", "The issuer (iss) of the access tokens, e.g. https://login.example.com")
+	jwtAudience     = flag.String("jwt-audience", "", "The audience (aud) of the access tokens.")
+)
+
+func TokenSigner() service.TokenSigner {
+	if *jwtKeyFiles == "" {
+		return nil
+	}
+
+	var paths []string
+	for _, path := range strings.Split(*jwtKeyFiles, ",") {
+		if path = strings.TrimSpace(path); path != "" {
+			paths = append(paths, path)
+		}
+	}
+
+	keySet, err := jwt.NewKeySet(paths, time.Duration(*jwtKeyCheckTime)*time.Second)
+	if err != nil {
+		log.Fatalf("Failed to load --jwt-key-files: %v", err)
+	}
+	return keySet
+}
+
+// ------------------------------------------------------------------------------
+
+var (
+	oidcIssuer      = flag.String("oidc-issuer", "", "The public URL of userd as OpenID Connect provider, e.g. https://login.example.com. Empty disables the provider.")
+	oidcClientsFile = flag.String("oidc-clients", "", "JSON file with the registered OpenID Connect clients.")
+)
+
+func OIDCClients() []oidc.Client {
+	if *oidcIssuer == "" {
+		return nil
+	}
+	if *jwtKeyFiles == "" {
+		log.Fatalf("--oidc-issuer requires --jwt-key-files to sign the tokens")
+	}
+	if *oidcClientsFile == "" {
+		log.Fatalf("--oidc-issuer requires --oidc-clients")
+	}
+
+	clients, err := oidc.LoadClients(*oidcClientsFile)
+	if err != nil {
+		log.Fatalf("Failed to load --oidc-clients: %v", err)
+	}
+	return clients
+}
+
+// ------------------------------------------------------------------------------
+
+var (
+	attributeSchemaFile = flag.String("attribute-schema", "", "JSON file defining the custom attributes of the users. Empty allows no attributes.")
+)
+
+func AttributeSchema() *attributes.Schema {
+	if *attributeSchemaFile == "" {
+		return nil
+	}
+
+	schema, err := attributes.LoadSchema(*attributeSchemaFile)
+	if err != nil {
+		log.Fatalf("Failed to load --attribute-schema: %v", err)
+	}
+	return schema
+}
+
+// ------------------------------------------------------------------------------
+
 var (
 	switchEventStreams = flag.String("eventstreams", "none", "Should events be logged? Use log, cores, redis or none")
 
@@ -142,23 +340,180 @@ func EventStreams() *eventstream.Broadcaster {
 
 var (
 	authEmail              = flag.Bool("auth-email", true, "Must the email adress be verified for an authentication to succeed.")
+	loginIdentifier        = flag.String("login-identifier", "login_name", "What identifies the user on authentication: login_name, email or login_name_or_email")
+	loginLinks             = flag.Bool("login-links", false, "Can users authenticate with a link sent by email instead of a password.")
+	requireCurrentPassword = flag.Bool("require-current-password", false, "Must the current password be given to change the login credentials, email addresses, phone number or passkeys, or to disable TOTP or email codes.")
 	eventCollectorMaxItems = flag.Int("feed-max-items", 1000, "Maximum items to keep in feed.")
 
-	resetPasswordExpireTime = flag.Uint("expire-reset-password-token", 2*60, "How long can a resetPasswordToken be used (minutes)")
+	totpIssuer = flag.String("totp-issuer", "userd", "The issuer shown in authenticator apps.")
+
+	webAuthnRPID                    = flag.String("webauthn-rp-id", "", "The domain passkeys are registered for, e.g. example.com. Empty disables WebAuthn.")
+	webAuthnRPName                  = flag.String("webauthn-rp-name", "userd", "The name of the service shown by the browser during WebAuthn registration.")
+	webAuthnOrigins                 = flag.String("webauthn-origins", "", "The origins of the pages using WebAuthn (comma separated), e.g. https://login.example.com")
+	webAuthnRequireUserVerification = flag.Bool("webauthn-require-user-verification", false, "Must the authenticator verify the user, e.g. with a PIN or biometrics.")
+
+	resetPasswordExpireTime     = flag.Uint("expire-reset-password-token", 2*60, "How long can a resetPasswordToken be used (minutes)")
+	emailVerificationExpireTime = flag.Uint("expire-email-verification-token", 3*24*60, "How long can an emailVerificationToken be used (minutes)")
+	phoneCodeExpireTime         = flag.Uint("expire-phone-code", 10, "How long can a code sent to a phone by SMS be used (minutes)")
+	loginLinkExpireTime         = flag.Uint("expire-login-link", 15, "How long can a login link be used (minutes)")
+	secondFactorExpireTime      = flag.Uint("expire-second-factor-challenge", 5, "How long can an authentication be completed with a second factor (minutes)")
+	webAuthnExpireTime          = flag.Uint("expire-webauthn-challenge", 5, "How long can a WebAuthn registration or login be completed (minutes)")
+	sessionExpireTime           = flag.Uint("expire-session", 60, "How long is a session token valid (minutes)")
+	sessionRefreshExpireTime    = flag.Uint("expire-session-refresh", 30*24*60, "How long is a refresh token valid (minutes)")
+	accessTokenExpireTime       = flag.Uint("expire-access-token", 15, "How long is an access token valid (minutes)")
+	oidcCodeExpireTime          = flag.Uint("expire-oidc-code", 1, "How long can an OpenID Connect authorization code be exchanged for tokens (minutes)")
+)
+
+// ------------------------------------------------------------------------------
+
+var (
+	realmsFile = flag.String("realms", "", "JSON file with additional realms, each with its own users, served below /realms/<name>/.")
 )
 
+func Realms() []realm.Realm {
+	if *realmsFile == "" {
+		return nil
+	}
+
+	realms, err := realm.LoadRealms(*realmsFile)
+	if err != nil {
+		log.Fatalf("Failed to load --realms: %v", err)
+	}
+	return realms
+}
+
+// RealmConfig applies the overrides of the realm to the config of the default realm. The OpenID Connect provider
+// is only available in the default realm.
+func RealmConfig(config service.Config, theRealm realm.Realm) service.Config {
+	config.Realm = theRealm.Name
+	config.OIDCIssuer = ""
+	config.OIDCClients = nil
+
+	if theRealm.AuthEmailMustBeVerified != nil {
+		config.AuthEmailMustBeVerified = *theRealm.AuthEmailMustBeVerified
+	}
+	if theRealm.EnableLoginLinks != nil {
+		config.EnableLoginLinks = *theRealm.EnableLoginLinks
+	}
+	if theRealm.SessionExpireTime != nil {
+		config.SessionExpireTime = time.Duration(*theRealm.SessionExpireTime) * time.Minute
+	}
+	if theRealm.SessionRefreshExpireTime != nil {
+		config.SessionRefreshExpireTime = time.Duration(*theRealm.SessionRefreshExpireTime) * time.Minute
+	}
+	if theRealm.AccessTokenExpireTime != nil {
+		config.AccessTokenExpireTime = time.Duration(*theRealm.AccessTokenExpireTime) * time.Minute
+	}
+	if theRealm.ResetPasswordExpireTime != nil {
+		config.ResetPasswordExpireTime = time.Duration(*theRealm.ResetPasswordExpireTime) * time.Minute
+	}
+	if theRealm.EmailVerificationExpireTime != nil {
+		config.EmailVerificationExpireTime = time.Duration(*theRealm.EmailVerificationExpireTime) * time.Minute
+	}
+	if theRealm.LoginLinkExpireTime != nil {
+		config.LoginLinkExpireTime = time.Duration(*theRealm.LoginLinkExpireTime) * time.Minute
+	}
+	if theRealm.PhoneCodeExpireTime != nil {
+		config.PhoneCodeExpireTime = time.Duration(*theRealm.PhoneCodeExpireTime) * time.Minute
+	}
+	if theRealm.AccessTokenAudience != nil {
+		config.AccessTokenAudience = *theRealm.AccessTokenAudience
+	}
+	return config
+}
+
+// RealmDependencies scopes the storages and the event tags to the realm. Everything else is shared.
+func RealmDependencies(dependencies service.Dependencies, theRealm realm.Realm) service.Dependencies {
+	userStorage := UserStorage(theRealm.Name)
+	dependencies.UserStorage = userStorage
+	dependencies.GroupStorage = GroupStorage(userStorage)
+	dependencies.SessionStorage = SessionStorage(theRealm.Name)
+	dependencies.AuditStorage = AuditStorage(theRealm.Name)
+	dependencies.EventStream = eventstream.NewTagPrefixStream(dependencies.EventStream, theRealm.Name)
+	return dependencies
+}
+
+// ------------------------------------------------------------------------------
+
+func WebAuthnOrigins() []string {
+	var origins []string
+	for _, origin := range strings.Split(*webAuthnOrigins, ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			origins = append(origins, origin)
+		}
+	}
+	return origins
+}
+
 func main() {
 	log.SetFlags(log.LstdFlags | log.Lshortfile)
 	starter := httpcli.NewStarterFromFlagSet(flag.CommandLine)
 	flag.Parse()
 
-	dependencies := service.Dependencies{IdFactory(), PasswordHasher(), UserStorage(), EventStreams()}
-	config := service.Config{*authEmail, *eventCollectorMaxItems, time.Duration(*resetPasswordExpireTime) * time.Minute}
+	userStorage := UserStorage("")
+	dependencies := service.Dependencies{
+		IdFactory:      IdFactory(),
+		Hasher:         PasswordHasher(),
+		PasswordPolicy: PasswordPolicy(),
+		UserStorage:    userStorage,
+		SessionStorage: SessionStorage(""),
+		GroupStorage:   GroupStorage(userStorage),
+		AuditStorage:   AuditStorage(""),
+		TokenSigner:    TokenSigner(),
+		EventStream:    EventStreams(),
+
+		BreachedPasswords: BreachedPasswords(),
+	}
+	config := service.Config{
+		AuthEmailMustBeVerified:     *authEmail,
+		LoginIdentifier:             *loginIdentifier,
+		MaxItems:                    *eventCollectorMaxItems,
+		ResetPasswordExpireTime:     time.Duration(*resetPasswordExpireTime) * time.Minute,
+		EmailVerificationExpireTime: time.Duration(*emailVerificationExpireTime) * time.Minute,
+		PhoneCodeExpireTime:         time.Duration(*phoneCodeExpireTime) * time.Minute,
+		EnableLoginLinks:            *loginLinks,
+		LoginLinkExpireTime:         time.Duration(*loginLinkExpireTime) * time.Minute,
+		RequireCurrentPassword:      *requireCurrentPassword,
+		FlagBreachedPasswords:       *breachedPasswordsFlag,
+		PasswordHistorySize:         *passwordHistory,
+		TOTPIssuer:                  *totpIssuer,
+		SecondFactorExpireTime:      time.Duration(*secondFactorExpireTime) * time.Minute,
+		AuditRetention:              time.Duration(*auditRetention) * 24 * time.Hour,
+		SessionExpireTime:           time.Duration(*sessionExpireTime) * time.Minute,
+		SessionRefreshExpireTime:    time.Duration(*sessionRefreshExpireTime) * time.Minute,
+		AccessTokenExpireTime:       time.Duration(*accessTokenExpireTime) * time.Minute,
+		AccessTokenIssuer:           *jwtIssuer,
+		AccessTokenAudience:         *jwtAudience,
+
+		AttributeSchema: AttributeSchema(),
+
+		OIDCIssuer:         strings.TrimSuffix(*oidcIssuer, "/"),
+		OIDCClients:        OIDCClients(),
+		OIDCCodeExpireTime: time.Duration(*oidcCodeExpireTime) * time.Minute,
+
+		WebAuthnRPID:                    *webAuthnRPID,
+		WebAuthnRPName:                  *webAuthnRPName,
+		WebAuthnOrigins:                 WebAuthnOrigins(),
+		WebAuthnRequireUserVerification: *webAuthnRequireUserVerification,
+		WebAuthnExpireTime:              time.Duration(*webAuthnExpireTime) * time.Minute,
+	}
 
 	userService := service.NewUserService(config, dependencies)
 
 	mux := http.NewServeMux()
 	mux.Handle("/", middlewares.WelcomeHandler{})
 	mux.Handle("/v1/", v1.NewUserAPIHandler(userService))
+	mux.Handle("/.well-known/jwks.json", v1.NewJWKSHandler(userService))
+
+	oidcProvider := oidcprovider.NewProviderHandler(userService)
+	mux.Handle("/.well-known/openid-configuration", oidcProvider)
+	mux.Handle("/oauth2/", oidcProvider)
+
+	for _, theRealm := range Realms() {
+		realmService := service.NewUserService(RealmConfig(config, theRealm), RealmDependencies(dependencies, theRealm))
+
+		prefix := "/realms/" + theRealm.Name
+		mux.Handle(prefix+"/v1/", http.StripPrefix(prefix, v1.NewUserAPIHandler(realmService)))
+	}
 	starter.StartHttpInterface(mux)
 }
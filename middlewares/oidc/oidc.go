@@ -0,0 +1,317 @@
+// Package oidc serves the endpoints of the OpenID Connect provider and its hosted login page. The logic lives in
+// the UserService, see service/oidc.go.
+package oidc
+
+import (
+	httputil "../../http"
+	"../../service"
+
+	"github.com/gorilla/mux"
+	"github.com/juju/errgo"
+
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const csrfCookieName = "userd_oidc_csrf"
+
+func NewProviderHandler(userService *service.UserService) http.Handler {
+	base := BaseHandler{userService}
+
+	mux := mux.NewRouter()
+	mux.Methods("GET").Path("/.well-known/openid-configuration").Handler(&DiscoveryHandler{base})
+	mux.Methods("GET", "POST").Path("/oauth2/authorize").Handler(&AuthorizeHandler{base})
+	mux.Methods("POST").Path("/oauth2/token").Handler(&TokenHandler{base})
+	mux.Methods("GET", "POST").Path("/oauth2/userinfo").Handler(&UserInfoHandler{base})
+	return mux
+}
+
+// --------------------------------------------------------------------------------------------
+
+type BaseHandler struct {
+	UserService *service.UserService
+}
+
+// writeOAuthError responds with an error of RFC 6749 section 5.2.
+func (base *BaseHandler) writeOAuthError(resp http.ResponseWriter, code int, oauthError, description string) {
+	resp.Header().Set("Cache-Control", "no-store")
+	httputil.WriteJSONResponse(resp, code, map[string]string{
+		"error":             oauthError,
+		"error_description": description,
+	})
+}
+
+func (base *BaseHandler) writeProcessingError(resp http.ResponseWriter, err error) {
+	httputil.WriteJSONErrorPage(resp, http.StatusInternalServerError, "An Internal Error occured. Please try again later.")
+
+	log.Printf("Internal error: %#v\n", err)
+}
+
+// --------------------------------------------------------------------------------------------
+
+type DiscoveryHandler struct{ BaseHandler }
+
+func (h *DiscoveryHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	discovery, err := h.UserService.OIDCDiscovery()
+	if err != nil {
+		httputil.WriteNotFound(resp)
+		return
+	}
+	resp.Header().Set("Cache-Control", "max-age=300")
+	httputil.WriteJSONResponse(resp, http.StatusOK, discovery)
+}
+
+// --------------------------------------------------------------------------------------------
+
+// AuthorizeHandler shows the login page on GET and authenticates the user on POST. The parameters of the
+// authorization request are passed on as hidden fields. On success the user is redirected to the client with a code.
+type AuthorizeHandler struct{ BaseHandler }
+
+func (h *AuthorizeHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	resp.Header().Set("X-Frame-Options", "DENY")
+	resp.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; frame-ancestors 'none'")
+	resp.Header().Set("Cache-Control", "no-store")
+
+	request := authorizationRequest{
+		ResponseType:        req.FormValue("response_type"),
+		ClientID:            req.FormValue("client_id"),
+		RedirectURI:         req.FormValue("redirect_uri"),
+		Scope:               req.FormValue("scope"),
+		State:               req.FormValue("state"),
+		Nonce:               req.FormValue("nonce"),
+		CodeChallenge:       req.FormValue("code_challenge"),
+		CodeChallengeMethod: req.FormValue("code_challenge_method"),
+	}
+
+	client, err := h.UserService.CheckOIDCClient(request.ClientID, request.RedirectURI)
+	if err == service.OIDCDisabled || err == service.AccessTokensDisabled {
+		httputil.WriteNotFound(resp)
+		return
+	} else if err != nil {
+		// Never redirect to an unknown redirect_uri
+		h.renderPage(resp, http.StatusBadRequest, page{Error: "Unknown client or redirect URI."})
+		return
+	}
+
+	if request.ResponseType != "code" {
+		h.redirectWithError(resp, req, request, "unsupported_response_type", "Only the authorization code flow is supported.")
+		return
+	}
+	if !strings.Contains(" "+request.Scope+" ", " openid ") {
+		h.redirectWithError(resp, req, request, "invalid_scope", "The scope must contain openid.")
+		return
+	}
+	if request.CodeChallenge == "" || request.CodeChallengeMethod != "S256" {
+		h.redirectWithError(resp, req, request, "invalid_request", "PKCE with code_challenge_method S256 is required.")
+		return
+	}
+
+	loginPage := page{ClientName: client.Name, Request: request}
+	if loginPage.ClientName == "" {
+		loginPage.ClientName = client.ID
+	}
+
+	if req.Method == "GET" {
+		h.renderLoginPage(resp, req, loginPage)
+		return
+	}
+
+	if !h.checkCSRFToken(req) {
+		loginPage.Error = "Your session has expired, please try again."
+		h.renderLoginPage(resp, req, loginPage)
+		return
+	}
+
+	var userID string
+	if challenge := req.PostFormValue("challenge"); challenge != "" {
+		userID, err = h.UserService.CompleteAuthentication(challenge, req.PostFormValue("code"))
+	} else {
+		userID, err = h.UserService.Authenticate(req.PostFormValue("login_name"), req.PostFormValue("password"))
+	}
+
+	if err != nil {
+		cause := errgo.Cause(err)
+		if required, ok := cause.(*service.SecondFactorRequired); ok {
+			loginPage.Challenge = required.Challenge
+		} else if cause == service.InvalidCredentials || cause == service.InvalidArguments || service.IsNotFoundError(cause) {
+			loginPage.Challenge = req.PostFormValue("challenge")
+			loginPage.Error = "The login name, password or code is wrong."
+		} else if service.IsServiceError(cause) || service.IsUserEmailMustBeVerifiedError(cause) || service.IsUserNotActiveError(cause) {
+			loginPage.Error = cause.Error()
+		} else {
+			h.writeProcessingError(resp, err)
+			return
+		}
+		h.renderLoginPage(resp, req, loginPage)
+		return
+	}
+
+	code, err := h.UserService.AuthorizeOIDC(userID, service.OIDCAuthorization{
+		ClientID:      request.ClientID,
+		RedirectURI:   request.RedirectURI,
+		Scope:         request.Scope,
+		Nonce:         request.Nonce,
+		CodeChallenge: request.CodeChallenge,
+	})
+	if err != nil {
+		if service.IsUserNotActiveError(err) {
+			loginPage.Error = errgo.Cause(err).Error()
+			h.renderLoginPage(resp, req, loginPage)
+		} else {
+			h.writeProcessingError(resp, err)
+		}
+		return
+	}
+
+	h.redirect(resp, req, request, url.Values{"code": {code}})
+}
+
+func (h *AuthorizeHandler) redirectWithError(resp http.ResponseWriter, req *http.Request, request authorizationRequest, oauthError, description string) {
+	h.redirect(resp, req, request, url.Values{"error": {oauthError}, "error_description": {description}})
+}
+
+// redirect sends the user back to the client. The redirect URI was checked by CheckOIDCClient before.
+func (h *AuthorizeHandler) redirect(resp http.ResponseWriter, req *http.Request, request authorizationRequest, params url.Values) {
+	redirectURI, err := url.Parse(request.RedirectURI)
+	if err != nil {
+		h.writeProcessingError(resp, err)
+		return
+	}
+
+	query := redirectURI.Query()
+	for name, values := range params {
+		query[name] = values
+	}
+	if request.State != "" {
+		query.Set("state", request.State)
+	}
+	redirectURI.RawQuery = query.Encode()
+
+	http.Redirect(resp, req, redirectURI.String(), http.StatusFound)
+}
+
+// renderLoginPage sets a new CSRF token as cookie and hidden field, see checkCSRFToken.
+func (h *AuthorizeHandler) renderLoginPage(resp http.ResponseWriter, req *http.Request, loginPage page) {
+	data := make([]byte, 32)
+	if _, err := rand.Read(data); err != nil {
+		h.writeProcessingError(resp, err)
+		return
+	}
+	loginPage.CSRFToken = base64.RawURLEncoding.EncodeToString(data)
+
+	http.SetCookie(resp, &http.Cookie{
+		Name:     csrfCookieName,
+		Value:    loginPage.CSRFToken,
+		Path:     "/oauth2/",
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(h.UserService.OIDCIssuer, "https://"),
+		SameSite: http.SameSiteStrictMode,
+	})
+	h.renderPage(resp, http.StatusOK, loginPage)
+}
+
+// checkCSRFToken compares the hidden field with the cookie, so other sites can not login a user into their account.
+func (h *AuthorizeHandler) checkCSRFToken(req *http.Request) bool {
+	cookie, err := req.Cookie(csrfCookieName)
+	if err != nil || cookie.Value == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(req.PostFormValue("csrf_token"))) == 1
+}
+
+func (h *AuthorizeHandler) renderPage(resp http.ResponseWriter, code int, p page) {
+	resp.Header().Set("Content-Type", "text/html; charset=utf-8")
+	resp.WriteHeader(code)
+	if err := pageTemplate.Execute(resp, p); err != nil {
+		log.Printf("Failed to render login page: %v\n", err)
+	}
+}
+
+// --------------------------------------------------------------------------------------------
+
+// TokenHandler exchanges authorization codes and refresh tokens. Clients authenticate with HTTP Basic or the
+// client_id and client_secret parameters, public clients only with client_id.
+type TokenHandler struct{ BaseHandler }
+
+func (h *TokenHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	clientID, clientSecret, basicAuth := req.BasicAuth()
+	if basicAuth {
+		// RFC 6749 section 2.3.1 requires form encoding
+		clientID, _ = url.QueryUnescape(clientID)
+		clientSecret, _ = url.QueryUnescape(clientSecret)
+	} else {
+		clientID = req.PostFormValue("client_id")
+		clientSecret = req.PostFormValue("client_secret")
+	}
+
+	var tokens service.OIDCTokens
+	var err error
+	switch req.PostFormValue("grant_type") {
+	case "authorization_code":
+		tokens, err = h.UserService.ExchangeOIDCCode(clientID, clientSecret, req.PostFormValue("code"),
+			req.PostFormValue("redirect_uri"), req.PostFormValue("code_verifier"))
+	case "refresh_token":
+		tokens, err = h.UserService.RefreshOIDCTokens(clientID, clientSecret, req.PostFormValue("refresh_token"))
+	default:
+		h.writeOAuthError(resp, http.StatusBadRequest, "unsupported_grant_type", "Use authorization_code or refresh_token.")
+		return
+	}
+
+	if err != nil {
+		cause := errgo.Cause(err)
+		if cause == service.OIDCDisabled || cause == service.AccessTokensDisabled {
+			httputil.WriteNotFound(resp)
+		} else if cause == service.InvalidOIDCClient {
+			if basicAuth {
+				resp.Header().Set("WWW-Authenticate", `Basic realm="userd"`)
+			}
+			h.writeOAuthError(resp, http.StatusUnauthorized, "invalid_client", cause.Error())
+		} else if cause == service.InvalidOIDCGrant || service.IsUserNotActiveError(cause) || service.IsNotFoundError(cause) {
+			h.writeOAuthError(resp, http.StatusBadRequest, "invalid_grant", cause.Error())
+		} else {
+			h.writeProcessingError(resp, err)
+		}
+		return
+	}
+
+	resp.Header().Set("Cache-Control", "no-store")
+	resp.Header().Set("Pragma", "no-cache")
+	httputil.WriteJSONResponse(resp, http.StatusOK, map[string]interface{}{
+		"access_token":  tokens.AccessToken,
+		"token_type":    "Bearer",
+		"expires_in":    int(tokens.Expires.Sub(time.Now()).Seconds()),
+		"id_token":      tokens.IDToken,
+		"refresh_token": tokens.RefreshToken,
+		"scope":         strings.Join(tokens.Scope, " "),
+	})
+}
+
+// --------------------------------------------------------------------------------------------
+
+type UserInfoHandler struct{ BaseHandler }
+
+func (h *UserInfoHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	accessToken := ""
+	if authorization := req.Header.Get("Authorization"); strings.HasPrefix(authorization, "Bearer ") {
+		accessToken = strings.TrimSpace(strings.TrimPrefix(authorization, "Bearer "))
+	}
+
+	claims, err := h.UserService.OIDCUserInfo(accessToken)
+	if err == service.OIDCDisabled || err == service.AccessTokensDisabled {
+		httputil.WriteNotFound(resp)
+	} else if err == service.InvalidOIDCToken {
+		resp.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		h.writeOAuthError(resp, http.StatusUnauthorized, "invalid_token", err.Error())
+	} else if err != nil {
+		h.writeProcessingError(resp, err)
+	} else {
+		resp.Header().Set("Cache-Control", "no-store")
+		httputil.WriteJSONResponse(resp, http.StatusOK, claims)
+	}
+}
@@ -0,0 +1,76 @@
+package oidc
+
+import (
+	"html/template"
+)
+
+// authorizationRequest contains the parameters of an authorization request, see OpenID Connect Core section 3.1.2.1.
+type authorizationRequest struct {
+	ResponseType        string
+	ClientID            string
+	RedirectURI         string
+	Scope               string
+	State               string
+	Nonce               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+}
+
+type page struct {
+	ClientName string
+	Request    authorizationRequest
+	CSRFToken  string
+
+	// Challenge is set if the user must enter a second factor.
+	Challenge string
+	Error     string
+}
+
+// pageTemplate is the minimal hosted login page. Without a Request it only shows the error.
+var pageTemplate = template.Must(template.New("login").Parse(`<!DOCTYPE html>
+<html>
+<head>
+	<meta charset="utf-8">
+	<meta name="viewport" content="width=device-width, initial-scale=1">
+	<title>Login</title>
+	<style>
+		body { font-family: sans-serif; max-width: 22em; margin: 4em auto; padding: 0 1em; }
+		label, input, button { display: block; width: 100%; box-sizing: border-box; }
+		input { margin: 0.25em 0 1em; padding: 0.5em; }
+		button { padding: 0.5em; }
+		.error { color: #b00; }
+	</style>
+</head>
+<body>
+{{if .Request.ClientID}}
+	<h1>Login to {{.ClientName}}</h1>
+	{{if .Error}}<p class="error">{{.Error}}</p>{{end}}
+	<form method="post" action="/oauth2/authorize">
+		<input type="hidden" name="response_type" value="{{.Request.ResponseType}}">
+		<input type="hidden" name="client_id" value="{{.Request.ClientID}}">
+		<input type="hidden" name="redirect_uri" value="{{.Request.RedirectURI}}">
+		<input type="hidden" name="scope" value="{{.Request.Scope}}">
+		<input type="hidden" name="state" value="{{.Request.State}}">
+		<input type="hidden" name="nonce" value="{{.Request.Nonce}}">
+		<input type="hidden" name="code_challenge" value="{{.Request.CodeChallenge}}">
+		<input type="hidden" name="code_challenge_method" value="{{.Request.CodeChallengeMethod}}">
+		<input type="hidden" name="csrf_token" value="{{.CSRFToken}}">
+	{{if .Challenge}}
+		<input type="hidden" name="challenge" value="{{.Challenge}}">
+		<label for="code">Code from your authenticator app, a recovery code or the code sent by email</label>
+		<input id="code" name="code" autocomplete="one-time-code" autofocus required>
+	{{else}}
+		<label for="login_name">Login name</label>
+		<input id="login_name" name="login_name" autocomplete="username" autofocus required>
+		<label for="password">Password</label>
+		<input id="password" name="password" type="password" autocomplete="current-password" required>
+	{{end}}
+		<button type="submit">Login</button>
+	</form>
+{{else}}
+	<h1>Login failed</h1>
+	<p class="error">{{.Error}}</p>
+{{end}}
+</body>
+</html>
+`))
@@ -3,20 +3,29 @@ package v1
 import (
 	httputil "../../http"
 	"../../service"
+	"../../service/audit"
+	"../../service/session"
 	"../../service/user"
+	"../../service/webauthn"
 
 	"github.com/gorilla/mux"
 	"github.com/juju/errgo"
 
+	"encoding/json"
 	"log"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 )
 
 var (
 	MaskError = errgo.MaskFunc(
 		service.IsServiceError,
-		service.IsNotFoundError, service.IsEmailAlreadyTakenError,
+		service.IsNotFoundError, service.IsGroupNotFoundError, service.IsEmailAlreadyTakenError, service.IsPhoneAlreadyTakenError,
 		service.IsLoginNameAlreadyTakenError, service.IsUserEmailMustBeVerifiedError,
+		service.IsUserNotActiveError, service.IsPasswordPolicyViolation, service.IsAttributeViolation,
+		service.IsSecondFactorRequired, service.IsWebAuthnCredentialAlreadyTakenError, service.IsTokenAlreadyTakenError,
 	)
 )
 
@@ -27,20 +36,81 @@ func NewUserAPIHandler(userService *service.UserService) http.Handler {
 	mux.Methods("POST").Path("/v1/user/create").Handler(&CreateUserHandler{base})
 	mux.Methods("GET").Path("/v1/user/get").Handler(&GetUserHandler{base})
 	mux.Methods("POST").Path("/v1/user/change_login_credentials").Handler(&ChangeLoginCredentialsHandler{base})
+	mux.Methods("POST").Path("/v1/user/change_password").Handler(&ChangePasswordHandler{base})
+	mux.Methods("POST").Path("/v1/user/change_login_name").Handler(&ChangeLoginNameHandler{base})
 	mux.Methods("POST").Path("/v1/user/change_email").Handler(&ChangeEmailHandler{base})
+	mux.Methods("POST").Path("/v1/user/confirm_email_change").Handler(&ConfirmEmailChangeHandler{base})
+	mux.Methods("POST").Path("/v1/user/cancel_email_change").Handler(&CancelEmailChangeHandler{base})
 	mux.Methods("POST").Path("/v1/user/change_profile_name").Handler(&ChangeProfileNameHandler{base})
+	mux.Methods("POST").Path("/v1/user/change_attributes").Handler(&ChangeAttributesHandler{base})
+	mux.Methods("GET").Path("/v1/user/public_attributes").Handler(&PublicAttributesHandler{base})
+	mux.Methods("GET").Path("/v1/user/history").Handler(&HistoryHandler{base})
+	mux.Methods("GET").Path("/v1/user/export").Handler(&ExportUserHandler{base})
 	mux.Methods("POST").Path("/v1/user/verify_email").Handler(&VerifyEmailHandler{base})
+	mux.Methods("POST").Path("/v1/user/new_email_verification_token").Handler(&NewEmailVerificationTokenHandler{base})
+	mux.Methods("POST").Path("/v1/user/verify_email_with_token").Handler(&VerifyEmailWithTokenHandler{base})
+	mux.Methods("POST").Path("/v1/user/add_email").Handler(&AddEmailHandler{base})
+	mux.Methods("POST").Path("/v1/user/remove_email").Handler(&EmailHandler{base, (*service.UserService).RemoveEmail})
+	mux.Methods("POST").Path("/v1/user/set_primary_email").Handler(&SetPrimaryEmailHandler{base})
+	mux.Methods("POST").Path("/v1/user/change_phone").Handler(&ChangePhoneHandler{base})
+	mux.Methods("POST").Path("/v1/user/verify_phone").Handler(&VerifyPhoneHandler{base})
+	mux.Methods("POST").Path("/v1/user/remove_phone").Handler(&RemovePhoneHandler{base})
+
+	mux.Methods("POST").Path("/v1/user/disable").Handler(&ChangeStatusHandler{base, (*service.UserService).DisableUser})
+	mux.Methods("POST").Path("/v1/user/lock").Handler(&ChangeStatusHandler{base, (*service.UserService).LockUser})
+	mux.Methods("POST").Path("/v1/user/enable").Handler(&ChangeStatusHandler{base, (*service.UserService).EnableUser})
+	mux.Methods("POST").Path("/v1/user/erase").Handler(&UserChangeHandler{base, (*service.UserService).EraseUser})
 
 	mux.Methods("POST").Path("/v1/user/authenticate").Handler(&AuthenticationHandler{base})
+	mux.Methods("POST").Path("/v1/user/complete_authentication").Handler(&CompleteAuthenticationHandler{base})
+	mux.Methods("POST").Path("/v1/user/new_login_link_token").Handler(&NewLoginLinkTokenHandler{base})
+	mux.Methods("POST").Path("/v1/user/authenticate_with_login_link").Handler(&LoginLinkAuthenticationHandler{base})
+
+	mux.Methods("POST").Path("/v1/user/enroll_totp").Handler(&EnrollTOTPHandler{base})
+	mux.Methods("POST").Path("/v1/user/confirm_totp").Handler(&ConfirmTOTPHandler{base})
+	mux.Methods("POST").Path("/v1/user/disable_totp").Handler(&DisableTOTPHandler{base})
+	mux.Methods("POST").Path("/v1/user/enable_email_otp").Handler(&UserChangeHandler{base, (*service.UserService).EnableEmailOTP})
+	mux.Methods("POST").Path("/v1/user/disable_email_otp").Handler(&DisableEmailOTPHandler{base})
+
+	mux.Methods("POST").Path("/v1/user/validate_session").Handler(&ValidateSessionHandler{base})
+	mux.Methods("POST").Path("/v1/user/refresh_session").Handler(&RefreshSessionHandler{base})
+	mux.Methods("POST").Path("/v1/user/revoke_session").Handler(&RevokeSessionHandler{base})
+	mux.Methods("GET").Path("/v1/user/sessions").Handler(&ListSessionsHandler{base})
+	mux.Methods("POST").Path("/v1/user/revoke_all_sessions").Handler(&RevokeAllSessionsHandler{base})
+
+	mux.Methods("POST").Path("/v1/user/set_token_claims").Handler(&SetTokenClaimsHandler{base})
+
+	mux.Methods("POST").Path("/v1/user/begin_webauthn_registration").Handler(&BeginWebAuthnRegistrationHandler{base})
+	mux.Methods("POST").Path("/v1/user/finish_webauthn_registration").Handler(&FinishWebAuthnRegistrationHandler{base})
+	mux.Methods("POST").Path("/v1/user/remove_webauthn_credential").Handler(&RemoveWebAuthnCredentialHandler{base})
+	mux.Methods("POST").Path("/v1/user/begin_webauthn_login").Handler(&BeginWebAuthnLoginHandler{base})
+	mux.Methods("POST").Path("/v1/user/finish_webauthn_login").Handler(&FinishWebAuthnLoginHandler{base})
 
 	mux.Methods("POST").Path("/v1/user/new_reset_login_credentials_token").Handler(&NewResetLoginCredentialsHandler{base})
 	mux.Methods("POST").Path("/v1/user/reset_login_credentials").Handler(&ResetCredentialsTokenHandler{base})
+	mux.Methods("POST").Path("/v1/user/reset_password").Handler(&ResetPasswordTokenHandler{base})
+	mux.Methods("POST").Path("/v1/user/new_phone_reset_code").Handler(&NewPhoneResetCodeHandler{base})
+	mux.Methods("POST").Path("/v1/user/exchange_phone_reset_code").Handler(&ExchangePhoneResetCodeHandler{base})
+
+	mux.Methods("GET").Path("/v1/user/groups").Handler(&UserGroupsHandler{base})
+	mux.Methods("GET").Path("/v1/user/has_permission").Handler(&HasPermissionHandler{base})
+	mux.Methods("POST").Path("/v1/group/create").Handler(&CreateGroupHandler{base})
+	mux.Methods("GET").Path("/v1/group/get").Handler(&GetGroupHandler{base})
+	mux.Methods("POST").Path("/v1/group/delete").Handler(&DeleteGroupHandler{base})
+	mux.Methods("POST").Path("/v1/group/set_permissions").Handler(&SetGroupPermissionsHandler{base})
+	mux.Methods("POST").Path("/v1/group/add_member").Handler(&GroupMemberHandler{base, (*service.UserService).AddGroupMember})
+	mux.Methods("POST").Path("/v1/group/remove_member").Handler(&GroupMemberHandler{base, (*service.UserService).RemoveGroupMember})
 
 	mux.Methods("GET").Path("/v1/feed").Handler(&FeedWriter{base})
 
 	return mux
 }
 
+// NewJWKSHandler publishes the public keys of the access tokens, to be mounted as /.well-known/jwks.json.
+func NewJWKSHandler(userService *service.UserService) http.Handler {
+	return &JWKSHandler{BaseHandler{userService}}
+}
+
 // --------------------------------------------------------------------------------------------
 
 type BaseHandler struct {
@@ -53,6 +123,12 @@ func (base *BaseHandler) writeProcessingError(resp http.ResponseWriter, err erro
 	log.Printf("Internal error: %#v\n", err)
 }
 
+// Service returns the UserService for the request. The optional headers X-Actor and X-Request-ID are recorded in the
+// change history of the users.
+func (base *BaseHandler) Service(req *http.Request) *service.UserService {
+	return base.UserService.WithOrigin(req.Header.Get("X-Actor"), req.Header.Get("X-Request-ID"))
+}
+
 func (base *BaseHandler) UserID(req *http.Request) (string, bool) {
 	userID := req.FormValue("id")
 	if userID == "" {
@@ -61,21 +137,117 @@ func (base *BaseHandler) UserID(req *http.Request) (string, bool) {
 	return userID, true
 }
 
+// CurrentPassword returns the optional current_password parameter, which must be given
+// for sensitive changes if userd runs with --require-current-password.
+func (base *BaseHandler) CurrentPassword(req *http.Request) (string, bool) {
+	currentPassword := req.FormValue("current_password")
+	if currentPassword == "" {
+		return "", false
+	}
+	return currentPassword, true
+}
+
+// writeAuthenticated responds with the ID of an authenticated user. With the parameter session=true a new session is
+// created, with access_token=true an access token is issued. Their tokens are returned as JSON instead, together with
+// the groups of the user. groups=true returns the JSON without any tokens.
+func (base *BaseHandler) writeAuthenticated(resp http.ResponseWriter, req *http.Request, userID string) {
+	withSession := req.FormValue("session") == "true"
+	if !withSession && req.FormValue("access_token") != "true" && req.FormValue("groups") != "true" {
+		resp.WriteHeader(http.StatusOK)
+		resp.Write([]byte(userID))
+		return
+	}
+
+	var tokens *service.SessionTokens
+	if withSession {
+		sessionTokens, err := base.Service(req).CreateSession(userID)
+		if err != nil {
+			base.handleProcessingError(resp, req, MaskError(err))
+			return
+		}
+		tokens = &sessionTokens
+	}
+	base.writeTokens(resp, req, userID, tokens)
+}
+
+// writeTokens responds with the groups of the user, the session tokens, if any, and a new access token if
+// access_token=true.
+func (base *BaseHandler) writeTokens(resp http.ResponseWriter, req *http.Request, userID string, tokens *service.SessionTokens) {
+	groups, err := base.Service(req).UserGroups(userID)
+	if err != nil {
+		base.handleProcessingError(resp, req, MaskError(err))
+		return
+	}
+
+	result := map[string]interface{}{
+		"user_id": userID,
+		"groups":  nonNil(groups),
+	}
+	if tokens != nil {
+		result["session_id"] = tokens.SessionID
+		result["token"] = tokens.Token
+		result["token_expires"] = tokens.TokenExpires
+		result["refresh_token"] = tokens.RefreshToken
+		result["refresh_token_expires"] = tokens.RefreshTokenExpires
+	}
+	if req.FormValue("access_token") == "true" {
+		accessToken, err := base.Service(req).IssueAccessToken(userID)
+		if err != nil {
+			base.handleProcessingError(resp, req, MaskError(err))
+			return
+		}
+		result["access_token"] = accessToken.Token
+		result["access_token_expires"] = accessToken.Expires
+	}
+	httputil.WriteJSONResponse(resp, http.StatusOK, result)
+}
+
 func (base *BaseHandler) handleProcessingError(resp http.ResponseWriter, req *http.Request, err error) {
 	err = errgo.Cause(err)
-	if service.IsNotFoundError(err) {
+	if required, ok := err.(*service.SecondFactorRequired); ok {
+		httputil.WriteJSONResponse(resp, http.StatusAccepted, map[string]interface{}{
+			"challenge": required.Challenge,
+			"methods":   required.Methods,
+		})
+	} else if violation, ok := err.(*service.PasswordPolicyViolation); ok {
+		httputil.WriteJSONResponse(resp, http.StatusBadRequest, map[string]interface{}{
+			"msg":   violation.Error(),
+			"rules": violation.Rules,
+		})
+	} else if violation, ok := err.(*service.AttributeViolation); ok {
+		httputil.WriteJSONResponse(resp, http.StatusBadRequest, map[string]interface{}{
+			"msg":        violation.Error(),
+			"attributes": violation.Violations,
+		})
+	} else if service.IsNotFoundError(err) || service.IsGroupNotFoundError(err) {
 		httputil.WriteNotFound(resp)
-	} else if service.IsEmailAlreadyTakenError(err) || service.IsLoginNameAlreadyTakenError(err) || service.IsServiceError(err) {
+	} else if service.IsEmailAlreadyTakenError(err) || service.IsPhoneAlreadyTakenError(err) || service.IsLoginNameAlreadyTakenError(err) || service.IsWebAuthnCredentialAlreadyTakenError(err) || service.IsServiceError(err) {
 		httputil.WriteBadRequest(resp, req, err.Error())
+	} else if service.IsTokenAlreadyTakenError(err) {
+		httputil.WriteJSONErrorPage(resp, http.StatusConflict, err.Error())
 	} else if err == service.InvalidCredentials {
 		httputil.WriteBadRequest(resp, req)
-	} else if service.IsUserEmailMustBeVerifiedError(err) {
+	} else if service.IsUserEmailMustBeVerifiedError(err) || service.IsUserNotActiveError(err) {
 		httputil.WriteBadRequest(resp, req, err.Error())
 	} else {
 		base.writeProcessingError(resp, err)
 	}
 }
 
+// mountPrefix returns the path prefix stripped before the request reached the API, e.g. "/realms/shop".
+func mountPrefix(req *http.Request) string {
+	requestPath := strings.SplitN(req.RequestURI, "?", 2)[0]
+	return strings.TrimSuffix(requestPath, req.URL.Path)
+}
+
+// nonNil returns an empty slice for nil, so it is written as [] instead of null.
+func nonNil(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
+
 // --------------------------------------------------------------------------------------------
 
 type CreateUserHandler struct {
@@ -89,12 +261,18 @@ func (h *CreateUserHandler) ServeHTTP(resp http.ResponseWriter, req *http.Reques
 	loginName := req.PostFormValue("login_name")
 	loginPassword := req.PostFormValue("login_password")
 
-	userID, err := h.UserService.CreateUser(profileName, email, loginName, loginPassword)
+	attributes, ok := attributesParameter(req)
+	if !ok {
+		httputil.WriteBadRequest(resp, req, "The attributes parameter must be a JSON object.")
+		return
+	}
+
+	userID, err := h.Service(req).CreateUserWithAttributes(profileName, email, loginName, loginPassword, attributes)
 
 	if err != nil {
 		h.handleProcessingError(resp, req, MaskError(err))
 	} else {
-		resp.Header().Add("location", "/v1/user/get?id="+userID)
+		resp.Header().Add("location", mountPrefix(req)+"/v1/user/get?id="+userID)
 		resp.WriteHeader(http.StatusCreated)
 		resp.Write([]byte(userID))
 	}
@@ -113,22 +291,52 @@ func (h *GetUserHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request)
 		return
 	}
 
-	user, err := h.UserService.GetUser(userId)
+	user, err := h.Service(req).GetUser(userId)
 	if err != nil {
 		h.handleProcessingError(resp, req, MaskError(err))
 	} else {
-		h.writeUser(resp, &user)
+		httputil.WriteJSONResponse(resp, http.StatusOK, userDocument(&user))
 	}
 }
 
-func (h *GetUserHandler) writeUser(resp http.ResponseWriter, theUser *user.User) {
+// userDocument contains the fields of the user returned by /get and /export.
+func userDocument(theUser *user.User) map[string]interface{} {
 	result := map[string]interface{}{}
 	result["profile_name"] = theUser.ProfileName
 	result["email"] = theUser.Email
 	result["login_name"] = theUser.LoginName
 	result["email_verified"] = theUser.EmailVerified
-
-	httputil.WriteJSONResponse(resp, http.StatusOK, result)
+	result["totp_enabled"] = theUser.TOTPEnabled
+	result["email_otp_enabled"] = theUser.EmailOTPEnabled
+	result["password_breached"] = theUser.PasswordBreached
+	result["pending_email"] = theUser.PendingEmail
+
+	secondaryEmails := make([]map[string]interface{}, 0, len(theUser.SecondaryEmails))
+	for _, address := range theUser.SecondaryEmails {
+		secondaryEmails = append(secondaryEmails, map[string]interface{}{
+			"email":    address.Email,
+			"verified": address.Verified,
+		})
+	}
+	result["secondary_emails"] = secondaryEmails
+	result["phone"] = theUser.Phone
+	result["phone_verified"] = theUser.PhoneVerified
+	result["status"] = theUser.AccountStatus()
+	result["status_reason"] = theUser.StatusReason
+	result["attributes"] = theUser.Attributes
+	result["groups"] = nonNil(theUser.Groups)
+
+	credentials := make([]map[string]interface{}, 0, len(theUser.WebAuthnCredentials))
+	for _, credential := range theUser.WebAuthnCredentials {
+		credentials = append(credentials, map[string]interface{}{
+			"id":        credential.ID,
+			"name":      credential.Name,
+			"created":   credential.Created,
+			"last_used": credential.LastUsed,
+		})
+	}
+	result["webauthn_credentials"] = credentials
+	return result
 }
 
 /// ----------------------------------------------
@@ -154,7 +362,14 @@ func (h *ChangeLoginCredentialsHandler) ServeHTTP(resp http.ResponseWriter, req
 		return
 	}
 
-	if err := h.UserService.ChangeLoginCredentials(userID, newLogin, newPassword); err != nil {
+	var err error
+	if currentPassword, ok := h.CurrentPassword(req); ok {
+		err = h.Service(req).ChangeLoginCredentialsWithCurrentPassword(userID, currentPassword, newLogin, newPassword)
+	} else {
+		err = h.Service(req).ChangeLoginCredentials(userID, newLogin, newPassword)
+	}
+
+	if err != nil {
 		h.handleProcessingError(resp, req, MaskError(err))
 	} else {
 		resp.WriteHeader(http.StatusNoContent)
@@ -163,6 +378,68 @@ func (h *ChangeLoginCredentialsHandler) ServeHTTP(resp http.ResponseWriter, req
 
 // -----------------------------------------------
 
+type ChangePasswordHandler struct{ BaseHandler }
+
+func (h *ChangePasswordHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	userID, ok := h.UserID(req)
+	if !ok {
+		httputil.WriteBadRequest(resp, req)
+		return
+	}
+
+	newPassword := req.FormValue("password")
+	if newPassword == "" {
+		httputil.WriteBadRequest(resp, req, "Parameter 'password' is required.")
+		return
+	}
+
+	var err error
+	if currentPassword, ok := h.CurrentPassword(req); ok {
+		err = h.Service(req).ChangePasswordWithCurrentPassword(userID, currentPassword, newPassword)
+	} else {
+		err = h.Service(req).ChangePassword(userID, newPassword)
+	}
+
+	if err != nil {
+		h.handleProcessingError(resp, req, MaskError(err))
+	} else {
+		httputil.WriteNoContent(resp)
+	}
+}
+
+// -----------------------------------------------
+
+type ChangeLoginNameHandler struct{ BaseHandler }
+
+func (h *ChangeLoginNameHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	userID, ok := h.UserID(req)
+	if !ok {
+		httputil.WriteBadRequest(resp, req)
+		return
+	}
+
+	newLogin := req.FormValue("name")
+	if newLogin == "" {
+		httputil.WriteBadRequest(resp, req, "Parameter 'name' is required.")
+		return
+	}
+
+	var err error
+	if currentPassword, ok := h.CurrentPassword(req); ok {
+		err = h.Service(req).ChangeLoginNameWithCurrentPassword(userID, currentPassword, newLogin)
+	} else {
+		err = h.Service(req).ChangeLoginName(userID, newLogin)
+	}
+
+	if err != nil {
+		h.handleProcessingError(resp, req, MaskError(err))
+	} else {
+		httputil.WriteNoContent(resp)
+	}
+}
+
+// -----------------------------------------------
+
 type ChangeProfileNameHandler struct{ BaseHandler }
 
 func (h *ChangeProfileNameHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
@@ -178,7 +455,7 @@ func (h *ChangeProfileNameHandler) ServeHTTP(resp http.ResponseWriter, req *http
 		return
 	}
 
-	if err := h.UserService.ChangeProfileName(userID, newProfileName); err != nil {
+	if err := h.Service(req).ChangeProfileName(userID, newProfileName); err != nil {
 		h.handleProcessingError(resp, req, MaskError(err))
 	} else {
 		httputil.WriteNoContent(resp)
@@ -202,10 +479,49 @@ func (h *ChangeEmailHandler) ServeHTTP(resp http.ResponseWriter, req *http.Reque
 		return
 	}
 
-	if err := h.UserService.ChangeEmail(userID, newEmail); err != nil {
+	var token, cancelToken string
+	var err error
+	if currentPassword, ok := h.CurrentPassword(req); ok {
+		token, cancelToken, err = h.Service(req).ChangeEmailWithCurrentPassword(userID, currentPassword, newEmail)
+	} else {
+		token, cancelToken, err = h.Service(req).ChangeEmail(userID, newEmail)
+	}
+
+	if err != nil {
 		h.handleProcessingError(resp, req, MaskError(err))
 	} else {
-		resp.WriteHeader(http.StatusNoContent)
+		httputil.WriteJSONResponse(resp, http.StatusOK, map[string]interface{}{
+			"token":        token,
+			"cancel_token": cancelToken,
+		})
+	}
+}
+
+// -----------------------------------------------
+
+type ConfirmEmailChangeHandler struct{ BaseHandler }
+
+func (h *ConfirmEmailChangeHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	token := req.FormValue("token")
+
+	if _, err := h.Service(req).ConfirmEmailChange(token); err != nil {
+		h.handleProcessingError(resp, req, MaskError(err))
+	} else {
+		httputil.WriteNoContent(resp)
+	}
+}
+
+// -----------------------------------------------
+
+type CancelEmailChangeHandler struct{ BaseHandler }
+
+func (h *CancelEmailChangeHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	token := req.FormValue("token")
+
+	if _, err := h.Service(req).CancelEmailChange(token); err != nil {
+		h.handleProcessingError(resp, req, MaskError(err))
+	} else {
+		httputil.WriteNoContent(resp)
 	}
 }
 
@@ -222,86 +538,1030 @@ func (h *AuthenticationHandler) ServeHTTP(resp http.ResponseWriter, req *http.Re
 		return
 	}
 
-	userID, err := h.UserService.Authenticate(loginName, loginPassword)
+	userID, err := h.Service(req).Authenticate(loginName, loginPassword)
 	if err != nil {
 		h.handleProcessingError(resp, req, MaskError(err))
 	} else {
-		resp.WriteHeader(http.StatusOK)
-		resp.Write([]byte(userID))
+		h.writeAuthenticated(resp, req, userID)
 	}
 }
 
 // ----------------------------------------------
-type VerifyEmailHandler struct{ BaseHandler }
+type CompleteAuthenticationHandler struct{ BaseHandler }
 
-func (h *VerifyEmailHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
-	userID, ok := h.UserID(req)
-	if !ok {
-		httputil.WriteBadRequest(resp, req, "No id parameter given.")
+func (h *CompleteAuthenticationHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	challenge := req.PostFormValue("challenge")
+	code := req.PostFormValue("code")
+
+	if challenge == "" || code == "" {
+		httputil.WriteBadRequest(resp, req)
 		return
 	}
 
-	email, emailGiven := h.Email(req)
+	userID, err := h.Service(req).CompleteAuthentication(challenge, code)
+	if err != nil {
+		h.handleProcessingError(resp, req, MaskError(err))
+	} else {
+		h.writeAuthenticated(resp, req, userID)
+	}
+}
 
-	var err error
-	if emailGiven {
-		err = h.UserService.CheckAndSetEmailVerified(userID, email)
+// ----------------------------------------------
+type NewLoginLinkTokenHandler struct{ BaseHandler }
+
+func (h *NewLoginLinkTokenHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	token, err := h.Service(req).NewLoginLinkToken(req.PostFormValue("email"))
+	if err != nil {
+		h.handleProcessingError(resp, req, MaskError(err))
 	} else {
-		err = h.UserService.SetEmailVerified(userID)
+		httputil.WriteJSONResponse(resp, http.StatusOK, map[string]interface{}{
+			"token": token,
+		})
+	}
+}
+
+// ----------------------------------------------
+type LoginLinkAuthenticationHandler struct{ BaseHandler }
+
+func (h *LoginLinkAuthenticationHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	token := req.PostFormValue("token")
+	if token == "" {
+		httputil.WriteBadRequest(resp, req)
+		return
 	}
 
+	userID, err := h.Service(req).AuthenticateWithLoginLinkToken(token)
 	if err != nil {
 		h.handleProcessingError(resp, req, MaskError(err))
 	} else {
-		resp.WriteHeader(http.StatusNoContent)
+		h.writeAuthenticated(resp, req, userID)
 	}
 }
 
-func (h *VerifyEmailHandler) Email(req *http.Request) (string, bool) {
-	email, ok := req.Form["email"]
-	if !ok || len(email) == 0 || email[0] == "" {
-		return "", false
+// ----------------------------------------------
+type EnrollTOTPHandler struct{ BaseHandler }
+
+func (h *EnrollTOTPHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	userID, ok := h.UserID(req)
+	if !ok {
+		httputil.WriteBadRequest(resp, req, "No id parameter given.")
+		return
+	}
+
+	secret, uri, err := h.Service(req).EnrollTOTP(userID)
+	if err != nil {
+		h.handleProcessingError(resp, req, MaskError(err))
+	} else {
+		httputil.WriteJSONResponse(resp, http.StatusOK, map[string]interface{}{
+			"secret": secret,
+			"uri":    uri,
+		})
 	}
-	return email[0], true
 }
 
 // ----------------------------------------------
-type NewResetLoginCredentialsHandler struct{ BaseHandler }
+type ConfirmTOTPHandler struct{ BaseHandler }
 
-func (r *NewResetLoginCredentialsHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
-	email := req.FormValue("email")
+func (h *ConfirmTOTPHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	userID, ok := h.UserID(req)
+	if !ok {
+		httputil.WriteBadRequest(resp, req, "No id parameter given.")
+		return
+	}
 
-	token, err := r.UserService.NewResetLoginCredentialsToken(email)
+	code := req.FormValue("code")
+
+	recoveryCodes, err := h.Service(req).ConfirmTOTP(userID, code)
 	if err != nil {
-		r.handleProcessingError(resp, req, err)
+		h.handleProcessingError(resp, req, MaskError(err))
 	} else {
 		httputil.WriteJSONResponse(resp, http.StatusOK, map[string]interface{}{
-			"token": token,
+			"recovery_codes": recoveryCodes,
 		})
 	}
 }
 
 // ----------------------------------------------
-type ResetCredentialsTokenHandler struct{ BaseHandler }
+type DisableTOTPHandler struct{ BaseHandler }
 
-func (r *ResetCredentialsTokenHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
-	token := req.FormValue("token")
-	login_name := req.FormValue("login_name")
-	login_password := req.FormValue("login_password")
+func (h *DisableTOTPHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	userID, ok := h.UserID(req)
+	if !ok {
+		httputil.WriteBadRequest(resp, req, "No id parameter given.")
+		return
+	}
+
+	var err error
+	if currentPassword, ok := h.CurrentPassword(req); ok {
+		err = h.Service(req).DisableTOTPWithCurrentPassword(userID, currentPassword)
+	} else {
+		err = h.Service(req).DisableTOTP(userID)
+	}
 
-	token, err := r.UserService.ResetCredentialsWithToken(token, login_name, login_password)
 	if err != nil {
-		r.handleProcessingError(resp, req, err)
+		h.handleProcessingError(resp, req, MaskError(err))
+	} else {
+		httputil.WriteNoContent(resp)
+	}
+}
+
+// ----------------------------------------------
+type DisableEmailOTPHandler struct{ BaseHandler }
+
+func (h *DisableEmailOTPHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	userID, ok := h.UserID(req)
+	if !ok {
+		httputil.WriteBadRequest(resp, req, "No id parameter given.")
+		return
+	}
+
+	var err error
+	if currentPassword, ok := h.CurrentPassword(req); ok {
+		err = h.Service(req).DisableEmailOTPWithCurrentPassword(userID, currentPassword)
+	} else {
+		err = h.Service(req).DisableEmailOTP(userID)
+	}
+
+	if err != nil {
+		h.handleProcessingError(resp, req, MaskError(err))
+	} else {
+		httputil.WriteNoContent(resp)
+	}
+}
+
+// ----------------------------------------------
+type UserChangeHandler struct {
+	BaseHandler
+	Change func(us *service.UserService, userID string) error
+}
+
+func (h *UserChangeHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	userID, ok := h.UserID(req)
+	if !ok {
+		httputil.WriteBadRequest(resp, req, "No id parameter given.")
+		return
+	}
+
+	if err := h.Change(h.Service(req), userID); err != nil {
+		h.handleProcessingError(resp, req, MaskError(err))
 	} else {
 		httputil.WriteNoContent(resp)
 	}
 }
 
+// ----------------------------------------------
+type ValidateSessionHandler struct{ BaseHandler }
+
+func (h *ValidateSessionHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	token := req.PostFormValue("token")
+	if token == "" {
+		httputil.WriteBadRequest(resp, req)
+		return
+	}
+
+	theSession, err := h.Service(req).ValidateSession(token)
+	if err != nil {
+		h.handleProcessingError(resp, req, MaskError(err))
+	} else {
+		httputil.WriteJSONResponse(resp, http.StatusOK, map[string]interface{}{
+			"user_id":       theSession.UserID,
+			"session_id":    theSession.ID,
+			"token_expires": theSession.TokenExpires,
+		})
+	}
+}
+
+// ----------------------------------------------
+type RefreshSessionHandler struct{ BaseHandler }
+
+func (h *RefreshSessionHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	refreshToken := req.PostFormValue("refresh_token")
+	if refreshToken == "" {
+		httputil.WriteBadRequest(resp, req)
+		return
+	}
+
+	tokens, err := h.Service(req).RefreshSession(refreshToken)
+	if err != nil {
+		h.handleProcessingError(resp, req, MaskError(err))
+	} else {
+		h.writeTokens(resp, req, tokens.UserID, &tokens)
+	}
+}
+
+// ----------------------------------------------
+type RevokeSessionHandler struct{ BaseHandler }
+
+func (h *RevokeSessionHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	sessionID := req.FormValue("session_id")
+	if sessionID == "" {
+		httputil.WriteBadRequest(resp, req, "No session_id parameter given.")
+		return
+	}
+
+	if err := h.Service(req).RevokeSession(sessionID); err != nil {
+		h.handleProcessingError(resp, req, MaskError(err))
+	} else {
+		httputil.WriteNoContent(resp)
+	}
+}
+
+// ----------------------------------------------
+type ListSessionsHandler struct{ BaseHandler }
+
+func (h *ListSessionsHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	userID, ok := h.UserID(req)
+	if !ok {
+		httputil.WriteBadRequest(resp, req, "No id parameter given.")
+		return
+	}
+
+	sessions, err := h.Service(req).ListSessions(userID)
+	if err != nil {
+		h.handleProcessingError(resp, req, MaskError(err))
+		return
+	}
+
+	httputil.WriteJSONResponse(resp, http.StatusOK, map[string]interface{}{
+		"sessions": sessionsDocument(sessions),
+	})
+}
+
+func sessionsDocument(sessions []session.Session) []map[string]interface{} {
+	result := make([]map[string]interface{}, 0, len(sessions))
+	for _, theSession := range sessions {
+		result = append(result, map[string]interface{}{
+			"session_id": theSession.ID,
+			"created":    theSession.Created,
+			"refreshed":  theSession.Refreshed,
+			"expires":    theSession.Expires,
+		})
+	}
+	return result
+}
+
+// ----------------------------------------------
+type RevokeAllSessionsHandler struct{ BaseHandler }
+
+func (h *RevokeAllSessionsHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	userID, ok := h.UserID(req)
+	if !ok {
+		httputil.WriteBadRequest(resp, req, "No id parameter given.")
+		return
+	}
+
+	count, err := h.Service(req).RevokeAllSessions(userID)
+	if err != nil {
+		h.handleProcessingError(resp, req, MaskError(err))
+	} else {
+		httputil.WriteJSONResponse(resp, http.StatusOK, map[string]interface{}{
+			"revoked": count,
+		})
+	}
+}
+
+// ----------------------------------------------
+type ChangeAttributesHandler struct{ BaseHandler }
+
+func (h *ChangeAttributesHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	userID, ok := h.UserID(req)
+	if !ok {
+		httputil.WriteBadRequest(resp, req, "No id parameter given.")
+		return
+	}
+
+	attributes, ok := attributesParameter(req)
+	if !ok || len(attributes) == 0 {
+		httputil.WriteBadRequest(resp, req, "The attributes parameter must be a non-empty JSON object.")
+		return
+	}
+
+	if err := h.Service(req).ChangeAttributes(userID, attributes); err != nil {
+		h.handleProcessingError(resp, req, MaskError(err))
+	} else {
+		httputil.WriteNoContent(resp)
+	}
+}
+
+// ----------------------------------------------
+type PublicAttributesHandler struct{ BaseHandler }
+
+func (h *PublicAttributesHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	userID, ok := h.UserID(req)
+	if !ok {
+		httputil.WriteBadRequest(resp, req, "No id parameter given.")
+		return
+	}
+
+	attributes, err := h.Service(req).GetPublicAttributes(userID)
+	if err != nil {
+		h.handleProcessingError(resp, req, MaskError(err))
+	} else {
+		httputil.WriteJSONResponse(resp, http.StatusOK, attributes)
+	}
+}
+
+// attributesParameter decodes the optional attributes parameter, a JSON object.
+func attributesParameter(req *http.Request) (map[string]interface{}, bool) {
+	var attributes map[string]interface{}
+	if value := req.PostFormValue("attributes"); value != "" {
+		if err := json.Unmarshal([]byte(value), &attributes); err != nil {
+			return nil, false
+		}
+	}
+	return attributes, true
+}
+
+// ----------------------------------------------
+type HistoryHandler struct{ BaseHandler }
+
+// defaultHistoryLimit is the number of entries returned without a limit parameter.
+const defaultHistoryLimit = 50
+
+func (h *HistoryHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	userID, ok := h.UserID(req)
+	if !ok {
+		httputil.WriteBadRequest(resp, req, "No id parameter given.")
+		return
+	}
+
+	offset, okOffset := intParameter(req, "offset", 0)
+	limit, okLimit := intParameter(req, "limit", defaultHistoryLimit)
+	if !okOffset || !okLimit {
+		httputil.WriteBadRequest(resp, req, "Invalid offset or limit parameter.")
+		return
+	}
+
+	entries, total, err := h.Service(req).UserHistory(userID, offset, limit)
+	if err != nil {
+		h.handleProcessingError(resp, req, MaskError(err))
+		return
+	}
+
+	httputil.WriteJSONResponse(resp, http.StatusOK, map[string]interface{}{
+		"entries": historyDocument(entries),
+		"total":   total,
+	})
+}
+
+func historyDocument(entries []audit.Entry) []map[string]interface{} {
+	result := make([]map[string]interface{}, 0, len(entries))
+	for _, entry := range entries {
+		result = append(result, map[string]interface{}{
+			"tag":        entry.Tag,
+			"timestamp":  entry.Timestamp,
+			"actor":      entry.Actor,
+			"request_id": entry.RequestID,
+			"fields":     nonNil(entry.Fields),
+		})
+	}
+	return result
+}
+
+// intParameter returns the value of an optional integer parameter.
+func intParameter(req *http.Request, name string, defaultValue int) (int, bool) {
+	value := req.FormValue(name)
+	if value == "" {
+		return defaultValue, true
+	}
+	number, err := strconv.Atoi(value)
+	return number, err == nil
+}
+
+// ----------------------------------------------
+type ExportUserHandler struct{ BaseHandler }
+
+func (h *ExportUserHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	userID, ok := h.UserID(req)
+	if !ok {
+		httputil.WriteBadRequest(resp, req, "No id parameter given.")
+		return
+	}
+
+	export, err := h.Service(req).ExportUser(userID)
+	if err != nil {
+		h.handleProcessingError(resp, req, MaskError(err))
+		return
+	}
+
+	theUser := userDocument(&export.User)
+	theUser["token_claims"] = export.User.TokenClaims
+	httputil.WriteJSONResponse(resp, http.StatusOK, map[string]interface{}{
+		"user_id":  userID,
+		"exported": export.Exported,
+		"user":     theUser,
+		"history":  historyDocument(export.History),
+		"sessions": sessionsDocument(export.Sessions),
+	})
+}
+
+// ----------------------------------------------
+type SetTokenClaimsHandler struct{ BaseHandler }
+
+func (h *SetTokenClaimsHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	userID, ok := h.UserID(req)
+	if !ok {
+		httputil.WriteBadRequest(resp, req, "No id parameter given.")
+		return
+	}
+
+	var claims map[string]interface{}
+	if value := req.PostFormValue("claims"); value != "" {
+		if err := json.Unmarshal([]byte(value), &claims); err != nil {
+			httputil.WriteBadRequest(resp, req, "The claims parameter must be a JSON object.")
+			return
+		}
+	}
+
+	if err := h.Service(req).SetTokenClaims(userID, claims); err != nil {
+		h.handleProcessingError(resp, req, MaskError(err))
+	} else {
+		httputil.WriteNoContent(resp)
+	}
+}
+
+// ----------------------------------------------
+type UserGroupsHandler struct{ BaseHandler }
+
+func (h *UserGroupsHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	userID, ok := h.UserID(req)
+	if !ok {
+		httputil.WriteBadRequest(resp, req, "No id parameter given.")
+		return
+	}
+
+	groups, err := h.Service(req).UserGroups(userID)
+	if err != nil {
+		h.handleProcessingError(resp, req, MaskError(err))
+	} else {
+		httputil.WriteJSONResponse(resp, http.StatusOK, map[string]interface{}{
+			"groups": nonNil(groups),
+		})
+	}
+}
+
+// ----------------------------------------------
+type HasPermissionHandler struct{ BaseHandler }
+
+func (h *HasPermissionHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	userID, ok := h.UserID(req)
+	if !ok {
+		httputil.WriteBadRequest(resp, req, "No id parameter given.")
+		return
+	}
+
+	granted, err := h.Service(req).HasPermission(userID, req.FormValue("permission"))
+	if err != nil {
+		h.handleProcessingError(resp, req, MaskError(err))
+	} else {
+		httputil.WriteJSONResponse(resp, http.StatusOK, map[string]interface{}{
+			"granted": granted,
+		})
+	}
+}
+
+// ----------------------------------------------
+type CreateGroupHandler struct{ BaseHandler }
+
+func (h *CreateGroupHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	permissions, ok := permissionsParameter(req)
+	if !ok {
+		httputil.WriteBadRequest(resp, req, "The permissions parameter must be a JSON array of strings.")
+		return
+	}
+
+	name := req.FormValue("name")
+	if err := h.Service(req).CreateGroup(name, req.FormValue("description"), permissions); err != nil {
+		h.handleProcessingError(resp, req, MaskError(err))
+	} else {
+		resp.Header().Add("location", mountPrefix(req)+"/v1/group/get?name="+url.QueryEscape(name))
+		resp.WriteHeader(http.StatusCreated)
+	}
+}
+
+// ----------------------------------------------
+type GetGroupHandler struct{ BaseHandler }
+
+func (h *GetGroupHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	theGroup, err := h.Service(req).GetGroup(req.FormValue("name"))
+	if err != nil {
+		h.handleProcessingError(resp, req, MaskError(err))
+		return
+	}
+
+	httputil.WriteJSONResponse(resp, http.StatusOK, map[string]interface{}{
+		"name":        theGroup.Name,
+		"description": theGroup.Description,
+		"permissions": nonNil(theGroup.Permissions),
+		"members":     nonNil(theGroup.Members),
+		"created":     theGroup.Created,
+	})
+}
+
+// ----------------------------------------------
+type DeleteGroupHandler struct{ BaseHandler }
+
+func (h *DeleteGroupHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	if err := h.Service(req).DeleteGroup(req.FormValue("name")); err != nil {
+		h.handleProcessingError(resp, req, MaskError(err))
+	} else {
+		httputil.WriteNoContent(resp)
+	}
+}
+
+// ----------------------------------------------
+type SetGroupPermissionsHandler struct{ BaseHandler }
+
+func (h *SetGroupPermissionsHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	permissions, ok := permissionsParameter(req)
+	if !ok {
+		httputil.WriteBadRequest(resp, req, "The permissions parameter must be a JSON array of strings.")
+		return
+	}
+
+	if err := h.Service(req).SetGroupPermissions(req.FormValue("name"), permissions); err != nil {
+		h.handleProcessingError(resp, req, MaskError(err))
+	} else {
+		httputil.WriteNoContent(resp)
+	}
+}
+
+// ----------------------------------------------
+type GroupMemberHandler struct {
+	BaseHandler
+	Change func(us *service.UserService, name, userID string) error
+}
+
+func (h *GroupMemberHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	userID, ok := h.UserID(req)
+	if !ok {
+		httputil.WriteBadRequest(resp, req, "No id parameter given.")
+		return
+	}
+
+	if err := h.Change(h.Service(req), req.FormValue("name"), userID); err != nil {
+		h.handleProcessingError(resp, req, MaskError(err))
+	} else {
+		httputil.WriteNoContent(resp)
+	}
+}
+
+// permissionsParameter decodes the optional permissions parameter, a JSON array of strings.
+func permissionsParameter(req *http.Request) ([]string, bool) {
+	var permissions []string
+	if value := req.PostFormValue("permissions"); value != "" {
+		if err := json.Unmarshal([]byte(value), &permissions); err != nil {
+			return nil, false
+		}
+	}
+	return permissions, true
+}
+
+// ----------------------------------------------
+type BeginWebAuthnRegistrationHandler struct{ BaseHandler }
+
+func (h *BeginWebAuthnRegistrationHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	userID, ok := h.UserID(req)
+	if !ok {
+		httputil.WriteBadRequest(resp, req, "No id parameter given.")
+		return
+	}
+
+	var options webauthn.CreationOptions
+	var err error
+	if currentPassword, ok := h.CurrentPassword(req); ok {
+		options, err = h.Service(req).BeginWebAuthnRegistrationWithCurrentPassword(userID, currentPassword)
+	} else {
+		options, err = h.Service(req).BeginWebAuthnRegistration(userID)
+	}
+
+	if err != nil {
+		h.handleProcessingError(resp, req, MaskError(err))
+	} else {
+		httputil.WriteJSONResponse(resp, http.StatusOK, map[string]interface{}{
+			"publicKey": options,
+		})
+	}
+}
+
+// ----------------------------------------------
+type FinishWebAuthnRegistrationHandler struct{ BaseHandler }
+
+func (h *FinishWebAuthnRegistrationHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	userID, ok := h.UserID(req)
+	if !ok {
+		httputil.WriteBadRequest(resp, req, "No id parameter given.")
+		return
+	}
+
+	name := req.FormValue("name")
+	clientDataJSON := req.FormValue("client_data_json")
+	attestationObject := req.FormValue("attestation_object")
+
+	var credentialID string
+	var err error
+	if currentPassword, ok := h.CurrentPassword(req); ok {
+		credentialID, err = h.Service(req).FinishWebAuthnRegistrationWithCurrentPassword(userID, currentPassword, name, clientDataJSON, attestationObject)
+	} else {
+		credentialID, err = h.Service(req).FinishWebAuthnRegistration(userID, name, clientDataJSON, attestationObject)
+	}
+
+	if err != nil {
+		h.handleProcessingError(resp, req, MaskError(err))
+	} else {
+		httputil.WriteJSONResponse(resp, http.StatusOK, map[string]interface{}{
+			"credential_id": credentialID,
+		})
+	}
+}
+
+// ----------------------------------------------
+type RemoveWebAuthnCredentialHandler struct{ BaseHandler }
+
+func (h *RemoveWebAuthnCredentialHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	userID, ok := h.UserID(req)
+	if !ok {
+		httputil.WriteBadRequest(resp, req, "No id parameter given.")
+		return
+	}
+
+	credentialID := req.FormValue("credential_id")
+
+	var err error
+	if currentPassword, ok := h.CurrentPassword(req); ok {
+		err = h.Service(req).RemoveWebAuthnCredentialWithCurrentPassword(userID, currentPassword, credentialID)
+	} else {
+		err = h.Service(req).RemoveWebAuthnCredential(userID, credentialID)
+	}
+
+	if err != nil {
+		h.handleProcessingError(resp, req, MaskError(err))
+	} else {
+		httputil.WriteNoContent(resp)
+	}
+}
+
+// ----------------------------------------------
+type BeginWebAuthnLoginHandler struct{ BaseHandler }
+
+func (h *BeginWebAuthnLoginHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	loginName := req.PostFormValue("name")
+	if loginName == "" {
+		httputil.WriteBadRequest(resp, req)
+		return
+	}
+
+	options, err := h.Service(req).BeginWebAuthnLogin(loginName)
+	if err != nil {
+		h.handleProcessingError(resp, req, MaskError(err))
+	} else {
+		httputil.WriteJSONResponse(resp, http.StatusOK, map[string]interface{}{
+			"publicKey": options,
+		})
+	}
+}
+
+// ----------------------------------------------
+type FinishWebAuthnLoginHandler struct{ BaseHandler }
+
+func (h *FinishWebAuthnLoginHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	credentialID := req.PostFormValue("credential_id")
+	clientDataJSON := req.PostFormValue("client_data_json")
+	authenticatorData := req.PostFormValue("authenticator_data")
+	signature := req.PostFormValue("signature")
+
+	if credentialID == "" || clientDataJSON == "" || authenticatorData == "" || signature == "" {
+		httputil.WriteBadRequest(resp, req)
+		return
+	}
+
+	userID, err := h.Service(req).FinishWebAuthnLogin(credentialID, clientDataJSON, authenticatorData, signature)
+	if err != nil {
+		h.handleProcessingError(resp, req, MaskError(err))
+	} else {
+		h.writeAuthenticated(resp, req, userID)
+	}
+}
+
+// ----------------------------------------------
+
+// ChangeStatusHandler calls Change with the id and reason parameters, e.g. UserService.DisableUser.
+type ChangeStatusHandler struct {
+	BaseHandler
+	Change func(us *service.UserService, userID, reason string) error
+}
+
+func (h *ChangeStatusHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	userID, ok := h.UserID(req)
+	if !ok {
+		httputil.WriteBadRequest(resp, req, "No id parameter given.")
+		return
+	}
+
+	reason := req.FormValue("reason")
+
+	if err := h.Change(h.Service(req), userID, reason); err != nil {
+		h.handleProcessingError(resp, req, MaskError(err))
+	} else {
+		httputil.WriteNoContent(resp)
+	}
+}
+
+// ----------------------------------------------
+type VerifyEmailHandler struct{ BaseHandler }
+
+func (h *VerifyEmailHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	userID, ok := h.UserID(req)
+	if !ok {
+		httputil.WriteBadRequest(resp, req, "No id parameter given.")
+		return
+	}
+
+	email, emailGiven := h.Email(req)
+
+	var err error
+	if emailGiven {
+		err = h.Service(req).CheckAndSetEmailVerified(userID, email)
+	} else {
+		err = h.Service(req).SetEmailVerified(userID)
+	}
+
+	if err != nil {
+		h.handleProcessingError(resp, req, MaskError(err))
+	} else {
+		resp.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (h *VerifyEmailHandler) Email(req *http.Request) (string, bool) {
+	email, ok := req.Form["email"]
+	if !ok || len(email) == 0 || email[0] == "" {
+		return "", false
+	}
+	return email[0], true
+}
+
+// ----------------------------------------------
+type NewEmailVerificationTokenHandler struct{ BaseHandler }
+
+func (h *NewEmailVerificationTokenHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	userID, ok := h.UserID(req)
+	if !ok {
+		httputil.WriteBadRequest(resp, req, "No id parameter given.")
+		return
+	}
+
+	token, err := h.Service(req).NewEmailVerificationToken(userID)
+	if err != nil {
+		h.handleProcessingError(resp, req, MaskError(err))
+	} else {
+		httputil.WriteJSONResponse(resp, http.StatusOK, map[string]interface{}{
+			"token": token,
+		})
+	}
+}
+
+// ----------------------------------------------
+type VerifyEmailWithTokenHandler struct{ BaseHandler }
+
+func (h *VerifyEmailWithTokenHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	token := req.FormValue("token")
+
+	if _, err := h.Service(req).VerifyEmailWithToken(token); err != nil {
+		h.handleProcessingError(resp, req, MaskError(err))
+	} else {
+		httputil.WriteNoContent(resp)
+	}
+}
+
+// ----------------------------------------------
+type AddEmailHandler struct{ BaseHandler }
+
+func (h *AddEmailHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	userID, ok := h.UserID(req)
+	if !ok {
+		httputil.WriteBadRequest(resp, req, "No id parameter given.")
+		return
+	}
+
+	var token string
+	var err error
+	if currentPassword, ok := h.CurrentPassword(req); ok {
+		token, err = h.Service(req).AddEmailWithCurrentPassword(userID, currentPassword, req.FormValue("email"))
+	} else {
+		token, err = h.Service(req).AddEmail(userID, req.FormValue("email"))
+	}
+
+	if err != nil {
+		h.handleProcessingError(resp, req, MaskError(err))
+	} else {
+		httputil.WriteJSONResponse(resp, http.StatusOK, map[string]interface{}{
+			"token": token,
+		})
+	}
+}
+
+// ----------------------------------------------
+type EmailHandler struct {
+	BaseHandler
+	Change func(us *service.UserService, userID, email string) error
+}
+
+func (h *EmailHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	userID, ok := h.UserID(req)
+	if !ok {
+		httputil.WriteBadRequest(resp, req, "No id parameter given.")
+		return
+	}
+
+	if err := h.Change(h.Service(req), userID, req.FormValue("email")); err != nil {
+		h.handleProcessingError(resp, req, MaskError(err))
+	} else {
+		httputil.WriteNoContent(resp)
+	}
+}
+
+// ----------------------------------------------
+type SetPrimaryEmailHandler struct{ BaseHandler }
+
+func (h *SetPrimaryEmailHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	userID, ok := h.UserID(req)
+	if !ok {
+		httputil.WriteBadRequest(resp, req, "No id parameter given.")
+		return
+	}
+
+	var err error
+	if currentPassword, ok := h.CurrentPassword(req); ok {
+		err = h.Service(req).SetPrimaryEmailWithCurrentPassword(userID, currentPassword, req.FormValue("email"))
+	} else {
+		err = h.Service(req).SetPrimaryEmail(userID, req.FormValue("email"))
+	}
+
+	if err != nil {
+		h.handleProcessingError(resp, req, MaskError(err))
+	} else {
+		httputil.WriteNoContent(resp)
+	}
+}
+
+// ----------------------------------------------
+type ChangePhoneHandler struct{ BaseHandler }
+
+func (h *ChangePhoneHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	userID, ok := h.UserID(req)
+	if !ok {
+		httputil.WriteBadRequest(resp, req, "No id parameter given.")
+		return
+	}
+
+	var code string
+	var err error
+	if currentPassword, ok := h.CurrentPassword(req); ok {
+		code, err = h.Service(req).ChangePhoneWithCurrentPassword(userID, currentPassword, req.FormValue("phone"))
+	} else {
+		code, err = h.Service(req).ChangePhone(userID, req.FormValue("phone"))
+	}
+
+	if err != nil {
+		h.handleProcessingError(resp, req, MaskError(err))
+	} else {
+		httputil.WriteJSONResponse(resp, http.StatusOK, map[string]interface{}{
+			"code": code,
+		})
+	}
+}
+
+// ----------------------------------------------
+type VerifyPhoneHandler struct{ BaseHandler }
+
+func (h *VerifyPhoneHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	userID, ok := h.UserID(req)
+	if !ok {
+		httputil.WriteBadRequest(resp, req, "No id parameter given.")
+		return
+	}
+
+	if err := h.Service(req).VerifyPhone(userID, req.FormValue("code")); err != nil {
+		h.handleProcessingError(resp, req, MaskError(err))
+	} else {
+		httputil.WriteNoContent(resp)
+	}
+}
+
+// ----------------------------------------------
+type RemovePhoneHandler struct{ BaseHandler }
+
+func (h *RemovePhoneHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	userID, ok := h.UserID(req)
+	if !ok {
+		httputil.WriteBadRequest(resp, req, "No id parameter given.")
+		return
+	}
+
+	if err := h.Service(req).RemovePhone(userID); err != nil {
+		h.handleProcessingError(resp, req, MaskError(err))
+	} else {
+		httputil.WriteNoContent(resp)
+	}
+}
+
+// ----------------------------------------------
+type NewResetLoginCredentialsHandler struct{ BaseHandler }
+
+func (r *NewResetLoginCredentialsHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	email := req.FormValue("email")
+
+	token, err := r.Service(req).NewResetLoginCredentialsToken(email)
+	if err != nil {
+		r.handleProcessingError(resp, req, err)
+	} else {
+		httputil.WriteJSONResponse(resp, http.StatusOK, map[string]interface{}{
+			"token": token,
+		})
+	}
+}
+
+// ----------------------------------------------
+type ResetCredentialsTokenHandler struct{ BaseHandler }
+
+func (r *ResetCredentialsTokenHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	token := req.FormValue("token")
+	login_name := req.FormValue("login_name")
+	login_password := req.FormValue("login_password")
+
+	token, err := r.Service(req).ResetCredentialsWithToken(token, login_name, login_password)
+	if err != nil {
+		r.handleProcessingError(resp, req, err)
+	} else {
+		httputil.WriteNoContent(resp)
+	}
+}
+
+// ----------------------------------------------
+type ResetPasswordTokenHandler struct{ BaseHandler }
+
+func (r *ResetPasswordTokenHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	token := req.FormValue("token")
+	login_password := req.FormValue("login_password")
+
+	_, err := r.Service(req).ResetPasswordWithToken(token, login_password)
+	if err != nil {
+		r.handleProcessingError(resp, req, err)
+	} else {
+		httputil.WriteNoContent(resp)
+	}
+}
+
+// ----------------------------------------------
+type NewPhoneResetCodeHandler struct{ BaseHandler }
+
+func (h *NewPhoneResetCodeHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	code, err := h.Service(req).NewPhoneResetCode(req.FormValue("phone"))
+	if err != nil {
+		h.handleProcessingError(resp, req, MaskError(err))
+	} else {
+		httputil.WriteJSONResponse(resp, http.StatusOK, map[string]interface{}{
+			"code": code,
+		})
+	}
+}
+
+// ----------------------------------------------
+type ExchangePhoneResetCodeHandler struct{ BaseHandler }
+
+func (h *ExchangePhoneResetCodeHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	token, err := h.Service(req).ExchangePhoneResetCode(req.FormValue("phone"), req.FormValue("code"))
+	if err != nil {
+		h.handleProcessingError(resp, req, MaskError(err))
+	} else {
+		httputil.WriteJSONResponse(resp, http.StatusOK, map[string]interface{}{
+			"token": token,
+		})
+	}
+}
+
+// ----------------------------------------------
+
+type JWKSHandler struct{ BaseHandler }
+
+func (h *JWKSHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	keySet, err := h.Service(req).PublicKeys()
+	if err == service.AccessTokensDisabled {
+		httputil.WriteNotFound(resp)
+	} else if err != nil {
+		h.handleProcessingError(resp, req, MaskError(err))
+	} else {
+		resp.Header().Set("Cache-Control", "max-age=300")
+		httputil.WriteJSONResponse(resp, http.StatusOK, keySet)
+	}
+}
+
 // ----------------------------------------------
 
 type FeedWriter struct{ BaseHandler }
 
 func (h *FeedWriter) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
 	resp.Header().Set("Content-Type", "application/json")
-	h.UserService.EventCollector.WriteJSONStreamOnce(resp)
+	h.Service(req).EventCollector.WriteJSONStreamOnce(resp)
 }
@@ -9,7 +9,7 @@ import (
 	"time"
 )
 
-func Dialer(address, password string) func() (redis.Conn, error) {
+func Dialer(address, password string, database int) func() (redis.Conn, error) {
 	// Be nice to docker and get rid of the protocol
 	if strings.HasPrefix(address, "tcp://") {
 		address = address[6:]
@@ -26,12 +26,19 @@ func Dialer(address, password string) func() (redis.Conn, error) {
 				return nil, err
 			}
 		}
+
+		if database != 0 {
+			if _, err := c.Do("SELECT", database); err != nil {
+				c.Close()
+				return nil, err
+			}
+		}
 		return c, err
 	}
 }
 
-func NewPool(address, password string, maxIdle, maxActive int, timeout time.Duration) *redis.Pool {
-	Dial := Dialer(address, password)
+func NewPool(address, password string, database, maxIdle, maxActive int, timeout time.Duration) *redis.Pool {
+	Dial := Dialer(address, password, database)
 
 	return &redis.Pool{
 		MaxIdle:     maxIdle,
@@ -44,6 +51,7 @@ func NewPool(address, password string, maxIdle, maxActive int, timeout time.Dura
 var (
 	redisAddress     = flag.String("redis-address", "localhost:6370", "Address to connect to.")
 	redisPassword    = flag.String("redis-auth", "", "Password to send when establishing a connection.")
+	redisDatabase    = flag.Int("redis-db", 0, "The database index to SELECT after connecting. Must be 0 for Redis Cluster.")
 	redisMaxIdle     = flag.Int("redis-max-idle", 20, "Maximum number of idle connections before closing.")
 	redisMaxActive   = flag.Int("redis-max-active", 20, "Maximum number of open connections.")
 	redisIdleTimeout = flag.Int("redis-idle", 10*60, "Seconds connections can be idle before closing.")
@@ -54,7 +62,7 @@ var (
 func RedisPool() *redis.Pool {
 	if pool == nil {
 		pool = NewPool(
-			*redisAddress, *redisPassword, *redisMaxIdle, *redisMaxActive,
+			*redisAddress, *redisPassword, *redisDatabase, *redisMaxIdle, *redisMaxActive,
 			time.Duration(*redisIdleTimeout)*time.Second,
 		)
 	}
@@ -0,0 +1,113 @@
+package service
+
+import (
+	"./jwt"
+	"./user"
+
+	"log"
+	"time"
+)
+
+// registeredClaims are set by IssueAccessToken and can not be used by SetTokenClaims.
+var registeredClaims = map[string]bool{
+	"iss": true, "sub": true, "aud": true, "exp": true, "nbf": true, "iat": true, "jti": true,
+	"email_verified": true, "scope": true, "client_id": true, "realm": true,
+}
+
+// AccessToken is a signed JWT, which can be verified by other services with the keys returned by PublicKeys.
+type AccessToken struct {
+	Token   string
+	Expires time.Time
+}
+
+// IssueAccessToken returns an access token for a user, which was authenticated before, e.g. with Authenticate.
+// The token contains the user ID as "sub", the "email_verified" flag, the "realm" unless it is the default realm
+// and the custom claims set by SetTokenClaims.
+func (us *UserService) IssueAccessToken(userID string) (AccessToken, error) {
+	if userID == "" {
+		return AccessToken{}, InvalidArguments
+	}
+	if us.TokenSigner == nil {
+		return AccessToken{}, AccessTokensDisabled
+	}
+	log.Printf("call IssueAccessToken('%s')\n", userID)
+
+	theUser, err := us.UserStorage.Get(userID)
+	if err != nil {
+		return AccessToken{}, Mask(err)
+	}
+	if err := checkUserActive(&theUser); err != nil {
+		return AccessToken{}, Mask(err)
+	}
+
+	now := time.Now()
+	expires := now.Add(us.AccessTokenExpireTime)
+
+	claims := accessTokenClaims(&theUser, now, expires)
+	if us.AccessTokenIssuer != "" {
+		claims["iss"] = us.AccessTokenIssuer
+	}
+	if us.AccessTokenAudience != "" {
+		claims["aud"] = us.AccessTokenAudience
+	}
+	if us.Realm != "" {
+		claims["realm"] = us.Realm
+	}
+
+	token, err := us.TokenSigner.Sign(claims)
+	if err != nil {
+		return AccessToken{}, Mask(err)
+	}
+	return AccessToken{token, expires}, nil
+}
+
+// accessTokenClaims returns the custom claims of the user and the registered claims except "iss" and "aud".
+func accessTokenClaims(theUser *user.User, now, expires time.Time) jwt.Claims {
+	claims := jwt.Claims{}
+	for name, value := range theUser.TokenClaims {
+		claims[name] = value
+	}
+	claims["sub"] = theUser.ID
+	claims["email_verified"] = theUser.EmailVerified
+	claims["iat"] = now.Unix()
+	claims["exp"] = expires.Unix()
+	return claims
+}
+
+// SetTokenClaims replaces the custom claims added to the access tokens of the user, e.g. roles. The registered
+// claims like "sub" or "exp" are set by IssueAccessToken and can not be used. Nil removes all custom claims.
+//
+// Event: user.token_claims_changed(user_id, claims)
+func (us *UserService) SetTokenClaims(userID string, claims map[string]interface{}) error {
+	if userID == "" {
+		return InvalidArguments
+	}
+	log.Printf("call SetTokenClaims('%s', ..)\n", userID)
+
+	for name := range claims {
+		if name == "" {
+			return InvalidArguments
+		}
+		if registeredClaims[name] {
+			return ReservedTokenClaim
+		}
+	}
+
+	return us.readModifyWrite(userID, func(theUser *user.User) error {
+		theUser.TokenClaims = claims
+		return nil
+	}, func(theUser *user.User) {
+		us.logEvent("user.token_claims_changed", map[string]interface{}{
+			"user_id": theUser.ID,
+			"claims":  theUser.TokenClaims,
+		})
+	})
+}
+
+// PublicKeys returns the keys to verify access tokens, including the ones of recently rotated keys.
+func (us *UserService) PublicKeys() (jwt.JSONWebKeySet, error) {
+	if us.TokenSigner == nil {
+		return jwt.JSONWebKeySet{}, AccessTokensDisabled
+	}
+	return us.TokenSigner.PublicKeys(), nil
+}
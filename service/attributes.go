@@ -0,0 +1,72 @@
+package service
+
+import (
+	"./attributes"
+	"./user"
+
+	"log"
+)
+
+// ChangeAttributes sets the given custom attributes of the user and keeps all others. A nil value removes the
+// attribute. The resulting attributes must satisfy the AttributeSchema.
+//
+// Event: user.change_attributes(user_id, attributes)
+func (us *UserService) ChangeAttributes(userID string, changes map[string]interface{}) error {
+	if userID == "" || len(changes) == 0 {
+		return InvalidArguments
+	}
+	log.Printf("call ChangeAttributes('%s', ..)\n", userID)
+
+	return us.readModifyWrite(userID, func(theUser *user.User) error {
+		values := map[string]interface{}{}
+		for name, value := range theUser.Attributes {
+			values[name] = value
+		}
+		for name, value := range changes {
+			if value == nil {
+				delete(values, name)
+			} else {
+				values[name] = value
+			}
+		}
+
+		if err := us.checkAttributes(values); err != nil {
+			return err
+		}
+		theUser.Attributes = values
+		return nil
+	}, func(theUser *user.User) {
+		us.logEvent("user.change_attributes", map[string]interface{}{
+			"user_id":    theUser.ID,
+			"attributes": theUser.Attributes,
+		})
+	})
+}
+
+// GetPublicAttributes returns the attributes of the user, which are marked as public in the AttributeSchema.
+func (us *UserService) GetPublicAttributes(userID string) (map[string]interface{}, error) {
+	if userID == "" {
+		return nil, InvalidArguments
+	}
+	log.Printf("call GetPublicAttributes('%s')\n", userID)
+
+	theUser, err := us.UserStorage.Get(userID)
+	if err != nil {
+		return nil, Mask(err)
+	}
+	return us.attributeSchema().Public(theUser.Attributes), nil
+}
+
+func (us *UserService) checkAttributes(values map[string]interface{}) error {
+	if violations := us.attributeSchema().Check(values); len(violations) > 0 {
+		return &AttributeViolation{violations}
+	}
+	return nil
+}
+
+func (us *UserService) attributeSchema() *attributes.Schema {
+	if us.AttributeSchema == nil {
+		return &attributes.Schema{}
+	}
+	return us.AttributeSchema
+}
@@ -0,0 +1,155 @@
+// Package attributes validates the custom profile attributes of users against a schema defined by the operator,
+// e.g. locale, timezone or a marketing opt-in.
+package attributes
+
+import (
+	"github.com/juju/errgo"
+
+	"encoding/json"
+	"io/ioutil"
+)
+
+// Types of an attribute value, as decoded from JSON.
+const (
+	TypeString  = "string"
+	TypeNumber  = "number"
+	TypeBoolean = "boolean"
+)
+
+// Names of the rules returned by Schema.Check.
+const (
+	RuleUnknown   = "unknown"
+	RuleRequired  = "required"
+	RuleType      = "type"
+	RuleMaxLength = "max_length"
+)
+
+var InvalidSchemaFile = errgo.New("Invalid attribute schema file.")
+
+// Definition describes one attribute.
+type Definition struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+
+	// Required attributes must be given when the user is created and can not be removed.
+	Required bool `json:"required"`
+
+	// MaxLength limits string values, counted in characters. 0 means no limit.
+	MaxLength int `json:"max_length"`
+
+	// Public attributes can be shown to other users, e.g. an avatar URL. All others are only returned to the
+	// user and the operator.
+	Public bool `json:"public"`
+}
+
+// Schema contains the definitions of all attributes. Attributes not defined in the schema are rejected, so the
+// empty schema allows no attributes at all.
+type Schema struct {
+	Attributes []Definition `json:"attributes"`
+}
+
+// LoadSchema reads the schema from a JSON file:
+//
+//	{
+//		"attributes": [
+//			{"name": "locale", "type": "string", "required": true, "max_length": 10},
+//			{"name": "avatar_url", "type": "string", "max_length": 2048, "public": true},
+//			{"name": "marketing_opt_in", "type": "boolean"}
+//		]
+//	}
+func LoadSchema(path string) (*Schema, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+
+	var schema Schema
+	if err := json.Unmarshal(data, &schema); err != nil {
+		return nil, errgo.Notef(InvalidSchemaFile, "%v", err)
+	}
+
+	seen := map[string]bool{}
+	for _, definition := range schema.Attributes {
+		if definition.Name == "" || seen[definition.Name] {
+			return nil, errgo.Notef(InvalidSchemaFile, "missing or duplicate name '%s'", definition.Name)
+		}
+		seen[definition.Name] = true
+
+		switch definition.Type {
+		case TypeString, TypeNumber, TypeBoolean:
+		default:
+			return nil, errgo.Notef(InvalidSchemaFile, "invalid type '%s' of attribute '%s'", definition.Type, definition.Name)
+		}
+		if definition.MaxLength < 0 {
+			return nil, errgo.Notef(InvalidSchemaFile, "invalid max_length of attribute '%s'", definition.Name)
+		}
+	}
+	return &schema, nil
+}
+
+// Find returns the definition of an attribute or nil.
+func (s *Schema) Find(name string) *Definition {
+	for i := range s.Attributes {
+		if s.Attributes[i].Name == name {
+			return &s.Attributes[i]
+		}
+	}
+	return nil
+}
+
+// Check returns the violated rule for every invalid attribute, keyed by the attribute name. An empty result means
+// the attributes can be stored.
+func (s *Schema) Check(values map[string]interface{}) map[string]string {
+	violations := map[string]string{}
+
+	for name, value := range values {
+		definition := s.Find(name)
+		if definition == nil {
+			violations[name] = RuleUnknown
+		} else if rule := definition.check(value); rule != "" {
+			violations[name] = rule
+		}
+	}
+
+	for _, definition := range s.Attributes {
+		if _, ok := values[definition.Name]; definition.Required && !ok {
+			violations[definition.Name] = RuleRequired
+		}
+	}
+	return violations
+}
+
+// Public returns the values of the public attributes.
+func (s *Schema) Public(values map[string]interface{}) map[string]interface{} {
+	public := map[string]interface{}{}
+	for name, value := range values {
+		if definition := s.Find(name); definition != nil && definition.Public {
+			public[name] = value
+		}
+	}
+	return public
+}
+
+func (d *Definition) check(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		if d.Type != TypeString {
+			return RuleType
+		}
+		if d.MaxLength > 0 && len([]rune(v)) > d.MaxLength {
+			return RuleMaxLength
+		}
+	case int, int64, float64, json.Number:
+		if d.Type != TypeNumber {
+			return RuleType
+		}
+	case bool:
+		if d.Type != TypeBoolean {
+			return RuleType
+		}
+	default:
+		// null, arrays and objects are not supported
+		return RuleType
+	}
+	return ""
+}
@@ -0,0 +1,57 @@
+package attributes
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+var testSchema = &Schema{Attributes: []Definition{
+	{Name: "locale", Type: TypeString, Required: true, MaxLength: 5},
+	{Name: "avatar_url", Type: TypeString, Public: true},
+	{Name: "age", Type: TypeNumber},
+	{Name: "marketing_opt_in", Type: TypeBoolean},
+}}
+
+func TestCheck(t *testing.T) {
+	valid := map[string]interface{}{"locale": "de-DE", "age": float64(42), "marketing_opt_in": true}
+	if violations := testSchema.Check(valid); len(violations) != 0 {
+		t.Fatalf("Expected no violations, got %#v", violations)
+	}
+
+	invalid := map[string]interface{}{"locale": "de-DE-x", "age": "42", "unknown": 1, "avatar_url": []interface{}{}}
+	expected := map[string]string{"locale": RuleMaxLength, "age": RuleType, "unknown": RuleUnknown, "avatar_url": RuleType}
+	if violations := testSchema.Check(invalid); !reflect.DeepEqual(violations, expected) {
+		t.Fatalf("Expected %#v, got %#v", expected, violations)
+	}
+
+	if violations := testSchema.Check(nil); !reflect.DeepEqual(violations, map[string]string{"locale": RuleRequired}) {
+		t.Fatalf("Expected the required locale, got %#v", violations)
+	}
+}
+
+func TestMaxLengthCountsCharacters(t *testing.T) {
+	if violations := testSchema.Check(map[string]interface{}{"locale": "äöüßé"}); len(violations) != 0 {
+		t.Fatalf("Expected no violations, got %#v", violations)
+	}
+}
+
+func TestPublic(t *testing.T) {
+	public := testSchema.Public(map[string]interface{}{"locale": "de-DE", "avatar_url": "https://example.com/a.png"})
+	if !reflect.DeepEqual(public, map[string]interface{}{"avatar_url": "https://example.com/a.png"}) {
+		t.Fatalf("Unexpected public attributes %#v", public)
+	}
+}
+
+func TestLoadSchemaRejectsInvalidTypes(t *testing.T) {
+	file, _ := ioutil.TempFile("", "schema")
+	defer os.Remove(file.Name())
+
+	file.WriteString(`{"attributes": [{"name": "locale", "type": "date"}]}`)
+	file.Close()
+
+	if _, err := LoadSchema(file.Name()); err == nil {
+		t.Fatalf("Expected the type date to be rejected")
+	}
+}
@@ -0,0 +1,59 @@
+// Package audit contains the entries of the per-user change history, see UserService.UserHistory.
+package audit
+
+import (
+	"github.com/juju/errgo"
+
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"sort"
+	"time"
+)
+
+// idLength is the number of random bytes of an ID, which follow the 8 bytes of the timestamp.
+const idLength = 8
+
+// Entry records one event of a user.
+type Entry struct {
+	ID        string
+	UserID    string
+	Tag       string
+	Timestamp time.Time
+
+	// Actor and RequestID are given by the caller of the API, e.g. the ID of an admin and the ID of the request in
+	// the logs of the consumer. Both may be empty.
+	Actor     string
+	RequestID string
+
+	// Fields are the names of the fields of the event, e.g. "email" for user.change_email. The values are not
+	// recorded, as they may contain tokens or codes.
+	Fields []string
+}
+
+// NewEntry returns an entry with a new ID. The ID starts with the timestamp, followed by random bytes, so the IDs
+// of a user can be ordered without reading the entries, see SortIDsNewestFirst. The fields are sorted.
+func NewEntry(userID, tag string, timestamp time.Time, actor, requestID string, fields []string) (Entry, error) {
+	data := make([]byte, 8+idLength)
+	binary.BigEndian.PutUint64(data, uint64(timestamp.UnixNano()))
+	if _, err := rand.Read(data[8:]); err != nil {
+		return Entry{}, errgo.Mask(err)
+	}
+
+	sorted := append([]string(nil), fields...)
+	sort.Strings(sorted)
+	return Entry{
+		ID:        hex.EncodeToString(data),
+		UserID:    userID,
+		Tag:       tag,
+		Timestamp: timestamp,
+		Actor:     actor,
+		RequestID: requestID,
+		Fields:    sorted,
+	}, nil
+}
+
+// SortIDsNewestFirst sorts the IDs returned by NewEntry by the timestamp of their entries, the newest first.
+func SortIDsNewestFirst(ids []string) {
+	sort.Sort(sort.Reverse(sort.StringSlice(ids)))
+}
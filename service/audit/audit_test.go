@@ -0,0 +1,39 @@
+package audit
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNewEntry(t *testing.T) {
+	fields := []string{"email", "attributes"}
+	first, err := NewEntry("user-1", "user.created", time.Now(), "admin", "req-1", fields)
+	if err != nil {
+		t.Fatalf("Failed to create entry: %v", err)
+	}
+	second, _ := NewEntry("user-1", "user.created", time.Now(), "", "", nil)
+
+	if first.ID == "" || first.ID == second.ID {
+		t.Fatalf("Expected unique IDs, got '%s' and '%s'", first.ID, second.ID)
+	}
+	if !reflect.DeepEqual(first.Fields, []string{"attributes", "email"}) {
+		t.Fatalf("Expected sorted fields, got %#v", first.Fields)
+	}
+	if fields[0] != "email" {
+		t.Fatalf("Expected the given fields to be unchanged, got %#v", fields)
+	}
+}
+
+func TestSortIDsNewestFirst(t *testing.T) {
+	now := time.Now()
+	old, _ := NewEntry("user-1", "user.created", now.Add(-time.Hour), "", "", nil)
+	recent, _ := NewEntry("user-1", "user.email_verified", now, "", "", nil)
+	middle, _ := NewEntry("user-1", "user.change_email", now.Add(-time.Second), "", "", nil)
+
+	ids := []string{old.ID, recent.ID, middle.ID}
+	SortIDsNewestFirst(ids)
+	if !reflect.DeepEqual(ids, []string{recent.ID, middle.ID, old.ID}) {
+		t.Fatalf("Unexpected order %#v", ids)
+	}
+}
@@ -40,6 +40,13 @@ func (w *UserStorageWrapper) FindByEmail(email string) (user.User, error) {
 	}
 	return user, err
 }
+func (w *UserStorageWrapper) FindByPhone(phone string) (user.User, error) {
+	user, err := w.UserStorage.FindByPhone(phone)
+	if logUserStorageCalls {
+		log.Printf("UserStorage.FindByPhone(%#v) =>\n\t(%#v, %#v)", phone, user, err)
+	}
+	return user, err
+}
 func (w *UserStorageWrapper) FindByResetPasswordToken(token string) (user.User, error) {
 	user, err := w.UserStorage.FindByResetPasswordToken(token)
 	if logUserStorageCalls {
@@ -47,3 +54,45 @@ func (w *UserStorageWrapper) FindByResetPasswordToken(token string) (user.User,
 	}
 	return user, err
 }
+func (w *UserStorageWrapper) FindByLoginLinkToken(token string) (user.User, error) {
+	user, err := w.UserStorage.FindByLoginLinkToken(token)
+	if logUserStorageCalls {
+		log.Printf("UserStorage.FindByLoginLinkToken(%#v) =>\n\t(%#v, %#v)", token, user, err)
+	}
+	return user, err
+}
+func (w *UserStorageWrapper) FindByEmailVerificationToken(token string) (user.User, error) {
+	user, err := w.UserStorage.FindByEmailVerificationToken(token)
+	if logUserStorageCalls {
+		log.Printf("UserStorage.FindByEmailVerificationToken(%#v) =>\n\t(%#v, %#v)", token, user, err)
+	}
+	return user, err
+}
+func (w *UserStorageWrapper) FindByPendingEmailToken(token string) (user.User, error) {
+	user, err := w.UserStorage.FindByPendingEmailToken(token)
+	if logUserStorageCalls {
+		log.Printf("UserStorage.FindByPendingEmailToken(%#v) =>\n\t(%#v, %#v)", token, user, err)
+	}
+	return user, err
+}
+func (w *UserStorageWrapper) FindByPendingEmailCancelToken(token string) (user.User, error) {
+	user, err := w.UserStorage.FindByPendingEmailCancelToken(token)
+	if logUserStorageCalls {
+		log.Printf("UserStorage.FindByPendingEmailCancelToken(%#v) =>\n\t(%#v, %#v)", token, user, err)
+	}
+	return user, err
+}
+func (w *UserStorageWrapper) FindByAuthChallenge(challenge string) (user.User, error) {
+	user, err := w.UserStorage.FindByAuthChallenge(challenge)
+	if logUserStorageCalls {
+		log.Printf("UserStorage.FindByAuthChallenge(%#v) =>\n\t(%#v, %#v)", challenge, user, err)
+	}
+	return user, err
+}
+func (w *UserStorageWrapper) FindByWebAuthnCredential(credentialID string) (user.User, error) {
+	user, err := w.UserStorage.FindByWebAuthnCredential(credentialID)
+	if logUserStorageCalls {
+		log.Printf("UserStorage.FindByWebAuthnCredential(%#v) =>\n\t(%#v, %#v)", credentialID, user, err)
+	}
+	return user, err
+}
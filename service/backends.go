@@ -1,7 +1,13 @@
 package service
 
 import (
+	"./audit"
+	"./group"
+	"./jwt"
+	"./session"
 	"./user"
+
+	"time"
 )
 
 type IdFactory interface {
@@ -10,6 +16,18 @@ type IdFactory interface {
 	// Generates a new password token to be used for the password reset feature.
 	// The result must never be empty.
 	NewResetPasswordToken() string
+
+	// Generates a new token to be send to one of the user's email addresses, e.g. to verify it.
+	// The result must never be empty.
+	NewEmailVerificationToken() string
+
+	// Generates a new ID for a challenge which must be completed with a second factor to authenticate.
+	// The result must never be empty.
+	NewAuthChallenge() string
+
+	// Generates a new token to be sent to one of the user's email addresses to authenticate without password.
+	// The result must never be empty.
+	NewLoginLinkToken() string
 }
 
 // This follows the design of the PHP password_* functions. The client don't need to know anything about the user algorithms.
@@ -19,13 +37,67 @@ type PasswordHasher interface {
 	Verify(password, passwordHash string) bool
 }
 
+// PasswordPolicy decides which passwords can be chosen by a user.
+type PasswordPolicy interface {
+	// Check returns the names of all rules the password violates. An empty result means the password can be used.
+	Check(password, loginName, email string) []string
+}
+
+// BreachedPasswords knows passwords which have been exposed in data breaches.
+type BreachedPasswords interface {
+	Contains(password string) (bool, error)
+}
+
 type UserStorage interface {
 	Save(user user.User) error
 	Get(userId string) (user.User, error)
 
 	FindByLoginName(loginName string) (user.User, error)
 	FindByEmail(email string) (user.User, error)
+	FindByPhone(phone string) (user.User, error)
 	FindByResetPasswordToken(token string) (user.User, error)
+	FindByLoginLinkToken(token string) (user.User, error)
+	FindByEmailVerificationToken(token string) (user.User, error)
+	FindByPendingEmailToken(token string) (user.User, error)
+	FindByPendingEmailCancelToken(token string) (user.User, error)
+	FindByAuthChallenge(challenge string) (user.User, error)
+	FindByWebAuthnCredential(credentialID string) (user.User, error)
+}
+
+// GroupStorage stores the groups. The memberships are also stored in the users, see user.User.Groups.
+type GroupStorage interface {
+	SaveGroup(group group.Group) error
+	GetGroup(name string) (group.Group, error)
+	RemoveGroup(name string) error
+}
+
+// SessionStorage keeps the sessions until they expire. Backends should remove expired sessions natively.
+type SessionStorage interface {
+	Save(session session.Session) error
+	Get(sessionID string) (session.Session, error)
+	Remove(sessionID string) error
+
+	FindByToken(tokenHash string) (session.Session, error)
+	FindByRefreshToken(refreshTokenHash string) (session.Session, error)
+	FindByAuthorizationCode(codeHash string) (session.Session, error)
+	FindByUser(userID string) ([]session.Session, error)
+}
+
+// AuditStorage keeps the change history of the users. Backends should remove entries natively once the retention
+// has passed.
+type AuditStorage interface {
+	Add(entry audit.Entry, retention time.Duration) error
+
+	// FindByUser returns the entries of the user, newest first, skipping the first offset entries and returning at
+	// most limit entries, all if limit is 0. Returns also the total number of entries.
+	FindByUser(userID string, offset, limit int) ([]audit.Entry, int, error)
+}
+
+// TokenSigner signs the access tokens issued by IssueAccessToken. Other services verify them with the published keys.
+type TokenSigner interface {
+	Sign(claims jwt.Claims) (string, error)
+	Verify(token string, now time.Time) (jwt.Claims, error)
+	PublicKeys() jwt.JSONWebKeySet
 }
 
 // EventLog abstracts any eventlog for store the business events of the UserService.
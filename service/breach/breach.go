@@ -0,0 +1,149 @@
+// Package breach checks passwords against local copies of breach corpora like the ones published by
+// haveibeenpwned.com. No external service is called.
+//
+// Supported formats:
+//
+//	sha1-file:  One file with the uppercase SHA-1 hashes of all breached passwords, sorted by hash.
+//	            Each line is either "<hash>" or "<hash>:<count>" (the "ordered by hash" HIBP dump).
+//	prefix-dir: A directory with one file per 5 character hash prefix, named "<prefix>.txt". Each file
+//	            contains the sorted remaining 35 characters of the hashes as "<suffix>:<count>" (the
+//	            k-anonymity range files, e.g. downloaded with the haveibeenpwned-downloader).
+package breach
+
+import (
+	"github.com/juju/errgo"
+
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// prefixLength is the length of the hash prefix used for k-anonymity range files.
+const prefixLength = 5
+
+func NewNone() *none {
+	return &none{}
+}
+
+type none struct{}
+
+func (n *none) Contains(password string) (bool, error) {
+	return false, nil
+}
+
+// -------------------------------------------------
+
+// NewSHA1File memory-maps the given file. The file must not be changed while userd is running.
+func NewSHA1File(path string) (*SHA1File, error) {
+	data, err := mapFile(path)
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+	return &SHA1File{data}, nil
+}
+
+// SHA1File looks up passwords in a sorted file of SHA-1 hashes.
+type SHA1File struct {
+	Data []byte
+}
+
+func (f *SHA1File) Contains(password string) (bool, error) {
+	return searchSortedLines(f.Data, []byte(hashPassword(password))), nil
+}
+
+// -------------------------------------------------
+
+func NewPrefixDirectory(path string) (*PrefixDirectory, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+	if !info.IsDir() {
+		return nil, errgo.Newf("%s is not a directory", path)
+	}
+	return &PrefixDirectory{path}, nil
+}
+
+// PrefixDirectory looks up passwords in a directory of k-anonymity range files. Only the file
+// for the prefix of the password hash is read.
+type PrefixDirectory struct {
+	Path string
+}
+
+func (d *PrefixDirectory) Contains(password string) (bool, error) {
+	hash := hashPassword(password)
+
+	data, err := ioutil.ReadFile(filepath.Join(d.Path, hash[:prefixLength]+".txt"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, errgo.Mask(err)
+	}
+	return searchSortedLines(data, []byte(hash[prefixLength:])), nil
+}
+
+// -------------------------------------------------
+
+func hashPassword(password string) string {
+	sum := sha1.Sum([]byte(password))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+// searchSortedLines performs a binary search for a line starting with key, followed by a colon or the line end.
+// The lines must be sorted by their key, hex digits are compared case-insensitive.
+func searchSortedLines(data, key []byte) bool {
+	low, high := 0, len(data)
+	for low < high {
+		middle := (low + high) / 2
+
+		start := bytes.LastIndexByte(data[:middle], '\n') + 1
+		end := bytes.IndexByte(data[start:], '\n')
+		if end < 0 {
+			end = len(data)
+		} else {
+			end += start
+		}
+
+		line := bytes.TrimRight(data[start:end], "\r")
+		if colon := bytes.IndexByte(line, ':'); colon >= 0 {
+			line = line[:colon]
+		}
+
+		switch compareHex(line, key) {
+		case 0:
+			return true
+		case -1:
+			low = end + 1
+		default:
+			high = start
+		}
+	}
+	return false
+}
+
+// compareHex compares like bytes.Compare, but treats lowercase letters in a as uppercase. b must be uppercase.
+func compareHex(a, b []byte) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		c := a[i]
+		if c >= 'a' && c <= 'z' {
+			c -= 'a' - 'A'
+		}
+		if c < b[i] {
+			return -1
+		} else if c > b[i] {
+			return 1
+		}
+	}
+	switch {
+	case len(a) < len(b):
+		return -1
+	case len(a) > len(b):
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,132 @@
+package breach
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// givenCorpus returns the sorted "<hash>:<count>" lines of the SHA-1 hashes of the given passwords.
+func givenCorpus(passwords []string) []string {
+	lines := make([]string, 0, len(passwords))
+	for i, password := range passwords {
+		lines = append(lines, fmt.Sprintf("%s:%d", hashPassword(password), i+1))
+	}
+	sort.Strings(lines)
+	return lines
+}
+
+func givenPasswords(count int) []string {
+	passwords := make([]string, 0, count)
+	for i := 0; i < count; i++ {
+		passwords = append(passwords, fmt.Sprintf("password-%d", i))
+	}
+	return passwords
+}
+
+func TestSearchSortedLines(t *testing.T) {
+	lines := givenCorpus(givenPasswords(101))
+
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"LF", strings.Join(lines, "\n")},
+		{"LF with trailing newline", strings.Join(lines, "\n") + "\n"},
+		{"CRLF", strings.Join(lines, "\r\n")},
+		{"CRLF with trailing newline", strings.Join(lines, "\r\n") + "\r\n"},
+		{"lowercase", strings.ToLower(strings.Join(lines, "\n"))},
+	}
+
+	for _, test := range tests {
+		data := []byte(test.data)
+		for _, i := range []int{0, 1, len(lines) / 2, len(lines) - 2, len(lines) - 1} {
+			hash := strings.SplitN(lines[i], ":", 2)[0]
+			if !searchSortedLines(data, []byte(hash)) {
+				t.Errorf("%s: expected to find line %d (%s)", test.name, i, hash)
+			}
+		}
+
+		for _, missing := range []string{"not-breached", "another-secret", "password-101"} {
+			if searchSortedLines(data, []byte(hashPassword(missing))) {
+				t.Errorf("%s: expected not to find %s", test.name, missing)
+			}
+		}
+		for _, missing := range []string{"0000000000000000000000000000000000000000", "FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF"} {
+			if searchSortedLines(data, []byte(missing)) {
+				t.Errorf("%s: expected not to find %s before the first or after the last line", test.name, missing)
+			}
+		}
+	}
+}
+
+func TestSearchSortedLinesWithoutCounts(t *testing.T) {
+	lines := givenCorpus(givenPasswords(10))
+	for i := range lines {
+		lines[i] = strings.SplitN(lines[i], ":", 2)[0]
+	}
+
+	for _, newline := range []string{"\n", "\r\n"} {
+		data := []byte(strings.Join(lines, newline) + newline)
+
+		for _, line := range lines {
+			if !searchSortedLines(data, []byte(line)) {
+				t.Errorf("%q: expected to find %s", newline, line)
+			}
+		}
+		if searchSortedLines(data, []byte(lines[0][:20])) {
+			t.Errorf("%q: expected a prefix of a hash not to match", newline)
+		}
+	}
+}
+
+func TestSearchSortedLinesEmpty(t *testing.T) {
+	for _, data := range []string{"", "\n", "\r\n"} {
+		if searchSortedLines([]byte(data), []byte(hashPassword("secret"))) {
+			t.Errorf("Expected nothing to be found in %q", data)
+		}
+	}
+}
+
+func TestSHA1File(t *testing.T) {
+	passwords := givenPasswords(50)
+	file := &SHA1File{[]byte(strings.Join(givenCorpus(passwords), "\n") + "\n")}
+
+	for _, password := range []string{passwords[0], passwords[25], passwords[49]} {
+		if found, err := file.Contains(password); err != nil || !found {
+			t.Errorf("Expected %s to be breached, got %v, %v", password, found, err)
+		}
+	}
+	if found, err := file.Contains("not-breached"); err != nil || found {
+		t.Errorf("Expected not-breached not to be breached, got %v, %v", found, err)
+	}
+}
+
+func TestPrefixDirectory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "breach")
+	if err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	hash := hashPassword("breached-secret")
+	data := hash[prefixLength:] + ":3\r\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, hash[:prefixLength]+".txt"), []byte(data), 0644); err != nil {
+		t.Fatalf("Failed to write range file: %v", err)
+	}
+
+	directory, err := NewPrefixDirectory(dir)
+	if err != nil {
+		t.Fatalf("Failed to open directory: %v", err)
+	}
+	if found, err := directory.Contains("breached-secret"); err != nil || !found {
+		t.Errorf("Expected breached-secret to be breached, got %v, %v", found, err)
+	}
+	if found, err := directory.Contains("not-breached"); err != nil || found {
+		t.Errorf("Expected a missing range file to mean not breached, got %v, %v", found, err)
+	}
+}
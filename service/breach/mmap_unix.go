@@ -0,0 +1,33 @@
+//go:build !windows
+// +build !windows
+
+package breach
+
+import (
+	"github.com/juju/errgo"
+
+	"os"
+	"syscall"
+)
+
+func mapFile(path string) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+	if info.Size() == 0 {
+		return []byte{}, nil
+	}
+
+	data, err := syscall.Mmap(int(file.Fd()), 0, int(info.Size()), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+	return data, nil
+}
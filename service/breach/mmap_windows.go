@@ -0,0 +1,16 @@
+//go:build windows
+// +build windows
+
+package breach
+
+import (
+	"github.com/juju/errgo"
+
+	"io/ioutil"
+)
+
+// mapFile reads the whole file into memory, as syscall.Mmap is not available on windows.
+func mapFile(path string) ([]byte, error) {
+	data, err := ioutil.ReadFile(path)
+	return data, errgo.Mask(err)
+}
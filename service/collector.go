@@ -60,6 +60,25 @@ func (esc *EventCollector) publish(tag string, json []byte) {
 	}
 }
 
+// removeUser drops all items of the user, e.g. once the user was erased. Items without a user_id are kept.
+func (esc *EventCollector) removeUser(userID string) {
+	esc.Lock.Lock()
+	defer esc.Lock.Unlock()
+
+	// Build a new slice, as readers of Get() may still iterate over the old one
+	items := make([]Item, 0, esc.MaxItems)
+	for _, item := range esc.Items {
+		var event struct {
+			UserID string `json:"user_id"`
+		}
+		if json.Unmarshal(item.Json, &event) == nil && event.UserID == userID {
+			continue
+		}
+		items = append(items, item)
+	}
+	esc.Items = items
+}
+
 func (esc *EventCollector) Get() []Item {
 	esc.Lock.Lock()
 	defer esc.Lock.Unlock()
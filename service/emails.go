@@ -0,0 +1,186 @@
+package service
+
+import (
+	"./storage"
+	"./user"
+
+	"log"
+	"time"
+)
+
+// AddEmail adds a secondary email address to the user. Like the primary address it must be unique among all users.
+// The returned token should be sent to the new address, passing it to VerifyEmailWithToken verifies the address.
+// The primary address is notified, as a verified secondary address can be used to reset the password.
+//
+// Event: user.email_added(user_id, profile_name, email, token, timestamp, expires)
+// Event: user.email_added_notification(user_id, profile_name, email, new_email, timestamp)
+func (us *UserService) AddEmail(userID, email string) (string, error) {
+	return us.addEmail(userID, email, us.withoutCurrentPassword)
+}
+
+// AddEmailWithCurrentPassword is like AddEmail, but verifies the current password first.
+func (us *UserService) AddEmailWithCurrentPassword(userID, currentPassword, email string) (string, error) {
+	return us.addEmail(userID, email, us.withCurrentPassword(currentPassword))
+}
+
+func (us *UserService) addEmail(userID, email string, check credentialCheck) (string, error) {
+	if userID == "" || email == "" {
+		return "", InvalidArguments
+	}
+	log.Printf("call AddEmail('%s', '%s')\n", userID, email)
+
+	var token string
+	err := us.readModifyWrite(userID, func(theUser *user.User) error {
+		if err := check(theUser); err != nil {
+			return err
+		}
+		if theUser.HasEmail(email) {
+			return InvalidArguments
+		}
+
+		now := time.Now()
+		token = us.IdFactory.NewEmailVerificationToken()
+		theUser.SecondaryEmails = append(theUser.SecondaryEmails, user.EmailAddress{
+			Email:                   email,
+			VerificationToken:       token,
+			VerificationTokenIssued: &now,
+		})
+		return nil
+	}, func(theUser *user.User) {
+		address := theUser.FindSecondaryEmail(email)
+		us.logEvent("user.email_added", map[string]interface{}{
+			"user_id":      theUser.ID,
+			"profile_name": theUser.ProfileName,
+			"email":        address.Email,
+			"token":        address.VerificationToken,
+			"timestamp":    address.VerificationTokenIssued,
+			"expires":      address.VerificationTokenIssued.Add(us.EmailVerificationExpireTime),
+		})
+		us.logEvent("user.email_added_notification", map[string]interface{}{
+			"user_id":      theUser.ID,
+			"profile_name": theUser.ProfileName,
+			"email":        theUser.Email,
+			"new_email":    address.Email,
+			"timestamp":    address.VerificationTokenIssued,
+		})
+	})
+	if err != nil {
+		return "", Mask(err)
+	}
+	return token, nil
+}
+
+// RemoveEmail removes a secondary email address of the user. The primary address can not be removed, but replaced
+// with SetPrimaryEmail or ChangeEmail.
+//
+// Event: user.email_removed(user_id, email)
+func (us *UserService) RemoveEmail(userID, email string) error {
+	if userID == "" || email == "" {
+		return InvalidArguments
+	}
+	log.Printf("call RemoveEmail('%s', '%s')\n", userID, email)
+
+	return us.readModifyWrite(userID, func(theUser *user.User) error {
+		if theUser.Email == email {
+			return PrimaryEmailNotRemovable
+		}
+		if theUser.FindSecondaryEmail(email) == nil {
+			return InvalidVerificationEmail
+		}
+		removeSecondaryEmail(theUser, email)
+		return nil
+	}, func(theUser *user.User) {
+		us.logEvent("user.email_removed", map[string]interface{}{
+			"user_id": theUser.ID,
+			"email":   email,
+		})
+	})
+}
+
+// SetPrimaryEmail makes a verified secondary address the primary address of the user. The previous primary address
+// is kept as secondary address and notified about the change.
+//
+// Event: user.primary_email_changed(user_id, email, previous_email)
+// Event: user.primary_email_changed_notification(user_id, profile_name, email, new_email, timestamp)
+func (us *UserService) SetPrimaryEmail(userID, email string) error {
+	return us.setPrimaryEmail(userID, email, us.withoutCurrentPassword)
+}
+
+// SetPrimaryEmailWithCurrentPassword is like SetPrimaryEmail, but verifies the current password first.
+func (us *UserService) SetPrimaryEmailWithCurrentPassword(userID, currentPassword, email string) error {
+	return us.setPrimaryEmail(userID, email, us.withCurrentPassword(currentPassword))
+}
+
+func (us *UserService) setPrimaryEmail(userID, email string, check credentialCheck) error {
+	if userID == "" || email == "" {
+		return InvalidArguments
+	}
+	log.Printf("call SetPrimaryEmail('%s', '%s')\n", userID, email)
+
+	var previous string
+	return us.readModifyWrite(userID, func(theUser *user.User) error {
+		if err := check(theUser); err != nil {
+			return err
+		}
+		if theUser.Email == email {
+			// Already the primary address, there is nothing to change
+			return InvalidArguments
+		}
+		address := theUser.FindSecondaryEmail(email)
+		if address == nil {
+			return InvalidVerificationEmail
+		}
+		if !address.Verified {
+			return EmailNotVerified
+		}
+
+		previous = theUser.Email
+		*address = user.EmailAddress{
+			Email:                   theUser.Email,
+			Verified:                theUser.EmailVerified,
+			VerificationToken:       theUser.EmailVerificationToken,
+			VerificationTokenIssued: theUser.EmailVerificationTokenIssued,
+		}
+		theUser.Email = email
+		theUser.EmailVerified = true
+		theUser.EmailVerificationToken = ""
+		theUser.EmailVerificationTokenIssued = nil
+		return nil
+	}, func(theUser *user.User) {
+		us.logEvent("user.primary_email_changed", map[string]interface{}{
+			"user_id":        theUser.ID,
+			"email":          theUser.Email,
+			"previous_email": previous,
+		})
+		us.logEvent("user.primary_email_changed_notification", map[string]interface{}{
+			"user_id":      theUser.ID,
+			"profile_name": theUser.ProfileName,
+			"email":        previous,
+			"new_email":    theUser.Email,
+			"timestamp":    time.Now(),
+		})
+	})
+}
+
+// findByEmail is like UserStorage.FindByEmail, but ignores secondary addresses which have not been verified yet.
+// Nobody must be able to authenticate or reset a password with an address that was merely added to an account.
+func (us *UserService) findByEmail(email string) (user.User, error) {
+	theUser, err := us.UserStorage.FindByEmail(email)
+	if err != nil {
+		return theUser, err
+	}
+	if address := theUser.FindSecondaryEmail(email); address != nil && !address.Verified {
+		return user.User{}, storage.UserNotFound
+	}
+	return theUser, nil
+}
+
+func removeSecondaryEmail(theUser *user.User, email string) {
+	addresses := make([]user.EmailAddress, 0, len(theUser.SecondaryEmails))
+	for _, address := range theUser.SecondaryEmails {
+		if address.Email != email {
+			addresses = append(addresses, address)
+		}
+	}
+	theUser.SecondaryEmails = addresses
+}
@@ -0,0 +1,63 @@
+package service
+
+import (
+	"./storage"
+	"./user"
+
+	"log"
+	"time"
+)
+
+// EraseUser removes all personal data of the user, e.g. for a GDPR erasure request. The stored record is replaced
+// by a tombstone, which only keeps the ID and the time of the erasure, so the ID of past events stays valid. The
+// email addresses, login name and phone number become available for other users. All sessions are revoked and the
+// user is removed from all groups. Erased users can not be modified anymore.
+//
+// The change history is kept, as it contains no personal data. The previous events of the user are removed from the
+// EventCollector, consumers should purge their copies of the user's data on user.erased.
+//
+// Event: user.erased(user_id, timestamp)
+func (us *UserService) EraseUser(userID string) error {
+	if userID == "" {
+		return InvalidArguments
+	}
+	log.Printf("call EraseUser('%s')\n", userID)
+
+	var groups []string
+	erased := time.Now()
+	err := us.readModifyWrite(userID, func(theUser *user.User) error {
+		groups = theUser.Groups
+		*theUser = user.User{
+			ID:     theUser.ID,
+			Erased: &erased,
+		}
+		return nil
+	})
+	if err != nil {
+		return Mask(err)
+	}
+
+	for _, name := range groups {
+		theGroup, err := us.GroupStorage.GetGroup(name)
+		if err == storage.GroupNotFound {
+			continue
+		} else if err != nil {
+			return Mask(err)
+		}
+		theGroup.Members = without(theGroup.Members, userID)
+		if err := us.GroupStorage.SaveGroup(theGroup); err != nil {
+			return Mask(err)
+		}
+	}
+
+	if _, err := us.revokeAllSessions(userID); err != nil {
+		return Mask(err)
+	}
+	us.EventCollector.removeUser(userID)
+
+	us.logEvent("user.erased", map[string]interface{}{
+		"user_id":   userID,
+		"timestamp": erased,
+	})
+	return nil
+}
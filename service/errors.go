@@ -1,43 +1,150 @@
 package service
 
 import (
+	"./phone"
 	"./storage"
 
 	"github.com/juju/errgo"
+
+	"strings"
 )
 
 var (
-	Mask = errgo.MaskFunc(IsServiceError, IsNotFoundError, IsEmailAlreadyTakenError, IsLoginNameAlreadyTakenError, IsUserEmailMustBeVerifiedError)
+	Mask = errgo.MaskFunc(IsServiceError, IsNotFoundError, IsGroupNotFoundError, IsEmailAlreadyTakenError, IsPhoneAlreadyTakenError, IsLoginNameAlreadyTakenError, IsWebAuthnCredentialAlreadyTakenError, IsTokenAlreadyTakenError, IsUserEmailMustBeVerifiedError, IsUserNotActiveError, IsPasswordPolicyViolation, IsAttributeViolation, IsSecondFactorRequired)
 )
 
 var (
-	InvalidConfig             = errgo.New("Invalid config")
-	InvalidArguments          = errgo.New("Invalid arguments.")
-	InvalidCredentials        = errgo.New("Invalid credentials.")
-	InvalidVerificationEmail  = errgo.New("Email adress does not match current email for user.")
-	ResetPasswordTokenExpired = errgo.New("The ResetPasswordToken has expired.")
-	UserEmailMustBeVerified   = errgo.New("Email must be verified to authenticate.")
+	InvalidConfig                 = errgo.New("Invalid config")
+	InvalidArguments              = errgo.New("Invalid arguments.")
+	InvalidCredentials            = errgo.New("Invalid credentials.")
+	InvalidVerificationEmail      = errgo.New("Email adress does not belong to the user.")
+	EmailNotVerified              = errgo.New("The email address must be verified first.")
+	PrimaryEmailNotRemovable      = errgo.New("The primary email address can not be removed.")
+	InvalidLoginName              = errgo.New("The login name must not be an email address.")
+	InvalidPhoneCode              = errgo.New("The phone code is wrong or has expired.")
+	PhoneCodeAttemptsExceeded     = errgo.New("Too many wrong phone codes, a new code can be requested once the last one has expired.")
+	ResetPasswordTokenExpired     = errgo.New("The ResetPasswordToken has expired.")
+	EmailVerificationTokenExpired = errgo.New("The EmailVerificationToken has expired.")
+	EmailChangeTokenExpired       = errgo.New("The token to confirm the email change has expired.")
+	LoginLinkTokenExpired         = errgo.New("The login link has expired.")
+	LoginLinksDisabled            = errgo.New("Login links are not enabled.")
+	CurrentPasswordRequired       = errgo.New("The current password is required for this change.")
+	AuthChallengeExpired          = errgo.New("The authentication challenge has expired.")
+	SecondFactorAttemptsExceeded  = errgo.New("Too many wrong codes, a new challenge is issued once the last one has expired.")
+	TOTPAlreadyEnabled            = errgo.New("TOTP is already enabled, disable it first.")
+	WebAuthnDisabled              = errgo.New("WebAuthn is not configured.")
+	InvalidWebAuthnResponse       = errgo.New("The WebAuthn response could not be verified.")
+	InvalidSession                = errgo.New("The session is invalid or has expired.")
+	AccessTokensDisabled          = errgo.New("Access tokens are not configured.")
+	HistoryDisabled               = errgo.New("The change history is not enabled.")
+	ReservedTokenClaim            = errgo.New("The claim is set by userd and can not be customized.")
+	OIDCDisabled                  = errgo.New("The OpenID Connect provider is not configured.")
+	InvalidOIDCClient             = errgo.New("Unknown OpenID Connect client or redirect URI.")
+	InvalidOIDCGrant              = errgo.New("The authorization code or refresh token is invalid or has expired.")
+	InvalidOIDCToken              = errgo.New("The access token is invalid or has expired.")
+	GroupAlreadyExists            = errgo.New("A group with the given name already exists.")
+	UserEmailMustBeVerified       = errgo.New("Email must be verified to authenticate.")
+	UserLocked                    = errgo.New("The user account is locked.")
+	UserDisabled                  = errgo.New("The user account is disabled.")
+	UserErased                    = errgo.New("The user account has been erased.")
 )
 
 func IsNotFoundError(err error) bool {
 	return err == storage.UserNotFound
 }
 
+func IsGroupNotFoundError(err error) bool {
+	return err == storage.GroupNotFound
+}
+
 func IsEmailAlreadyTakenError(err error) bool {
 	return err == storage.EmailAlreadyTaken
 }
 
+func IsPhoneAlreadyTakenError(err error) bool {
+	return err == storage.PhoneAlreadyTaken
+}
+
 func IsLoginNameAlreadyTakenError(err error) bool {
 	return err == storage.LoginNameAlreadyTaken
 }
 
+func IsWebAuthnCredentialAlreadyTakenError(err error) bool {
+	return err == storage.WebAuthnCredentialAlreadyTaken
+}
+
+// IsTokenAlreadyTakenError reports a collision of a newly generated token with the token of another user. Retrying
+// the call generates a new token.
+func IsTokenAlreadyTakenError(err error) bool {
+	return err == storage.TokenAlreadyTaken
+}
+
 func IsUserEmailMustBeVerifiedError(err error) bool {
 	return err == UserEmailMustBeVerified
 }
 
+func IsUserNotActiveError(err error) bool {
+	err = errgo.Cause(err)
+	return err == UserLocked || err == UserDisabled || err == UserErased
+}
+
+// Rules reported by a PasswordPolicyViolation in addition to the ones of the PasswordPolicy.
+const (
+	// The password is known from a data breach.
+	PasswordRuleBreached = "breached"
+
+	// The password was used recently by the user, see Config.PasswordHistorySize.
+	PasswordRuleReused = "reused"
+)
+
+// PasswordPolicyViolation is returned if a new password violates one or more rules of the PasswordPolicy.
+type PasswordPolicyViolation struct {
+	Rules []string
+}
+
+func (v *PasswordPolicyViolation) Error() string {
+	return "The password violates the password policy: " + strings.Join(v.Rules, ", ")
+}
+
+func IsPasswordPolicyViolation(err error) bool {
+	_, ok := errgo.Cause(err).(*PasswordPolicyViolation)
+	return ok
+}
+
+// AttributeViolation is returned if custom attributes violate the AttributeSchema. Violations contains the
+// violated rule per attribute name, see package attributes.
+type AttributeViolation struct {
+	Violations map[string]string
+}
+
+func (v *AttributeViolation) Error() string {
+	return "The attributes violate the attribute schema."
+}
+
+func IsAttributeViolation(err error) bool {
+	_, ok := errgo.Cause(err).(*AttributeViolation)
+	return ok
+}
+
+// SecondFactorRequired is returned by Authenticate if the password was correct, but the user must also provide
+// a second factor with one of the given methods. Pass the Challenge to CompleteAuthentication.
+type SecondFactorRequired struct {
+	Challenge string
+	Methods   []string
+}
+
+func (s *SecondFactorRequired) Error() string {
+	return "A second factor is required to authenticate."
+}
+
+func IsSecondFactorRequired(err error) bool {
+	_, ok := errgo.Cause(err).(*SecondFactorRequired)
+	return ok
+}
+
 func IsServiceError(err error) bool {
 	err = errgo.Cause(err)
-	return err == ResetPasswordTokenExpired || err == InvalidArguments || err == InvalidCredentials || err == InvalidVerificationEmail || err == InvalidConfig
+	return err == ResetPasswordTokenExpired || err == EmailVerificationTokenExpired || err == EmailChangeTokenExpired || err == LoginLinkTokenExpired || err == LoginLinksDisabled || err == CurrentPasswordRequired || err == AuthChallengeExpired || err == SecondFactorAttemptsExceeded || err == TOTPAlreadyEnabled || err == WebAuthnDisabled || err == InvalidWebAuthnResponse || err == InvalidSession || err == AccessTokensDisabled || err == HistoryDisabled || err == ReservedTokenClaim || err == OIDCDisabled || err == InvalidOIDCClient || err == InvalidOIDCGrant || err == InvalidOIDCToken || err == GroupAlreadyExists || err == InvalidArguments || err == InvalidCredentials || err == InvalidVerificationEmail || err == EmailNotVerified || err == PrimaryEmailNotRemovable || err == InvalidLoginName || err == InvalidPhoneCode || err == PhoneCodeAttemptsExceeded || err == phone.InvalidNumber || err == InvalidConfig
 }
 
 func newInvalidConfig(field string, value interface{}) error {
@@ -0,0 +1,15 @@
+package eventstream
+
+// NewTagPrefixStream prefixes the tags of all events, e.g. with the realm: "shop.user.created".
+func NewTagPrefixStream(stream Stream, prefix string) *tagPrefixStream {
+	return &tagPrefixStream{stream, prefix}
+}
+
+type tagPrefixStream struct {
+	Stream Stream
+	Prefix string
+}
+
+func (stream *tagPrefixStream) Publish(tag string, data []byte) {
+	stream.Stream.Publish(stream.Prefix+"."+tag, data)
+}
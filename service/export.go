@@ -0,0 +1,107 @@
+package service
+
+import (
+	"./audit"
+	"./session"
+	"./user"
+
+	"log"
+	"time"
+)
+
+// UserExport contains the personal data stored about a user, see ExportUser.
+type UserExport struct {
+	// User is the stored record without password hashes, TOTP secrets, recovery codes, tokens, codes and challenges.
+	User user.User
+
+	// History is the complete change history of the user, newest first. It is empty if the history is disabled.
+	History []audit.Entry
+
+	// Sessions are the active sessions of the user without the hashes of their tokens.
+	Sessions []session.Session
+
+	Exported time.Time
+}
+
+// ExportUser gathers all personal data stored about the user, e.g. to answer a subject access request.
+//
+// Event: user.exported(user_id, timestamp)
+func (us *UserService) ExportUser(userID string) (UserExport, error) {
+	if userID == "" {
+		return UserExport{}, InvalidArguments
+	}
+	log.Printf("call ExportUser('%s')\n", userID)
+
+	theUser, err := us.UserStorage.Get(userID)
+	if err != nil {
+		return UserExport{}, Mask(err)
+	}
+
+	var history []audit.Entry
+	if us.historyEnabled() {
+		if history, _, err = us.AuditStorage.FindByUser(userID, 0, 0); err != nil {
+			return UserExport{}, Mask(err)
+		}
+	}
+
+	sessions, err := us.ListSessions(userID)
+	if err != nil {
+		return UserExport{}, Mask(err)
+	}
+	for i := range sessions {
+		sessions[i].TokenHash = ""
+		sessions[i].RefreshTokenHash = ""
+		sessions[i].Code = nil
+	}
+
+	export := UserExport{
+		User:     withoutSecrets(theUser),
+		History:  history,
+		Sessions: sessions,
+		Exported: time.Now(),
+	}
+
+	us.logEvent("user.exported", map[string]interface{}{
+		"user_id":   userID,
+		"timestamp": export.Exported,
+	})
+	return export, nil
+}
+
+// withoutSecrets returns a copy of the user without any hashes, secrets, tokens, codes and challenges.
+func withoutSecrets(theUser user.User) user.User {
+	theUser.LoginPasswordHash = ""
+	theUser.PasswordHistory = nil
+	theUser.TOTPSecret = ""
+	theUser.TOTPLastCounter = 0
+	theUser.TOTPRecoveryCodes = nil
+	clearAuthChallenge(&theUser)
+
+	theUser.WebAuthnRegistrationChallenge = ""
+	theUser.WebAuthnRegistrationChallengeIssued = nil
+	theUser.WebAuthnLoginChallenge = ""
+	theUser.WebAuthnLoginChallengeIssued = nil
+
+	theUser.PhoneCodeHash = ""
+	theUser.PhoneCodePurpose = ""
+	theUser.PhoneCodeIssued = nil
+	theUser.PhoneCodeAttempts = 0
+
+	theUser.ResetPasswordToken = ""
+	theUser.ResetPasswordTokenIssued = nil
+	theUser.LoginLinkToken = ""
+	theUser.LoginLinkTokenIssued = nil
+	theUser.EmailVerificationToken = ""
+	theUser.EmailVerificationTokenIssued = nil
+	theUser.PendingEmailToken = ""
+	theUser.PendingEmailCancelToken = ""
+
+	secondaryEmails := make([]user.EmailAddress, 0, len(theUser.SecondaryEmails))
+	for _, address := range theUser.SecondaryEmails {
+		address.VerificationToken = ""
+		address.VerificationTokenIssued = nil
+		secondaryEmails = append(secondaryEmails, address)
+	}
+	theUser.SecondaryEmails = secondaryEmails
+	return theUser
+}
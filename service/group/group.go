@@ -0,0 +1,37 @@
+package group
+
+import (
+	"time"
+)
+
+// Group is a set of users. Its permissions are granted to all members, so a group also serves as role, e.g. an
+// "admins" group with the permission "wiki.admin".
+type Group struct {
+	Name        string
+	Description string
+
+	// Permissions are free-form names chosen by the consuming apps, e.g. "wiki.edit".
+	Permissions []string
+
+	// Members are the IDs of the users in the group. Each user lists its groups in user.User.Groups.
+	Members []string
+
+	Created time.Time
+}
+
+func (g *Group) HasMember(userID string) bool {
+	return contains(g.Members, userID)
+}
+
+func (g *Group) HasPermission(permission string) bool {
+	return contains(g.Permissions, permission)
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
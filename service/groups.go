@@ -0,0 +1,260 @@
+package service
+
+import (
+	"./group"
+	"./storage"
+	"./user"
+
+	"log"
+	"time"
+)
+
+// CreateGroup creates an empty group. Its permissions are granted to all members, see HasPermission.
+//
+// Event: user.group_created(group, permissions)
+func (us *UserService) CreateGroup(name, description string, permissions []string) error {
+	if name == "" || !validPermissions(permissions) {
+		return InvalidArguments
+	}
+	log.Printf("call CreateGroup('%s', ..)\n", name)
+
+	if _, err := us.GroupStorage.GetGroup(name); err == nil {
+		return GroupAlreadyExists
+	} else if err != storage.GroupNotFound {
+		return Mask(err)
+	}
+
+	theGroup := group.Group{
+		Name:        name,
+		Description: description,
+		Permissions: permissions,
+		Created:     time.Now(),
+	}
+	if err := us.GroupStorage.SaveGroup(theGroup); err != nil {
+		return Mask(err)
+	}
+
+	us.logEvent("user.group_created", map[string]interface{}{
+		"group":       name,
+		"permissions": permissions,
+	})
+	return nil
+}
+
+func (us *UserService) GetGroup(name string) (group.Group, error) {
+	if name == "" {
+		return group.Group{}, InvalidArguments
+	}
+	log.Printf("call GetGroup('%s')\n", name)
+
+	theGroup, err := us.GroupStorage.GetGroup(name)
+	return theGroup, Mask(err)
+}
+
+// DeleteGroup removes the group and the membership of all its members.
+//
+// Event: user.group_deleted(group, members)
+func (us *UserService) DeleteGroup(name string) error {
+	if name == "" {
+		return InvalidArguments
+	}
+	log.Printf("call DeleteGroup('%s')\n", name)
+
+	theGroup, err := us.GroupStorage.GetGroup(name)
+	if err != nil {
+		return Mask(err)
+	}
+
+	for _, userID := range theGroup.Members {
+		err := us.readModifyWrite(userID, func(theUser *user.User) error {
+			theUser.Groups = without(theUser.Groups, name)
+			return nil
+		})
+		if err != nil && !IsNotFoundError(err) {
+			return Mask(err)
+		}
+	}
+	if err := us.GroupStorage.RemoveGroup(name); err != nil {
+		return Mask(err)
+	}
+
+	us.logEvent("user.group_deleted", map[string]interface{}{
+		"group":   name,
+		"members": theGroup.Members,
+	})
+	return nil
+}
+
+// SetGroupPermissions replaces the permissions granted to the members of the group.
+//
+// Event: user.group_permissions_changed(group, permissions)
+func (us *UserService) SetGroupPermissions(name string, permissions []string) error {
+	if name == "" || !validPermissions(permissions) {
+		return InvalidArguments
+	}
+	log.Printf("call SetGroupPermissions('%s', ..)\n", name)
+
+	theGroup, err := us.GroupStorage.GetGroup(name)
+	if err != nil {
+		return Mask(err)
+	}
+	theGroup.Permissions = permissions
+	if err := us.GroupStorage.SaveGroup(theGroup); err != nil {
+		return Mask(err)
+	}
+
+	us.logEvent("user.group_permissions_changed", map[string]interface{}{
+		"group":       name,
+		"permissions": permissions,
+	})
+	return nil
+}
+
+// AddGroupMember adds the user to the group. Adding an existing member changes nothing.
+//
+// Event: user.group_member_added(user_id, group)
+func (us *UserService) AddGroupMember(name, userID string) error {
+	if name == "" || userID == "" {
+		return InvalidArguments
+	}
+	log.Printf("call AddGroupMember('%s', '%s')\n", name, userID)
+
+	theGroup, err := us.GroupStorage.GetGroup(name)
+	if err != nil {
+		return Mask(err)
+	}
+
+	err = us.readModifyWrite(userID, func(theUser *user.User) error {
+		if !contains(theUser.Groups, name) {
+			theUser.Groups = append(theUser.Groups, name)
+		}
+		return nil
+	})
+	if err != nil {
+		return Mask(err)
+	}
+
+	if theGroup.HasMember(userID) {
+		return nil
+	}
+	theGroup.Members = append(theGroup.Members, userID)
+	if err := us.GroupStorage.SaveGroup(theGroup); err != nil {
+		return Mask(err)
+	}
+
+	us.logEvent("user.group_member_added", map[string]interface{}{
+		"user_id": userID,
+		"group":   name,
+	})
+	return nil
+}
+
+// RemoveGroupMember removes the user from the group.
+//
+// Event: user.group_member_removed(user_id, group)
+func (us *UserService) RemoveGroupMember(name, userID string) error {
+	if name == "" || userID == "" {
+		return InvalidArguments
+	}
+	log.Printf("call RemoveGroupMember('%s', '%s')\n", name, userID)
+
+	theGroup, err := us.GroupStorage.GetGroup(name)
+	if err != nil {
+		return Mask(err)
+	}
+
+	err = us.readModifyWrite(userID, func(theUser *user.User) error {
+		theUser.Groups = without(theUser.Groups, name)
+		return nil
+	})
+	if err != nil {
+		return Mask(err)
+	}
+
+	if !theGroup.HasMember(userID) {
+		return nil
+	}
+	theGroup.Members = without(theGroup.Members, userID)
+	if err := us.GroupStorage.SaveGroup(theGroup); err != nil {
+		return Mask(err)
+	}
+
+	us.logEvent("user.group_member_removed", map[string]interface{}{
+		"user_id": userID,
+		"group":   name,
+	})
+	return nil
+}
+
+// UserGroups returns the names of the groups the user is a member of.
+func (us *UserService) UserGroups(userID string) ([]string, error) {
+	if userID == "" {
+		return nil, InvalidArguments
+	}
+	log.Printf("call UserGroups('%s')\n", userID)
+
+	theUser, err := us.UserStorage.Get(userID)
+	if err != nil {
+		return nil, Mask(err)
+	}
+	return theUser.Groups, nil
+}
+
+// HasPermission returns true, if one of the user's groups grants the permission. Locked and disabled users have no
+// permissions.
+func (us *UserService) HasPermission(userID, permission string) (bool, error) {
+	if userID == "" || permission == "" {
+		return false, InvalidArguments
+	}
+	log.Printf("call HasPermission('%s', '%s')\n", userID, permission)
+
+	theUser, err := us.UserStorage.Get(userID)
+	if err != nil {
+		return false, Mask(err)
+	}
+	if !theUser.IsActive() {
+		return false, nil
+	}
+
+	for _, name := range theUser.Groups {
+		theGroup, err := us.GroupStorage.GetGroup(name)
+		if err == storage.GroupNotFound {
+			continue
+		} else if err != nil {
+			return false, Mask(err)
+		}
+		if theGroup.HasPermission(permission) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func validPermissions(permissions []string) bool {
+	for _, permission := range permissions {
+		if permission == "" {
+			return false
+		}
+	}
+	return true
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// without returns the values except the given one.
+func without(values []string, value string) []string {
+	result := make([]string, 0, len(values))
+	for _, v := range values {
+		if v != value {
+			result = append(result, v)
+		}
+	}
+	return result
+}
@@ -0,0 +1,64 @@
+package service
+
+import (
+	"./audit"
+
+	"log"
+	"time"
+)
+
+// MaxHistoryLimit is the maximum number of entries returned by UserHistory at once.
+const MaxHistoryLimit = 100
+
+// UserHistory returns the change history of the user, newest first, skipping the first offset entries. Returns also
+// the total number of entries. Entries are kept for Config.AuditRetention.
+func (us *UserService) UserHistory(userID string, offset, limit int) ([]audit.Entry, int, error) {
+	if userID == "" || offset < 0 || limit <= 0 || limit > MaxHistoryLimit {
+		return nil, 0, InvalidArguments
+	}
+	if !us.historyEnabled() {
+		return nil, 0, HistoryDisabled
+	}
+	log.Printf("call UserHistory('%s', %d, %d)\n", userID, offset, limit)
+
+	if _, err := us.UserStorage.Get(userID); err != nil {
+		return nil, 0, Mask(err)
+	}
+
+	entries, total, err := us.AuditStorage.FindByUser(userID, offset, limit)
+	if err != nil {
+		return nil, 0, Mask(err)
+	}
+	return entries, total, nil
+}
+
+func (us *UserService) historyEnabled() bool {
+	return us.AuditStorage != nil && us.AuditRetention > 0
+}
+
+// recordHistory adds an entry to the change history of the user the event belongs to. Events without a user_id,
+// e.g. of groups, are not recorded. Errors are only logged, as the change itself has already been made.
+func (us *UserService) recordHistory(tag string, event map[string]interface{}) {
+	if !us.historyEnabled() {
+		return
+	}
+	userID, ok := event["user_id"].(string)
+	if !ok || userID == "" {
+		return
+	}
+
+	fields := make([]string, 0, len(event))
+	for name := range event {
+		if name != "user_id" && name != "timestamp" {
+			fields = append(fields, name)
+		}
+	}
+
+	entry, err := audit.NewEntry(userID, tag, time.Now(), us.actor, us.requestID, fields)
+	if err == nil {
+		err = us.AuditStorage.Add(entry, us.AuditRetention)
+	}
+	if err != nil {
+		log.Printf("Failed to record %s of user %s in the history: %v\n", tag, userID, err)
+	}
+}
@@ -24,3 +24,12 @@ func (seq *sequenceFactory) NewUserID() string {
 func (seq *sequenceFactory) NewResetPasswordToken() string {
 	return seq.NewUserID()
 }
+func (seq *sequenceFactory) NewEmailVerificationToken() string {
+	return seq.NewUserID()
+}
+func (seq *sequenceFactory) NewAuthChallenge() string {
+	return seq.NewUserID()
+}
+func (seq *sequenceFactory) NewLoginLinkToken() string {
+	return seq.NewUserID()
+}
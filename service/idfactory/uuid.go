@@ -13,3 +13,15 @@ func (factory *UUIDFactory) NewUserID() string {
 func (factory *UUIDFactory) NewResetPasswordToken() string {
 	return uuid.New()
 }
+
+func (factory *UUIDFactory) NewEmailVerificationToken() string {
+	return uuid.New()
+}
+
+func (factory *UUIDFactory) NewAuthChallenge() string {
+	return uuid.New()
+}
+
+func (factory *UUIDFactory) NewLoginLinkToken() string {
+	return uuid.New()
+}
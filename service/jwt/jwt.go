@@ -0,0 +1,135 @@
+// Package jwt signs and verifies JSON Web Tokens (RFC 7519) with RS256 or EdDSA (Ed25519) keys.
+//
+// The tokens are compact serialized JWS with the key ID in the "kid" header, so verifiers can pick the matching key
+// from the published JWKS.
+package jwt
+
+import (
+	"github.com/juju/errgo"
+
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+var (
+	InvalidToken = errgo.New("Invalid token.")
+	UnknownKey   = errgo.New("The token was signed by an unknown key.")
+	TokenExpired = errgo.New("The token has expired.")
+)
+
+var (
+	encoding   = base64.RawURLEncoding
+	randReader = rand.Reader
+)
+
+func encode(data []byte) string {
+	return encoding.EncodeToString(data)
+}
+
+// Claims are the payload of a token. Numbers are decoded as json.Number.
+type Claims map[string]interface{}
+
+type header struct {
+	Algorithm string `json:"alg"`
+	Type      string `json:"typ,omitempty"`
+	KeyID     string `json:"kid"`
+}
+
+// Sign returns the token for the claims, signed with the first key of the set.
+func (s *KeySet) Sign(claims Claims) (string, error) {
+	keys := s.Keys()
+	if len(keys) == 0 {
+		return "", NoSigningKey
+	}
+	return SignWithKey(keys[0], claims)
+}
+
+// SignWithKey returns the token for the claims, signed with the given key.
+func SignWithKey(key *Key, claims Claims) (string, error) {
+	headerJSON, err := json.Marshal(header{key.Algorithm, "JWT", key.ID})
+	if err != nil {
+		return "", errgo.Mask(err)
+	}
+	claimsJSON, err := json.Marshal(claims)
+	if err != nil {
+		return "", errgo.Mask(err)
+	}
+
+	signingInput := encode(headerJSON) + "." + encode(claimsJSON)
+	signature, err := key.sign([]byte(signingInput))
+	if err != nil {
+		return "", errgo.Mask(err)
+	}
+	return signingInput + "." + encode(signature), nil
+}
+
+// Verify checks the signature of the token with the matching key of the set and returns its claims.
+// Tokens which are expired ("exp") or not yet valid ("nbf") at the given time are rejected.
+func (s *KeySet) Verify(token string, now time.Time) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, InvalidToken
+	}
+
+	headerJSON, err1 := encoding.DecodeString(parts[0])
+	claimsJSON, err2 := encoding.DecodeString(parts[1])
+	signature, err3 := encoding.DecodeString(parts[2])
+	if err1 != nil || err2 != nil || err3 != nil {
+		return nil, InvalidToken
+	}
+
+	var h header
+	if err := json.Unmarshal(headerJSON, &h); err != nil {
+		return nil, InvalidToken
+	}
+
+	var key *Key
+	for _, k := range s.Keys() {
+		if k.ID == h.KeyID {
+			key = k
+			break
+		}
+	}
+	if key == nil {
+		return nil, UnknownKey
+	}
+	// Never let the token choose the algorithm, see RFC 8725 section 3.1
+	if h.Algorithm != key.Algorithm {
+		return nil, InvalidToken
+	}
+	if !key.verify([]byte(parts[0]+"."+parts[1]), signature) {
+		return nil, InvalidToken
+	}
+
+	var claims Claims
+	decoder := json.NewDecoder(bytes.NewReader(claimsJSON))
+	decoder.UseNumber()
+	if err := decoder.Decode(&claims); err != nil {
+		return nil, InvalidToken
+	}
+
+	if exp, ok := claims.time("exp"); ok && !now.Before(exp) {
+		return nil, TokenExpired
+	}
+	if nbf, ok := claims.time("nbf"); ok && now.Before(nbf) {
+		return nil, InvalidToken
+	}
+	return claims, nil
+}
+
+// time returns a NumericDate claim.
+func (c Claims) time(name string) (time.Time, bool) {
+	number, ok := c[name].(json.Number)
+	if !ok {
+		return time.Time{}, false
+	}
+	seconds, err := number.Int64()
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(seconds, 0), true
+}
@@ -0,0 +1,160 @@
+package jwt
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeKeyFile(t *testing.T, dir, name string, privateKey interface{}) string {
+	data, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: data}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func newEd25519Key(t *testing.T) ed25519.PrivateKey {
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return privateKey
+}
+
+func TestSignAndVerify(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "jwt")
+	defer os.RemoveAll(dir)
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, privateKey := range []interface{}{rsaKey, newEd25519Key(t)} {
+		keySet, err := NewKeySet([]string{writeKeyFile(t, dir, "key.pem", privateKey)}, time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		now := time.Now()
+		token, err := keySet.Sign(Claims{"sub": "user-1", "exp": now.Add(time.Minute).Unix()})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		claims, err := keySet.Verify(token, now)
+		if err != nil {
+			t.Fatalf("%s: %v", keySet.Keys()[0].Algorithm, err)
+		}
+		if claims["sub"] != "user-1" {
+			t.Fatalf("Unexpected claims %#v", claims)
+		}
+
+		if _, err := keySet.Verify(token, now.Add(time.Minute)); err != TokenExpired {
+			t.Fatalf("Expected TokenExpired, got %v", err)
+		}
+
+		parts := strings.Split(token, ".")
+		tampered := parts[0] + "." + encode([]byte(`{"sub":"user-2"}`)) + "." + parts[2]
+		if _, err := keySet.Verify(tampered, now); err != InvalidToken {
+			t.Fatalf("Expected InvalidToken, got %v", err)
+		}
+	}
+}
+
+func TestVerifyRejectsAlgorithmOfToken(t *testing.T) {
+	key := newKey(AlgEdDSA, newEd25519Key(t))
+	keySet := &KeySet{keys: []*Key{key}, checkInterval: time.Hour, lastCheck: time.Now()}
+
+	token, err := SignWithKey(key, Claims{"sub": "user-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := strings.Split(token, ".")
+	unsigned := encode([]byte(`{"alg":"none","kid":"`+key.ID+`"}`)) + "." + parts[1] + "."
+	if _, err := keySet.Verify(unsigned, time.Now()); err != InvalidToken {
+		t.Fatalf("Expected InvalidToken, got %v", err)
+	}
+}
+
+func TestKeyIDIsThumbprint(t *testing.T) {
+	// Example of RFC 8037 appendix A
+	seed, _ := encoding.DecodeString("nWGxne_9WmC6hEr0kuwsxERJxWl7MmkZcDusAxyuf2A")
+	key := newKey(AlgEdDSA, ed25519.NewKeyFromSeed(seed))
+
+	if key.ID != "kPrK_qmxVWaYVA9wwBF6Iuo3vVzz7TxHCTwXBygrS4k" {
+		t.Fatalf("Unexpected key ID %s", key.ID)
+	}
+	if jwk := key.PublicKey(); jwk.X != "11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo" {
+		t.Fatalf("Unexpected public key %#v", jwk)
+	}
+}
+
+func TestRotation(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "jwt")
+	defer os.RemoveAll(dir)
+
+	first := writeKeyFile(t, dir, "first.pem", newEd25519Key(t))
+	keySet, err := NewKeySet([]string{first}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldToken, err := keySet.Sign(Claims{"sub": "user-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The new key signs, the old one is still published
+	second := writeKeyFile(t, dir, "second.pem", newEd25519Key(t))
+	keySet.paths = []string{second, first}
+	keySet.modTimes = append(keySet.modTimes, time.Time{})
+
+	newToken, err := keySet.Sign(Claims{"sub": "user-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keySet.PublicKeys().Keys) != 2 {
+		t.Fatalf("Expected 2 public keys, got %#v", keySet.PublicKeys())
+	}
+	for _, token := range []string{oldToken, newToken} {
+		if _, err := keySet.Verify(token, time.Now()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if strings.Split(oldToken, ".")[0] == strings.Split(newToken, ".")[0] {
+		t.Fatalf("Expected the new key to sign")
+	}
+
+	// A broken key file keeps the previous keys
+	if err := ioutil.WriteFile(second, []byte("broken"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	os.Chtimes(second, time.Now(), time.Now().Add(time.Hour))
+	if _, err := keySet.Verify(newToken, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestParseKeyRejectsSmallRSAKeys(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)})
+	if _, err := ParseKey(data); err != UnsupportedKey {
+		t.Fatalf("Expected UnsupportedKey, got %v", err)
+	}
+}
@@ -0,0 +1,256 @@
+package jwt
+
+import (
+	"github.com/juju/errgo"
+
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"os"
+	"sync"
+	"time"
+)
+
+// Signature algorithms, see RFC 7518 and RFC 8037.
+const (
+	AlgRS256 = "RS256"
+	AlgEdDSA = "EdDSA"
+)
+
+// minRSABits is the minimum size of RSA signing keys required by RFC 7518.
+const minRSABits = 2048
+
+var (
+	InvalidKeyFile = errgo.New("Invalid key file.")
+	UnsupportedKey = errgo.New("Unsupported key type, use RSA or Ed25519.")
+	NoSigningKey   = errgo.New("No signing key.")
+)
+
+// Key is a private signing key. The ID is the JWK thumbprint (RFC 7638) of the public key.
+type Key struct {
+	ID        string
+	Algorithm string
+
+	signer crypto.Signer
+}
+
+// ParseKey reads a PEM encoded RSA (PKCS #1 or PKCS #8) or Ed25519 (PKCS #8) private key.
+func ParseKey(data []byte) (*Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, InvalidKeyFile
+	}
+
+	var privateKey interface{}
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		privateKey, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		privateKey, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	default:
+		return nil, InvalidKeyFile
+	}
+	if err != nil {
+		return nil, InvalidKeyFile
+	}
+
+	switch privateKey := privateKey.(type) {
+	case *rsa.PrivateKey:
+		if privateKey.N.BitLen() < minRSABits {
+			return nil, UnsupportedKey
+		}
+		return newKey(AlgRS256, privateKey), nil
+	case ed25519.PrivateKey:
+		return newKey(AlgEdDSA, privateKey), nil
+	default:
+		return nil, UnsupportedKey
+	}
+}
+
+func newKey(algorithm string, signer crypto.Signer) *Key {
+	key := &Key{Algorithm: algorithm, signer: signer}
+	key.ID = key.thumbprint()
+	return key
+}
+
+// PublicKey returns the public key as JWK.
+func (k *Key) PublicKey() JSONWebKey {
+	jwk := JSONWebKey{KeyID: k.ID, Use: "sig", Algorithm: k.Algorithm}
+	switch publicKey := k.signer.Public().(type) {
+	case *rsa.PublicKey:
+		jwk.KeyType = "RSA"
+		jwk.N = encode(publicKey.N.Bytes())
+		jwk.E = encode(big.NewInt(int64(publicKey.E)).Bytes())
+	case ed25519.PublicKey:
+		jwk.KeyType = "OKP"
+		jwk.Curve = "Ed25519"
+		jwk.X = encode(publicKey)
+	}
+	return jwk
+}
+
+// thumbprint hashes the required members of the public JWK in lexicographic order, see RFC 7638.
+func (k *Key) thumbprint() string {
+	jwk := k.PublicKey()
+
+	var members interface{}
+	if jwk.KeyType == "RSA" {
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{jwk.E, jwk.KeyType, jwk.N}
+	} else {
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{jwk.Curve, jwk.KeyType, jwk.X}
+	}
+
+	data, _ := json.Marshal(members)
+	hash := sha256.Sum256(data)
+	return encode(hash[:])
+}
+
+func (k *Key) sign(data []byte) ([]byte, error) {
+	if k.Algorithm == AlgEdDSA {
+		return k.signer.Sign(nil, data, crypto.Hash(0))
+	}
+	hash := sha256.Sum256(data)
+	return k.signer.Sign(randReader, hash[:], crypto.SHA256)
+}
+
+func (k *Key) verify(data, signature []byte) bool {
+	switch publicKey := k.signer.Public().(type) {
+	case *rsa.PublicKey:
+		hash := sha256.Sum256(data)
+		return rsa.VerifyPKCS1v15(publicKey, crypto.SHA256, hash[:], signature) == nil
+	case ed25519.PublicKey:
+		return ed25519.Verify(publicKey, data, signature)
+	default:
+		return false
+	}
+}
+
+// JSONWebKey is the public part of a signing key, see RFC 7517.
+type JSONWebKey struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+
+	// OKP
+	Curve string `json:"crv,omitempty"`
+	X     string `json:"x,omitempty"`
+}
+
+// JSONWebKeySet is published as /.well-known/jwks.json.
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+// -------------------------------------------------
+
+// NewKeySet loads the private keys from the given files. The first key signs new tokens, the others are only
+// published, so tokens signed before a rotation can still be verified.
+//
+// The files are checked for changes every checkInterval, so keys can be rotated without a restart: Add the new
+// key as the first file, keep the previous one until the tokens signed by it have expired. If the changed files
+// can not be loaded, the previous keys stay in use.
+func NewKeySet(paths []string, checkInterval time.Duration) (*KeySet, error) {
+	if len(paths) == 0 {
+		return nil, NoSigningKey
+	}
+
+	keySet := &KeySet{paths: paths, checkInterval: checkInterval}
+	if err := keySet.load(); err != nil {
+		return nil, errgo.Mask(err, errgo.Any)
+	}
+	return keySet, nil
+}
+
+// KeySet signs tokens with the first of its keys and verifies them with any of them.
+type KeySet struct {
+	paths         []string
+	checkInterval time.Duration
+
+	mutex     sync.Mutex
+	keys      []*Key
+	modTimes  []time.Time
+	lastCheck time.Time
+}
+
+// Keys returns the current keys, the signing key first.
+func (s *KeySet) Keys() []*Key {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if time.Since(s.lastCheck) >= s.checkInterval {
+		s.lastCheck = time.Now()
+		if s.changed() {
+			if err := s.load(); err != nil {
+				log.Printf("Failed to reload the JWT keys, keeping the previous ones: %v\n", err)
+			}
+		}
+	}
+	return s.keys
+}
+
+// PublicKeys returns the JWKS of all keys.
+func (s *KeySet) PublicKeys() JSONWebKeySet {
+	keys := s.Keys()
+	keySet := JSONWebKeySet{Keys: make([]JSONWebKey, 0, len(keys))}
+	for _, key := range keys {
+		keySet.Keys = append(keySet.Keys, key.PublicKey())
+	}
+	return keySet
+}
+
+func (s *KeySet) changed() bool {
+	for i, path := range s.paths {
+		info, err := os.Stat(path)
+		if err != nil || !info.ModTime().Equal(s.modTimes[i]) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *KeySet) load() error {
+	keys := make([]*Key, 0, len(s.paths))
+	modTimes := make([]time.Time, 0, len(s.paths))
+	for _, path := range s.paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return errgo.Mask(err)
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return errgo.Mask(err)
+		}
+		key, err := ParseKey(data)
+		if err != nil {
+			return errgo.Notef(err, "%s", path)
+		}
+		keys = append(keys, key)
+		modTimes = append(modTimes, info.ModTime())
+	}
+
+	s.keys = keys
+	s.modTimes = modTimes
+	s.lastCheck = time.Now()
+	return nil
+}
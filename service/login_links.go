@@ -0,0 +1,111 @@
+package service
+
+import (
+	"./user"
+
+	"log"
+	"time"
+)
+
+// NewLoginLinkToken creates a token to authenticate the user with the given email without password. The consumer
+// should send a link containing the token to this address, the link proves that the user can receive mails with it.
+// Besides the primary email, any verified secondary address can be given. Any previous token of the user becomes
+// invalid.
+//
+// Event: user.login_link_requested(user_id, profile_name, email, token, timestamp, expires)
+//
+// Returns the token or an error if no user could be found.
+func (us *UserService) NewLoginLinkToken(email string) (string, error) {
+	if email == "" {
+		return "", InvalidArguments
+	}
+	if !us.EnableLoginLinks {
+		return "", LoginLinksDisabled
+	}
+	log.Printf("call NewLoginLinkToken('%s')\n", email)
+
+	u, err := us.findByEmail(email)
+	if err != nil {
+		return "", Mask(err)
+	}
+
+	if err := checkUserActive(&u); err != nil {
+		return "", Mask(err)
+	}
+
+	now := time.Now()
+	u.LoginLinkToken = us.IdFactory.NewLoginLinkToken()
+	u.LoginLinkTokenIssued = &now
+
+	if err := us.UserStorage.Save(u); err != nil {
+		return "", Mask(err)
+	}
+
+	us.logEvent("user.login_link_requested", map[string]interface{}{
+		"user_id":      u.ID,
+		"profile_name": u.ProfileName,
+		"email":        email,
+		"token":        u.LoginLinkToken,
+		"timestamp":    u.LoginLinkTokenIssued,
+		"expires":      u.LoginLinkTokenIssued.Add(us.LoginLinkExpireTime),
+	})
+	return u.LoginLinkToken, nil
+}
+
+// AuthenticateWithLoginLinkToken authenticates the user, who owns the token created by NewLoginLinkToken. The token
+// can only be used once, even if the authentication fails. As the link proves access to the email, the address
+// needs no prior verification. If the user enabled a second factor, a *SecondFactorRequired is returned instead, see
+// CompleteAuthentication.
+//
+// Event: user.authenticated(user_id, method, groups)
+//
+// Returns the ID of the authenticated user.
+func (us *UserService) AuthenticateWithLoginLinkToken(token string) (string, error) {
+	if token == "" {
+		return "", InvalidArguments
+	}
+	if !us.EnableLoginLinks {
+		return "", LoginLinksDisabled
+	}
+	log.Printf("call AuthenticateWithLoginLinkToken(..)\n")
+
+	theUser, err := us.UserStorage.FindByLoginLinkToken(token)
+	if err != nil {
+		if IsNotFoundError(err) {
+			return "", InvalidCredentials
+		}
+		return "", Mask(err)
+	}
+
+	expired := time.Now().After(theUser.LoginLinkTokenIssued.Add(us.LoginLinkExpireTime))
+
+	// The token is used up, even if the authentication fails
+	clearLoginLinkToken(&theUser)
+	if err := us.UserStorage.Save(theUser); err != nil {
+		return "", Mask(err)
+	}
+	if expired {
+		return "", Mask(LoginLinkTokenExpired)
+	}
+
+	if err := checkUserActive(&theUser); err != nil {
+		return "", Mask(err)
+	}
+
+	if methods := secondFactorMethods(&theUser); len(methods) > 0 {
+		return "", us.requireSecondFactor(theUser, methods)
+	}
+
+	us.logEvent("user.authenticated", map[string]interface{}{
+		"user_id": theUser.ID,
+		"method":  "login_link",
+		"groups":  theUser.Groups,
+	})
+
+	return theUser.ID, nil
+}
+
+func clearLoginLinkToken(theUser *user.User) {
+	theUser.LoginLinkToken = ""
+	theUser.LoginLinkTokenIssued = nil
+}
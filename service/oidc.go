@@ -0,0 +1,354 @@
+package service
+
+import (
+	"./jwt"
+	"./oidc"
+	"./session"
+	"./storage"
+	"./user"
+
+	"log"
+	"strings"
+	"time"
+)
+
+// OIDCAuthorization is the authorization request of an OpenID Connect client.
+type OIDCAuthorization struct {
+	ClientID      string
+	RedirectURI   string
+	Scope         string
+	Nonce         string
+	CodeChallenge string
+}
+
+// OIDCTokens are returned by the token endpoint of the OpenID Connect provider.
+type OIDCTokens struct {
+	AccessToken  string
+	IDToken      string
+	RefreshToken string
+	Expires      time.Time
+	Scope        []string
+}
+
+// OIDCDiscovery returns the provider metadata.
+func (us *UserService) OIDCDiscovery() (oidc.Discovery, error) {
+	if err := us.checkOIDCEnabled(); err != nil {
+		return oidc.Discovery{}, err
+	}
+
+	var algorithms []string
+	seen := map[string]bool{}
+	for _, key := range us.TokenSigner.PublicKeys().Keys {
+		if !seen[key.Algorithm] {
+			seen[key.Algorithm] = true
+			algorithms = append(algorithms, key.Algorithm)
+		}
+	}
+	return oidc.NewDiscovery(us.OIDCIssuer, algorithms), nil
+}
+
+// CheckOIDCClient returns the client, if it is registered and allows the redirect URI. Otherwise the user must not be
+// redirected back, as the redirect URI could belong to an attacker.
+func (us *UserService) CheckOIDCClient(clientID, redirectURI string) (oidc.Client, error) {
+	if err := us.checkOIDCEnabled(); err != nil {
+		return oidc.Client{}, err
+	}
+
+	client, ok := us.findOIDCClient(clientID)
+	if !ok || !client.AllowsRedirectURI(redirectURI) {
+		return oidc.Client{}, InvalidOIDCClient
+	}
+	return client, nil
+}
+
+// AuthorizeOIDC issues an authorization code for a user, which was authenticated by the login page of the provider.
+// The code can be exchanged once for tokens with ExchangeOIDCCode and expires after Config.OIDCCodeExpireTime.
+//
+// Event: user.oidc_authorized(user_id, client_id, scope)
+func (us *UserService) AuthorizeOIDC(userID string, authorization OIDCAuthorization) (string, error) {
+	if userID == "" || authorization.CodeChallenge == "" {
+		return "", InvalidArguments
+	}
+	log.Printf("call AuthorizeOIDC('%s', '%s')\n", userID, authorization.ClientID)
+
+	client, err := us.CheckOIDCClient(authorization.ClientID, authorization.RedirectURI)
+	if err != nil {
+		return "", Mask(err)
+	}
+	scope := oidc.ParseScope(authorization.Scope)
+	if !oidc.HasScope(scope, oidc.ScopeOpenID) {
+		return "", InvalidArguments
+	}
+
+	theUser, err := us.UserStorage.Get(userID)
+	if err != nil {
+		return "", Mask(err)
+	}
+	if err := checkUserActive(&theUser); err != nil {
+		return "", Mask(err)
+	}
+
+	sessionID, err := session.NewToken()
+	if err != nil {
+		return "", Mask(err)
+	}
+	code, err := session.NewToken()
+	if err != nil {
+		return "", Mask(err)
+	}
+
+	now := time.Now()
+	expires := now.Add(us.OIDCCodeExpireTime)
+	theSession := session.Session{
+		ID:       sessionID,
+		UserID:   theUser.ID,
+		Expires:  expires,
+		Created:  now,
+		ClientID: client.ID,
+		Scope:    scope,
+		Code: &session.AuthorizationCode{
+			Hash:          session.HashToken(code),
+			Expires:       expires,
+			RedirectURI:   authorization.RedirectURI,
+			CodeChallenge: authorization.CodeChallenge,
+			Nonce:         authorization.Nonce,
+		},
+	}
+	if err := us.SessionStorage.Save(theSession); err != nil {
+		return "", Mask(err)
+	}
+
+	us.logEvent("user.oidc_authorized", map[string]interface{}{
+		"user_id":   theUser.ID,
+		"client_id": client.ID,
+		"scope":     strings.Join(scope, " "),
+	})
+	return code, nil
+}
+
+// ExchangeOIDCCode returns the tokens for an authorization code. The redirect URI and the PKCE code verifier must
+// match the authorization request. If a code is used twice, it was probably intercepted, so the session and its
+// tokens are revoked.
+//
+// Event: user.session_created(user_id, session_id, client_id)
+// Event: user.oidc_code_reused(user_id, client_id)
+func (us *UserService) ExchangeOIDCCode(clientID, clientSecret, code, redirectURI, codeVerifier string) (OIDCTokens, error) {
+	if code == "" || codeVerifier == "" {
+		return OIDCTokens{}, InvalidOIDCGrant
+	}
+	log.Printf("call ExchangeOIDCCode('%s', ..)\n", clientID)
+
+	client, err := us.authenticateOIDCClient(clientID, clientSecret)
+	if err != nil {
+		return OIDCTokens{}, Mask(err)
+	}
+
+	codeHash := session.HashToken(code)
+	theSession, err := us.SessionStorage.FindByAuthorizationCode(codeHash)
+	if err == storage.SessionNotFound {
+		return OIDCTokens{}, InvalidOIDCGrant
+	} else if err != nil {
+		return OIDCTokens{}, Mask(err)
+	}
+
+	if theSession.Code == nil || theSession.Code.Hash != codeHash {
+		if err := us.SessionStorage.Remove(theSession.ID); err != nil && err != storage.SessionNotFound {
+			return OIDCTokens{}, Mask(err)
+		}
+		us.logEvent("user.oidc_code_reused", map[string]interface{}{
+			"user_id":   theSession.UserID,
+			"client_id": theSession.ClientID,
+		})
+		return OIDCTokens{}, InvalidOIDCGrant
+	}
+
+	authorizationCode := theSession.Code
+	if theSession.ClientID != client.ID || authorizationCode.RedirectURI != redirectURI || !time.Now().Before(authorizationCode.Expires) {
+		return OIDCTokens{}, InvalidOIDCGrant
+	}
+	if !oidc.VerifyCodeChallenge(authorizationCode.CodeChallenge, codeVerifier) {
+		return OIDCTokens{}, InvalidOIDCGrant
+	}
+
+	theUser, err := us.UserStorage.Get(theSession.UserID)
+	if err != nil {
+		return OIDCTokens{}, Mask(err)
+	}
+	if err := checkUserActive(&theUser); err != nil {
+		return OIDCTokens{}, Mask(err)
+	}
+
+	// The code index keeps pointing to the session, so a second use is detected
+	theSession.Code = nil
+	sessionTokens, err := us.issueSessionTokens(&theSession)
+	if err != nil {
+		return OIDCTokens{}, Mask(err)
+	}
+
+	us.logEvent("user.session_created", map[string]interface{}{
+		"user_id":    theSession.UserID,
+		"session_id": theSession.ID,
+		"client_id":  theSession.ClientID,
+	})
+
+	return us.issueOIDCTokens(&theUser, &theSession, sessionTokens, authorizationCode.Nonce)
+}
+
+// RefreshOIDCTokens returns new tokens for a refresh token issued by ExchangeOIDCCode, see RefreshSession.
+func (us *UserService) RefreshOIDCTokens(clientID, clientSecret, refreshToken string) (OIDCTokens, error) {
+	if refreshToken == "" {
+		return OIDCTokens{}, InvalidOIDCGrant
+	}
+	log.Printf("call RefreshOIDCTokens('%s', ..)\n", clientID)
+
+	client, err := us.authenticateOIDCClient(clientID, clientSecret)
+	if err != nil {
+		return OIDCTokens{}, Mask(err)
+	}
+
+	theSession, err := us.SessionStorage.FindByRefreshToken(session.HashToken(refreshToken))
+	if err == storage.SessionNotFound {
+		return OIDCTokens{}, InvalidOIDCGrant
+	} else if err != nil {
+		return OIDCTokens{}, Mask(err)
+	}
+	if theSession.ClientID != client.ID {
+		return OIDCTokens{}, InvalidOIDCGrant
+	}
+
+	sessionTokens, err := us.RefreshSession(refreshToken)
+	if err == InvalidSession {
+		return OIDCTokens{}, InvalidOIDCGrant
+	} else if err != nil {
+		return OIDCTokens{}, Mask(err)
+	}
+
+	theUser, err := us.UserStorage.Get(theSession.UserID)
+	if err != nil {
+		return OIDCTokens{}, Mask(err)
+	}
+	return us.issueOIDCTokens(&theUser, &theSession, sessionTokens, "")
+}
+
+// OIDCUserInfo returns the claims of the user for an access token issued by ExchangeOIDCCode or RefreshOIDCTokens.
+// Which claims are included depends on the authorized scope.
+func (us *UserService) OIDCUserInfo(accessToken string) (map[string]interface{}, error) {
+	if err := us.checkOIDCEnabled(); err != nil {
+		return nil, err
+	}
+	if accessToken == "" {
+		return nil, InvalidOIDCToken
+	}
+
+	claims, err := us.TokenSigner.Verify(accessToken, time.Now())
+	if err != nil {
+		return nil, InvalidOIDCToken
+	}
+	userID, _ := claims["sub"].(string)
+	scope, _ := claims["scope"].(string)
+	if _, ok := claims["client_id"].(string); !ok || claims["iss"] != us.OIDCIssuer || userID == "" {
+		return nil, InvalidOIDCToken
+	}
+
+	theUser, err := us.UserStorage.Get(userID)
+	if IsNotFoundError(err) {
+		return nil, InvalidOIDCToken
+	} else if err != nil {
+		return nil, Mask(err)
+	}
+	if err := checkUserActive(&theUser); err != nil {
+		return nil, InvalidOIDCToken
+	}
+
+	return userInfoClaims(&theUser, strings.Fields(scope)), nil
+}
+
+func (us *UserService) issueOIDCTokens(theUser *user.User, theSession *session.Session, sessionTokens SessionTokens, nonce string) (OIDCTokens, error) {
+	now := time.Now()
+	expires := now.Add(us.AccessTokenExpireTime)
+
+	accessClaims := accessTokenClaims(theUser, now, expires)
+	accessClaims["iss"] = us.OIDCIssuer
+	accessClaims["aud"] = theSession.ClientID
+	accessClaims["client_id"] = theSession.ClientID
+	accessClaims["scope"] = strings.Join(theSession.Scope, " ")
+
+	accessToken, err := us.TokenSigner.Sign(accessClaims)
+	if err != nil {
+		return OIDCTokens{}, err
+	}
+
+	idClaims := jwt.Claims{}
+	for name, value := range userInfoClaims(theUser, theSession.Scope) {
+		idClaims[name] = value
+	}
+	idClaims["iss"] = us.OIDCIssuer
+	idClaims["aud"] = theSession.ClientID
+	idClaims["iat"] = now.Unix()
+	idClaims["exp"] = expires.Unix()
+	idClaims["auth_time"] = theSession.Created.Unix()
+	if nonce != "" {
+		idClaims["nonce"] = nonce
+	}
+
+	idToken, err := us.TokenSigner.Sign(idClaims)
+	if err != nil {
+		return OIDCTokens{}, err
+	}
+
+	return OIDCTokens{
+		AccessToken:  accessToken,
+		IDToken:      idToken,
+		RefreshToken: sessionTokens.RefreshToken,
+		Expires:      expires,
+		Scope:        theSession.Scope,
+	}, nil
+}
+
+// userInfoClaims returns the standard claims of the user for the scope.
+func userInfoClaims(theUser *user.User, scope []string) map[string]interface{} {
+	claims := map[string]interface{}{
+		"sub": theUser.ID,
+	}
+	if oidc.HasScope(scope, oidc.ScopeProfile) {
+		claims["name"] = theUser.ProfileName
+		claims["preferred_username"] = theUser.LoginName
+	}
+	if oidc.HasScope(scope, oidc.ScopeEmail) {
+		claims["email"] = theUser.Email
+		claims["email_verified"] = theUser.EmailVerified
+	}
+	return claims
+}
+
+// authenticateOIDCClient checks the credentials of a client at the token endpoint. Public clients have no secret.
+func (us *UserService) authenticateOIDCClient(clientID, clientSecret string) (oidc.Client, error) {
+	if err := us.checkOIDCEnabled(); err != nil {
+		return oidc.Client{}, err
+	}
+
+	client, ok := us.findOIDCClient(clientID)
+	if !ok || !client.CheckSecret(clientSecret) {
+		return oidc.Client{}, InvalidOIDCClient
+	}
+	return client, nil
+}
+
+func (us *UserService) findOIDCClient(clientID string) (oidc.Client, bool) {
+	for _, client := range us.OIDCClients {
+		if client.ID == clientID {
+			return client, true
+		}
+	}
+	return oidc.Client{}, false
+}
+
+func (us *UserService) checkOIDCEnabled() error {
+	if us.OIDCIssuer == "" {
+		return OIDCDisabled
+	}
+	if us.TokenSigner == nil {
+		return AccessTokensDisabled
+	}
+	return nil
+}
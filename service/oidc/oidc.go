@@ -0,0 +1,189 @@
+// Package oidc contains the client registry and the protocol helpers of the OpenID Connect provider
+// (https://openid.net/specs/openid-connect-core-1_0.html). Only the authorization code flow with PKCE (RFC 7636,
+// method S256) is supported.
+package oidc
+
+import (
+	"github.com/juju/errgo"
+
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/url"
+	"strings"
+)
+
+// Scopes supported by the provider. ScopeOpenID is required for every authorization.
+const (
+	ScopeOpenID  = "openid"
+	ScopeProfile = "profile"
+	ScopeEmail   = "email"
+)
+
+var SupportedScopes = []string{ScopeOpenID, ScopeProfile, ScopeEmail}
+
+// Lengths of a PKCE code verifier, see RFC 7636 section 4.1.
+const (
+	minCodeVerifierLength = 43
+	maxCodeVerifierLength = 128
+)
+
+var InvalidClientsFile = errgo.New("Invalid OpenID Connect clients file.")
+
+// Client is a relying party, registered in the clients file.
+type Client struct {
+	ID   string `json:"client_id"`
+	Name string `json:"name"`
+
+	// Secret is empty for public clients like single page apps, which are only protected by PKCE.
+	Secret string `json:"client_secret"`
+
+	// RedirectURIs must match the redirect_uri of an authorization request exactly.
+	RedirectURIs []string `json:"redirect_uris"`
+}
+
+func (c *Client) IsPublic() bool {
+	return c.Secret == ""
+}
+
+// CheckSecret compares the secret in constant time. Public clients have no secret to check.
+func (c *Client) CheckSecret(secret string) bool {
+	if c.IsPublic() {
+		return secret == ""
+	}
+	return subtle.ConstantTimeCompare([]byte(c.Secret), []byte(secret)) == 1
+}
+
+func (c *Client) AllowsRedirectURI(redirectURI string) bool {
+	for _, uri := range c.RedirectURIs {
+		if uri == redirectURI {
+			return true
+		}
+	}
+	return false
+}
+
+// LoadClients reads the clients from a JSON file:
+//
+//	{
+//		"clients": [
+//			{
+//				"client_id": "wiki",
+//				"name": "Wiki",
+//				"client_secret": "...",
+//				"redirect_uris": ["https://wiki.example.com/oidc/callback"]
+//			}
+//		]
+//	}
+func LoadClients(path string) ([]Client, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+
+	var file struct {
+		Clients []Client `json:"clients"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, errgo.Notef(InvalidClientsFile, "%v", err)
+	}
+
+	seen := map[string]bool{}
+	for _, client := range file.Clients {
+		if client.ID == "" || seen[client.ID] {
+			return nil, errgo.Notef(InvalidClientsFile, "missing or duplicate client_id '%s'", client.ID)
+		}
+		seen[client.ID] = true
+
+		if len(client.RedirectURIs) == 0 {
+			return nil, errgo.Notef(InvalidClientsFile, "client '%s' has no redirect_uris", client.ID)
+		}
+		for _, redirectURI := range client.RedirectURIs {
+			if uri, err := url.Parse(redirectURI); err != nil || !uri.IsAbs() || uri.Fragment != "" {
+				return nil, errgo.Notef(InvalidClientsFile, "invalid redirect_uri '%s' of client '%s'", redirectURI, client.ID)
+			}
+		}
+	}
+	return file.Clients, nil
+}
+
+// -------------------------------------------------
+
+// VerifyCodeChallenge checks the PKCE code verifier against the S256 code challenge of the authorization request.
+func VerifyCodeChallenge(codeChallenge, codeVerifier string) bool {
+	if len(codeVerifier) < minCodeVerifierLength || len(codeVerifier) > maxCodeVerifierLength {
+		return false
+	}
+	sum := sha256.Sum256([]byte(codeVerifier))
+	expected := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(codeChallenge)) == 1
+}
+
+// ParseScope splits the scope parameter and drops unsupported and duplicate scopes.
+func ParseScope(scope string) []string {
+	var scopes []string
+	for _, s := range strings.Fields(scope) {
+		if HasScope(SupportedScopes, s) && !HasScope(scopes, s) {
+			scopes = append(scopes, s)
+		}
+	}
+	return scopes
+}
+
+func HasScope(scopes []string, scope string) bool {
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// -------------------------------------------------
+
+// Discovery is the provider metadata published at /.well-known/openid-configuration.
+type Discovery struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	UserInfoEndpoint                  string   `json:"userinfo_endpoint"`
+	JWKSURI                           string   `json:"jwks_uri"`
+	ScopesSupported                   []string `json:"scopes_supported"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+	ClaimsSupported                   []string `json:"claims_supported"`
+}
+
+// Paths of the provider endpoints below the issuer URL.
+const (
+	AuthorizationPath = "/oauth2/authorize"
+	TokenPath         = "/oauth2/token"
+	UserInfoPath      = "/oauth2/userinfo"
+	JWKSPath          = "/.well-known/jwks.json"
+	DiscoveryPath     = "/.well-known/openid-configuration"
+)
+
+// NewDiscovery returns the metadata for the issuer, e.g. "https://login.example.com" without a trailing slash.
+func NewDiscovery(issuer string, signingAlgorithms []string) Discovery {
+	return Discovery{
+		Issuer:                            issuer,
+		AuthorizationEndpoint:             issuer + AuthorizationPath,
+		TokenEndpoint:                     issuer + TokenPath,
+		UserInfoEndpoint:                  issuer + UserInfoPath,
+		JWKSURI:                           issuer + JWKSPath,
+		ScopesSupported:                   SupportedScopes,
+		ResponseTypesSupported:            []string{"code"},
+		GrantTypesSupported:               []string{"authorization_code", "refresh_token"},
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  signingAlgorithms,
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "none"},
+		CodeChallengeMethodsSupported:     []string{"S256"},
+		ClaimsSupported:                   []string{"sub", "iss", "aud", "exp", "iat", "auth_time", "nonce", "name", "preferred_username", "email", "email_verified"},
+	}
+}
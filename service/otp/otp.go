@@ -0,0 +1,25 @@
+// Package otp generates the short numeric one-time codes sent by email or SMS.
+package otp
+
+import (
+	"github.com/juju/errgo"
+
+	"crypto/rand"
+	"math/big"
+)
+
+// Digits is the length of the codes returned by NewCode.
+const Digits = 6
+
+// NewCode returns a random code of Digits digits.
+func NewCode() (string, error) {
+	code := make([]byte, Digits)
+	for i := range code {
+		n, err := rand.Int(rand.Reader, big.NewInt(10))
+		if err != nil {
+			return "", errgo.Mask(err)
+		}
+		code[i] = byte('0' + n.Int64())
+	}
+	return string(code), nil
+}
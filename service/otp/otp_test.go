@@ -0,0 +1,13 @@
+package otp
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNewCode(t *testing.T) {
+	code, err := NewCode()
+	if err != nil || len(code) != Digits || strings.Trim(code, "0123456789") != "" {
+		t.Fatalf("Expected a numeric code, got %s, %v", code, err)
+	}
+}
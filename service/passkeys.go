@@ -0,0 +1,370 @@
+package service
+
+import (
+	"./user"
+	"./webauthn"
+
+	"log"
+	"strings"
+	"time"
+)
+
+// The purposes of the WebAuthn challenges of a user, see webAuthnChallengeFields.
+const (
+	webAuthnRegistration = "registration"
+	webAuthnLogin        = "login"
+)
+
+// BeginWebAuthnRegistration starts the registration of a new passkey or security key for the user.
+// The returned options must be passed as publicKey to navigator.credentials.create() in the browser.
+func (us *UserService) BeginWebAuthnRegistration(userID string) (webauthn.CreationOptions, error) {
+	return us.beginWebAuthnRegistration(userID, us.withoutCurrentPassword)
+}
+
+// BeginWebAuthnRegistrationWithCurrentPassword is like BeginWebAuthnRegistration, but verifies the current password
+// first.
+func (us *UserService) BeginWebAuthnRegistrationWithCurrentPassword(userID, currentPassword string) (webauthn.CreationOptions, error) {
+	return us.beginWebAuthnRegistration(userID, us.withCurrentPassword(currentPassword))
+}
+
+func (us *UserService) beginWebAuthnRegistration(userID string, check credentialCheck) (webauthn.CreationOptions, error) {
+	if userID == "" {
+		return webauthn.CreationOptions{}, InvalidArguments
+	}
+	if us.WebAuthnRPID == "" {
+		return webauthn.CreationOptions{}, WebAuthnDisabled
+	}
+	log.Printf("call BeginWebAuthnRegistration('%s')\n", userID)
+
+	var options webauthn.CreationOptions
+	err := us.readModifyWrite(userID, func(theUser *user.User) error {
+		if err := checkUserActive(theUser); err != nil {
+			return err
+		}
+		if err := check(theUser); err != nil {
+			return err
+		}
+
+		challenge, err := us.newWebAuthnChallenge(theUser, webAuthnRegistration)
+		if err != nil {
+			return err
+		}
+
+		entity := webauthn.UserEntity{
+			ID:          webauthn.Encode([]byte(theUser.ID)),
+			Name:        theUser.LoginName,
+			DisplayName: theUser.ProfileName,
+		}
+		options = us.relyingParty().CreationOptions(challenge, entity, webAuthnCredentialIDs(theUser))
+		return nil
+	})
+	if err != nil {
+		return webauthn.CreationOptions{}, Mask(err)
+	}
+	return options, nil
+}
+
+// FinishWebAuthnRegistration verifies the response of navigator.credentials.create() and stores the new credential.
+// clientDataJSON and attestationObject are base64url encoded, the name helps the user to tell the credentials apart.
+//
+// Event: user.webauthn_credential_registered(user_id, credential_id, name, attestation)
+//
+// Returns the ID of the new credential.
+func (us *UserService) FinishWebAuthnRegistration(userID, name, clientDataJSON, attestationObject string) (string, error) {
+	return us.finishWebAuthnRegistration(userID, name, clientDataJSON, attestationObject, us.withoutCurrentPassword)
+}
+
+// FinishWebAuthnRegistrationWithCurrentPassword is like FinishWebAuthnRegistration, but verifies the current password
+// first.
+func (us *UserService) FinishWebAuthnRegistrationWithCurrentPassword(userID, currentPassword, name, clientDataJSON, attestationObject string) (string, error) {
+	return us.finishWebAuthnRegistration(userID, name, clientDataJSON, attestationObject, us.withCurrentPassword(currentPassword))
+}
+
+func (us *UserService) finishWebAuthnRegistration(userID, name, clientDataJSON, attestationObject string, check credentialCheck) (string, error) {
+	if userID == "" || clientDataJSON == "" || attestationObject == "" {
+		return "", InvalidArguments
+	}
+	if us.WebAuthnRPID == "" {
+		return "", WebAuthnDisabled
+	}
+	log.Printf("call FinishWebAuthnRegistration('%s', '%s', ..)\n", userID, name)
+
+	clientData, err1 := webauthn.Decode(clientDataJSON)
+	attestation, err2 := webauthn.Decode(attestationObject)
+	if err1 != nil || err2 != nil {
+		return "", InvalidArguments
+	}
+
+	var challenge string
+	var challengeErr error
+	err := us.readModifyWrite(userID, func(theUser *user.User) error {
+		if err := check(theUser); err != nil {
+			return err
+		}
+		challenge, challengeErr = us.useWebAuthnChallenge(theUser, webAuthnRegistration)
+		if challengeErr == InvalidArguments {
+			return challengeErr
+		}
+		// The challenge is used up, even if the registration fails
+		return nil
+	})
+	if err != nil {
+		return "", Mask(err)
+	}
+	if challengeErr != nil {
+		return "", Mask(challengeErr)
+	}
+
+	credential, err := us.relyingParty().VerifyRegistration(challenge, clientData, attestation)
+	if err != nil {
+		log.Printf("WebAuthn registration of user '%s' failed: %v\n", userID, err)
+		return "", InvalidWebAuthnResponse
+	}
+
+	credentialID := webauthn.Encode(credential.ID)
+	err = us.readModifyWrite(userID, func(theUser *user.User) error {
+		if theUser.FindWebAuthnCredential(credentialID) != nil {
+			return InvalidWebAuthnResponse
+		}
+
+		theUser.WebAuthnCredentials = append(theUser.WebAuthnCredentials, user.WebAuthnCredential{
+			ID:              credentialID,
+			Name:            strings.TrimSpace(name),
+			PublicKey:       credential.PublicKey,
+			SignCount:       credential.SignCount,
+			AAGUID:          credential.AAGUID,
+			AttestationType: credential.AttestationType,
+			Created:         time.Now(),
+		})
+		return nil
+	}, func(theUser *user.User) {
+		credential := theUser.FindWebAuthnCredential(credentialID)
+		us.logEvent("user.webauthn_credential_registered", map[string]interface{}{
+			"user_id":       theUser.ID,
+			"credential_id": credential.ID,
+			"name":          credential.Name,
+			"attestation":   credential.AttestationType,
+		})
+	})
+	if err != nil {
+		return "", Mask(err)
+	}
+	return credentialID, nil
+}
+
+// RemoveWebAuthnCredential deletes a credential of the user, so it can not be used to login anymore.
+//
+// Event: user.webauthn_credential_removed(user_id, credential_id)
+func (us *UserService) RemoveWebAuthnCredential(userID, credentialID string) error {
+	return us.removeWebAuthnCredential(userID, credentialID, us.withoutCurrentPassword)
+}
+
+// RemoveWebAuthnCredentialWithCurrentPassword is like RemoveWebAuthnCredential, but verifies the current password
+// first.
+func (us *UserService) RemoveWebAuthnCredentialWithCurrentPassword(userID, currentPassword, credentialID string) error {
+	return us.removeWebAuthnCredential(userID, credentialID, us.withCurrentPassword(currentPassword))
+}
+
+func (us *UserService) removeWebAuthnCredential(userID, credentialID string, check credentialCheck) error {
+	if userID == "" || credentialID == "" {
+		return InvalidArguments
+	}
+	log.Printf("call RemoveWebAuthnCredential('%s', '%s')\n", userID, credentialID)
+
+	return us.readModifyWrite(userID, func(theUser *user.User) error {
+		if err := check(theUser); err != nil {
+			return err
+		}
+		for i, credential := range theUser.WebAuthnCredentials {
+			if credential.ID == credentialID {
+				theUser.WebAuthnCredentials = append(theUser.WebAuthnCredentials[:i], theUser.WebAuthnCredentials[i+1:]...)
+				return nil
+			}
+		}
+		return InvalidArguments
+	}, func(theUser *user.User) {
+		us.logEvent("user.webauthn_credential_removed", map[string]interface{}{
+			"user_id":       theUser.ID,
+			"credential_id": credentialID,
+		})
+	})
+}
+
+// BeginWebAuthnLogin starts a passwordless login of the user with one of the registered credentials. The user is
+// identified like in Authenticate.
+// The returned options must be passed as publicKey to navigator.credentials.get() in the browser.
+func (us *UserService) BeginWebAuthnLogin(loginName string) (webauthn.RequestOptions, error) {
+	if loginName == "" {
+		return webauthn.RequestOptions{}, InvalidArguments
+	}
+	if us.WebAuthnRPID == "" {
+		return webauthn.RequestOptions{}, WebAuthnDisabled
+	}
+	log.Printf("call BeginWebAuthnLogin('%s')\n", loginName)
+
+	theUser, err := us.findByLoginIdentifier(loginName)
+	if err != nil {
+		return webauthn.RequestOptions{}, Mask(err)
+	}
+	if len(theUser.WebAuthnCredentials) == 0 {
+		return webauthn.RequestOptions{}, InvalidCredentials
+	}
+
+	challenge, err := us.newWebAuthnChallenge(&theUser, webAuthnLogin)
+	if err != nil {
+		return webauthn.RequestOptions{}, Mask(err)
+	}
+	if err := us.UserStorage.Save(theUser); err != nil {
+		return webauthn.RequestOptions{}, Mask(err)
+	}
+
+	return us.relyingParty().RequestOptions(challenge, webAuthnCredentialIDs(&theUser)), nil
+}
+
+// FinishWebAuthnLogin verifies the response of navigator.credentials.get(). All values except the credential ID
+// are base64url encoded. If the authenticator verified the user, e.g. with a PIN, no further second factor is
+// required. Otherwise a *SecondFactorRequired is returned like by Authenticate, if the user enabled one.
+//
+// If the signature counter did not increase, the credential was probably cloned and the login is rejected.
+//
+// Event: user.authenticated(user_id, method, groups)
+// Event: user.webauthn_sign_count_mismatch(user_id, credential_id)
+//
+// Returns the ID of the authenticated user.
+func (us *UserService) FinishWebAuthnLogin(credentialID, clientDataJSON, authenticatorData, signature string) (string, error) {
+	if credentialID == "" || clientDataJSON == "" || authenticatorData == "" || signature == "" {
+		return "", InvalidArguments
+	}
+	if us.WebAuthnRPID == "" {
+		return "", WebAuthnDisabled
+	}
+	log.Printf("call FinishWebAuthnLogin('%s', ..)\n", credentialID)
+
+	clientData, err1 := webauthn.Decode(clientDataJSON)
+	authData, err2 := webauthn.Decode(authenticatorData)
+	sig, err3 := webauthn.Decode(signature)
+	if err1 != nil || err2 != nil || err3 != nil {
+		return "", InvalidArguments
+	}
+
+	theUser, err := us.UserStorage.FindByWebAuthnCredential(credentialID)
+	if err != nil {
+		if IsNotFoundError(err) {
+			return "", InvalidCredentials
+		}
+		return "", Mask(err)
+	}
+
+	challenge, err := us.useWebAuthnChallenge(&theUser, webAuthnLogin)
+	if err == InvalidArguments {
+		return "", InvalidArguments
+	}
+	// The challenge is used up, even if the login fails
+	if err := us.UserStorage.Save(theUser); err != nil {
+		return "", Mask(err)
+	}
+	if err != nil {
+		return "", Mask(err)
+	}
+
+	credential := theUser.FindWebAuthnCredential(credentialID)
+	assertion, err := us.relyingParty().VerifyAssertion(challenge, credential.PublicKey, credential.SignCount, clientData, authData, sig)
+	if err == webauthn.SignCountMismatch {
+		us.logEvent("user.webauthn_sign_count_mismatch", map[string]interface{}{
+			"user_id":       theUser.ID,
+			"credential_id": credentialID,
+		})
+		return "", InvalidCredentials
+	} else if err != nil {
+		log.Printf("WebAuthn login of user '%s' failed: %v\n", theUser.ID, err)
+		return "", InvalidCredentials
+	}
+
+	if us.AuthEmailMustBeVerified && !theUser.EmailVerified {
+		return "", UserEmailMustBeVerified
+	}
+	if err := checkUserActive(&theUser); err != nil {
+		return "", Mask(err)
+	}
+
+	now := time.Now()
+	credential.SignCount = assertion.SignCount
+	credential.LastUsed = &now
+
+	// Without user verification the authenticator only proves possession, like a password proves knowledge
+	if methods := secondFactorMethods(&theUser); len(methods) > 0 && !assertion.UserVerified {
+		return "", us.requireSecondFactor(theUser, methods)
+	}
+
+	if err := us.UserStorage.Save(theUser); err != nil {
+		return "", Mask(err)
+	}
+
+	us.logEvent("user.authenticated", map[string]interface{}{
+		"user_id": theUser.ID,
+		"method":  "webauthn",
+		"groups":  theUser.Groups,
+	})
+
+	return theUser.ID, nil
+}
+
+func (us *UserService) relyingParty() *webauthn.RelyingParty {
+	return &webauthn.RelyingParty{
+		ID:                      us.WebAuthnRPID,
+		Name:                    us.WebAuthnRPName,
+		Origins:                 us.WebAuthnOrigins,
+		RequireUserVerification: us.WebAuthnRequireUserVerification,
+		Timeout:                 us.WebAuthnExpireTime,
+	}
+}
+
+// newWebAuthnChallenge issues a new challenge for the given purpose. The user must be saved afterwards.
+func (us *UserService) newWebAuthnChallenge(theUser *user.User, purpose string) (string, error) {
+	challenge, err := webauthn.NewChallenge()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	current, issued := webAuthnChallengeFields(theUser, purpose)
+	*current = challenge
+	*issued = &now
+	return challenge, nil
+}
+
+// useWebAuthnChallenge returns the current challenge for the given purpose and clears it, so it can only be used once.
+// The user must be saved afterwards.
+func (us *UserService) useWebAuthnChallenge(theUser *user.User, purpose string) (string, error) {
+	current, issued := webAuthnChallengeFields(theUser, purpose)
+	challenge := *current
+	if challenge == "" {
+		return "", InvalidArguments
+	}
+	expires := (*issued).Add(us.WebAuthnExpireTime)
+
+	*current = ""
+	*issued = nil
+
+	if time.Now().After(expires) {
+		return "", AuthChallengeExpired
+	}
+	return challenge, nil
+}
+
+// webAuthnChallengeFields returns the challenge of the user for the purpose and its issue time. Registration and login
+// have their own challenge, so the unauthenticated BeginWebAuthnLogin can not replace a registration in progress.
+func webAuthnChallengeFields(theUser *user.User, purpose string) (*string, **time.Time) {
+	if purpose == webAuthnRegistration {
+		return &theUser.WebAuthnRegistrationChallenge, &theUser.WebAuthnRegistrationChallengeIssued
+	}
+	return &theUser.WebAuthnLoginChallenge, &theUser.WebAuthnLoginChallengeIssued
+}
+
+func webAuthnCredentialIDs(theUser *user.User) []string {
+	ids := make([]string, 0, len(theUser.WebAuthnCredentials))
+	for _, credential := range theUser.WebAuthnCredentials {
+		ids = append(ids, credential.ID)
+	}
+	return ids
+}
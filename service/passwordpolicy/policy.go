@@ -0,0 +1,168 @@
+package passwordpolicy
+
+import (
+	"math"
+	"strings"
+	"unicode"
+)
+
+// Names of the rules returned by Policy.Check.
+const (
+	RuleMinLength         = "min_length"
+	RuleMaxLength         = "max_length"
+	RuleLowercase         = "lowercase"
+	RuleUppercase         = "uppercase"
+	RuleDigit             = "digit"
+	RuleSymbol            = "symbol"
+	RuleStrength          = "strength"
+	RuleContainsLoginName = "contains_login_name"
+	RuleContainsEmail     = "contains_email"
+)
+
+// BcryptMaxLength is the number of bytes bcrypt considers, anything after is silently ignored.
+const BcryptMaxLength = 72
+
+// minPersonalDataLength avoids rejecting passwords because of very short login names or email prefixes.
+const minPersonalDataLength = 3
+
+func NewPolicy() *Policy {
+	return &Policy{
+		MinLength: 1,
+		MaxLength: BcryptMaxLength,
+
+		RejectPersonalData: true,
+	}
+}
+
+type Policy struct {
+	// MinLength is counted in characters, MaxLength in bytes (see BcryptMaxLength).
+	MinLength int
+	MaxLength int
+
+	RequireLowercase bool
+	RequireUppercase bool
+	RequireDigit     bool
+	RequireSymbol    bool
+
+	// MinStrength is the minimum estimated strength in bits, see EstimateStrength.
+	MinStrength float64
+
+	// RejectPersonalData rejects passwords containing the login name or email.
+	RejectPersonalData bool
+}
+
+// Check returns the names of all rules the password violates. An empty result means the password can be used.
+func (p *Policy) Check(password, loginName, email string) []string {
+	var violations []string
+
+	length := len([]rune(password))
+	if length < p.MinLength {
+		violations = append(violations, RuleMinLength)
+	}
+	if p.MaxLength > 0 && len(password) > p.MaxLength {
+		violations = append(violations, RuleMaxLength)
+	}
+
+	classes := characterClasses(password)
+	if p.RequireLowercase && !classes.Lowercase {
+		violations = append(violations, RuleLowercase)
+	}
+	if p.RequireUppercase && !classes.Uppercase {
+		violations = append(violations, RuleUppercase)
+	}
+	if p.RequireDigit && !classes.Digit {
+		violations = append(violations, RuleDigit)
+	}
+	if p.RequireSymbol && !classes.Symbol {
+		violations = append(violations, RuleSymbol)
+	}
+
+	if p.MinStrength > 0 && EstimateStrength(password) < p.MinStrength {
+		violations = append(violations, RuleStrength)
+	}
+
+	if p.RejectPersonalData {
+		lowerPassword := strings.ToLower(password)
+		if containsPersonalData(lowerPassword, loginName) {
+			violations = append(violations, RuleContainsLoginName)
+		}
+
+		localPart := email
+		if at := strings.LastIndex(email, "@"); at >= 0 {
+			localPart = email[:at]
+		}
+		if containsPersonalData(lowerPassword, email) || containsPersonalData(lowerPassword, localPart) {
+			violations = append(violations, RuleContainsEmail)
+		}
+	}
+
+	return violations
+}
+
+// EstimateStrength returns a rough estimate of the password entropy in bits. It assumes every character
+// is randomly chosen from the character classes used in the password, but counts repeated characters only
+// twice, so 'aaaaaaaa' is not considered stronger than 'aa'.
+func EstimateStrength(password string) float64 {
+	classes := characterClasses(password)
+
+	poolSize := 0
+	if classes.Lowercase {
+		poolSize += 26
+	}
+	if classes.Uppercase {
+		poolSize += 26
+	}
+	if classes.Digit {
+		poolSize += 10
+	}
+	if classes.Symbol {
+		poolSize += 33
+	}
+	if classes.Other {
+		poolSize += 100
+	}
+	if poolSize == 0 {
+		return 0
+	}
+
+	seen := map[rune]int{}
+	effectiveLength := 0
+	for _, r := range password {
+		seen[r]++
+		if seen[r] <= 2 {
+			effectiveLength++
+		}
+	}
+
+	return float64(effectiveLength) * math.Log2(float64(poolSize))
+}
+
+type classes struct {
+	Lowercase, Uppercase, Digit, Symbol, Other bool
+}
+
+func characterClasses(password string) classes {
+	var c classes
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			c.Lowercase = true
+		case unicode.IsUpper(r):
+			c.Uppercase = true
+		case unicode.IsDigit(r):
+			c.Digit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.IsSpace(r):
+			c.Symbol = true
+		default:
+			c.Other = true
+		}
+	}
+	return c
+}
+
+func containsPersonalData(lowerPassword, data string) bool {
+	if len(data) < minPersonalDataLength {
+		return false
+	}
+	return strings.Contains(lowerPassword, strings.ToLower(data))
+}
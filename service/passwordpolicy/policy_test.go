@@ -0,0 +1,63 @@
+package passwordpolicy
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	strict := &Policy{
+		MinLength:        8,
+		MaxLength:        BcryptMaxLength,
+		RequireLowercase: true,
+		RequireUppercase: true,
+		RequireDigit:     true,
+		RequireSymbol:    true,
+	}
+
+	tests := []struct {
+		name     string
+		policy   *Policy
+		password string
+		want     []string
+	}{
+		{"valid", strict, "Secret-123", nil},
+		{"too short", strict, "Se-1", []string{RuleMinLength}},
+		{"too long", strict, "Se-1" + strings.Repeat("x", BcryptMaxLength), []string{RuleMaxLength}},
+		{"only lowercase", strict, "secretsecret", []string{RuleUppercase, RuleDigit, RuleSymbol}},
+		{"only uppercase", strict, "SECRET-123", []string{RuleLowercase}},
+		{"min length counts characters", &Policy{MinLength: 4}, "äöüß", nil},
+		{"max length counts bytes", &Policy{MaxLength: 4}, "äöü", []string{RuleMaxLength}},
+		{"too weak", &Policy{MinStrength: 40}, "aaaaaaaaaaaa", []string{RuleStrength}},
+		{"strong enough", &Policy{MinStrength: 40}, "correct horse battery", nil},
+		{"contains login name", NewPolicy(), "my-Alice-secret", []string{RuleContainsLoginName}},
+		{"contains email", NewPolicy(), "bob@example.com!", []string{RuleContainsEmail}},
+		{"contains local part", NewPolicy(), "BOB-secret", []string{RuleContainsEmail}},
+	}
+
+	for _, test := range tests {
+		violations := test.policy.Check(test.password, "alice", "bob@example.com")
+		if !reflect.DeepEqual(violations, test.want) {
+			t.Errorf("%s: expected %v, got %v", test.name, test.want, violations)
+		}
+	}
+}
+
+func TestCheckIgnoresShortPersonalData(t *testing.T) {
+	if violations := NewPolicy().Check("always-secret", "al", "ys@example.com"); violations != nil {
+		t.Fatalf("Expected login names and local parts shorter than 3 characters to be ignored, got %v", violations)
+	}
+}
+
+func TestEstimateStrength(t *testing.T) {
+	if strength := EstimateStrength(""); strength != 0 {
+		t.Fatalf("Expected no strength for an empty password, got %f", strength)
+	}
+	if EstimateStrength("aaaaaaaa") != EstimateStrength("aa") {
+		t.Fatalf("Expected repeated characters to be counted only twice")
+	}
+	if EstimateStrength("abcdefgh") >= EstimateStrength("abcdEFG1") {
+		t.Fatalf("Expected more character classes to be stronger")
+	}
+}
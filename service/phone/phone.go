@@ -0,0 +1,44 @@
+// Package phone normalizes phone numbers to E.164. The codes sent to them by SMS are generated by package otp.
+package phone
+
+import (
+	"github.com/juju/errgo"
+
+	"strings"
+)
+
+var InvalidNumber = errgo.New("Invalid phone number, the international format is required, e.g. +49 30 1234567.")
+
+// Normalize returns the number in E.164 format, e.g. "+49301234567". The number must contain the country code,
+// either with a leading + or 00. Spaces, dashes, dots, slashes and parentheses are ignored, as is a national trunk
+// prefix written as "(0)".
+func Normalize(number string) (string, error) {
+	number = strings.Replace(strings.TrimSpace(number), "(0)", "", 1)
+
+	var digits strings.Builder
+	for i, r := range number {
+		switch {
+		case r >= '0' && r <= '9':
+			digits.WriteRune(r)
+		case r == '+' && i == 0:
+		case strings.ContainsRune(" -./()", r):
+		default:
+			return "", InvalidNumber
+		}
+	}
+
+	result := digits.String()
+	if strings.HasPrefix(number, "+") {
+		// nothing to strip
+	} else if strings.HasPrefix(result, "00") {
+		result = result[2:]
+	} else {
+		return "", InvalidNumber
+	}
+
+	// The country code never starts with 0, E.164 allows at most 15 digits
+	if len(result) < 7 || len(result) > 15 || result[0] == '0' {
+		return "", InvalidNumber
+	}
+	return "+" + result, nil
+}
@@ -0,0 +1,25 @@
+package phone
+
+import (
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	valid := map[string]string{
+		"+49 30 1234567":       "+49301234567",
+		"0049 (0)30 123-45-67": "+49301234567",
+		"+1 (555) 123.4567":    "+15551234567",
+		" +44 20/7946 0958 ":   "+442079460958",
+	}
+	for number, expected := range valid {
+		if normalized, err := Normalize(number); err != nil || normalized != expected {
+			t.Errorf("Expected %s to be normalized to %s, got %s, %v", number, expected, normalized, err)
+		}
+	}
+
+	for _, number := range []string{"", "030 1234567", "+49 30 abc", "+0 30 1234567", "+49 30 123456789012", "49+301234567", "+123"} {
+		if normalized, err := Normalize(number); err == nil {
+			t.Errorf("Expected %s to be rejected, got %s", number, normalized)
+		}
+	}
+}
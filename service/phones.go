@@ -0,0 +1,304 @@
+package service
+
+import (
+	"./otp"
+	"./phone"
+	"./storage"
+	"./user"
+
+	"log"
+	"time"
+)
+
+// Purposes of user.User.PhoneCodeHash.
+const (
+	phoneCodeVerify = "verify"
+	phoneCodeReset  = "reset"
+)
+
+// maxPhoneCodeAttempts is the number of wrong codes after which a phone code becomes invalid. Requesting a new code
+// does not reset the count, until the last code has expired.
+const maxPhoneCodeAttempts = 5
+
+// ChangePhone sets the phone number of the user and sends a code to it, which must be passed to VerifyPhone. The
+// number is normalized to E.164 and must be unique among all users. Calling it again with the same number sends a
+// new code. The primary email address is notified, as a verified number can be used to reset the password.
+//
+// Event: user.phone_verification_code(user_id, phone, code, timestamp, expires)
+// Event: user.phone_changed_notification(user_id, profile_name, email, phone, timestamp)
+//
+// Returns the code.
+func (us *UserService) ChangePhone(userID, number string) (string, error) {
+	return us.changePhone(userID, number, us.withoutCurrentPassword)
+}
+
+// ChangePhoneWithCurrentPassword is like ChangePhone, but verifies the current password first.
+func (us *UserService) ChangePhoneWithCurrentPassword(userID, currentPassword, number string) (string, error) {
+	return us.changePhone(userID, number, us.withCurrentPassword(currentPassword))
+}
+
+func (us *UserService) changePhone(userID, number string, check credentialCheck) (string, error) {
+	if userID == "" || number == "" {
+		return "", InvalidArguments
+	}
+	log.Printf("call ChangePhone('%s', '%s')\n", userID, number)
+
+	normalized, err := phone.Normalize(number)
+	if err != nil {
+		return "", Mask(err)
+	}
+
+	var code string
+	err = us.readModifyWrite(userID, func(theUser *user.User) error {
+		if err := check(theUser); err != nil {
+			return err
+		}
+		if theUser.Phone == normalized && theUser.PhoneVerified {
+			return InvalidArguments
+		}
+
+		var err error
+		if code, err = us.newPhoneCode(theUser, phoneCodeVerify); err != nil {
+			return err
+		}
+		theUser.Phone = normalized
+		theUser.PhoneVerified = false
+		return nil
+	}, func(theUser *user.User) {
+		us.logPhoneCode("user.phone_verification_code", theUser, code)
+		us.logEvent("user.phone_changed_notification", map[string]interface{}{
+			"user_id":      theUser.ID,
+			"profile_name": theUser.ProfileName,
+			"email":        theUser.Email,
+			"phone":        theUser.Phone,
+			"timestamp":    theUser.PhoneCodeIssued,
+		})
+	})
+	if err != nil {
+		return "", Mask(err)
+	}
+	return code, nil
+}
+
+// VerifyPhone marks the phone number of the user as verified, if the code matches the one sent by ChangePhone.
+// After maxPhoneCodeAttempts wrong codes a new one must be requested. Only active users can verify their number.
+//
+// Event: user.phone_verified(user_id, phone)
+func (us *UserService) VerifyPhone(userID, code string) error {
+	if userID == "" || code == "" {
+		return InvalidArguments
+	}
+	log.Printf("call VerifyPhone('%s', ..)\n", userID)
+
+	theUser, err := us.UserStorage.Get(userID)
+	if err != nil {
+		return Mask(err)
+	}
+	if err := checkUserActive(&theUser); err != nil {
+		return Mask(err)
+	}
+	if err := us.usePhoneCode(&theUser, phoneCodeVerify, code); err != nil {
+		return Mask(err)
+	}
+
+	theUser.PhoneVerified = true
+	if err := us.UserStorage.Save(theUser); err != nil {
+		return Mask(err)
+	}
+
+	us.logEvent("user.phone_verified", map[string]interface{}{
+		"user_id": theUser.ID,
+		"phone":   theUser.Phone,
+	})
+	return nil
+}
+
+// RemovePhone removes the phone number of the user.
+//
+// Event: user.phone_removed(user_id, phone)
+func (us *UserService) RemovePhone(userID string) error {
+	if userID == "" {
+		return InvalidArguments
+	}
+	log.Printf("call RemovePhone('%s')\n", userID)
+
+	var number string
+	return us.readModifyWrite(userID, func(theUser *user.User) error {
+		if theUser.Phone == "" {
+			return InvalidArguments
+		}
+
+		number = theUser.Phone
+		theUser.Phone = ""
+		theUser.PhoneVerified = false
+		discardPhoneCode(theUser)
+		return nil
+	}, func(theUser *user.User) {
+		us.logEvent("user.phone_removed", map[string]interface{}{
+			"user_id": theUser.ID,
+			"phone":   number,
+		})
+	})
+}
+
+// NewPhoneResetCode sends a code to the verified phone number of a user, who wants to reset the password. This
+// works like NewResetLoginCredentialsToken, but as the code is short, it can not be used directly. Instead it is
+// exchanged for a reset password token with ExchangePhoneResetCode.
+//
+// Event: user.new_reset_password_code(user_id, phone, code, timestamp, expires)
+//
+// Returns the code or an error if no user could be found.
+func (us *UserService) NewPhoneResetCode(number string) (string, error) {
+	if number == "" {
+		return "", InvalidArguments
+	}
+	log.Printf("call NewPhoneResetCode('%s')\n", number)
+
+	normalized, err := phone.Normalize(number)
+	if err != nil {
+		return "", Mask(err)
+	}
+
+	u, err := us.UserStorage.FindByPhone(normalized)
+	if err != nil {
+		return "", Mask(err)
+	}
+	if !u.PhoneVerified {
+		// Like an unknown number, nobody must be able to reset a password with a number merely set by ChangePhone
+		return "", Mask(storage.UserNotFound)
+	}
+
+	if err := checkUserActive(&u); err != nil {
+		return "", Mask(err)
+	}
+
+	code, err := us.newPhoneCode(&u, phoneCodeReset)
+	if err != nil {
+		return "", Mask(err)
+	}
+
+	if err := us.UserStorage.Save(u); err != nil {
+		return "", Mask(err)
+	}
+
+	us.logPhoneCode("user.new_reset_password_code", &u, code)
+	return code, nil
+}
+
+// ExchangePhoneResetCode checks the code sent by NewPhoneResetCode and returns a new reset password token, to be
+// passed to ResetPasswordWithToken or ResetCredentialsWithToken. After maxPhoneCodeAttempts wrong codes a new one
+// must be requested.
+//
+// Event: user.phone_reset_code_exchanged(user_id, phone, timestamp)
+func (us *UserService) ExchangePhoneResetCode(number, code string) (string, error) {
+	if number == "" || code == "" {
+		return "", InvalidArguments
+	}
+	log.Printf("call ExchangePhoneResetCode('%s', ..)\n", number)
+
+	normalized, err := phone.Normalize(number)
+	if err != nil {
+		return "", Mask(err)
+	}
+
+	u, err := us.UserStorage.FindByPhone(normalized)
+	if err != nil {
+		if IsNotFoundError(err) {
+			return "", Mask(InvalidPhoneCode)
+		}
+		return "", Mask(err)
+	}
+	if err := us.usePhoneCode(&u, phoneCodeReset, code); err != nil {
+		return "", Mask(err)
+	}
+
+	if err := checkUserActive(&u); err != nil {
+		return "", Mask(err)
+	}
+
+	now := time.Now()
+	u.ResetPasswordToken = us.IdFactory.NewResetPasswordToken()
+	u.ResetPasswordTokenIssued = &now
+
+	if err := us.UserStorage.Save(u); err != nil {
+		return "", Mask(err)
+	}
+
+	us.logEvent("user.phone_reset_code_exchanged", map[string]interface{}{
+		"user_id":   u.ID,
+		"phone":     u.Phone,
+		"timestamp": u.ResetPasswordTokenIssued,
+	})
+	return u.ResetPasswordToken, nil
+}
+
+// newPhoneCode generates a new code for the purpose and replaces any previous code of the user. The wrong attempts
+// are kept while the previous code is valid, so requesting new codes does not allow guessing more often.
+func (us *UserService) newPhoneCode(theUser *user.User, purpose string) (string, error) {
+	now := time.Now()
+	if theUser.PhoneCodeIssued == nil || now.After(theUser.PhoneCodeIssued.Add(us.PhoneCodeExpireTime)) {
+		theUser.PhoneCodeAttempts = 0
+	} else if theUser.PhoneCodeAttempts >= maxPhoneCodeAttempts {
+		return "", PhoneCodeAttemptsExceeded
+	}
+
+	code, err := otp.NewCode()
+	if err != nil {
+		return "", err
+	}
+
+	theUser.PhoneCodeHash = us.Hasher.Hash(code)
+	theUser.PhoneCodePurpose = purpose
+	theUser.PhoneCodeIssued = &now
+	return code, nil
+}
+
+// usePhoneCode checks the code of the user. A wrong code is counted as failed attempt and saved immediately, after
+// maxPhoneCodeAttempts the code is discarded. A matching code is cleared, so it can only be used once, the caller must
+// save the user then.
+func (us *UserService) usePhoneCode(theUser *user.User, purpose, code string) error {
+	if theUser.PhoneCodeHash == "" || theUser.PhoneCodePurpose != purpose {
+		return InvalidPhoneCode
+	}
+	if time.Now().After(theUser.PhoneCodeIssued.Add(us.PhoneCodeExpireTime)) {
+		return InvalidPhoneCode
+	}
+
+	if len(code) != otp.Digits || !us.Hasher.Verify(code, theUser.PhoneCodeHash) {
+		theUser.PhoneCodeAttempts++
+		if theUser.PhoneCodeAttempts >= maxPhoneCodeAttempts {
+			discardPhoneCode(theUser)
+		}
+		if err := us.UserStorage.Save(*theUser); err != nil {
+			return err
+		}
+		return InvalidPhoneCode
+	}
+
+	clearPhoneCode(theUser)
+	return nil
+}
+
+func (us *UserService) logPhoneCode(tag string, theUser *user.User, code string) {
+	us.logEvent(tag, map[string]interface{}{
+		"user_id":   theUser.ID,
+		"phone":     theUser.Phone,
+		"code":      code,
+		"timestamp": theUser.PhoneCodeIssued,
+		"expires":   theUser.PhoneCodeIssued.Add(us.PhoneCodeExpireTime),
+	})
+}
+
+// discardPhoneCode invalidates the code, but keeps the attempts and the issue time, so newPhoneCode still refuses new
+// codes after too many wrong attempts until this one would have expired.
+func discardPhoneCode(theUser *user.User) {
+	theUser.PhoneCodeHash = ""
+	theUser.PhoneCodePurpose = ""
+}
+
+func clearPhoneCode(theUser *user.User) {
+	theUser.PhoneCodeHash = ""
+	theUser.PhoneCodePurpose = ""
+	theUser.PhoneCodeIssued = nil
+	theUser.PhoneCodeAttempts = 0
+}
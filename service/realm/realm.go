@@ -0,0 +1,74 @@
+// Package realm loads the realms of a userd deployment. Each realm is a separate tenant with its own users, groups,
+// sessions and events, so the same email can register in every realm.
+package realm
+
+import (
+	"github.com/juju/errgo"
+
+	"encoding/json"
+	"io/ioutil"
+	"regexp"
+)
+
+var InvalidRealmsFile = errgo.New("Invalid realms file.")
+
+// validName keeps realm names safe to use in storage keys, URL paths and event tags.
+var validName = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,62}$`)
+
+// Realm overrides the configuration of the default realm. Nil values keep the value of the command line arguments.
+type Realm struct {
+	Name string `json:"name"`
+
+	AuthEmailMustBeVerified *bool `json:"auth_email"`
+	EnableLoginLinks        *bool `json:"login_links"`
+
+	// Expire times in minutes, like --expire-session, --expire-session-refresh and --expire-access-token.
+	SessionExpireTime        *uint `json:"expire_session"`
+	SessionRefreshExpireTime *uint `json:"expire_session_refresh"`
+	AccessTokenExpireTime    *uint `json:"expire_access_token"`
+
+	// Expire times of the tokens and codes sent to the users in minutes, like --expire-reset-password-token,
+	// --expire-email-verification-token (also used for email changes), --expire-login-link and --expire-phone-code.
+	ResetPasswordExpireTime     *uint `json:"expire_reset_password_token"`
+	EmailVerificationExpireTime *uint `json:"expire_email_verification_token"`
+	LoginLinkExpireTime         *uint `json:"expire_login_link"`
+	PhoneCodeExpireTime         *uint `json:"expire_phone_code"`
+
+	// AccessTokenAudience should differ between realms, so apps don't accept the access tokens of other realms.
+	AccessTokenAudience *string `json:"jwt_audience"`
+}
+
+func ValidName(name string) bool {
+	return validName.MatchString(name)
+}
+
+// LoadRealms reads the realms from a JSON file:
+//
+//	{
+//		"realms": [
+//			{"name": "shop", "auth_email": false, "expire_session": 120, "expire_login_link": 5, "jwt_audience": "shop"},
+//			{"name": "forum"}
+//		]
+//	}
+func LoadRealms(path string) ([]Realm, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+
+	var file struct {
+		Realms []Realm `json:"realms"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, errgo.Notef(InvalidRealmsFile, "%v", err)
+	}
+
+	seen := map[string]bool{}
+	for _, realm := range file.Realms {
+		if !ValidName(realm.Name) || seen[realm.Name] {
+			return nil, errgo.Notef(InvalidRealmsFile, "invalid or duplicate name '%s'", realm.Name)
+		}
+		seen[realm.Name] = true
+	}
+	return file.Realms, nil
+}
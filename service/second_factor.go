@@ -0,0 +1,378 @@
+package service
+
+import (
+	"./otp"
+	"./totp"
+	"./user"
+
+	"log"
+	"strings"
+	"time"
+)
+
+// Methods which can be reported by SecondFactorRequired.
+const (
+	SecondFactorTOTP         = "totp"
+	SecondFactorRecoveryCode = "recovery_code"
+	SecondFactorEmail        = "email"
+)
+
+const (
+	// totpRecoveryCodes is the number of recovery codes generated by ConfirmTOTP.
+	totpRecoveryCodes = 10
+
+	// maxSecondFactorAttempts is the number of wrong codes after which a challenge becomes invalid. New challenges
+	// keep the count, until the last challenge has expired.
+	maxSecondFactorAttempts = 5
+)
+
+// EnrollTOTP generates a new TOTP secret for the user. TOTP is enabled once ConfirmTOTP was called with
+// a first code generated by the authenticator app. Calling EnrollTOTP again replaces the unconfirmed secret.
+//
+// Returns the secret and the otpauth:// URI which can be shown as a QR code.
+func (us *UserService) EnrollTOTP(userID string) (string, string, error) {
+	if userID == "" {
+		return "", "", InvalidArguments
+	}
+	log.Printf("call EnrollTOTP('%s')\n", userID)
+
+	var secret, uri string
+	err := us.readModifyWrite(userID, func(user *user.User) error {
+		if user.TOTPEnabled {
+			return TOTPAlreadyEnabled
+		}
+
+		var err error
+		secret, err = totp.NewSecret()
+		if err != nil {
+			return err
+		}
+		uri = totp.ProvisioningURI(us.TOTPIssuer, user.Email, secret)
+
+		user.TOTPSecret = secret
+		return nil
+	})
+	if err != nil {
+		return "", "", Mask(err)
+	}
+	return secret, uri, nil
+}
+
+// ConfirmTOTP enables TOTP for the user, if the code matches the secret generated by EnrollTOTP.
+//
+// Event: user.totp_enrolled(user_id)
+//
+// Returns the recovery codes, which can be used instead of a TOTP code if the authenticator is lost.
+// Only their hashes are stored, so they must be shown to the user now.
+func (us *UserService) ConfirmTOTP(userID, code string) ([]string, error) {
+	if userID == "" || code == "" {
+		return nil, InvalidArguments
+	}
+	log.Printf("call ConfirmTOTP('%s', ..)\n", userID)
+
+	var recoveryCodes []string
+	err := us.readModifyWrite(userID, func(user *user.User) error {
+		if user.TOTPEnabled {
+			return TOTPAlreadyEnabled
+		}
+		if user.TOTPSecret == "" {
+			return InvalidArguments
+		}
+
+		counter, ok := totp.Validate(user.TOTPSecret, strings.TrimSpace(code), time.Now())
+		if !ok {
+			return InvalidCredentials
+		}
+
+		hashes := make([]string, 0, totpRecoveryCodes)
+		for i := 0; i < totpRecoveryCodes; i++ {
+			recoveryCode, err := totp.NewRecoveryCode()
+			if err != nil {
+				return err
+			}
+			recoveryCodes = append(recoveryCodes, recoveryCode)
+			hashes = append(hashes, us.Hasher.Hash(recoveryCode))
+		}
+
+		user.TOTPEnabled = true
+		user.TOTPLastCounter = counter
+		user.TOTPRecoveryCodes = hashes
+		return nil
+	}, func(user *user.User) {
+		us.logEvent("user.totp_enrolled", map[string]interface{}{
+			"user_id": user.ID,
+		})
+	})
+	if err != nil {
+		return nil, Mask(err)
+	}
+	return recoveryCodes, nil
+}
+
+// DisableTOTP removes the TOTP secret and all recovery codes of the user.
+//
+// Event: user.totp_disabled(user_id)
+func (us *UserService) DisableTOTP(userID string) error {
+	return us.disableTOTP(userID, us.withoutCurrentPassword)
+}
+
+// DisableTOTPWithCurrentPassword is like DisableTOTP, but verifies the current password first.
+func (us *UserService) DisableTOTPWithCurrentPassword(userID, currentPassword string) error {
+	return us.disableTOTP(userID, us.withCurrentPassword(currentPassword))
+}
+
+func (us *UserService) disableTOTP(userID string, check credentialCheck) error {
+	if userID == "" {
+		return InvalidArguments
+	}
+	log.Printf("call DisableTOTP('%s')\n", userID)
+
+	return us.readModifyWrite(userID, func(user *user.User) error {
+		if err := check(user); err != nil {
+			return err
+		}
+		user.TOTPSecret = ""
+		user.TOTPEnabled = false
+		user.TOTPLastCounter = 0
+		user.TOTPRecoveryCodes = nil
+		clearAuthChallenge(user)
+		return nil
+	}, func(user *user.User) {
+		us.logEvent("user.totp_disabled", map[string]interface{}{
+			"user_id": user.ID,
+		})
+	})
+}
+
+// EnableEmailOTP requires a one-time code sent to the primary email address for every authentication of the user.
+// The address must be verified.
+//
+// Event: user.email_otp_enabled(user_id)
+func (us *UserService) EnableEmailOTP(userID string) error {
+	if userID == "" {
+		return InvalidArguments
+	}
+	log.Printf("call EnableEmailOTP('%s')\n", userID)
+
+	return us.readModifyWrite(userID, func(user *user.User) error {
+		if !user.EmailVerified {
+			return EmailNotVerified
+		}
+		user.EmailOTPEnabled = true
+		return nil
+	}, func(user *user.User) {
+		us.logEvent("user.email_otp_enabled", map[string]interface{}{
+			"user_id": user.ID,
+		})
+	})
+}
+
+// DisableEmailOTP stops sending one-time codes to the user.
+//
+// Event: user.email_otp_disabled(user_id)
+func (us *UserService) DisableEmailOTP(userID string) error {
+	return us.disableEmailOTP(userID, us.withoutCurrentPassword)
+}
+
+// DisableEmailOTPWithCurrentPassword is like DisableEmailOTP, but verifies the current password first.
+func (us *UserService) DisableEmailOTPWithCurrentPassword(userID, currentPassword string) error {
+	return us.disableEmailOTP(userID, us.withCurrentPassword(currentPassword))
+}
+
+func (us *UserService) disableEmailOTP(userID string, check credentialCheck) error {
+	if userID == "" {
+		return InvalidArguments
+	}
+	log.Printf("call DisableEmailOTP('%s')\n", userID)
+
+	return us.readModifyWrite(userID, func(user *user.User) error {
+		if err := check(user); err != nil {
+			return err
+		}
+		user.EmailOTPEnabled = false
+		clearAuthChallenge(user)
+		return nil
+	}, func(user *user.User) {
+		us.logEvent("user.email_otp_disabled", map[string]interface{}{
+			"user_id": user.ID,
+		})
+	})
+}
+
+// CompleteAuthentication finishes an authentication started with Authenticate, which returned a *SecondFactorRequired.
+// The code is either a TOTP code, one of the recovery codes or the code sent by email. After too many wrong codes,
+// the challenge becomes invalid and no new challenge is issued until it would have expired.
+//
+// Event: user.authenticated(user_id, method, groups)
+// Event: user.totp_recovery_code_used(user_id, remaining)
+//
+// Returns the ID of the authenticated user.
+func (us *UserService) CompleteAuthentication(challenge, code string) (string, error) {
+	if challenge == "" || code == "" {
+		return "", InvalidArguments
+	}
+	log.Printf("call CompleteAuthentication(..)\n")
+
+	theUser, err := us.UserStorage.FindByAuthChallenge(challenge)
+	if err != nil {
+		if IsNotFoundError(err) {
+			return "", Mask(InvalidArguments)
+		}
+		return "", Mask(err)
+	}
+
+	if time.Now().After(theUser.AuthChallengeIssued.Add(us.SecondFactorExpireTime)) {
+		clearAuthChallenge(&theUser)
+		if err := us.UserStorage.Save(theUser); err != nil {
+			return "", Mask(err)
+		}
+		return "", Mask(AuthChallengeExpired)
+	}
+
+	if err := checkUserActive(&theUser); err != nil {
+		return "", Mask(err)
+	}
+
+	method, ok := us.verifySecondFactor(&theUser, strings.TrimSpace(code))
+	if !ok {
+		theUser.AuthChallengeAttempts++
+		if theUser.AuthChallengeAttempts >= maxSecondFactorAttempts {
+			discardAuthChallenge(&theUser)
+		}
+		if err := us.UserStorage.Save(theUser); err != nil {
+			return "", Mask(err)
+		}
+		return "", InvalidCredentials
+	}
+
+	clearAuthChallenge(&theUser)
+	if err := us.UserStorage.Save(theUser); err != nil {
+		return "", Mask(err)
+	}
+
+	if method == SecondFactorRecoveryCode {
+		us.logEvent("user.totp_recovery_code_used", map[string]interface{}{
+			"user_id":   theUser.ID,
+			"remaining": len(theUser.TOTPRecoveryCodes),
+		})
+	}
+
+	us.logEvent("user.authenticated", map[string]interface{}{
+		"user_id": theUser.ID,
+		"method":  method,
+		"groups":  theUser.Groups,
+	})
+
+	return theUser.ID, nil
+}
+
+// secondFactorMethods returns the methods the user can use to complete an authentication.
+// An empty result means no second factor is required.
+func secondFactorMethods(theUser *user.User) []string {
+	var methods []string
+	if theUser.TOTPEnabled {
+		methods = append(methods, SecondFactorTOTP)
+		if len(theUser.TOTPRecoveryCodes) > 0 {
+			methods = append(methods, SecondFactorRecoveryCode)
+		}
+	}
+	if theUser.EmailOTPEnabled {
+		methods = append(methods, SecondFactorEmail)
+	}
+	return methods
+}
+
+// requireSecondFactor issues a new challenge for the user and returns it as *SecondFactorRequired.
+// If email codes are enabled, a new code is generated and only its hash is stored. The wrong attempts are kept while
+// the previous challenge is valid, so requesting new challenges does not allow guessing more often. After
+// maxSecondFactorAttempts no challenge is issued until the previous one has expired.
+//
+// Event: user.email_otp_code(user_id, email, code, timestamp, expires)
+func (us *UserService) requireSecondFactor(theUser user.User, methods []string) error {
+	now := time.Now()
+	if theUser.AuthChallengeIssued == nil || now.After(theUser.AuthChallengeIssued.Add(us.SecondFactorExpireTime)) {
+		theUser.AuthChallengeAttempts = 0
+	} else if theUser.AuthChallengeAttempts >= maxSecondFactorAttempts {
+		return SecondFactorAttemptsExceeded
+	}
+
+	theUser.AuthChallenge = us.IdFactory.NewAuthChallenge()
+	theUser.AuthChallengeIssued = &now
+
+	var code string
+	if theUser.EmailOTPEnabled {
+		var err error
+		if code, err = otp.NewCode(); err != nil {
+			return Mask(err)
+		}
+		theUser.EmailOTPHash = us.Hasher.Hash(code)
+	}
+
+	if err := us.UserStorage.Save(theUser); err != nil {
+		return Mask(err)
+	}
+
+	if code != "" {
+		us.logEvent("user.email_otp_code", map[string]interface{}{
+			"user_id":   theUser.ID,
+			"email":     theUser.Email,
+			"code":      code,
+			"timestamp": now,
+			"expires":   now.Add(us.SecondFactorExpireTime),
+		})
+	}
+
+	us.logEvent("user.second_factor_required", map[string]interface{}{
+		"user_id": theUser.ID,
+		"methods": methods,
+	})
+
+	return &SecondFactorRequired{
+		Challenge: theUser.AuthChallenge,
+		Methods:   methods,
+	}
+}
+
+// verifySecondFactor checks the code against the TOTP secret, the email code and the recovery codes of the user.
+// Returns the method which accepted the code.
+func (us *UserService) verifySecondFactor(theUser *user.User, code string) (string, bool) {
+	if theUser.TOTPEnabled {
+		if counter, ok := totp.Validate(theUser.TOTPSecret, code, time.Now()); ok && counter > theUser.TOTPLastCounter {
+			theUser.TOTPLastCounter = counter
+			return SecondFactorTOTP, true
+		}
+	}
+
+	if theUser.EmailOTPHash != "" && len(code) == otp.Digits && us.Hasher.Verify(code, theUser.EmailOTPHash) {
+		theUser.EmailOTPHash = ""
+		return SecondFactorEmail, true
+	}
+
+	// Recovery codes are longer than TOTP codes, so we can skip hashing for most wrong TOTP codes
+	if !theUser.TOTPEnabled || len(code) == totp.Digits {
+		return "", false
+	}
+
+	code = strings.ToLower(code)
+	for i, hash := range theUser.TOTPRecoveryCodes {
+		if us.Hasher.Verify(code, hash) {
+			theUser.TOTPRecoveryCodes = append(theUser.TOTPRecoveryCodes[:i], theUser.TOTPRecoveryCodes[i+1:]...)
+			return SecondFactorRecoveryCode, true
+		}
+	}
+	return "", false
+}
+
+// discardAuthChallenge invalidates the challenge and the email code, but keeps the attempts and the issue time, so
+// requireSecondFactor still refuses new challenges after too many wrong codes until this one would have expired.
+func discardAuthChallenge(theUser *user.User) {
+	theUser.AuthChallenge = ""
+	theUser.EmailOTPHash = ""
+}
+
+func clearAuthChallenge(theUser *user.User) {
+	theUser.AuthChallenge = ""
+	theUser.AuthChallengeIssued = nil
+	theUser.AuthChallengeAttempts = 0
+	theUser.EmailOTPHash = ""
+}
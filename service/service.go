@@ -1,37 +1,187 @@
 package service
 
 import (
+	"./attributes"
+	"./oidc"
+	"./storage"
 	"./user"
 
 	"encoding/json"
 	"log"
+	"strings"
 	"time"
 )
 
 type Dependencies struct {
-	IdFactory   IdFactory
-	Hasher      PasswordHasher
-	UserStorage UserStorage
+	IdFactory      IdFactory
+	Hasher         PasswordHasher
+	PasswordPolicy PasswordPolicy
+	UserStorage    UserStorage
+	SessionStorage SessionStorage
+	GroupStorage   GroupStorage
+
+	// AuditStorage keeps the change history of the users, see UserHistory. Nil disables the history.
+	AuditStorage AuditStorage
+
+	// BreachedPasswords is checked for every new password, see PasswordRuleBreached.
+	BreachedPasswords BreachedPasswords
+
+	// TokenSigner signs access tokens. Nil disables access tokens.
+	TokenSigner TokenSigner
 
 	// EventStream.Publish() is called for every succesfull event in the UserService. Should also forward to EventCollector.
 	EventStream EventStream
 }
 
+// Identifiers accepted by Authenticate, see Config.LoginIdentifier.
+const (
+	IdentifierLoginName        = "login_name"
+	IdentifierEmail            = "email"
+	IdentifierLoginNameOrEmail = "login_name_or_email"
+)
+
 type Config struct {
+	// Realm is the name of the tenant served by this UserService, empty for the default realm. The storages and
+	// event streams must be scoped to the realm by the caller.
+	Realm string
+
 	AuthEmailMustBeVerified bool
 	MaxItems                int
 
+	// LoginIdentifier decides how Authenticate finds the user: IdentifierLoginName (the default if empty),
+	// IdentifierEmail or IdentifierLoginNameOrEmail.
+	LoginIdentifier string
+
 	// How long can a ResetPasswordToken be used?
 	ResetPasswordExpireTime time.Duration
+
+	// How long can an EmailVerificationToken be used?
+	EmailVerificationExpireTime time.Duration
+
+	// How long can a code sent to the phone of a user be used?
+	PhoneCodeExpireTime time.Duration
+
+	// Can users authenticate with a link sent by email instead of a password? See NewLoginLinkToken.
+	EnableLoginLinks bool
+
+	// How long can a LoginLinkToken be used?
+	LoginLinkExpireTime time.Duration
+
+	// Must the current password be given to change the login credentials, email addresses, phone number or passkeys,
+	// or to disable TOTP or email codes?
+	RequireCurrentPassword bool
+
+	// Should Authenticate check the password against BreachedPasswords and flag the user on a match?
+	FlagBreachedPasswords bool
+
+	// How many of the last passwords, including the current one, can not be chosen again? 0 disables the check.
+	PasswordHistorySize int
+
+	// TOTPIssuer is shown in the authenticator app of the user.
+	TOTPIssuer string
+
+	// How long can the challenge returned by Authenticate be completed with a second factor?
+	SecondFactorExpireTime time.Duration
+
+	// How long are the entries of the change history kept? Must be set if an AuditStorage is given.
+	AuditRetention time.Duration
+
+	// How long is a session token valid? It can be renewed with the refresh token.
+	SessionExpireTime time.Duration
+
+	// How long is a refresh token valid? Every refresh issues a new one.
+	SessionRefreshExpireTime time.Duration
+
+	// AccessTokenIssuer and AccessTokenAudience are set as "iss" and "aud" claim of the access tokens. Both are optional.
+	AccessTokenIssuer   string
+	AccessTokenAudience string
+
+	// How long is an access token valid? It can not be revoked.
+	AccessTokenExpireTime time.Duration
+
+	// OIDCIssuer is the URL of the OpenID Connect provider without a trailing slash, e.g. "https://login.example.com".
+	// Empty disables the provider.
+	OIDCIssuer  string
+	OIDCClients []oidc.Client
+
+	// How long can an authorization code be exchanged for tokens?
+	OIDCCodeExpireTime time.Duration
+
+	// AttributeSchema defines the custom attributes of the users. Nil allows no attributes.
+	AttributeSchema *attributes.Schema
+
+	// WebAuthnRPID is the domain passkeys are registered for, e.g. "example.com". Empty disables WebAuthn.
+	WebAuthnRPID   string
+	WebAuthnRPName string
+
+	// WebAuthnOrigins are the origins of the web pages which call the WebAuthn browser API.
+	WebAuthnOrigins []string
+
+	// Must the authenticator verify the user, e.g. with a PIN or biometrics?
+	WebAuthnRequireUserVerification bool
+
+	// How long can a WebAuthn registration or login be completed?
+	WebAuthnExpireTime time.Duration
 }
 
 func (c Config) ValidateValues() error {
 	if c.MaxItems <= 0 {
 		return newInvalidConfig("MaxItems", c.MaxItems)
 	}
+	switch c.LoginIdentifier {
+	case "", IdentifierLoginName, IdentifierEmail, IdentifierLoginNameOrEmail:
+	default:
+		return newInvalidConfig("LoginIdentifier", c.LoginIdentifier)
+	}
 	if c.ResetPasswordExpireTime <= 0 {
 		return newInvalidConfig("ResetPasswordExpireTime", c.ResetPasswordExpireTime)
 	}
+	if c.EmailVerificationExpireTime <= 0 {
+		return newInvalidConfig("EmailVerificationExpireTime", c.EmailVerificationExpireTime)
+	}
+	if c.PhoneCodeExpireTime <= 0 {
+		return newInvalidConfig("PhoneCodeExpireTime", c.PhoneCodeExpireTime)
+	}
+	if c.EnableLoginLinks && c.LoginLinkExpireTime <= 0 {
+		return newInvalidConfig("LoginLinkExpireTime", c.LoginLinkExpireTime)
+	}
+	if c.AuditRetention < 0 {
+		return newInvalidConfig("AuditRetention", c.AuditRetention)
+	}
+	if c.PasswordHistorySize < 0 {
+		return newInvalidConfig("PasswordHistorySize", c.PasswordHistorySize)
+	}
+	if c.TOTPIssuer == "" {
+		return newInvalidConfig("TOTPIssuer", c.TOTPIssuer)
+	}
+	if c.SecondFactorExpireTime <= 0 {
+		return newInvalidConfig("SecondFactorExpireTime", c.SecondFactorExpireTime)
+	}
+	if c.SessionExpireTime <= 0 {
+		return newInvalidConfig("SessionExpireTime", c.SessionExpireTime)
+	}
+	if c.SessionRefreshExpireTime < c.SessionExpireTime {
+		return newInvalidConfig("SessionRefreshExpireTime", c.SessionRefreshExpireTime)
+	}
+	if c.AccessTokenExpireTime <= 0 {
+		return newInvalidConfig("AccessTokenExpireTime", c.AccessTokenExpireTime)
+	}
+	if c.OIDCIssuer != "" {
+		if strings.HasSuffix(c.OIDCIssuer, "/") {
+			return newInvalidConfig("OIDCIssuer", c.OIDCIssuer)
+		}
+		if c.OIDCCodeExpireTime <= 0 {
+			return newInvalidConfig("OIDCCodeExpireTime", c.OIDCCodeExpireTime)
+		}
+	}
+	if c.WebAuthnRPID != "" {
+		if len(c.WebAuthnOrigins) == 0 {
+			return newInvalidConfig("WebAuthnOrigins", c.WebAuthnOrigins)
+		}
+		if c.WebAuthnExpireTime <= 0 {
+			return newInvalidConfig("WebAuthnExpireTime", c.WebAuthnExpireTime)
+		}
+	}
 	return nil
 }
 
@@ -60,14 +210,45 @@ type UserService struct {
 
 	// EventCollector is used by any consumer of the UserService which needs access to the previous events.
 	EventCollector *EventCollector
+
+	// actor and requestID are recorded in the change history, see WithOrigin.
+	actor     string
+	requestID string
+}
+
+// WithOrigin returns a copy of the UserService, which records the actor and the request ID in the change history
+// of the users. Both are given by the consumer, e.g. the ID of an admin and the ID of the request in its logs.
+func (us *UserService) WithOrigin(actor, requestID string) *UserService {
+	scoped := *us
+	scoped.actor = actor
+	scoped.requestID = requestID
+	return &scoped
 }
 
 func (us *UserService) CreateUser(profileName, email, loginName, loginPassword string) (string, error) {
+	return us.CreateUserWithAttributes(profileName, email, loginName, loginPassword, nil)
+}
+
+// CreateUserWithAttributes is like CreateUser, but also sets the custom attributes of the user. They must contain
+// all required attributes of the AttributeSchema.
+//
+// Event: user.created(user_id, profile_name, email, attributes)
+func (us *UserService) CreateUserWithAttributes(profileName, email, loginName, loginPassword string, attributes map[string]interface{}) (string, error) {
 	if profileName == "" || email == "" || loginName == "" || loginPassword == "" {
 		return "", InvalidArguments
 	}
 	log.Printf("call CreateUser('%s', '%s', ..)\n", profileName, email)
 
+	if err := us.checkAttributes(attributes); err != nil {
+		return "", Mask(err)
+	}
+	if err := us.checkLoginName(loginName); err != nil {
+		return "", Mask(err)
+	}
+	if err := us.checkPasswordPolicy(loginPassword, loginName, email, nil); err != nil {
+		return "", Mask(err)
+	}
+
 	passwordHash := us.Hasher.Hash(loginPassword)
 	newUserID := us.IdFactory.NewUserID()
 
@@ -80,6 +261,8 @@ func (us *UserService) CreateUser(profileName, email, loginName, loginPassword s
 
 		LoginName:         loginName,
 		LoginPasswordHash: passwordHash,
+
+		Attributes: attributes,
 	}
 
 	err := us.UserStorage.Save(theUser)
@@ -92,6 +275,7 @@ func (us *UserService) CreateUser(profileName, email, loginName, loginPassword s
 		"user_id":      newUserID,
 		"profile_name": profileName,
 		"email":        email,
+		"attributes":   attributes,
 	})
 
 	return newUserID, nil
@@ -104,14 +288,34 @@ func (us *UserService) GetUser(id string) (user.User, error) {
 }
 
 func (us *UserService) ChangeLoginCredentials(userID, newLogin, newPassword string) error {
+	return us.changeLoginCredentials(userID, newLogin, newPassword, us.withoutCurrentPassword)
+}
+
+// ChangeLoginCredentialsWithCurrentPassword is like ChangeLoginCredentials, but verifies the current password first.
+func (us *UserService) ChangeLoginCredentialsWithCurrentPassword(userID, currentPassword, newLogin, newPassword string) error {
+	return us.changeLoginCredentials(userID, newLogin, newPassword, us.withCurrentPassword(currentPassword))
+}
+
+func (us *UserService) changeLoginCredentials(userID, newLogin, newPassword string, check credentialCheck) error {
 	if userID == "" || newLogin == "" || newPassword == "" {
 		return InvalidArguments
 	}
 	log.Printf("call ChangeLoginCredentials('%s', ..)\n", userID)
 
 	return us.readModifyWrite(userID, func(user *user.User) error {
+		if err := check(user); err != nil {
+			return err
+		}
+		if newLogin != user.LoginName {
+			if err := us.checkLoginName(newLogin); err != nil {
+				return err
+			}
+		}
+		if err := us.checkPasswordPolicy(newPassword, newLogin, user.Email, us.recentPasswordHashes(user)); err != nil {
+			return err
+		}
 		user.LoginName = newLogin
-		user.LoginPasswordHash = us.Hasher.Hash(newPassword)
+		us.setPassword(user, newPassword)
 		return nil
 	}, func(user *user.User) {
 		us.logEvent("user.change_login_credentials", map[string]interface{}{
@@ -120,6 +324,77 @@ func (us *UserService) ChangeLoginCredentials(userID, newLogin, newPassword stri
 	})
 }
 
+// ChangePassword sets a new password for the user and keeps the login name.
+//
+// Event: user.change_password(user_id)
+func (us *UserService) ChangePassword(userID, newPassword string) error {
+	return us.changePassword(userID, newPassword, us.withoutCurrentPassword)
+}
+
+// ChangePasswordWithCurrentPassword is like ChangePassword, but verifies the current password first.
+func (us *UserService) ChangePasswordWithCurrentPassword(userID, currentPassword, newPassword string) error {
+	return us.changePassword(userID, newPassword, us.withCurrentPassword(currentPassword))
+}
+
+func (us *UserService) changePassword(userID, newPassword string, check credentialCheck) error {
+	if userID == "" || newPassword == "" {
+		return InvalidArguments
+	}
+	log.Printf("call ChangePassword('%s', ..)\n", userID)
+
+	return us.readModifyWrite(userID, func(user *user.User) error {
+		if err := check(user); err != nil {
+			return err
+		}
+		if err := us.checkPasswordPolicy(newPassword, user.LoginName, user.Email, us.recentPasswordHashes(user)); err != nil {
+			return err
+		}
+		us.setPassword(user, newPassword)
+		return nil
+	}, func(user *user.User) {
+		us.logEvent("user.change_password", map[string]interface{}{
+			"user_id": userID,
+		})
+	})
+}
+
+// ChangeLoginName sets a new login name for the user and keeps the password.
+//
+// Event: user.change_login_name(user_id, login_name)
+func (us *UserService) ChangeLoginName(userID, newLogin string) error {
+	return us.changeLoginName(userID, newLogin, us.withoutCurrentPassword)
+}
+
+// ChangeLoginNameWithCurrentPassword is like ChangeLoginName, but verifies the current password first.
+func (us *UserService) ChangeLoginNameWithCurrentPassword(userID, currentPassword, newLogin string) error {
+	return us.changeLoginName(userID, newLogin, us.withCurrentPassword(currentPassword))
+}
+
+func (us *UserService) changeLoginName(userID, newLogin string, check credentialCheck) error {
+	if userID == "" || newLogin == "" {
+		return InvalidArguments
+	}
+	log.Printf("call ChangeLoginName('%s', '%s')\n", userID, newLogin)
+
+	return us.readModifyWrite(userID, func(user *user.User) error {
+		if err := check(user); err != nil {
+			return err
+		}
+		if newLogin != user.LoginName {
+			if err := us.checkLoginName(newLogin); err != nil {
+				return err
+			}
+		}
+		user.LoginName = newLogin
+		return nil
+	}, func(user *user.User) {
+		us.logEvent("user.change_login_name", map[string]interface{}{
+			"user_id":    userID,
+			"login_name": newLogin,
+		})
+	})
+}
+
 func (us *UserService) ChangeProfileName(userID, profileName string) error {
 	if userID == "" || profileName == "" {
 		return InvalidArguments
@@ -137,25 +412,170 @@ func (us *UserService) ChangeProfileName(userID, profileName string) error {
 	})
 }
 
-func (us *UserService) ChangeEmail(userID, email string) error {
+// ChangeEmail starts changing the email of the user. The new address is stored as pending until the returned token
+// is passed to ConfirmEmailChange, proving the user can receive mails with it. The current address is notified and
+// can abort the change with the cancel token via CancelEmailChange. Any previous pending change is replaced.
+//
+// Event: user.change_email_requested(user_id, profile_name, email, token, timestamp, expires)
+// Event: user.change_email_notification(user_id, profile_name, email, new_email, cancel_token, timestamp)
+//
+// Returns the confirmation token and the cancel token.
+func (us *UserService) ChangeEmail(userID, email string) (string, string, error) {
+	return us.changeEmail(userID, email, us.withoutCurrentPassword)
+}
+
+// ChangeEmailWithCurrentPassword is like ChangeEmail, but verifies the current password first.
+func (us *UserService) ChangeEmailWithCurrentPassword(userID, currentPassword, email string) (string, string, error) {
+	return us.changeEmail(userID, email, us.withCurrentPassword(currentPassword))
+}
+
+func (us *UserService) changeEmail(userID, email string, check credentialCheck) (string, string, error) {
 	if userID == "" || email == "" {
-		return InvalidArguments
+		return "", "", InvalidArguments
 	}
 	log.Printf("call ChangeEmail('%s', '%s')\n", userID, email)
 
-	return us.readModifyWrite(userID, func(user *user.User) error {
-		user.Email = email
+	var token, cancelToken string
+	err := us.readModifyWrite(userID, func(user *user.User) error {
+		if err := check(user); err != nil {
+			return err
+		}
+
+		if other, err := us.UserStorage.FindByEmail(email); err == nil {
+			if other.ID != userID {
+				return storage.EmailAlreadyTaken
+			}
+			// The user already has this address, there is nothing to confirm
+			return InvalidArguments
+		} else if !IsNotFoundError(err) {
+			return err
+		}
+
+		now := time.Now()
+		token = us.IdFactory.NewEmailVerificationToken()
+		cancelToken = us.IdFactory.NewEmailVerificationToken()
+
+		user.PendingEmail = email
+		user.PendingEmailToken = token
+		user.PendingEmailCancelToken = cancelToken
+		user.PendingEmailIssued = &now
 		return nil
 	}, func(user *user.User) {
-		us.logEvent("user.change_email", map[string]interface{}{
-			"user_id": userID,
-			"email":   email,
+		us.logEvent("user.change_email_requested", map[string]interface{}{
+			"user_id":      user.ID,
+			"profile_name": user.ProfileName,
+			"email":        user.PendingEmail,
+			"token":        user.PendingEmailToken,
+			"timestamp":    user.PendingEmailIssued,
+			"expires":      user.PendingEmailIssued.Add(us.EmailVerificationExpireTime),
+		})
+		us.logEvent("user.change_email_notification", map[string]interface{}{
+			"user_id":      user.ID,
+			"profile_name": user.ProfileName,
+			"email":        user.Email,
+			"new_email":    user.PendingEmail,
+			"cancel_token": user.PendingEmailCancelToken,
+			"timestamp":    user.PendingEmailIssued,
 		})
 	})
+	if err != nil {
+		return "", "", Mask(err)
+	}
+	return token, cancelToken, nil
+}
+
+// ConfirmEmailChange replaces the email of the user, who owns the given token, with the pending email.
+// As the token was sent to the new address, it is verified afterwards.
+//
+// Event: user.change_email(user_id, email)
+//
+// Returns the ID of the user.
+func (us *UserService) ConfirmEmailChange(token string) (string, error) {
+	if token == "" {
+		return "", InvalidArguments
+	}
+	log.Printf("call ConfirmEmailChange(..)\n")
+
+	user, err := us.UserStorage.FindByPendingEmailToken(token)
+	if err != nil {
+		if IsNotFoundError(err) {
+			return "", Mask(InvalidArguments)
+		}
+		return "", Mask(err)
+	}
+
+	if time.Now().After(user.PendingEmailIssued.Add(us.EmailVerificationExpireTime)) {
+		return "", Mask(EmailChangeTokenExpired)
+	}
+
+	// The new address may have been added as secondary address in the meantime
+	removeSecondaryEmail(&user, user.PendingEmail)
+
+	user.Email = user.PendingEmail
+	user.EmailVerified = true
+	clearPendingEmail(&user)
+
+	// Tokens issued for the previous address must not verify the new one
+	user.EmailVerificationToken = ""
+	user.EmailVerificationTokenIssued = nil
+
+	if err := us.UserStorage.Save(user); err != nil {
+		return "", Mask(err)
+	}
+
+	us.logEvent("user.change_email", map[string]interface{}{
+		"user_id": user.ID,
+		"email":   user.Email,
+	})
+
+	return user.ID, nil
+}
+
+// CancelEmailChange aborts the pending email change of the user, who owns the given cancel token.
+//
+// Event: user.change_email_cancelled(user_id, email, new_email)
+//
+// Returns the ID of the user.
+func (us *UserService) CancelEmailChange(cancelToken string) (string, error) {
+	if cancelToken == "" {
+		return "", InvalidArguments
+	}
+	log.Printf("call CancelEmailChange(..)\n")
+
+	user, err := us.UserStorage.FindByPendingEmailCancelToken(cancelToken)
+	if err != nil {
+		if IsNotFoundError(err) {
+			return "", Mask(InvalidArguments)
+		}
+		return "", Mask(err)
+	}
+
+	pendingEmail := user.PendingEmail
+	clearPendingEmail(&user)
+
+	if err := us.UserStorage.Save(user); err != nil {
+		return "", Mask(err)
+	}
+
+	us.logEvent("user.change_email_cancelled", map[string]interface{}{
+		"user_id":   user.ID,
+		"email":     user.Email,
+		"new_email": pendingEmail,
+	})
+
+	return user.ID, nil
+}
+
+func clearPendingEmail(theUser *user.User) {
+	theUser.PendingEmail = ""
+	theUser.PendingEmailToken = ""
+	theUser.PendingEmailCancelToken = ""
+	theUser.PendingEmailIssued = nil
 }
 
 // Authenticate checks whether a user with the given login credentials exists.
 // Returns an error if the credentials are incorrect or the user cannot be authorized.
+// If the user enabled a second factor, a *SecondFactorRequired is returned instead, see CompleteAuthentication.
 //
 // Error Helpers
 //
@@ -165,7 +585,7 @@ func (us *UserService) Authenticate(loginName, loginPassword string) (string, er
 	}
 	log.Printf("call Authenticate('%s', ...)\n", loginName)
 
-	theUser, err := us.UserStorage.FindByLoginName(loginName)
+	theUser, err := us.findByLoginIdentifier(loginName)
 	if err != nil {
 		return "", Mask(err)
 	}
@@ -181,21 +601,87 @@ func (us *UserService) Authenticate(loginName, loginPassword string) (string, er
 		return "", InvalidCredentials
 	}
 
+	// Checked after the password, so the status is not revealed to someone without valid credentials
+	if err := checkUserActive(&theUser); err != nil {
+		return "", Mask(err)
+	}
+
+	changed := false
+
 	needsRehash := us.Hasher.NeedsRehash(theUser.LoginPasswordHash)
 	if needsRehash {
 		theUser.LoginPasswordHash = us.Hasher.Hash(loginPassword)
+		changed = true
+	}
+
+	if us.FlagBreachedPasswords && !theUser.PasswordBreached {
+		if breached, err := us.BreachedPasswords.Contains(loginPassword); err != nil {
+			log.Printf("Failed to check for breached password of user '%s': %v\n", theUser.ID, err)
+		} else if breached {
+			theUser.PasswordBreached = true
+			changed = true
+
+			us.logEvent("user.password_breached", map[string]interface{}{
+				"user_id": theUser.ID,
+				"email":   theUser.Email,
+			})
+		}
+	}
+
+	if methods := secondFactorMethods(&theUser); len(methods) > 0 {
+		return "", us.requireSecondFactor(theUser, methods)
+	}
 
+	if changed {
 		// NOTE: we ignore any error here. Main intent of this function is to provide authentication
 		us.UserStorage.Save(theUser)
 	}
 
 	us.logEvent("user.authenticated", map[string]interface{}{
 		"user_id": theUser.ID,
+		"method":  "password",
+		"groups":  theUser.Groups,
 	})
 
 	return theUser.ID, nil
 }
 
+// findByLoginIdentifier returns the user for the name given to Authenticate, see Config.LoginIdentifier. With
+// IdentifierLoginNameOrEmail the login names are searched first. checkLoginName prevents new login names from
+// shadowing the email of another user.
+func (us *UserService) findByLoginIdentifier(identifier string) (user.User, error) {
+	switch us.LoginIdentifier {
+	case IdentifierEmail:
+		return us.findByEmail(identifier)
+	case IdentifierLoginNameOrEmail:
+		theUser, err := us.UserStorage.FindByLoginName(identifier)
+		if !IsNotFoundError(err) {
+			return theUser, err
+		}
+		return us.findByEmail(identifier)
+	default:
+		return us.UserStorage.FindByLoginName(identifier)
+	}
+}
+
+// checkLoginName returns InvalidLoginName with IdentifierLoginNameOrEmail, if the login name contains an '@' or equals
+// the email of a user. Otherwise Authenticate would find the user with the login name instead of the one with the
+// email.
+func (us *UserService) checkLoginName(loginName string) error {
+	if us.LoginIdentifier != IdentifierLoginNameOrEmail {
+		return nil
+	}
+	if strings.Contains(loginName, "@") {
+		return InvalidLoginName
+	}
+	if _, err := us.UserStorage.FindByEmail(loginName); err == nil {
+		return InvalidLoginName
+	} else if !IsNotFoundError(err) {
+		return err
+	}
+	return nil
+}
+
 func (us *UserService) SetEmailVerified(userID string) error {
 	if userID == "" {
 		return InvalidArguments
@@ -213,6 +699,10 @@ func (us *UserService) SetEmailVerified(userID string) error {
 	})
 }
 
+// CheckAndSetEmailVerified marks the given address of the user as verified. It can be the primary or a secondary
+// address.
+//
+// Event: user.email_verified(user_id, email)
 func (us *UserService) CheckAndSetEmailVerified(userID, email string) error {
 	if userID == "" || email == "" {
 		return InvalidArguments
@@ -220,22 +710,117 @@ func (us *UserService) CheckAndSetEmailVerified(userID, email string) error {
 	log.Printf("call CheckAndSetEmailVerified('%s', '%s')\n", userID, email)
 
 	return us.readModifyWrite(userID, func(user *user.User) error {
-		if user.Email != email {
+		if user.Email == email {
+			user.EmailVerified = true
+			return nil
+		}
+
+		address := user.FindSecondaryEmail(email)
+		if address == nil {
 			return InvalidVerificationEmail
 		}
-		user.EmailVerified = true
+		address.Verified = true
+		address.VerificationToken = ""
+		address.VerificationTokenIssued = nil
 		return nil
 	}, func(user *user.User) {
 		us.logEvent("user.email_verified", map[string]interface{}{
 			"user_id": user.ID,
-			"email":   user.Email,
+			"email":   email,
+		})
+	})
+}
+
+// NewEmailVerificationToken creates a new email verification token for the current email of the user and returns it.
+// The consumer should send this token to the user's email. Passing it to VerifyEmailWithToken proves that the user
+// can receive mails with this address. Any previous token of the user becomes invalid.
+//
+// Event: user.new_email_verification_token(user_id, profile_name, email, token, timestamp, expires)
+func (us *UserService) NewEmailVerificationToken(userID string) (string, error) {
+	if userID == "" {
+		return "", InvalidArguments
+	}
+	log.Printf("call NewEmailVerificationToken('%s')\n", userID)
+
+	var token string
+	err := us.readModifyWrite(userID, func(user *user.User) error {
+		now := time.Now()
+		token = us.IdFactory.NewEmailVerificationToken()
+		user.EmailVerificationToken = token
+		user.EmailVerificationTokenIssued = &now
+		return nil
+	}, func(user *user.User) {
+		us.logEvent("user.new_email_verification_token", map[string]interface{}{
+			"user_id":      user.ID,
+			"profile_name": user.ProfileName,
+			"email":        user.Email,
+			"token":        user.EmailVerificationToken,
+			"timestamp":    user.EmailVerificationTokenIssued,
+			"expires":      user.EmailVerificationTokenIssued.Add(us.EmailVerificationExpireTime),
 		})
 	})
+	if err != nil {
+		return "", Mask(err)
+	}
+	return token, nil
+}
+
+// VerifyEmailWithToken marks the email of the user, who owns the given token, as verified. The token can only be used once.
+// Tokens issued by AddEmail verify the secondary address they were issued for.
+//
+// Event: user.email_verified(user_id, email)
+//
+// Returns the ID of the verified user.
+func (us *UserService) VerifyEmailWithToken(token string) (string, error) {
+	if token == "" {
+		return "", InvalidArguments
+	}
+	log.Printf("call VerifyEmailWithToken(..)\n")
+
+	user, err := us.UserStorage.FindByEmailVerificationToken(token)
+	if err != nil {
+		if IsNotFoundError(err) {
+			return "", Mask(InvalidArguments)
+		}
+		return "", Mask(err)
+	}
+
+	email := user.Email
+	if address := user.FindSecondaryEmailByToken(token); address != nil {
+		if time.Now().After(address.VerificationTokenIssued.Add(us.EmailVerificationExpireTime)) {
+			return "", Mask(EmailVerificationTokenExpired)
+		}
+
+		email = address.Email
+		address.Verified = true
+		address.VerificationToken = ""
+		address.VerificationTokenIssued = nil
+	} else {
+		if time.Now().After(user.EmailVerificationTokenIssued.Add(us.EmailVerificationExpireTime)) {
+			return "", Mask(EmailVerificationTokenExpired)
+		}
+
+		user.EmailVerified = true
+		user.EmailVerificationToken = ""
+		user.EmailVerificationTokenIssued = nil
+	}
+
+	if err := us.UserStorage.Save(user); err != nil {
+		return "", Mask(err)
+	}
+
+	us.logEvent("user.email_verified", map[string]interface{}{
+		"user_id": user.ID,
+		"email":   email,
+	})
+
+	return user.ID, nil
 }
 
 // NewResetLoginCredentialsToken creates a new reset password token, associates it with the user and returns it. The
 // consumer should forward this token to the user's email (or via another communication medium which is known
-// to reach the real user) to verify that the initiator is the real user.
+// to reach the real user) to verify that the initiator is the real user. Besides the primary email, any verified
+// secondary address of the user can be given, the event then contains this address.
 //
 // Event: user.new_reset_password_token(user_id, email, token)
 //
@@ -247,11 +832,15 @@ func (us *UserService) NewResetLoginCredentialsToken(email string) (string, erro
 	}
 	log.Printf("call NewResetLoginCredentialsToken('%s')", email)
 
-	u, err := us.UserStorage.FindByEmail(email)
+	u, err := us.findByEmail(email)
 	if err != nil {
 		return "", Mask(err)
 	}
 
+	if err := checkUserActive(&u); err != nil {
+		return "", Mask(err)
+	}
+
 	now := time.Now()
 	u.ResetPasswordToken = us.IdFactory.NewResetPasswordToken()
 	u.ResetPasswordTokenIssued = &now
@@ -262,7 +851,7 @@ func (us *UserService) NewResetLoginCredentialsToken(email string) (string, erro
 
 	us.logEvent("user.new_reset_login_credentials_token", map[string]interface{}{
 		"user_id":   u.ID,
-		"email":     u.Email,
+		"email":     email,
 		"token":     u.ResetPasswordToken,
 		"timestamp": u.ResetPasswordTokenIssued,
 	})
@@ -270,27 +859,30 @@ func (us *UserService) NewResetLoginCredentialsToken(email string) (string, erro
 }
 
 // ResetCredentialsWithToken checks for users with the given token and resets their login credentials to given values.
+// All sessions of the user are revoked.
 //
-// Event: user.
+// Event: user.login_credentials_resetted(user_id)
 func (us *UserService) ResetCredentialsWithToken(resetPasswordToken, new_login_name, new_login_password string) (string, error) {
 	if resetPasswordToken == "" || new_login_name == "" || new_login_password == "" {
 		return "", Mask(InvalidArguments)
 	}
 
-	user, err := us.UserStorage.FindByResetPasswordToken(resetPasswordToken)
+	user, err := us.findByValidResetPasswordToken(resetPasswordToken)
 	if err != nil {
-		if IsNotFoundError(err) {
-			return "", Mask(InvalidArguments)
-		}
 		return "", Mask(err)
 	}
 
-	if time.Now().After(user.ResetPasswordTokenIssued.Add(us.ResetPasswordExpireTime)) {
-		return "", Mask(ResetPasswordTokenExpired)
+	if new_login_name != user.LoginName {
+		if err := us.checkLoginName(new_login_name); err != nil {
+			return "", Mask(err)
+		}
+	}
+	if err := us.checkPasswordPolicy(new_login_password, new_login_name, user.Email, us.recentPasswordHashes(&user)); err != nil {
+		return "", Mask(err)
 	}
 
 	user.LoginName = new_login_name
-	user.LoginPasswordHash = us.Hasher.Hash(new_login_password)
+	us.setPassword(&user, new_login_password)
 	user.ResetPasswordToken = ""
 	user.ResetPasswordTokenIssued = nil
 
@@ -298,6 +890,11 @@ func (us *UserService) ResetCredentialsWithToken(resetPasswordToken, new_login_n
 		return "", Mask(err)
 	}
 
+	// Sessions opened with the old credentials must not survive the reset
+	if _, err := us.revokeAllSessions(user.ID); err != nil {
+		log.Printf("Failed to revoke sessions of user '%s': %v\n", user.ID, err)
+	}
+
 	us.logEvent("user.login_credentials_resetted", map[string]interface{}{
 		"user_id": user.ID,
 	})
@@ -305,13 +902,224 @@ func (us *UserService) ResetCredentialsWithToken(resetPasswordToken, new_login_n
 	return user.ID, nil
 }
 
+// ResetPasswordWithToken checks for users with the given token and resets their password. The login name is kept.
+// All sessions of the user are revoked.
+//
+// Event: user.password_resetted(user_id)
+func (us *UserService) ResetPasswordWithToken(resetPasswordToken, new_login_password string) (string, error) {
+	if resetPasswordToken == "" || new_login_password == "" {
+		return "", Mask(InvalidArguments)
+	}
+
+	user, err := us.findByValidResetPasswordToken(resetPasswordToken)
+	if err != nil {
+		return "", Mask(err)
+	}
+
+	if err := us.checkPasswordPolicy(new_login_password, user.LoginName, user.Email, us.recentPasswordHashes(&user)); err != nil {
+		return "", Mask(err)
+	}
+
+	us.setPassword(&user, new_login_password)
+	user.ResetPasswordToken = ""
+	user.ResetPasswordTokenIssued = nil
+
+	if err := us.UserStorage.Save(user); err != nil {
+		return "", Mask(err)
+	}
+
+	// Sessions opened with the old credentials must not survive the reset
+	if _, err := us.revokeAllSessions(user.ID); err != nil {
+		log.Printf("Failed to revoke sessions of user '%s': %v\n", user.ID, err)
+	}
+
+	us.logEvent("user.password_resetted", map[string]interface{}{
+		"user_id": user.ID,
+	})
+
+	return user.ID, nil
+}
+
+// findByValidResetPasswordToken returns the user owning the token, if the token has not expired and the user is active.
+func (us *UserService) findByValidResetPasswordToken(resetPasswordToken string) (user.User, error) {
+	user, err := us.UserStorage.FindByResetPasswordToken(resetPasswordToken)
+	if err != nil {
+		if IsNotFoundError(err) {
+			return user, Mask(InvalidArguments)
+		}
+		return user, Mask(err)
+	}
+
+	if time.Now().After(user.ResetPasswordTokenIssued.Add(us.ResetPasswordExpireTime)) {
+		return user, Mask(ResetPasswordTokenExpired)
+	}
+
+	if err := checkUserActive(&user); err != nil {
+		return user, Mask(err)
+	}
+	return user, nil
+}
+
+// DisableUser blocks the user from authenticating or resetting the login credentials until EnableUser is called.
+// Use this for accounts which should be shut down permanently, e.g. because of abuse. All sessions are revoked.
+//
+// Event: user.disabled(user_id, reason, timestamp)
+func (us *UserService) DisableUser(userID, reason string) error {
+	if userID == "" || reason == "" {
+		return InvalidArguments
+	}
+	log.Printf("call DisableUser('%s', '%s')\n", userID, reason)
+
+	return us.changeStatus(userID, user.StatusDisabled, reason, "user.disabled")
+}
+
+// LockUser blocks the user like DisableUser, but is meant for temporary measures like an ongoing investigation.
+//
+// Event: user.locked(user_id, reason, timestamp)
+func (us *UserService) LockUser(userID, reason string) error {
+	if userID == "" || reason == "" {
+		return InvalidArguments
+	}
+	log.Printf("call LockUser('%s', '%s')\n", userID, reason)
+
+	return us.changeStatus(userID, user.StatusLocked, reason, "user.locked")
+}
+
+// EnableUser makes a locked or disabled user active again.
+//
+// Event: user.enabled(user_id, reason, timestamp)
+func (us *UserService) EnableUser(userID, reason string) error {
+	if userID == "" {
+		return InvalidArguments
+	}
+	log.Printf("call EnableUser('%s', '%s')\n", userID, reason)
+
+	return us.changeStatus(userID, user.StatusActive, reason, "user.enabled")
+}
+
+func (us *UserService) changeStatus(userID, status, reason, eventTag string) error {
+	revokeSessions := status != user.StatusActive
+
+	return us.readModifyWrite(userID, func(user *user.User) error {
+		now := time.Now()
+		user.Status = status
+		user.StatusReason = reason
+		user.StatusChanged = &now
+		return nil
+	}, func(user *user.User) {
+		us.logEvent(eventTag, map[string]interface{}{
+			"user_id":   user.ID,
+			"reason":    user.StatusReason,
+			"timestamp": user.StatusChanged,
+		})
+
+		if revokeSessions {
+			if _, err := us.revokeAllSessions(user.ID); err != nil {
+				log.Printf("Failed to revoke sessions of user '%s': %v\n", user.ID, err)
+			}
+		}
+	})
+}
+
+// checkPasswordPolicy returns a *PasswordPolicyViolation if the password violates the PasswordPolicy,
+// is known from a data breach or matches one of the given previous password hashes.
+func (us *UserService) checkPasswordPolicy(password, loginName, email string, previousHashes []string) error {
+	rules := us.PasswordPolicy.Check(password, loginName, email)
+
+	for _, hash := range previousHashes {
+		if us.Hasher.Verify(password, hash) {
+			rules = append(rules, PasswordRuleReused)
+			break
+		}
+	}
+
+	breached, err := us.BreachedPasswords.Contains(password)
+	if err != nil {
+		return Mask(err)
+	}
+	if breached {
+		rules = append(rules, PasswordRuleBreached)
+	}
+
+	if len(rules) > 0 {
+		return &PasswordPolicyViolation{rules}
+	}
+	return nil
+}
+
+// recentPasswordHashes returns the hashes of the last PasswordHistorySize passwords, including the current one.
+func (us *UserService) recentPasswordHashes(user *user.User) []string {
+	if us.PasswordHistorySize <= 0 {
+		return nil
+	}
+
+	hashes := append([]string{user.LoginPasswordHash}, user.PasswordHistory...)
+	if len(hashes) > us.PasswordHistorySize {
+		hashes = hashes[:us.PasswordHistorySize]
+	}
+	return hashes
+}
+
+// setPassword hashes the new password, remembers the previous one in the password history
+// and resets all flags related to the previous password.
+func (us *UserService) setPassword(user *user.User, password string) {
+	if us.PasswordHistorySize > 1 {
+		user.PasswordHistory = append([]string{user.LoginPasswordHash}, user.PasswordHistory...)
+		if len(user.PasswordHistory) > us.PasswordHistorySize-1 {
+			user.PasswordHistory = user.PasswordHistory[:us.PasswordHistorySize-1]
+		}
+	} else {
+		user.PasswordHistory = nil
+	}
+
+	user.LoginPasswordHash = us.Hasher.Hash(password)
+	user.PasswordBreached = false
+}
+
+// credentialCheck is called with the stored user before a sensitive change is applied.
+type credentialCheck func(user *user.User) error
+
+// withoutCurrentPassword allows a sensitive change without the current password, unless the config requires it.
+func (us *UserService) withoutCurrentPassword(user *user.User) error {
+	if us.RequireCurrentPassword {
+		return CurrentPasswordRequired
+	}
+	return nil
+}
+
+// withCurrentPassword returns a check which only allows a sensitive change if currentPassword matches the stored hash.
+func (us *UserService) withCurrentPassword(currentPassword string) credentialCheck {
+	return func(user *user.User) error {
+		if currentPassword == "" || !us.Hasher.Verify(currentPassword, user.LoginPasswordHash) {
+			return InvalidCredentials
+		}
+		return nil
+	}
+}
+
+// checkUserActive returns UserLocked or UserDisabled if the user may not use the service.
+func checkUserActive(theUser *user.User) error {
+	switch theUser.AccountStatus() {
+	case user.StatusLocked:
+		return UserLocked
+	case user.StatusDisabled:
+		return UserDisabled
+	case user.StatusErased:
+		return UserErased
+	}
+	return nil
+}
+
 // readModifyWrite reads the user with the given userID, applies modifier to it, saves the result
-// and calls all success function if no error occured.
+// and calls all success function if no error occured. Erased users can not be modified.
 func (us *UserService) readModifyWrite(userID string, modifier func(user *user.User) error, success ...func(user *user.User)) error {
 	user, err := us.UserStorage.Get(userID)
 	if err != nil {
 		return Mask(err)
 	}
+	if user.Erased != nil {
+		return UserErased
+	}
 
 	err = modifier(&user)
 	if err != nil {
@@ -337,5 +1145,10 @@ func (us *UserService) logEvent(tag string, entry interface{}) {
 		panic(err)
 	}
 	go us.EventStream.Publish(tag, data)
-	go us.EventCollector.publish(tag, data)
+	// Not in the background, so EraseUser finds all previous events of the user in the EventCollector
+	us.EventCollector.publish(tag, data)
+
+	if fields, ok := entry.(map[string]interface{}); ok {
+		us.recordHistory(tag, fields)
+	}
 }
@@ -0,0 +1,75 @@
+package session
+
+import (
+	"github.com/juju/errgo"
+
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"time"
+)
+
+const tokenLength = 32
+
+// Session is created for an authenticated user. Only the hashes of the tokens are stored.
+type Session struct {
+	ID     string
+	UserID string
+
+	// TokenHash is the hash of the current session token, which is valid until TokenExpires.
+	TokenHash    string
+	TokenExpires time.Time
+
+	// RefreshTokenHash is the hash of the current refresh token. It is replaced on every refresh,
+	// older refresh tokens are rejected and revoke the session.
+	RefreshTokenHash string
+
+	// Expires is the time the refresh token expires. The storage removes the session afterwards.
+	Expires time.Time
+
+	Created   time.Time
+	Refreshed *time.Time
+
+	// ClientID and Scope are set for sessions created by the OpenID Connect provider.
+	ClientID string
+	Scope    []string
+
+	// Code is the pending authorization code of an OpenID Connect login. Until it is exchanged, the session has no
+	// tokens and expires with the code.
+	Code *AuthorizationCode
+}
+
+// AuthorizationCode is issued by the OpenID Connect provider and can be exchanged for tokens once.
+type AuthorizationCode struct {
+	Hash    string
+	Expires time.Time
+
+	// RedirectURI and CodeChallenge must match the token request.
+	RedirectURI   string
+	CodeChallenge string
+
+	// Nonce is copied into the ID token.
+	Nonce string
+}
+
+// IsValidToken returns true if the token is the current session token and has not expired.
+func (s *Session) IsValidToken(token string, now time.Time) bool {
+	return s.TokenHash == HashToken(token) && now.Before(s.TokenExpires)
+}
+
+// NewToken returns a new random token, base64url encoded.
+func NewToken() (string, error) {
+	data := make([]byte, tokenLength)
+	if _, err := rand.Read(data); err != nil {
+		return "", errgo.Mask(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// HashToken returns the hex encoded SHA-256 hash of the token. The tokens are random, so no salt or
+// slow hash is needed.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,264 @@
+package service
+
+import (
+	"./session"
+	"./storage"
+
+	"log"
+	"time"
+)
+
+// SessionTokens are returned by CreateSession and RefreshSession. The tokens are not stored, so they can only be
+// handed out once.
+type SessionTokens struct {
+	UserID    string
+	SessionID string
+
+	Token        string
+	TokenExpires time.Time
+
+	RefreshToken        string
+	RefreshTokenExpires time.Time
+}
+
+// CreateSession issues a session for a user, which was authenticated before, e.g. with Authenticate.
+//
+// Event: user.session_created(user_id, session_id)
+func (us *UserService) CreateSession(userID string) (SessionTokens, error) {
+	if userID == "" {
+		return SessionTokens{}, InvalidArguments
+	}
+	log.Printf("call CreateSession('%s')\n", userID)
+
+	theUser, err := us.UserStorage.Get(userID)
+	if err != nil {
+		return SessionTokens{}, Mask(err)
+	}
+	if err := checkUserActive(&theUser); err != nil {
+		return SessionTokens{}, Mask(err)
+	}
+
+	sessionID, err := session.NewToken()
+	if err != nil {
+		return SessionTokens{}, Mask(err)
+	}
+
+	theSession := session.Session{
+		ID:      sessionID,
+		UserID:  theUser.ID,
+		Created: time.Now(),
+	}
+	tokens, err := us.issueSessionTokens(&theSession)
+	if err != nil {
+		return SessionTokens{}, Mask(err)
+	}
+
+	us.logEvent("user.session_created", map[string]interface{}{
+		"user_id":    theSession.UserID,
+		"session_id": theSession.ID,
+	})
+
+	return tokens, nil
+}
+
+// ValidateSession returns the session for a valid session token. The user must still be active.
+func (us *UserService) ValidateSession(token string) (session.Session, error) {
+	if token == "" {
+		return session.Session{}, InvalidArguments
+	}
+
+	theSession, err := us.SessionStorage.FindByToken(session.HashToken(token))
+	if err == storage.SessionNotFound {
+		return session.Session{}, InvalidSession
+	} else if err != nil {
+		return session.Session{}, Mask(err)
+	}
+
+	// Refreshed sessions still have an index entry for their previous tokens
+	if !theSession.IsValidToken(token, time.Now()) {
+		return session.Session{}, InvalidSession
+	}
+
+	theUser, err := us.UserStorage.Get(theSession.UserID)
+	if err != nil {
+		return session.Session{}, Mask(err)
+	}
+	if err := checkUserActive(&theUser); err != nil {
+		return session.Session{}, Mask(err)
+	}
+
+	return theSession, nil
+}
+
+// RefreshSession issues new tokens for the session of the refresh token. The refresh token can only be used once.
+// If an older refresh token is used again, it was probably stolen, so the session is revoked.
+//
+// Event: user.session_refreshed(user_id, session_id)
+// Event: user.session_refresh_token_reused(user_id, session_id)
+func (us *UserService) RefreshSession(refreshToken string) (SessionTokens, error) {
+	if refreshToken == "" {
+		return SessionTokens{}, InvalidArguments
+	}
+	log.Printf("call RefreshSession(..)\n")
+
+	refreshTokenHash := session.HashToken(refreshToken)
+	theSession, err := us.SessionStorage.FindByRefreshToken(refreshTokenHash)
+	if err == storage.SessionNotFound {
+		return SessionTokens{}, InvalidSession
+	} else if err != nil {
+		return SessionTokens{}, Mask(err)
+	}
+
+	if theSession.RefreshTokenHash != refreshTokenHash {
+		if err := us.SessionStorage.Remove(theSession.ID); err != nil && err != storage.SessionNotFound {
+			return SessionTokens{}, Mask(err)
+		}
+
+		us.logEvent("user.session_refresh_token_reused", map[string]interface{}{
+			"user_id":    theSession.UserID,
+			"session_id": theSession.ID,
+		})
+		return SessionTokens{}, InvalidSession
+	}
+
+	theUser, err := us.UserStorage.Get(theSession.UserID)
+	if err != nil {
+		return SessionTokens{}, Mask(err)
+	}
+	if err := checkUserActive(&theUser); err != nil {
+		return SessionTokens{}, Mask(err)
+	}
+
+	now := time.Now()
+	theSession.Refreshed = &now
+	tokens, err := us.issueSessionTokens(&theSession)
+	if err != nil {
+		return SessionTokens{}, Mask(err)
+	}
+
+	us.logEvent("user.session_refreshed", map[string]interface{}{
+		"user_id":    theSession.UserID,
+		"session_id": theSession.ID,
+	})
+
+	return tokens, nil
+}
+
+// ListSessions returns all sessions of the user which have not expired.
+func (us *UserService) ListSessions(userID string) ([]session.Session, error) {
+	if userID == "" {
+		return nil, InvalidArguments
+	}
+	log.Printf("call ListSessions('%s')\n", userID)
+
+	sessions, err := us.SessionStorage.FindByUser(userID)
+	if err != nil {
+		return nil, Mask(err)
+	}
+
+	// Skip OpenID Connect logins, which wait for their authorization code to be exchanged
+	result := make([]session.Session, 0, len(sessions))
+	for _, theSession := range sessions {
+		if theSession.TokenHash != "" {
+			result = append(result, theSession)
+		}
+	}
+	return result, nil
+}
+
+// RevokeSession removes a single session, e.g. on logout. Its tokens become invalid immediately.
+//
+// Event: user.session_revoked(user_id, session_id)
+func (us *UserService) RevokeSession(sessionID string) error {
+	if sessionID == "" {
+		return InvalidArguments
+	}
+	log.Printf("call RevokeSession('%s')\n", sessionID)
+
+	theSession, err := us.SessionStorage.Get(sessionID)
+	if err == storage.SessionNotFound {
+		return InvalidSession
+	} else if err != nil {
+		return Mask(err)
+	}
+
+	if err := us.SessionStorage.Remove(theSession.ID); err != nil && err != storage.SessionNotFound {
+		return Mask(err)
+	}
+
+	us.logEvent("user.session_revoked", map[string]interface{}{
+		"user_id":    theSession.UserID,
+		"session_id": theSession.ID,
+	})
+	return nil
+}
+
+// RevokeAllSessions removes all sessions of the user. Returns the number of revoked sessions.
+//
+// Event: user.sessions_revoked(user_id, count)
+func (us *UserService) RevokeAllSessions(userID string) (int, error) {
+	if userID == "" {
+		return 0, InvalidArguments
+	}
+	log.Printf("call RevokeAllSessions('%s')\n", userID)
+
+	count, err := us.revokeAllSessions(userID)
+	if err != nil {
+		return 0, Mask(err)
+	}
+	return count, nil
+}
+
+func (us *UserService) revokeAllSessions(userID string) (int, error) {
+	sessions, err := us.SessionStorage.FindByUser(userID)
+	if err != nil {
+		return 0, Mask(err)
+	}
+
+	count := 0
+	for _, theSession := range sessions {
+		if err := us.SessionStorage.Remove(theSession.ID); err == storage.SessionNotFound {
+			continue
+		} else if err != nil {
+			return count, Mask(err)
+		}
+		count++
+	}
+
+	us.logEvent("user.sessions_revoked", map[string]interface{}{
+		"user_id": userID,
+		"count":   count,
+	})
+	return count, nil
+}
+
+// issueSessionTokens generates new tokens for the session and saves it. Previous tokens become invalid.
+func (us *UserService) issueSessionTokens(theSession *session.Session) (SessionTokens, error) {
+	token, err := session.NewToken()
+	if err != nil {
+		return SessionTokens{}, err
+	}
+	refreshToken, err := session.NewToken()
+	if err != nil {
+		return SessionTokens{}, err
+	}
+
+	now := time.Now()
+	theSession.TokenHash = session.HashToken(token)
+	theSession.TokenExpires = now.Add(us.SessionExpireTime)
+	theSession.RefreshTokenHash = session.HashToken(refreshToken)
+	theSession.Expires = now.Add(us.SessionRefreshExpireTime)
+
+	if err := us.SessionStorage.Save(*theSession); err != nil {
+		return SessionTokens{}, err
+	}
+
+	return SessionTokens{
+		UserID:              theSession.UserID,
+		SessionID:           theSession.ID,
+		Token:               token,
+		TokenExpires:        theSession.TokenExpires,
+		RefreshToken:        refreshToken,
+		RefreshTokenExpires: theSession.Expires,
+	}, nil
+}
@@ -0,0 +1,113 @@
+package storage
+
+import (
+	"../audit"
+
+	"github.com/garyburd/redigo/redis"
+	"github.com/juju/errgo"
+
+	"encoding/json"
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+var InvalidAuditEntry = errors.New("Invalid audit entry")
+
+// Names used by the audit storage, next to the names of the session storage.
+const (
+	auditEntryName  = "audit_entry"
+	userHistoryName = "user_history"
+)
+
+// NewLocalAuditStorage keeps the audit entries in memory.
+func NewLocalAuditStorage() *auditStorage {
+	return &auditStorage{&localSessionDriver{
+		Lock:   &sync.Mutex{},
+		Values: make(map[string]localValue),
+		Sets:   make(map[string]map[string]time.Time),
+	}}
+}
+
+// NewRedisAuditStorage stores the audit entries with the same key layout as NewRedisSessionStorage:
+//
+//	<prefix>:audit_entry:<entryid> = JSON()
+//	<prefix>:user_history:<userid> = SET(entryid)
+func NewRedisAuditStorage(pool *redis.Pool, prefix string, layout RedisKeyLayout) *auditStorage {
+	return &auditStorage{&redisSessionDriver{pool, prefix, layout}}
+}
+
+// NewEtcdAuditStorage stores the audit entries below the same prefix as NewEtcdSessionStorage:
+//
+//	<prefix>/audit_entry/<entryid> = JSON()
+//	<prefix>/user_history/<userid>/<entryid> = ""
+func NewEtcdAuditStorage(peers []string, prefix string, syncCluster, logCURL bool, logger *log.Logger) *auditStorage {
+	client := newEtcdClient(peers, syncCluster, logCURL, logger)
+	return &auditStorage{&etcdSessionDriver{&EtcdStorageDriver{client, prefix, 0}}}
+}
+
+// auditStorage uses the drivers of the session storage, which remove the entries natively once their retention
+// has passed.
+type auditStorage struct {
+	Driver sessionStorageDriver
+}
+
+func (s *auditStorage) Add(entry audit.Entry, retention time.Duration) error {
+	if entry.ID == "" || entry.UserID == "" || retention <= 0 {
+		return errgo.Mask(InvalidAuditEntry)
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	if err := s.Driver.Set(auditEntryName, entry.ID, string(data), retention); err != nil {
+		return errgo.Mask(err)
+	}
+	if err := s.Driver.AddMember(userHistoryName, entry.UserID, entry.ID, retention); err != nil {
+		return errgo.Mask(err)
+	}
+	return nil
+}
+
+// FindByUser returns the entries of the user, which have not expired yet, newest first. The first offset entries are
+// skipped and at most limit entries are returned, all if limit is 0. Only the returned entries are read, as the IDs
+// of the entries can be ordered on their own. Returns also the total number of entries.
+func (s *auditStorage) FindByUser(userID string, offset, limit int) ([]audit.Entry, int, error) {
+	entryIDs, err := s.Driver.Members(userHistoryName, userID)
+	if err != nil {
+		return nil, 0, errgo.Mask(err)
+	}
+	audit.SortIDsNewestFirst(entryIDs)
+
+	total := len(entryIDs)
+	if offset > total {
+		offset = total
+	}
+
+	var entries []audit.Entry
+	for _, entryID := range entryIDs[offset:] {
+		if limit > 0 && len(entries) == limit {
+			break
+		}
+
+		data, ok, err := s.Driver.Lookup(auditEntryName, entryID)
+		if err != nil {
+			return nil, 0, errgo.Mask(err)
+		}
+		if !ok {
+			// Expired
+			s.Driver.RemoveMember(userHistoryName, userID, entryID)
+			total--
+			continue
+		}
+
+		var entry audit.Entry
+		if err := json.Unmarshal([]byte(data), &entry); err != nil {
+			return nil, 0, errgo.Mask(err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, total, nil
+}
@@ -0,0 +1,62 @@
+package storage
+
+import (
+	"../audit"
+
+	"testing"
+	"time"
+)
+
+func TestAuditStorageFindByUser(t *testing.T) {
+	s := NewLocalAuditStorage()
+	now := time.Now()
+
+	var ids []string
+	for i := 0; i < 5; i++ {
+		entry, _ := audit.NewEntry("user-1", "user.changed", now.Add(time.Duration(i)*time.Second), "", "", nil)
+		if err := s.Add(entry, time.Hour); err != nil {
+			t.Fatalf("Failed to add entry: %v", err)
+		}
+		ids = append([]string{entry.ID}, ids...)
+	}
+	other, _ := audit.NewEntry("user-2", "user.changed", now, "", "", nil)
+	s.Add(other, time.Hour)
+
+	tests := []struct {
+		offset, limit int
+		want          []string
+	}{
+		{0, 0, ids},
+		{0, 2, ids[:2]},
+		{2, 2, ids[2:4]},
+		{4, 2, ids[4:]},
+		{5, 2, nil},
+		{10, 2, nil},
+	}
+	for _, test := range tests {
+		entries, total, err := s.FindByUser("user-1", test.offset, test.limit)
+		if err != nil || total != len(ids) || len(entries) != len(test.want) {
+			t.Fatalf("offset %d, limit %d: expected %d of %d entries, got %d of %d, %v", test.offset, test.limit, len(test.want), len(ids), len(entries), total, err)
+		}
+		for i, entry := range entries {
+			if entry.ID != test.want[i] {
+				t.Errorf("offset %d, limit %d: expected %s at %d, got %s", test.offset, test.limit, test.want[i], i, entry.ID)
+			}
+		}
+	}
+}
+
+func TestAuditStorageFindByUserSkipsExpired(t *testing.T) {
+	s := NewLocalAuditStorage()
+
+	kept, _ := audit.NewEntry("user-1", "user.created", time.Now().Add(-time.Second), "", "", nil)
+	s.Add(kept, time.Hour)
+	expired, _ := audit.NewEntry("user-1", "user.changed", time.Now(), "", "", nil)
+	s.Add(expired, time.Hour)
+	s.Driver.Remove(auditEntryName, expired.ID)
+
+	entries, total, err := s.FindByUser("user-1", 0, 1)
+	if err != nil || total != 1 || len(entries) != 1 || entries[0].ID != kept.ID {
+		t.Fatalf("Expected only the entry which has not expired, got %#v, %d, %v", entries, total, err)
+	}
+}
@@ -8,4 +8,8 @@ var (
 
 	LoginNameAlreadyTaken = errors.New("The given loginName is already taken.")
 	EmailAlreadyTaken     = errors.New("The given email address is already taken.")
+	PhoneAlreadyTaken     = errors.New("The given phone number is already taken.")
+	TokenAlreadyTaken     = errors.New("The given token is already taken.")
+
+	WebAuthnCredentialAlreadyTaken = errors.New("The given WebAuthn credential is already registered.")
 )
@@ -0,0 +1,68 @@
+package storage
+
+import (
+	"../group"
+
+	"github.com/juju/errgo"
+
+	"encoding/json"
+	"errors"
+)
+
+var (
+	InvalidGroupObject = errors.New("Invalid group object")
+	GroupNotFound      = errors.New("No group found.")
+)
+
+// groupDataName is the index the groups are stored in, e.g. as redis key prefix.
+const groupDataName = "group"
+
+// SaveGroup writes the group as JSON into the group index of the user storage backend.
+func (s *keyValueStorage) SaveGroup(theGroup group.Group) error {
+	if theGroup.Name == "" {
+		return errgo.Mask(InvalidGroupObject)
+	}
+
+	data, err := json.Marshal(theGroup)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+
+	// Some backends (etcd) don't overwrite index entries
+	if _, ok, err := s.Groups.Lookup(theGroup.Name); err != nil {
+		return errgo.Mask(err)
+	} else if ok {
+		if err := s.Groups.Remove(theGroup.Name); err != nil {
+			return errgo.Mask(err)
+		}
+	}
+	if err := s.Groups.Put(theGroup.Name, string(data)); err != nil {
+		return errgo.Mask(err)
+	}
+	return nil
+}
+
+func (s *keyValueStorage) GetGroup(name string) (group.Group, error) {
+	data, ok, err := s.Groups.Lookup(name)
+	if err != nil {
+		return group.Group{}, errgo.Mask(err)
+	}
+	if !ok {
+		return group.Group{}, GroupNotFound
+	}
+
+	var theGroup group.Group
+	if err := json.Unmarshal([]byte(data), &theGroup); err != nil {
+		return group.Group{}, errgo.Mask(err)
+	}
+	return theGroup, nil
+}
+
+func (s *keyValueStorage) RemoveGroup(name string) error {
+	if _, ok, err := s.Groups.Lookup(name); err != nil {
+		return errgo.Mask(err)
+	} else if !ok {
+		return GroupNotFound
+	}
+	return errgo.Mask(s.Groups.Remove(name))
+}
@@ -27,10 +27,24 @@ type keyValueStorageDriver interface {
 	Index(name string) keyValueIndex
 }
 
+// keyValueUpdateDriver is implemented by drivers which can write a user together with its index entries atomically.
+type keyValueUpdateDriver interface {
+	// Update removes the removed index entries, puts the added ones and writes the json of the user at once.
+	Update(userID, json string, removed, added []indexEntry) error
+}
+
 type keyValueStorage struct {
-	LoginNames         keyValueIndex
-	Emails             keyValueIndex
-	ResetPasswordToken keyValueIndex
+	LoginNames             keyValueIndex
+	Emails                 keyValueIndex
+	Phones                 keyValueIndex
+	ResetPasswordToken     keyValueIndex
+	LoginLinkToken         keyValueIndex
+	EmailVerificationToken keyValueIndex
+	PendingEmailToken      keyValueIndex
+	PendingEmailCancel     keyValueIndex
+	AuthChallenge          keyValueIndex
+	WebAuthnCredentials    keyValueIndex
+	Groups                 keyValueIndex
 
 	Driver keyValueStorageDriver
 }
@@ -38,13 +52,29 @@ type keyValueStorage struct {
 func newKeyValueStorage(driver keyValueStorageDriver) *keyValueStorage {
 	loginNames := driver.Index("login_name")
 	emails := driver.Index("emails")
+	phones := driver.Index("phone")
 	resedPasswordToken := driver.Index("reset_password_token")
+	loginLinkToken := driver.Index("login_link_token")
+	emailVerificationToken := driver.Index("email_verification_token")
+	pendingEmailToken := driver.Index("pending_email_token")
+	pendingEmailCancel := driver.Index("pending_email_cancel_token")
+	authChallenge := driver.Index("auth_challenge")
+	webAuthnCredentials := driver.Index("webauthn_credential")
+	groups := driver.Index(groupDataName)
 
 	return &keyValueStorage{
-		Driver:             driver,
-		LoginNames:         loginNames,
-		Emails:             emails,
-		ResetPasswordToken: resedPasswordToken,
+		Driver:                 driver,
+		LoginNames:             loginNames,
+		Emails:                 emails,
+		Phones:                 phones,
+		ResetPasswordToken:     resedPasswordToken,
+		LoginLinkToken:         loginLinkToken,
+		EmailVerificationToken: emailVerificationToken,
+		PendingEmailToken:      pendingEmailToken,
+		PendingEmailCancel:     pendingEmailCancel,
+		AuthChallenge:          authChallenge,
+		WebAuthnCredentials:    webAuthnCredentials,
+		Groups:                 groups,
 	}
 }
 
@@ -52,33 +82,22 @@ func (s *keyValueStorage) Save(user user.User) error {
 	if user.ID == "" {
 		return errgo.Mask(InvalidUserObject)
 	}
-	if user.Email == "" {
+	// Erased users are kept without any personal data
+	if user.Email == "" && user.Erased == nil {
 		return errgo.Mask(InvalidUserObject)
 
 	}
 
-	if user.LoginName == "" {
+	if user.LoginName == "" && user.Erased == nil {
 		return errgo.Mask(InvalidUserObject)
 	}
 
 	// Unique Index Validation
-	if taken, err := s.checkTakenByOtherUser(s.Emails, user.Email, user.ID); err != nil {
-		return errgo.Mask(err)
-	} else if taken {
-		return EmailAlreadyTaken
-	}
-
-	if taken, err := s.checkTakenByOtherUser(s.LoginNames, user.LoginName, user.ID); err != nil {
-		return errgo.Mask(err)
-	} else if taken {
-		return LoginNameAlreadyTaken
-	}
-
-	if user.ResetPasswordToken != "" {
-		if taken, err := s.checkTakenByOtherUser(s.ResetPasswordToken, user.ResetPasswordToken, user.ID); err != nil {
+	for _, entry := range s.indexEntries(user) {
+		if taken, err := s.checkTakenByOtherUser(entry.Index, entry.Key, user.ID); err != nil {
 			return errgo.Mask(err)
 		} else if taken {
-			return LoginNameAlreadyTaken
+			return entry.TakenError
 		}
 	}
 
@@ -88,28 +107,27 @@ func (s *keyValueStorage) Save(user user.User) error {
 		return errgo.Mask(err)
 	}
 
-	if oldUser.Email != "" {
-		s.Emails.Remove(oldUser.Email)
+	data, err := json.Marshal(user)
+	if err != nil {
+		return errgo.Mask(err)
 	}
 
-	if oldUser.LoginName != "" {
-		s.LoginNames.Remove(oldUser.LoginName)
+	if driver, ok := s.Driver.(keyValueUpdateDriver); ok {
+		// Drivers may check the index again, e.g. against concurrent saves, and return the TakenError of the entry
+		if err := driver.Update(user.ID, string(data), s.indexEntries(oldUser), s.indexEntries(user)); err != nil {
+			return errgo.Mask(err, errgo.Any)
+		}
+		return nil
 	}
 
-	if oldUser.ResetPasswordToken != "" {
-		s.ResetPasswordToken.Remove(oldUser.ResetPasswordToken)
+	for _, entry := range s.indexEntries(oldUser) {
+		entry.Index.Remove(entry.Key)
 	}
 
-	s.Emails.Put(user.Email, user.ID)
-	s.LoginNames.Put(user.LoginName, user.ID)
-	if user.ResetPasswordToken != "" {
-		s.ResetPasswordToken.Put(user.ResetPasswordToken, user.ID)
+	for _, entry := range s.indexEntries(user) {
+		entry.Index.Put(entry.Key, user.ID)
 	}
 
-	data, err := json.Marshal(user)
-	if err != nil {
-		return errgo.Mask(err)
-	}
 	s.Driver.Set(user.ID, string(data))
 
 	return nil
@@ -143,6 +161,16 @@ func (s *keyValueStorage) FindByEmail(email string) (user.User, error) {
 	}
 	return s.noLockLookup(userID)
 }
+func (s *keyValueStorage) FindByPhone(phone string) (user.User, error) {
+	userID, ok, err := s.Phones.Lookup(phone)
+	if err != nil {
+		return user.User{}, errgo.Mask(err)
+	}
+	if !ok {
+		return user.User{}, UserNotFound
+	}
+	return s.noLockLookup(userID)
+}
 func (s *keyValueStorage) FindByResetPasswordToken(token string) (user.User, error) {
 	userID, ok, err := s.ResetPasswordToken.Lookup(token)
 	if err != nil {
@@ -153,9 +181,110 @@ func (s *keyValueStorage) FindByResetPasswordToken(token string) (user.User, err
 	}
 	return s.noLockLookup(userID)
 }
+func (s *keyValueStorage) FindByLoginLinkToken(token string) (user.User, error) {
+	userID, ok, err := s.LoginLinkToken.Lookup(token)
+	if err != nil {
+		return user.User{}, errgo.Mask(err)
+	}
+	if !ok {
+		return user.User{}, UserNotFound
+	}
+	return s.noLockLookup(userID)
+}
+func (s *keyValueStorage) FindByEmailVerificationToken(token string) (user.User, error) {
+	userID, ok, err := s.EmailVerificationToken.Lookup(token)
+	if err != nil {
+		return user.User{}, errgo.Mask(err)
+	}
+	if !ok {
+		return user.User{}, UserNotFound
+	}
+	return s.noLockLookup(userID)
+}
+func (s *keyValueStorage) FindByPendingEmailToken(token string) (user.User, error) {
+	userID, ok, err := s.PendingEmailToken.Lookup(token)
+	if err != nil {
+		return user.User{}, errgo.Mask(err)
+	}
+	if !ok {
+		return user.User{}, UserNotFound
+	}
+	return s.noLockLookup(userID)
+}
+func (s *keyValueStorage) FindByPendingEmailCancelToken(token string) (user.User, error) {
+	userID, ok, err := s.PendingEmailCancel.Lookup(token)
+	if err != nil {
+		return user.User{}, errgo.Mask(err)
+	}
+	if !ok {
+		return user.User{}, UserNotFound
+	}
+	return s.noLockLookup(userID)
+}
+func (s *keyValueStorage) FindByAuthChallenge(challenge string) (user.User, error) {
+	userID, ok, err := s.AuthChallenge.Lookup(challenge)
+	if err != nil {
+		return user.User{}, errgo.Mask(err)
+	}
+	if !ok {
+		return user.User{}, UserNotFound
+	}
+	return s.noLockLookup(userID)
+}
+func (s *keyValueStorage) FindByWebAuthnCredential(credentialID string) (user.User, error) {
+	userID, ok, err := s.WebAuthnCredentials.Lookup(credentialID)
+	if err != nil {
+		return user.User{}, errgo.Mask(err)
+	}
+	if !ok {
+		return user.User{}, UserNotFound
+	}
+	return s.noLockLookup(userID)
+}
 
 // -------------------------------------------------
 
+// indexEntry describes a key of a user in one of the unique indexes.
+type indexEntry struct {
+	Index keyValueIndex
+	Key   string
+
+	// TakenError is returned by Save() if the key belongs to another user.
+	TakenError error
+}
+
+// indexEntries returns all index keys of the given user. Empty keys are not indexed.
+func (s *keyValueStorage) indexEntries(user user.User) []indexEntry {
+	candidates := []indexEntry{
+		{s.Emails, user.Email, EmailAlreadyTaken},
+		{s.LoginNames, user.LoginName, LoginNameAlreadyTaken},
+		{s.Phones, user.Phone, PhoneAlreadyTaken},
+		{s.ResetPasswordToken, user.ResetPasswordToken, TokenAlreadyTaken},
+		{s.LoginLinkToken, user.LoginLinkToken, TokenAlreadyTaken},
+		{s.EmailVerificationToken, user.EmailVerificationToken, TokenAlreadyTaken},
+		{s.PendingEmailToken, user.PendingEmailToken, TokenAlreadyTaken},
+		{s.PendingEmailCancel, user.PendingEmailCancelToken, TokenAlreadyTaken},
+		{s.AuthChallenge, user.AuthChallenge, TokenAlreadyTaken},
+	}
+	for _, address := range user.SecondaryEmails {
+		candidates = append(candidates,
+			indexEntry{s.Emails, address.Email, EmailAlreadyTaken},
+			indexEntry{s.EmailVerificationToken, address.VerificationToken, TokenAlreadyTaken},
+		)
+	}
+	for _, credential := range user.WebAuthnCredentials {
+		candidates = append(candidates, indexEntry{s.WebAuthnCredentials, credential.ID, WebAuthnCredentialAlreadyTaken})
+	}
+
+	entries := make([]indexEntry, 0, len(candidates))
+	for _, entry := range candidates {
+		if entry.Key != "" {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
 func (s *keyValueStorage) checkTakenByOtherUser(index keyValueIndex, key, userID string) (bool, error) {
 	otherUserID, taken, err := index.Lookup(key)
 	if err != nil {
@@ -22,6 +22,11 @@ func etcdKey(prefix, index, key string) string {
 }
 
 func NewEtcdStorage(peers []string, prefix string, ttl uint64, syncCluster, logCURL bool, logger *log.Logger) *keyValueStorage {
+	client := newEtcdClient(peers, syncCluster, logCURL, logger)
+	return newKeyValueStorage(&EtcdStorageDriver{client, prefix, ttl})
+}
+
+func newEtcdClient(peers []string, syncCluster, logCURL bool, logger *log.Logger) *etcd.Client {
 	client := etcd.NewClient(peers)
 
 	if logger != nil {
@@ -42,7 +47,7 @@ func NewEtcdStorage(peers []string, prefix string, ttl uint64, syncCluster, logC
 	if syncCluster {
 		client.SyncCluster()
 	}
-	return newKeyValueStorage(&EtcdStorageDriver{client, prefix, ttl})
+	return client
 }
 
 type EtcdStorageDriver struct {
@@ -5,18 +5,62 @@ import (
 	"github.com/juju/errgo"
 )
 
+// RedisKeyLayout decides how the users and indexes are mapped onto redis keys.
+type RedisKeyLayout int
+
+const (
+	// RedisLayoutPlain writes all keys as they are:
+	//  <prefix>:user:<userid> = JSON()
+	//  <prefix>:emails:<email> = userid()
+	//  <prefix>:login_name:<login_name> = userid()
+	RedisLayoutPlain RedisKeyLayout = iota
+
+	// RedisLayoutHashTag wraps the prefix into a hash tag, so all keys end up in the same slot
+	// of a Redis Cluster and a user can be updated together with its index entries:
+	//  {<prefix>}:user:<userid> = JSON()
+	//  {<prefix>}:emails:<email> = userid()
+	//  {<prefix>}:login_name:<login_name> = userid()
+	//
+	// As a consequence the data of userd is not sharded: all keys are stored on the one node owning the slot.
+	// The index entries can not be tagged per user, since they are looked up by email or login name.
+	RedisLayoutHashTag
+)
+
+// defaultRedisHashTag is used by RedisLayoutHashTag if no prefix is given.
+const defaultRedisHashTag = "userd"
+
+// redisKey builds the key for the given index and key. Without a prefix the plain layout
+// produces the same keys as older versions of userd (<index>:<key>).
+func redisKey(layout RedisKeyLayout, prefix, index, key string) string {
+	switch layout {
+	case RedisLayoutHashTag:
+		if prefix == "" {
+			prefix = defaultRedisHashTag
+		}
+		return "{" + prefix + "}:" + index + ":" + key
+	default:
+		if prefix == "" {
+			return index + ":" + key
+		}
+		return prefix + ":" + index + ":" + key
+	}
+}
+
 type redisKeyValueDriver struct {
-	Pool  *redis.Pool
-	Users *redisIndex
+	Pool   *redis.Pool
+	Prefix string
+	Layout RedisKeyLayout
+	Users  *redisIndex
 }
 
-func NewRedisStorage(pool *redis.Pool) *keyValueStorage {
-	return newKeyValueStorage(&redisKeyValueDriver{
-		Pool: pool,
-		Users: &redisIndex{pool, func(key string) string {
-			return "user:" + key
-		}},
-	})
+func NewRedisStorage(pool *redis.Pool, prefix string, layout RedisKeyLayout) *keyValueStorage {
+	driver := &redisKeyValueDriver{
+		Pool:   pool,
+		Prefix: prefix,
+		Layout: layout,
+	}
+	driver.Users = driver.index(userDataName)
+	return newKeyValueStorage(driver)
 }
 
 func (r *redisKeyValueDriver) Set(userID, userJson string) error {
@@ -27,9 +71,108 @@ func (r *redisKeyValueDriver) Lookup(userID string) (string, bool, error) {
 	return r.Users.Lookup(userID)
 }
 
+// redisUpdateAttempts is how often Update tries again, if a concurrent save changed one of the watched index keys.
+const redisUpdateAttempts = 3
+
+// Update writes the user and its index entries in one MULTI/EXEC transaction, so a crash can not leave stale or
+// missing index entries behind. The added index keys are watched and checked again before the transaction, so two
+// concurrent saves can not claim the same key. On a Redis Cluster this requires RedisLayoutHashTag.
+func (r *redisKeyValueDriver) Update(userID, userJson string, removed, added []indexEntry) error {
+	removedKeys, err := redisIndexKeys(removed)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	addedKeys, err := redisIndexKeys(added)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+
+	con := r.Pool.Get()
+	defer con.Close()
+
+	for attempt := 0; attempt < redisUpdateAttempts; attempt++ {
+		done, err := r.update(con, userID, userJson, removedKeys, addedKeys, added)
+		if err != nil {
+			return errgo.Mask(err, errgo.Any)
+		}
+		if done {
+			return nil
+		}
+	}
+	return errgo.Newf("The index keys of user %s were changed concurrently too often.", userID)
+}
+
+// update runs one attempt of Update. Returns false if a watched key was changed and nothing was written.
+func (r *redisKeyValueDriver) update(con redis.Conn, userID, userJson string, removedKeys, addedKeys []string, added []indexEntry) (bool, error) {
+	for i, key := range addedKeys {
+		if _, err := con.Do("WATCH", key); err != nil {
+			return false, errgo.Mask(err)
+		}
+		owner, err := redis.String(con.Do("GET", key))
+		if err == redis.ErrNil {
+			continue
+		}
+		if err == nil && owner != userID {
+			err = added[i].TakenError
+		}
+		if err != nil {
+			con.Do("UNWATCH")
+			return false, errgo.Mask(err, errgo.Any)
+		}
+	}
+
+	if err := con.Send("MULTI"); err != nil {
+		return false, errgo.Mask(err)
+	}
+	for _, key := range removedKeys {
+		if err := con.Send("DEL", key); err != nil {
+			return false, errgo.Mask(err)
+		}
+	}
+	for _, key := range addedKeys {
+		if err := con.Send("SET", key, userID); err != nil {
+			return false, errgo.Mask(err)
+		}
+	}
+	if err := con.Send("SET", r.Users.Key(userID), userJson); err != nil {
+		return false, errgo.Mask(err)
+	}
+
+	replies, err := redis.Values(con.Do("EXEC"))
+	if err == redis.ErrNil {
+		// A watched key was changed, the transaction was discarded
+		return false, nil
+	} else if err != nil {
+		return false, errgo.Mask(err)
+	}
+	for _, reply := range replies {
+		if err, ok := reply.(redis.Error); ok {
+			return false, errgo.Mask(err)
+		}
+	}
+	return true, nil
+}
+
+// redisIndexKeys returns the Redis keys of the index entries. All indexes must be created by redisKeyValueDriver.
+func redisIndexKeys(entries []indexEntry) ([]string, error) {
+	keys := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		index, ok := entry.Index.(*redisIndex)
+		if !ok {
+			return nil, errgo.Newf("The index %T is not stored in Redis.", entry.Index)
+		}
+		keys = append(keys, index.Key(entry.Key))
+	}
+	return keys, nil
+}
+
 func (r *redisKeyValueDriver) Index(name string) keyValueIndex {
+	return r.index(name)
+}
+
+func (r *redisKeyValueDriver) index(name string) *redisIndex {
 	return &redisIndex{Pool: r.Pool, Key: func(key string) string {
-		return name + ":" + key
+		return redisKey(r.Layout, r.Prefix, name, key)
 	}}
 }
 
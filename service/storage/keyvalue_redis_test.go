@@ -0,0 +1,38 @@
+package storage
+
+import (
+	"testing"
+)
+
+func TestRedisKey(t *testing.T) {
+	tests := []struct {
+		layout RedisKeyLayout
+		prefix string
+		want   string
+	}{
+		{RedisLayoutPlain, "", "emails:user@example.com"},
+		{RedisLayoutPlain, "userd", "userd:emails:user@example.com"},
+		{RedisLayoutPlain, "userd:realm", "userd:realm:emails:user@example.com"},
+		{RedisLayoutHashTag, "", "{userd}:emails:user@example.com"},
+		{RedisLayoutHashTag, "accounts", "{accounts}:emails:user@example.com"},
+		{RedisLayoutHashTag, "userd:realm", "{userd:realm}:emails:user@example.com"},
+	}
+
+	for _, test := range tests {
+		if key := redisKey(test.layout, test.prefix, "emails", "user@example.com"); key != test.want {
+			t.Errorf("redisKey(%d, '%s') = '%s', expected '%s'", test.layout, test.prefix, key, test.want)
+		}
+	}
+}
+
+func TestRedisIndexKeys(t *testing.T) {
+	index := &redisIndex{Key: func(key string) string { return "emails:" + key }}
+	keys, err := redisIndexKeys([]indexEntry{{Index: index, Key: "user@example.com"}})
+	if err != nil || len(keys) != 1 || keys[0] != "emails:user@example.com" {
+		t.Errorf("redisIndexKeys() = %v, %v, expected [emails:user@example.com]", keys, err)
+	}
+
+	if _, err := redisIndexKeys([]indexEntry{{Index: &EtcdIndex{}, Key: "user@example.com"}}); err == nil {
+		t.Errorf("Expected an index not stored in Redis to be rejected")
+	}
+}
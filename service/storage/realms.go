@@ -0,0 +1,19 @@
+package storage
+
+// realmsName separates the keys of the realms from the ones of the default realm.
+const realmsName = "realms"
+
+// RealmPrefix returns the key prefix of a realm below the given prefix, so every realm has its own users, indexes and
+// sessions. The default realm "" keeps the prefix and therefore the keys of older versions:
+//
+//	redis: <prefix>:realms:<realm>:user:<userid>
+//	etcd:  <prefix>/realms/<realm>/user/<userid>
+func RealmPrefix(prefix, realm, separator string) string {
+	if realm == "" {
+		return prefix
+	}
+	if prefix == "" {
+		return realmsName + separator + realm
+	}
+	return prefix + separator + realmsName + separator + realm
+}
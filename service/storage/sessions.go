@@ -0,0 +1,192 @@
+package storage
+
+import (
+	"../session"
+
+	"github.com/juju/errgo"
+
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+var (
+	InvalidSessionObject = errors.New("Invalid session object")
+	SessionNotFound      = errors.New("No session found.")
+)
+
+// Names used by the session storage drivers, e.g. as redis key prefix.
+const (
+	sessionDataName         = "session"
+	sessionTokenName        = "session_token"
+	sessionRefreshTokenName = "session_refresh_token"
+	sessionCodeName         = "session_code"
+	userSessionsName        = "user_sessions"
+)
+
+// sessionStorageDriver stores values which expire after the given ttl. Backends with native expiry remove the
+// values themselves.
+type sessionStorageDriver interface {
+	Set(name, key, value string, ttl time.Duration) error
+	Lookup(name, key string) (string, bool, error)
+	Remove(name, key string) error
+
+	// AddMember adds a member to a set. The set expires after ttl, unless it is extended by another member.
+	AddMember(name, set, member string, ttl time.Duration) error
+	RemoveMember(name, set, member string) error
+	Members(name, set string) ([]string, error)
+}
+
+type sessionStorage struct {
+	Driver sessionStorageDriver
+}
+
+func newSessionStorage(driver sessionStorageDriver) *sessionStorage {
+	return &sessionStorage{driver}
+}
+
+// Save writes the session and its token indexes. Everything expires at session.Expires, the
+// session token index already at session.TokenExpires. Sessions with a pending authorization
+// code may have no tokens yet.
+func (s *sessionStorage) Save(theSession session.Session) error {
+	if theSession.ID == "" || theSession.UserID == "" {
+		return errgo.Mask(InvalidSessionObject)
+	}
+	hasTokens := theSession.TokenHash != "" && theSession.RefreshTokenHash != ""
+	if !hasTokens && theSession.Code == nil {
+		return errgo.Mask(InvalidSessionObject)
+	}
+
+	ttl := theSession.Expires.Sub(time.Now())
+	if ttl <= 0 {
+		return errgo.Mask(InvalidSessionObject)
+	}
+
+	data, err := json.Marshal(theSession)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+
+	if err := s.Driver.Set(sessionDataName, theSession.ID, string(data), ttl); err != nil {
+		return errgo.Mask(err)
+	}
+	if hasTokens {
+		tokenTTL := theSession.TokenExpires.Sub(time.Now())
+		if tokenTTL <= 0 {
+			return errgo.Mask(InvalidSessionObject)
+		}
+		if err := s.Driver.Set(sessionTokenName, theSession.TokenHash, theSession.ID, tokenTTL); err != nil {
+			return errgo.Mask(err)
+		}
+		if err := s.Driver.Set(sessionRefreshTokenName, theSession.RefreshTokenHash, theSession.ID, ttl); err != nil {
+			return errgo.Mask(err)
+		}
+	}
+	if theSession.Code != nil {
+		codeTTL := theSession.Code.Expires.Sub(time.Now())
+		if codeTTL <= 0 {
+			return errgo.Mask(InvalidSessionObject)
+		}
+		if err := s.Driver.Set(sessionCodeName, theSession.Code.Hash, theSession.ID, codeTTL); err != nil {
+			return errgo.Mask(err)
+		}
+	}
+	if err := s.Driver.AddMember(userSessionsName, theSession.UserID, theSession.ID, ttl); err != nil {
+		return errgo.Mask(err)
+	}
+	return nil
+}
+
+func (s *sessionStorage) Get(sessionID string) (session.Session, error) {
+	data, ok, err := s.Driver.Lookup(sessionDataName, sessionID)
+	if err != nil {
+		return session.Session{}, errgo.Mask(err)
+	}
+	if !ok {
+		return session.Session{}, SessionNotFound
+	}
+
+	var theSession session.Session
+	if err := json.Unmarshal([]byte(data), &theSession); err != nil {
+		return session.Session{}, errgo.Mask(err)
+	}
+	return theSession, nil
+}
+
+// FindByToken returns the session the token hash was issued for. The caller must check, if it is still the current token.
+func (s *sessionStorage) FindByToken(tokenHash string) (session.Session, error) {
+	return s.findBy(sessionTokenName, tokenHash)
+}
+
+// FindByRefreshToken returns the session the refresh token hash was issued for, also if it was replaced by now.
+func (s *sessionStorage) FindByRefreshToken(refreshTokenHash string) (session.Session, error) {
+	return s.findBy(sessionRefreshTokenName, refreshTokenHash)
+}
+
+// FindByAuthorizationCode returns the session the code hash was issued for, also if it was exchanged by now.
+func (s *sessionStorage) FindByAuthorizationCode(codeHash string) (session.Session, error) {
+	return s.findBy(sessionCodeName, codeHash)
+}
+
+func (s *sessionStorage) FindByUser(userID string) ([]session.Session, error) {
+	sessionIDs, err := s.Driver.Members(userSessionsName, userID)
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+
+	sessions := make([]session.Session, 0, len(sessionIDs))
+	for _, sessionID := range sessionIDs {
+		theSession, err := s.Get(sessionID)
+		if err == SessionNotFound {
+			// Expired
+			s.Driver.RemoveMember(userSessionsName, userID, sessionID)
+			continue
+		} else if err != nil {
+			return nil, errgo.Mask(err)
+		}
+		sessions = append(sessions, theSession)
+	}
+	return sessions, nil
+}
+
+// Remove deletes the session and its current token indexes. Older refresh tokens point to a missing session afterwards.
+func (s *sessionStorage) Remove(sessionID string) error {
+	theSession, err := s.Get(sessionID)
+	if err == SessionNotFound {
+		return SessionNotFound
+	} else if err != nil {
+		return errgo.Mask(err)
+	}
+
+	if theSession.TokenHash != "" {
+		if err := s.Driver.Remove(sessionTokenName, theSession.TokenHash); err != nil {
+			return errgo.Mask(err)
+		}
+		if err := s.Driver.Remove(sessionRefreshTokenName, theSession.RefreshTokenHash); err != nil {
+			return errgo.Mask(err)
+		}
+	}
+	if theSession.Code != nil {
+		if err := s.Driver.Remove(sessionCodeName, theSession.Code.Hash); err != nil {
+			return errgo.Mask(err)
+		}
+	}
+	if err := s.Driver.RemoveMember(userSessionsName, theSession.UserID, sessionID); err != nil {
+		return errgo.Mask(err)
+	}
+	if err := s.Driver.Remove(sessionDataName, sessionID); err != nil {
+		return errgo.Mask(err)
+	}
+	return nil
+}
+
+func (s *sessionStorage) findBy(name, hash string) (session.Session, error) {
+	sessionID, ok, err := s.Driver.Lookup(name, hash)
+	if err != nil {
+		return session.Session{}, errgo.Mask(err)
+	}
+	if !ok {
+		return session.Session{}, SessionNotFound
+	}
+	return s.Get(sessionID)
+}
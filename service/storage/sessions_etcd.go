@@ -0,0 +1,86 @@
+package storage
+
+import (
+	"github.com/coreos/go-etcd/etcd"
+	"github.com/juju/errgo"
+
+	"log"
+	"path"
+	"time"
+)
+
+// etcdKeyNotFound is the error code of etcd for missing keys.
+const etcdKeyNotFound = 100
+
+// NewEtcdSessionStorage stores the sessions below the same prefix as NewEtcdStorage. Etcd removes expired
+// sessions itself, sets are directories with one key per member:
+//  <prefix>/session/<sessionid> = JSON()
+//  <prefix>/session_token/<hash> = sessionid()
+//  <prefix>/user_sessions/<userid>/<sessionid> = ""
+func NewEtcdSessionStorage(peers []string, prefix string, syncCluster, logCURL bool, logger *log.Logger) *sessionStorage {
+	client := newEtcdClient(peers, syncCluster, logCURL, logger)
+	return newSessionStorage(&etcdSessionDriver{&EtcdStorageDriver{client, prefix, 0}})
+}
+
+type etcdSessionDriver struct {
+	*EtcdStorageDriver
+}
+
+func (d *etcdSessionDriver) Set(name, key, value string, ttl time.Duration) error {
+	_, err := d.client.Set(d.Path(name, key), value, seconds(ttl))
+	return errgo.Mask(err)
+}
+
+func (d *etcdSessionDriver) Lookup(name, key string) (string, bool, error) {
+	value, ok, err := d.lookupIndex(name, key)
+	if err != nil {
+		return "", false, errgo.Mask(err)
+	}
+	return value, ok, nil
+}
+
+func (d *etcdSessionDriver) Remove(name, key string) error {
+	_, err := d.client.Delete(d.Path(name, key), false)
+	if err != nil && !isEtcdKeyNotFound(err) {
+		return errgo.Mask(err)
+	}
+	return nil
+}
+
+func (d *etcdSessionDriver) AddMember(name, set, member string, ttl time.Duration) error {
+	return d.Set(name, set+"/"+member, "", ttl)
+}
+
+func (d *etcdSessionDriver) RemoveMember(name, set, member string) error {
+	return d.Remove(name, set+"/"+member)
+}
+
+func (d *etcdSessionDriver) Members(name, set string) ([]string, error) {
+	resp, err := d.client.Get(d.Path(name, set), false, false)
+	if err != nil {
+		if isEtcdKeyNotFound(err) {
+			return nil, nil
+		}
+		return nil, errgo.Mask(err)
+	}
+
+	members := make([]string, 0, len(resp.Node.Nodes))
+	for _, node := range resp.Node.Nodes {
+		members = append(members, path.Base(node.Key))
+	}
+	return members, nil
+}
+
+func isEtcdKeyNotFound(err error) bool {
+	etcdErr, ok := err.(*etcd.EtcdError)
+	return ok && etcdErr.ErrorCode == etcdKeyNotFound
+}
+
+// seconds rounds up, as etcd would remove a key with a TTL of 0 seconds immediately.
+func seconds(d time.Duration) uint64 {
+	s := uint64((d + time.Second - 1) / time.Second)
+	if s < 1 {
+		return 1
+	}
+	return s
+}
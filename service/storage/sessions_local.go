@@ -0,0 +1,127 @@
+package storage
+
+import (
+	"sync"
+	"time"
+)
+
+// localSweepInterval is how often expired values are removed from memory.
+const localSweepInterval = time.Minute
+
+func NewLocalSessionStorage() *sessionStorage {
+	return newSessionStorage(&localSessionDriver{
+		Lock:   &sync.Mutex{},
+		Values: make(map[string]localValue),
+		Sets:   make(map[string]map[string]time.Time),
+	})
+}
+
+type localValue struct {
+	Value   string
+	Expires time.Time
+}
+
+type localSessionDriver struct {
+	Lock *sync.Mutex
+
+	// Map{name:key => value}
+	Values map[string]localValue
+
+	// Map{name:set => Map{member => expires}}
+	Sets map[string]map[string]time.Time
+
+	lastSweep time.Time
+}
+
+func (d *localSessionDriver) Set(name, key, value string, ttl time.Duration) error {
+	d.Lock.Lock()
+	defer d.Lock.Unlock()
+
+	d.sweep()
+	d.Values[name+":"+key] = localValue{value, time.Now().Add(ttl)}
+	return nil
+}
+
+func (d *localSessionDriver) Lookup(name, key string) (string, bool, error) {
+	d.Lock.Lock()
+	defer d.Lock.Unlock()
+
+	value, ok := d.Values[name+":"+key]
+	if !ok || !time.Now().Before(value.Expires) {
+		return "", false, nil
+	}
+	return value.Value, true, nil
+}
+
+func (d *localSessionDriver) Remove(name, key string) error {
+	d.Lock.Lock()
+	defer d.Lock.Unlock()
+
+	delete(d.Values, name+":"+key)
+	return nil
+}
+
+func (d *localSessionDriver) AddMember(name, set, member string, ttl time.Duration) error {
+	d.Lock.Lock()
+	defer d.Lock.Unlock()
+
+	members, ok := d.Sets[name+":"+set]
+	if !ok {
+		members = make(map[string]time.Time)
+		d.Sets[name+":"+set] = members
+	}
+	members[member] = time.Now().Add(ttl)
+	return nil
+}
+
+func (d *localSessionDriver) RemoveMember(name, set, member string) error {
+	d.Lock.Lock()
+	defer d.Lock.Unlock()
+
+	if members, ok := d.Sets[name+":"+set]; ok {
+		delete(members, member)
+		if len(members) == 0 {
+			delete(d.Sets, name+":"+set)
+		}
+	}
+	return nil
+}
+
+func (d *localSessionDriver) Members(name, set string) ([]string, error) {
+	d.Lock.Lock()
+	defer d.Lock.Unlock()
+
+	now := time.Now()
+	var result []string
+	for member, expires := range d.Sets[name+":"+set] {
+		if now.Before(expires) {
+			result = append(result, member)
+		}
+	}
+	return result, nil
+}
+
+// sweep removes all expired values, at most once per localSweepInterval. The lock must be held.
+func (d *localSessionDriver) sweep() {
+	now := time.Now()
+	if now.Sub(d.lastSweep) < localSweepInterval {
+		return
+	}
+	d.lastSweep = now
+
+	for key, value := range d.Values {
+		if !now.Before(value.Expires) {
+			delete(d.Values, key)
+		}
+	}
+	for set, members := range d.Sets {
+		for member, expires := range members {
+			if !now.Before(expires) {
+				delete(members, member)
+			}
+		}
+		if len(members) == 0 {
+			delete(d.Sets, set)
+		}
+	}
+}
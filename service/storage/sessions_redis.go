@@ -0,0 +1,113 @@
+package storage
+
+import (
+	"github.com/garyburd/redigo/redis"
+	"github.com/juju/errgo"
+
+	"time"
+)
+
+// NewRedisSessionStorage stores the sessions with the same key layout as NewRedisStorage. Redis removes
+// expired sessions itself:
+//  <prefix>:session:<sessionid> = JSON()
+//  <prefix>:session_token:<hash> = sessionid()
+//  <prefix>:user_sessions:<userid> = SET(sessionid)
+func NewRedisSessionStorage(pool *redis.Pool, prefix string, layout RedisKeyLayout) *sessionStorage {
+	return newSessionStorage(&redisSessionDriver{pool, prefix, layout})
+}
+
+type redisSessionDriver struct {
+	Pool   *redis.Pool
+	Prefix string
+	Layout RedisKeyLayout
+}
+
+func (d *redisSessionDriver) key(name, key string) string {
+	return redisKey(d.Layout, d.Prefix, name, key)
+}
+
+func (d *redisSessionDriver) Set(name, key, value string, ttl time.Duration) error {
+	con := d.Pool.Get()
+	defer con.Close()
+
+	_, err := redis.String(con.Do("SET", d.key(name, key), value, "PX", milliseconds(ttl)))
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	return nil
+}
+
+func (d *redisSessionDriver) Lookup(name, key string) (string, bool, error) {
+	con := d.Pool.Get()
+	defer con.Close()
+
+	value, err := redis.String(con.Do("GET", d.key(name, key)))
+	if err != nil {
+		if err == redis.ErrNil {
+			return "", false, nil
+		}
+		return "", false, errgo.Mask(err)
+	}
+	return value, true, nil
+}
+
+func (d *redisSessionDriver) Remove(name, key string) error {
+	con := d.Pool.Get()
+	defer con.Close()
+
+	if _, err := redis.Int(con.Do("DEL", d.key(name, key))); err != nil {
+		return errgo.Mask(err)
+	}
+	return nil
+}
+
+func (d *redisSessionDriver) AddMember(name, set, member string, ttl time.Duration) error {
+	con := d.Pool.Get()
+	defer con.Close()
+
+	key := d.key(name, set)
+	if _, err := redis.Int(con.Do("SADD", key, member)); err != nil {
+		return errgo.Mask(err)
+	}
+
+	// Only extend the expiry, so the set lives as long as its longest living member
+	remaining, err := redis.Int64(con.Do("PTTL", key))
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	if remaining < milliseconds(ttl) {
+		if _, err := redis.Int(con.Do("PEXPIRE", key, milliseconds(ttl))); err != nil {
+			return errgo.Mask(err)
+		}
+	}
+	return nil
+}
+
+func (d *redisSessionDriver) RemoveMember(name, set, member string) error {
+	con := d.Pool.Get()
+	defer con.Close()
+
+	if _, err := redis.Int(con.Do("SREM", d.key(name, set), member)); err != nil {
+		return errgo.Mask(err)
+	}
+	return nil
+}
+
+func (d *redisSessionDriver) Members(name, set string) ([]string, error) {
+	con := d.Pool.Get()
+	defer con.Close()
+
+	members, err := redis.Strings(con.Do("SMEMBERS", d.key(name, set)))
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+	return members, nil
+}
+
+func milliseconds(d time.Duration) int64 {
+	ms := int64(d / time.Millisecond)
+	if ms < 1 {
+		return 1
+	}
+	return ms
+}
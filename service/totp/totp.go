@@ -0,0 +1,108 @@
+// Package totp implements time-based one-time passwords (RFC 6238) as used by authenticator apps,
+// with HMAC-SHA1, 6 digits and a period of 30 seconds.
+package totp
+
+import (
+	"github.com/juju/errgo"
+
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	Digits = 6
+	Period = 30 * time.Second
+
+	// Skew is the number of periods before and after the current one, in which a code is still accepted.
+	Skew = 1
+
+	secretLength       = 20
+	recoveryCodeLength = 10
+)
+
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// NewSecret returns a new random secret, base32 encoded.
+func NewSecret() (string, error) {
+	data := make([]byte, secretLength)
+	if _, err := rand.Read(data); err != nil {
+		return "", errgo.Mask(err)
+	}
+	return encoding.EncodeToString(data), nil
+}
+
+// ProvisioningURI returns the otpauth:// URI to be shown as a QR code to the user.
+func ProvisioningURI(issuer, account, secret string) string {
+	params := url.Values{}
+	params.Set("secret", secret)
+	params.Set("issuer", issuer)
+	params.Set("algorithm", "SHA1")
+	params.Set("digits", fmt.Sprintf("%d", Digits))
+	params.Set("period", fmt.Sprintf("%d", int(Period/time.Second)))
+
+	label := url.PathEscape(issuer + ":" + account)
+	return "otpauth://totp/" + label + "?" + params.Encode()
+}
+
+// Counter returns the time step for the given time.
+func Counter(t time.Time) int64 {
+	return t.Unix() / int64(Period/time.Second)
+}
+
+// Code returns the code for the given time step.
+func Code(secret string, counter int64) (string, error) {
+	key, err := encoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", errgo.Mask(err)
+	}
+
+	message := make([]byte, 8)
+	binary.BigEndian.PutUint64(message, uint64(counter))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(message)
+	sum := mac.Sum(nil)
+
+	// Dynamic truncation, see RFC 4226 section 5.3
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	modulo := uint32(1)
+	for i := 0; i < Digits; i++ {
+		modulo *= 10
+	}
+	return fmt.Sprintf("%0*d", Digits, value%modulo), nil
+}
+
+// Validate checks the code against the time steps around now. Returns the matching time step, which
+// should be remembered to reject the same code a second time.
+func Validate(secret, code string, now time.Time) (int64, bool) {
+	current := Counter(now)
+	for counter := current - Skew; counter <= current+Skew; counter++ {
+		expected, err := Code(secret, counter)
+		if err != nil {
+			return 0, false
+		}
+		if hmac.Equal([]byte(expected), []byte(code)) {
+			return counter, true
+		}
+	}
+	return 0, false
+}
+
+// NewRecoveryCode returns a random code like "abcde-fghij", to be used once if the authenticator is lost.
+func NewRecoveryCode() (string, error) {
+	data := make([]byte, recoveryCodeLength)
+	if _, err := rand.Read(data); err != nil {
+		return "", errgo.Mask(err)
+	}
+	code := strings.ToLower(encoding.EncodeToString(data))[:recoveryCodeLength]
+	return code[:recoveryCodeLength/2] + "-" + code[recoveryCodeLength/2:], nil
+}
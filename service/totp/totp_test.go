@@ -0,0 +1,56 @@
+package totp
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA-1 seed of the test vectors in RFC 6238 appendix B.
+var rfcSecret = encoding.EncodeToString([]byte("12345678901234567890"))
+
+// TestCodeRFC6238 uses the SHA-1 test vectors of RFC 6238 appendix B. The RFC lists 8 digit codes, the last 6 digits
+// are the codes with Digits = 6.
+func TestCodeRFC6238(t *testing.T) {
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+		{20000000000, "65353130"},
+	}
+
+	for _, test := range tests {
+		code, err := Code(rfcSecret, Counter(time.Unix(test.unix, 0)))
+		if err != nil {
+			t.Fatalf("Failed to create code: %v", err)
+		}
+		if expected := test.code[len(test.code)-Digits:]; code != expected {
+			t.Errorf("Code at %d = %s, expected %s", test.unix, code, expected)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	current := Counter(now)
+
+	for _, offset := range []int64{-Skew, 0, Skew} {
+		code, _ := Code(rfcSecret, current+offset)
+		if counter, ok := Validate(rfcSecret, code, now); !ok || counter != current+offset {
+			t.Errorf("Expected the code of step %d to be accepted, got %d, %v", offset, counter, ok)
+		}
+	}
+
+	code, _ := Code(rfcSecret, current+Skew+1)
+	if _, ok := Validate(rfcSecret, code, now); ok {
+		t.Errorf("Expected a code outside of the skew to be rejected")
+	}
+	if _, ok := Validate(strings.ToLower(rfcSecret), "14050471"[2:], now); !ok {
+		t.Errorf("Expected a lowercase secret to be accepted")
+	}
+}
@@ -4,6 +4,13 @@ import (
 	"time"
 )
 
+const (
+	StatusActive   = "active"
+	StatusLocked   = "locked"
+	StatusDisabled = "disabled"
+	StatusErased   = "erased"
+)
+
 type User struct {
 	ID string
 
@@ -12,9 +19,169 @@ type User struct {
 	LoginName         string
 	LoginPasswordHash string
 
-	Email         string
-	EmailVerified bool
+	// PasswordBreached is set by Authenticate if the password is known from a data breach.
+	PasswordBreached bool
+
+	// PasswordHistory contains the hashes of the previous passwords, newest first.
+	PasswordHistory []string
+
+	// TOTPSecret is set by EnrollTOTP, TOTPEnabled once the first code was confirmed.
+	// TOTPLastCounter is the time step of the last accepted code, so no code can be used twice.
+	TOTPSecret      string
+	TOTPEnabled     bool
+	TOTPLastCounter int64
+
+	// TOTPRecoveryCodes contains the hashes of the unused recovery codes.
+	TOTPRecoveryCodes []string
+
+	// EmailOTPEnabled sends a one-time code to the primary email for every challenge. EmailOTPHash is the hash
+	// of the code sent for the current AuthChallenge.
+	EmailOTPEnabled bool
+	EmailOTPHash    string
+
+	// AuthChallenge is issued by Authenticate if a second factor is required, see CompleteAuthentication.
+	// AuthChallengeAttempts counts the wrong codes of all challenges issued while the previous one was still valid.
+	AuthChallenge         string
+	AuthChallengeIssued   *time.Time
+	AuthChallengeAttempts int
+
+	// WebAuthnCredentials are the passkeys and security keys registered by the user.
+	WebAuthnCredentials []WebAuthnCredential
+
+	// WebAuthnRegistrationChallenge is issued by BeginWebAuthnRegistration, WebAuthnLoginChallenge by
+	// BeginWebAuthnLogin. They are kept apart, so a login can not replace a registration in progress.
+	WebAuthnRegistrationChallenge       string
+	WebAuthnRegistrationChallengeIssued *time.Time
+	WebAuthnLoginChallenge              string
+	WebAuthnLoginChallengeIssued        *time.Time
+
+	// TokenClaims are added to the access tokens of the user, see SetTokenClaims.
+	TokenClaims map[string]interface{}
+
+	// Groups are the names of the groups the user is a member of, see package group.
+	Groups []string
+
+	// Attributes are the custom profile attributes, validated against Config.AttributeSchema.
+	Attributes map[string]interface{}
+
+	// Email is the primary address of the user, SecondaryEmails are further addresses added by AddEmail.
+	// Every address is verified separately.
+	Email           string
+	EmailVerified   bool
+	SecondaryEmails []EmailAddress
+
+	// Phone is the E.164 normalized phone number, see package phone. PhoneCodeHash is the hash of the last code
+	// sent to it by SMS, the purpose tells whether it verifies the number or resets the password. PhoneCodeAttempts
+	// counts the wrong codes of all codes issued while the previous one was still valid.
+	Phone             string
+	PhoneVerified     bool
+	PhoneCodeHash     string
+	PhoneCodePurpose  string
+	PhoneCodeIssued   *time.Time
+	PhoneCodeAttempts int
 
 	ResetPasswordToken       string
 	ResetPasswordTokenIssued *time.Time
+
+	// LoginLinkToken is sent by email to authenticate without password, see NewLoginLinkToken.
+	LoginLinkToken       string
+	LoginLinkTokenIssued *time.Time
+
+	EmailVerificationToken       string
+	EmailVerificationTokenIssued *time.Time
+
+	// PendingEmail is the address the user wants to change to. It replaces Email once
+	// PendingEmailToken was confirmed, PendingEmailCancelToken aborts the change.
+	PendingEmail            string
+	PendingEmailToken       string
+	PendingEmailCancelToken string
+	PendingEmailIssued      *time.Time
+
+	// Status is one of StatusActive, StatusLocked or StatusDisabled. Users stored by older versions have
+	// no status and are considered active.
+	Status        string
+	StatusReason  string
+	StatusChanged *time.Time
+
+	// Erased is set once the personal data of the user was removed. Only the ID is kept, so it stays valid for the
+	// consumers of the events.
+	Erased *time.Time
+}
+
+// WebAuthnCredential is a public key credential, see package webauthn.
+type WebAuthnCredential struct {
+	// ID is the base64url encoded credential ID.
+	ID   string
+	Name string
+
+	// PublicKey is the COSE encoded public key.
+	PublicKey []byte
+
+	// SignCount is the last signature counter reported by the authenticator.
+	SignCount uint32
+
+	AAGUID          []byte
+	AttestationType string
+
+	Created  time.Time
+	LastUsed *time.Time
+}
+
+// EmailAddress is a secondary email address of the user.
+type EmailAddress struct {
+	Email    string
+	Verified bool
+
+	VerificationToken       string
+	VerificationTokenIssued *time.Time
+}
+
+// AccountStatus returns the status of the user, defaulting to StatusActive. Erased users always have StatusErased.
+func (u *User) AccountStatus() string {
+	if u.Erased != nil {
+		return StatusErased
+	}
+	if u.Status == "" {
+		return StatusActive
+	}
+	return u.Status
+}
+
+func (u *User) IsActive() bool {
+	return u.AccountStatus() == StatusActive
+}
+
+// FindWebAuthnCredential returns the credential with the given ID or nil.
+func (u *User) FindWebAuthnCredential(credentialID string) *WebAuthnCredential {
+	for i := range u.WebAuthnCredentials {
+		if u.WebAuthnCredentials[i].ID == credentialID {
+			return &u.WebAuthnCredentials[i]
+		}
+	}
+	return nil
+}
+
+// FindSecondaryEmail returns the secondary address or nil.
+func (u *User) FindSecondaryEmail(email string) *EmailAddress {
+	for i := range u.SecondaryEmails {
+		if u.SecondaryEmails[i].Email == email {
+			return &u.SecondaryEmails[i]
+		}
+	}
+	return nil
+}
+
+// HasEmail returns true, if the address is the primary or a secondary address of the user.
+func (u *User) HasEmail(email string) bool {
+	return u.Email == email || u.FindSecondaryEmail(email) != nil
+}
+
+// FindSecondaryEmailByToken returns the secondary address, which can be verified with the token, or nil.
+func (u *User) FindSecondaryEmailByToken(token string) *EmailAddress {
+	for i := range u.SecondaryEmails {
+		if u.SecondaryEmails[i].VerificationToken == token {
+			return &u.SecondaryEmails[i]
+		}
+	}
+	return nil
 }
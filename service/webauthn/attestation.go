@@ -0,0 +1,113 @@
+package webauthn
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"encoding/asn1"
+)
+
+// Attestation types returned in Credential.AttestationType
+const (
+	AttestationNone  = "none"
+	AttestationSelf  = "self"
+	AttestationBasic = "basic"
+)
+
+// oidAAGUID is the certificate extension which contains the AAGUID of the authenticator model.
+var oidAAGUID = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 45724, 1, 1, 4}
+
+// verifyAttestation checks the attestation statement and returns the attestation type.
+func verifyAttestation(format string, statement map[interface{}]interface{}, authData *authenticatorData, rawAuthData, clientDataHash []byte, credentialKey crypto.PublicKey, credentialAlg int64) (string, error) {
+	switch format {
+	case "none":
+		if len(statement) != 0 {
+			return "", InvalidAttestation
+		}
+		return AttestationNone, nil
+	case "packed":
+		return verifyPackedAttestation(statement, authData, rawAuthData, clientDataHash, credentialKey, credentialAlg)
+	}
+	return "", UnsupportedAttestation
+}
+
+// verifyPackedAttestation implements https://www.w3.org/TR/webauthn-2/#sctn-packed-attestation
+func verifyPackedAttestation(statement map[interface{}]interface{}, authData *authenticatorData, rawAuthData, clientDataHash []byte, credentialKey crypto.PublicKey, credentialAlg int64) (string, error) {
+	alg, ok := statement["alg"].(int64)
+	if !ok {
+		return "", InvalidAttestation
+	}
+	sig, ok := statement["sig"].([]byte)
+	if !ok {
+		return "", InvalidAttestation
+	}
+	if _, ecdaa := statement["ecdaaKeyId"]; ecdaa {
+		return "", UnsupportedAttestation
+	}
+
+	signed := append(append([]byte{}, rawAuthData...), clientDataHash...)
+
+	x5c, hasCertificates := statement["x5c"].([]interface{})
+	if !hasCertificates {
+		// Self attestation: signed with the credential key itself
+		if alg != credentialAlg {
+			return "", InvalidAttestation
+		}
+		if err := verifySignature(credentialKey, alg, signed, sig); err != nil {
+			return "", InvalidAttestation
+		}
+		return AttestationSelf, nil
+	}
+
+	if len(x5c) == 0 {
+		return "", InvalidAttestation
+	}
+	der, ok := x5c[0].([]byte)
+	if !ok {
+		return "", InvalidAttestation
+	}
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		return "", InvalidAttestation
+	}
+	if err := checkAttestationCertificate(certificate, authData.AAGUID); err != nil {
+		return "", err
+	}
+
+	if err := verifySignature(certificate.PublicKey, alg, signed, sig); err != nil {
+		return "", InvalidAttestation
+	}
+	return AttestationBasic, nil
+}
+
+// checkAttestationCertificate checks the requirements for packed attestation certificates.
+func checkAttestationCertificate(certificate *x509.Certificate, aaguid []byte) error {
+	if certificate.Version != 3 || certificate.IsCA {
+		return InvalidAttestation
+	}
+
+	subject := certificate.Subject
+	if len(subject.Country) == 0 || len(subject.Organization) == 0 || subject.CommonName == "" {
+		return InvalidAttestation
+	}
+	if len(subject.OrganizationalUnit) != 1 || subject.OrganizationalUnit[0] != "Authenticator Attestation" {
+		return InvalidAttestation
+	}
+
+	for _, extension := range certificate.Extensions {
+		if !extension.Id.Equal(oidAAGUID) {
+			continue
+		}
+		if extension.Critical {
+			return InvalidAttestation
+		}
+		var value []byte
+		if _, err := asn1.Unmarshal(extension.Value, &value); err != nil {
+			return InvalidAttestation
+		}
+		if !bytes.Equal(value, aaguid) {
+			return InvalidAttestation
+		}
+	}
+	return nil
+}
@@ -0,0 +1,244 @@
+package webauthn
+
+import (
+	"github.com/juju/errgo"
+
+	"bytes"
+	"encoding/binary"
+	"math"
+	"sort"
+)
+
+// This file contains a minimal CBOR (RFC 7049) implementation, just enough for the attestation objects,
+// authenticator data and COSE keys used by WebAuthn. Indefinite lengths, tags and floats are not supported.
+//
+// Decoded values are int64, []byte, string, bool, nil, []interface{} or map[interface{}]interface{}.
+
+const (
+	cborUnsigned = 0
+	cborNegative = 1
+	cborBytes    = 2
+	cborText     = 3
+	cborArray    = 4
+	cborMap      = 5
+	cborSimple   = 7
+
+	// maxCBORDepth protects against deeply nested input.
+	maxCBORDepth = 16
+)
+
+var InvalidCBOR = errgo.New("Invalid or unsupported CBOR data.")
+
+// decodeCBOR decodes the first value in data and returns it with the number of bytes read.
+func decodeCBOR(data []byte) (interface{}, int, error) {
+	return decodeCBORItem(data, 0)
+}
+
+func decodeCBORItem(data []byte, depth int) (interface{}, int, error) {
+	if depth > maxCBORDepth || len(data) == 0 {
+		return nil, 0, InvalidCBOR
+	}
+
+	major := data[0] >> 5
+	info := data[0] & 0x1f
+
+	if major == cborSimple {
+		switch info {
+		case 20:
+			return false, 1, nil
+		case 21:
+			return true, 1, nil
+		case 22, 23:
+			return nil, 1, nil
+		}
+		return nil, 0, InvalidCBOR
+	}
+
+	argument, offset, err := decodeCBORArgument(data)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	switch major {
+	case cborUnsigned:
+		if argument > math.MaxInt64 {
+			return nil, 0, InvalidCBOR
+		}
+		return int64(argument), offset, nil
+	case cborNegative:
+		if argument > math.MaxInt64 {
+			return nil, 0, InvalidCBOR
+		}
+		return -1 - int64(argument), offset, nil
+	case cborBytes, cborText:
+		if argument > uint64(len(data)-offset) {
+			return nil, 0, InvalidCBOR
+		}
+		end := offset + int(argument)
+		if major == cborText {
+			return string(data[offset:end]), end, nil
+		}
+		value := make([]byte, argument)
+		copy(value, data[offset:end])
+		return value, end, nil
+	case cborArray:
+		if argument > uint64(len(data)) {
+			return nil, 0, InvalidCBOR
+		}
+		items := make([]interface{}, 0, argument)
+		for i := uint64(0); i < argument; i++ {
+			item, n, err := decodeCBORItem(data[offset:], depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			items = append(items, item)
+			offset += n
+		}
+		return items, offset, nil
+	case cborMap:
+		if argument > uint64(len(data)) {
+			return nil, 0, InvalidCBOR
+		}
+		items := make(map[interface{}]interface{}, argument)
+		for i := uint64(0); i < argument; i++ {
+			key, n, err := decodeCBORItem(data[offset:], depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			offset += n
+
+			switch key.(type) {
+			case int64, string:
+			default:
+				return nil, 0, InvalidCBOR
+			}
+
+			value, n, err := decodeCBORItem(data[offset:], depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			offset += n
+			items[key] = value
+		}
+		return items, offset, nil
+	}
+	return nil, 0, InvalidCBOR
+}
+
+func decodeCBORArgument(data []byte) (uint64, int, error) {
+	info := data[0] & 0x1f
+	switch {
+	case info < 24:
+		return uint64(info), 1, nil
+	case info == 24 && len(data) >= 2:
+		return uint64(data[1]), 2, nil
+	case info == 25 && len(data) >= 3:
+		return uint64(binary.BigEndian.Uint16(data[1:])), 3, nil
+	case info == 26 && len(data) >= 5:
+		return uint64(binary.BigEndian.Uint32(data[1:])), 5, nil
+	case info == 27 && len(data) >= 9:
+		return binary.BigEndian.Uint64(data[1:]), 9, nil
+	}
+	return 0, 0, InvalidCBOR
+}
+
+// -------------------------------------------------
+
+// cborPair is an entry of a map to encode. Keys must be int or string.
+type cborPair struct {
+	Key   interface{}
+	Value interface{}
+}
+
+// encodeCBOR encodes int, int64, uint32, bool, []byte, string, []interface{}, map[interface{}]interface{}
+// and []cborPair. Map keys are written in the canonical order.
+func encodeCBOR(value interface{}) []byte {
+	var buf bytes.Buffer
+	writeCBOR(&buf, value)
+	return buf.Bytes()
+}
+
+func writeCBOR(buf *bytes.Buffer, value interface{}) {
+	switch v := value.(type) {
+	case int:
+		writeCBORInt(buf, int64(v))
+	case int64:
+		writeCBORInt(buf, v)
+	case uint32:
+		writeCBORHead(buf, cborUnsigned, uint64(v))
+	case bool:
+		if v {
+			buf.WriteByte(cborSimple<<5 | 21)
+		} else {
+			buf.WriteByte(cborSimple<<5 | 20)
+		}
+	case []byte:
+		writeCBORHead(buf, cborBytes, uint64(len(v)))
+		buf.Write(v)
+	case string:
+		writeCBORHead(buf, cborText, uint64(len(v)))
+		buf.WriteString(v)
+	case []interface{}:
+		writeCBORHead(buf, cborArray, uint64(len(v)))
+		for _, item := range v {
+			writeCBOR(buf, item)
+		}
+	case map[interface{}]interface{}:
+		pairs := make([]cborPair, 0, len(v))
+		for key, item := range v {
+			pairs = append(pairs, cborPair{key, item})
+		}
+		writeCBOR(buf, pairs)
+	case []cborPair:
+		encoded := make([][2][]byte, 0, len(v))
+		for _, pair := range v {
+			encoded = append(encoded, [2][]byte{encodeCBOR(pair.Key), encodeCBOR(pair.Value)})
+		}
+		// Canonical CBOR: shorter keys first, then bytewise
+		sort.Slice(encoded, func(i, j int) bool {
+			a, b := encoded[i][0], encoded[j][0]
+			if len(a) != len(b) {
+				return len(a) < len(b)
+			}
+			return bytes.Compare(a, b) < 0
+		})
+
+		writeCBORHead(buf, cborMap, uint64(len(v)))
+		for _, pair := range encoded {
+			buf.Write(pair[0])
+			buf.Write(pair[1])
+		}
+	default:
+		panic("Unsupported type for CBOR encoding.")
+	}
+}
+
+func writeCBORInt(buf *bytes.Buffer, v int64) {
+	if v < 0 {
+		writeCBORHead(buf, cborNegative, uint64(-1-v))
+	} else {
+		writeCBORHead(buf, cborUnsigned, uint64(v))
+	}
+}
+
+func writeCBORHead(buf *bytes.Buffer, major byte, argument uint64) {
+	head := make([]byte, 9)
+	switch {
+	case argument < 24:
+		buf.WriteByte(major<<5 | byte(argument))
+	case argument <= math.MaxUint8:
+		buf.Write([]byte{major<<5 | 24, byte(argument)})
+	case argument <= math.MaxUint16:
+		head[0] = major<<5 | 25
+		binary.BigEndian.PutUint16(head[1:], uint16(argument))
+		buf.Write(head[:3])
+	case argument <= math.MaxUint32:
+		head[0] = major<<5 | 26
+		binary.BigEndian.PutUint32(head[1:], uint32(argument))
+		buf.Write(head[:5])
+	default:
+		head[0] = major<<5 | 27
+		binary.BigEndian.PutUint64(head[1:], argument)
+		buf.Write(head)
+	}
+}
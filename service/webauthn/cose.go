@@ -0,0 +1,145 @@
+package webauthn
+
+import (
+	"github.com/juju/errgo"
+
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"math/big"
+)
+
+// COSE algorithm identifiers (RFC 8152) supported for credentials and packed attestation.
+const (
+	AlgES256 = -7
+	AlgEdDSA = -8
+	AlgRS256 = -257
+)
+
+// COSE key parameters
+const (
+	coseKeyType   = 1
+	coseAlgorithm = 3
+	coseCurve     = -1
+	coseX         = -2
+	coseY         = -3
+	coseRSAN      = -1
+	coseRSAE      = -2
+
+	coseKeyTypeOKP = 1
+	coseKeyTypeEC2 = 2
+	coseKeyTypeRSA = 3
+
+	coseCurveP256    = 1
+	coseCurveEd25519 = 6
+)
+
+var (
+	UnsupportedAlgorithm = errgo.New("Unsupported public key algorithm.")
+	InvalidPublicKey     = errgo.New("Invalid credential public key.")
+	InvalidSignature     = errgo.New("Invalid signature.")
+)
+
+// parsePublicKey decodes a COSE_Key and returns the public key and its algorithm.
+func parsePublicKey(coseKey []byte) (crypto.PublicKey, int64, error) {
+	value, n, err := decodeCBOR(coseKey)
+	if err != nil {
+		return nil, 0, InvalidPublicKey
+	}
+	if n != len(coseKey) {
+		return nil, 0, InvalidPublicKey
+	}
+	return publicKeyFromCOSE(value)
+}
+
+func publicKeyFromCOSE(value interface{}) (crypto.PublicKey, int64, error) {
+	key, ok := value.(map[interface{}]interface{})
+	if !ok {
+		return nil, 0, InvalidPublicKey
+	}
+
+	kty, _ := key[int64(coseKeyType)].(int64)
+	alg, _ := key[int64(coseAlgorithm)].(int64)
+
+	switch {
+	case kty == coseKeyTypeEC2 && alg == AlgES256:
+		crv, _ := key[int64(coseCurve)].(int64)
+		x, _ := key[int64(coseX)].([]byte)
+		y, _ := key[int64(coseY)].([]byte)
+		if crv != coseCurveP256 || len(x) != 32 || len(y) != 32 {
+			return nil, 0, InvalidPublicKey
+		}
+
+		pub := &ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}
+		if !pub.Curve.IsOnCurve(pub.X, pub.Y) {
+			return nil, 0, InvalidPublicKey
+		}
+		return pub, alg, nil
+
+	case kty == coseKeyTypeOKP && alg == AlgEdDSA:
+		crv, _ := key[int64(coseCurve)].(int64)
+		x, _ := key[int64(coseX)].([]byte)
+		if crv != coseCurveEd25519 || len(x) != ed25519.PublicKeySize {
+			return nil, 0, InvalidPublicKey
+		}
+		return ed25519.PublicKey(x), alg, nil
+
+	case kty == coseKeyTypeRSA && alg == AlgRS256:
+		n, _ := key[int64(coseRSAN)].([]byte)
+		e, _ := key[int64(coseRSAE)].([]byte)
+		if len(n) < 256 || len(e) == 0 || len(e) > 4 {
+			return nil, 0, InvalidPublicKey
+		}
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}, alg, nil
+	}
+
+	return nil, 0, UnsupportedAlgorithm
+}
+
+// verifySignature checks a signature over data made by the key with the given COSE algorithm.
+func verifySignature(pub crypto.PublicKey, alg int64, data, signature []byte) error {
+	switch alg {
+	case AlgES256:
+		key, ok := pub.(*ecdsa.PublicKey)
+		if !ok {
+			return UnsupportedAlgorithm
+		}
+		digest := sha256.Sum256(data)
+		if !ecdsa.VerifyASN1(key, digest[:], signature) {
+			return InvalidSignature
+		}
+		return nil
+
+	case AlgEdDSA:
+		key, ok := pub.(ed25519.PublicKey)
+		if !ok {
+			return UnsupportedAlgorithm
+		}
+		if !ed25519.Verify(key, data, signature) {
+			return InvalidSignature
+		}
+		return nil
+
+	case AlgRS256:
+		key, ok := pub.(*rsa.PublicKey)
+		if !ok {
+			return UnsupportedAlgorithm
+		}
+		digest := sha256.Sum256(data)
+		if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+			return InvalidSignature
+		}
+		return nil
+	}
+	return UnsupportedAlgorithm
+}
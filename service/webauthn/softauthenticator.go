@@ -0,0 +1,286 @@
+package webauthn
+
+import (
+	"github.com/juju/errgo"
+
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/binary"
+	"encoding/json"
+	"math/big"
+	"time"
+)
+
+// Attestation modes of the SoftAuthenticator
+const (
+	SoftAttestationNone      = "none"
+	SoftAttestationPacked    = "packed"
+	SoftAttestationPackedX5C = "packed-x5c"
+)
+
+var NoCredential = errgo.New("The authenticator has no matching credential.")
+
+// SoftAuthenticator is an authenticator implemented in software, which creates ES256 credentials.
+// It is meant for tests of the ceremonies without browser and hardware.
+type SoftAuthenticator struct {
+	RPID   string
+	Origin string
+	AAGUID []byte
+
+	// Attestation is one of SoftAttestationNone, SoftAttestationPacked (self attestation) or
+	// SoftAttestationPackedX5C (basic attestation with a generated certificate).
+	Attestation string
+
+	// UserVerified sets the user verified flag in all responses.
+	UserVerified bool
+
+	credentials map[string]*softCredential
+}
+
+type softCredential struct {
+	Key        *ecdsa.PrivateKey
+	UserHandle string
+	SignCount  uint32
+}
+
+// RegistrationResponse contains the base64url encoded result of a registration.
+type RegistrationResponse struct {
+	CredentialID      string
+	ClientDataJSON    string
+	AttestationObject string
+}
+
+// AssertionResponse contains the base64url encoded result of an authentication.
+type AssertionResponse struct {
+	CredentialID      string
+	ClientDataJSON    string
+	AuthenticatorData string
+	Signature         string
+	UserHandle        string
+}
+
+func NewSoftAuthenticator(rpID, origin string) *SoftAuthenticator {
+	return &SoftAuthenticator{
+		RPID:         rpID,
+		Origin:       origin,
+		AAGUID:       make([]byte, 16),
+		Attestation:  SoftAttestationNone,
+		UserVerified: true,
+		credentials:  make(map[string]*softCredential),
+	}
+}
+
+// Clone returns a copy of the authenticator with the same keys and signature counters.
+func (a *SoftAuthenticator) Clone() *SoftAuthenticator {
+	clone := *a
+	clone.credentials = make(map[string]*softCredential, len(a.credentials))
+	for id, credential := range a.credentials {
+		copied := *credential
+		clone.credentials[id] = &copied
+	}
+	return &clone
+}
+
+// Register creates a new credential like navigator.credentials.create().
+func (a *SoftAuthenticator) Register(options CreationOptions) (*RegistrationResponse, error) {
+	if options.RelyingParty.ID != a.RPID {
+		return nil, RPIDMismatch
+	}
+	for _, excluded := range options.ExcludeCredentials {
+		if _, ok := a.credentials[excluded.ID]; ok {
+			return nil, errgo.New("The authenticator already contains a credential for the user.")
+		}
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+	credentialID := make([]byte, 32)
+	if _, err := rand.Read(credentialID); err != nil {
+		return nil, errgo.Mask(err)
+	}
+
+	coseKey := encodeCBOR([]cborPair{
+		{coseKeyType, coseKeyTypeEC2},
+		{coseAlgorithm, AlgES256},
+		{coseCurve, coseCurveP256},
+		{coseX, padded(key.X.Bytes(), 32)},
+		{coseY, padded(key.Y.Bytes(), 32)},
+	})
+
+	attested := make([]byte, 0, 18+len(credentialID)+len(coseKey))
+	attested = append(attested, a.AAGUID...)
+	attested = append(attested, byte(len(credentialID)>>8), byte(len(credentialID)))
+	attested = append(attested, credentialID...)
+	attested = append(attested, coseKey...)
+
+	authData := append(a.authenticatorData(FlagAttestedCredentialData, 0), attested...)
+	clientDataJSON := a.clientData(clientDataTypeCreate, options.Challenge)
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	signed := append(append([]byte{}, authData...), clientDataHash[:]...)
+
+	statement := map[interface{}]interface{}{}
+	switch a.Attestation {
+	case SoftAttestationNone:
+	case SoftAttestationPacked:
+		sig, err := signES256(key, signed)
+		if err != nil {
+			return nil, errgo.Mask(err)
+		}
+		statement["alg"] = AlgES256
+		statement["sig"] = sig
+	case SoftAttestationPackedX5C:
+		attestationKey, certificate, err := a.attestationCertificate()
+		if err != nil {
+			return nil, errgo.Mask(err)
+		}
+		sig, err := signES256(attestationKey, signed)
+		if err != nil {
+			return nil, errgo.Mask(err)
+		}
+		statement["alg"] = AlgES256
+		statement["sig"] = sig
+		statement["x5c"] = []interface{}{certificate}
+	default:
+		return nil, UnsupportedAttestation
+	}
+
+	format := a.Attestation
+	if format == SoftAttestationPackedX5C {
+		format = SoftAttestationPacked
+	}
+	attestationObject := encodeCBOR([]cborPair{
+		{"fmt", format},
+		{"attStmt", statement},
+		{"authData", authData},
+	})
+
+	a.credentials[Encode(credentialID)] = &softCredential{
+		Key:        key,
+		UserHandle: options.User.ID,
+	}
+
+	return &RegistrationResponse{
+		CredentialID:      Encode(credentialID),
+		ClientDataJSON:    Encode(clientDataJSON),
+		AttestationObject: Encode(attestationObject),
+	}, nil
+}
+
+// Authenticate signs the challenge with the first allowed credential like navigator.credentials.get().
+// If no credentials are allowed, any credential of the relying party is used.
+func (a *SoftAuthenticator) Authenticate(options RequestOptions) (*AssertionResponse, error) {
+	if options.RelyingPartyID != a.RPID {
+		return nil, RPIDMismatch
+	}
+
+	credentialID := ""
+	for _, allowed := range options.AllowCredentials {
+		if _, ok := a.credentials[allowed.ID]; ok {
+			credentialID = allowed.ID
+			break
+		}
+	}
+	if len(options.AllowCredentials) == 0 {
+		for id := range a.credentials {
+			credentialID = id
+			break
+		}
+	}
+	if credentialID == "" {
+		return nil, NoCredential
+	}
+
+	credential := a.credentials[credentialID]
+	credential.SignCount++
+
+	authData := a.authenticatorData(0, credential.SignCount)
+	clientDataJSON := a.clientData(clientDataTypeGet, options.Challenge)
+	clientDataHash := sha256.Sum256(clientDataJSON)
+
+	sig, err := signES256(credential.Key, append(append([]byte{}, authData...), clientDataHash[:]...))
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+
+	return &AssertionResponse{
+		CredentialID:      credentialID,
+		ClientDataJSON:    Encode(clientDataJSON),
+		AuthenticatorData: Encode(authData),
+		Signature:         Encode(sig),
+		UserHandle:        credential.UserHandle,
+	}, nil
+}
+
+func (a *SoftAuthenticator) authenticatorData(flags byte, signCount uint32) []byte {
+	flags |= FlagUserPresent
+	if a.UserVerified {
+		flags |= FlagUserVerified
+	}
+
+	rpIDHash := sha256.Sum256([]byte(a.RPID))
+	data := make([]byte, 37)
+	copy(data, rpIDHash[:])
+	data[32] = flags
+	binary.BigEndian.PutUint32(data[33:], signCount)
+	return data
+}
+
+func (a *SoftAuthenticator) clientData(clientDataType, challenge string) []byte {
+	data, _ := json.Marshal(clientData{
+		Type:      clientDataType,
+		Challenge: challenge,
+		Origin:    a.Origin,
+	})
+	return data
+}
+
+// attestationCertificate generates a key and a self-signed certificate with the attributes required for packed attestation.
+func (a *SoftAuthenticator) attestationCertificate() (*ecdsa.PrivateKey, []byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, errgo.Mask(err)
+	}
+	aaguid, err := asn1.Marshal(a.AAGUID)
+	if err != nil {
+		return nil, nil, errgo.Mask(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject: pkix.Name{
+			Country:            []string{"DE"},
+			Organization:       []string{"userd"},
+			OrganizationalUnit: []string{"Authenticator Attestation"},
+			CommonName:         "userd soft authenticator",
+		},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		BasicConstraintsValid: true,
+		ExtraExtensions: []pkix.Extension{
+			{Id: oidAAGUID, Value: aaguid},
+		},
+	}
+	certificate, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, errgo.Mask(err)
+	}
+	return key, certificate, nil
+}
+
+func signES256(key *ecdsa.PrivateKey, data []byte) ([]byte, error) {
+	digest := sha256.Sum256(data)
+	return ecdsa.SignASN1(rand.Reader, key, digest[:])
+}
+
+func padded(data []byte, length int) []byte {
+	result := make([]byte, length)
+	copy(result[length-len(data):], data)
+	return result
+}
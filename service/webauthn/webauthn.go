@@ -0,0 +1,417 @@
+// Package webauthn implements the relying party side of the WebAuthn registration and authentication
+// ceremonies (https://www.w3.org/TR/webauthn-2/) for passkeys and security keys.
+//
+// Supported are credentials with ES256, EdDSA and RS256 keys and the attestation formats "none" and "packed".
+// Packed attestation certificates are checked, but not chained to a trust anchor, as there is no metadata service.
+//
+// Binary values are exchanged as base64url strings without padding, like in the JSON serialization of
+// the WebAuthn Level 3 spec (PublicKeyCredential.toJSON()).
+package webauthn
+
+import (
+	"github.com/juju/errgo"
+
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// Authenticator data flags
+const (
+	FlagUserPresent            = 0x01
+	FlagUserVerified           = 0x04
+	FlagBackupEligible         = 0x08
+	FlagBackedUp               = 0x10
+	FlagAttestedCredentialData = 0x40
+	FlagExtensionData          = 0x80
+)
+
+const (
+	challengeLength = 32
+
+	// maxCredentialIDLength is the limit defined by the spec.
+	maxCredentialIDLength = 1023
+
+	clientDataTypeCreate = "webauthn.create"
+	clientDataTypeGet    = "webauthn.get"
+)
+
+var (
+	InvalidClientData        = errgo.New("Invalid client data.")
+	ChallengeMismatch        = errgo.New("The challenge does not match.")
+	OriginNotAllowed         = errgo.New("The origin is not allowed.")
+	RPIDMismatch             = errgo.New("The relying party ID does not match.")
+	UserNotPresent           = errgo.New("The user was not present.")
+	UserNotVerified          = errgo.New("The user was not verified.")
+	InvalidAuthenticatorData = errgo.New("Invalid authenticator data.")
+	InvalidAttestation       = errgo.New("Invalid attestation.")
+	UnsupportedAttestation   = errgo.New("Unsupported attestation format.")
+
+	// SignCountMismatch means the signature counter did not increase, which indicates a cloned authenticator.
+	SignCountMismatch = errgo.New("The signature counter did not increase.")
+)
+
+var encoding = base64.RawURLEncoding
+
+// Encode returns the base64url encoding of data without padding.
+func Encode(data []byte) string {
+	return encoding.EncodeToString(data)
+}
+
+// Decode decodes base64url with or without padding.
+func Decode(s string) ([]byte, error) {
+	return encoding.DecodeString(strings.TrimRight(s, "="))
+}
+
+// NewChallenge returns a new random challenge, base64url encoded.
+func NewChallenge() (string, error) {
+	data := make([]byte, challengeLength)
+	if _, err := rand.Read(data); err != nil {
+		return "", errgo.Mask(err)
+	}
+	return Encode(data), nil
+}
+
+// -------------------------------------------------
+
+// RelyingParty holds the settings of the server side of the ceremonies.
+type RelyingParty struct {
+	// ID is the domain the credentials are scoped to, e.g. "example.com".
+	ID   string
+	Name string
+
+	// Origins are the allowed origins of the web pages, e.g. "https://login.example.com".
+	Origins []string
+
+	// RequireUserVerification rejects authenticators which did not verify the user, e.g. with a PIN or biometrics.
+	RequireUserVerification bool
+
+	// Timeout is a hint for the browser how long the user has to complete a ceremony.
+	Timeout time.Duration
+}
+
+// Credential is a public key credential created by VerifyRegistration.
+type Credential struct {
+	ID        []byte
+	PublicKey []byte // COSE_Key
+	Algorithm int64
+	SignCount uint32
+	AAGUID    []byte
+
+	// AttestationFormat is "none" or "packed", AttestationType is "none", "self" or "basic".
+	AttestationFormat string
+	AttestationType   string
+
+	UserVerified   bool
+	BackupEligible bool
+}
+
+// UserEntity describes the user in the creation options.
+type UserEntity struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+}
+
+type RelyingPartyEntity struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type CredentialParameter struct {
+	Type      string `json:"type"`
+	Algorithm int64  `json:"alg"`
+}
+
+type CredentialDescriptor struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+}
+
+type AuthenticatorSelection struct {
+	ResidentKey      string `json:"residentKey"`
+	UserVerification string `json:"userVerification"`
+}
+
+// CreationOptions is passed as publicKey to navigator.credentials.create().
+type CreationOptions struct {
+	Challenge              string                 `json:"challenge"`
+	RelyingParty           RelyingPartyEntity     `json:"rp"`
+	User                   UserEntity             `json:"user"`
+	Parameters             []CredentialParameter  `json:"pubKeyCredParams"`
+	Timeout                int64                  `json:"timeout,omitempty"`
+	ExcludeCredentials     []CredentialDescriptor `json:"excludeCredentials"`
+	AuthenticatorSelection AuthenticatorSelection `json:"authenticatorSelection"`
+	Attestation            string                 `json:"attestation"`
+}
+
+// RequestOptions is passed as publicKey to navigator.credentials.get().
+type RequestOptions struct {
+	Challenge        string                 `json:"challenge"`
+	RelyingPartyID   string                 `json:"rpId"`
+	Timeout          int64                  `json:"timeout,omitempty"`
+	AllowCredentials []CredentialDescriptor `json:"allowCredentials"`
+	UserVerification string                 `json:"userVerification"`
+}
+
+// CreationOptions returns the options for registering a new credential. The user ID must not contain personal data,
+// excludeCredentials are the base64url IDs of the credentials the user already has.
+func (rp *RelyingParty) CreationOptions(challenge string, user UserEntity, excludeCredentials []string) CreationOptions {
+	return CreationOptions{
+		Challenge:    challenge,
+		RelyingParty: RelyingPartyEntity{ID: rp.ID, Name: rp.Name},
+		User:         user,
+		Parameters: []CredentialParameter{
+			{"public-key", AlgES256},
+			{"public-key", AlgEdDSA},
+			{"public-key", AlgRS256},
+		},
+		Timeout:            int64(rp.Timeout / time.Millisecond),
+		ExcludeCredentials: descriptors(excludeCredentials),
+		AuthenticatorSelection: AuthenticatorSelection{
+			ResidentKey:      "preferred",
+			UserVerification: rp.userVerification(),
+		},
+		// Browsers replace unsupported attestation formats by "none" this way
+		Attestation: "none",
+	}
+}
+
+// RequestOptions returns the options for authenticating with one of the given credentials.
+func (rp *RelyingParty) RequestOptions(challenge string, allowCredentials []string) RequestOptions {
+	return RequestOptions{
+		Challenge:        challenge,
+		RelyingPartyID:   rp.ID,
+		Timeout:          int64(rp.Timeout / time.Millisecond),
+		AllowCredentials: descriptors(allowCredentials),
+		UserVerification: rp.userVerification(),
+	}
+}
+
+func (rp *RelyingParty) userVerification() string {
+	if rp.RequireUserVerification {
+		return "required"
+	}
+	return "preferred"
+}
+
+func descriptors(credentialIDs []string) []CredentialDescriptor {
+	result := make([]CredentialDescriptor, 0, len(credentialIDs))
+	for _, id := range credentialIDs {
+		result = append(result, CredentialDescriptor{"public-key", id})
+	}
+	return result
+}
+
+// -------------------------------------------------
+
+// VerifyRegistration checks the response of navigator.credentials.create() for the given challenge and returns the new credential.
+func (rp *RelyingParty) VerifyRegistration(challenge string, clientDataJSON, attestationObject []byte) (*Credential, error) {
+	if err := rp.verifyClientData(clientDataJSON, clientDataTypeCreate, challenge); err != nil {
+		return nil, err
+	}
+
+	value, n, err := decodeCBOR(attestationObject)
+	if err != nil || n != len(attestationObject) {
+		return nil, InvalidAttestation
+	}
+	object, ok := value.(map[interface{}]interface{})
+	if !ok {
+		return nil, InvalidAttestation
+	}
+	format, _ := object["fmt"].(string)
+	statement, _ := object["attStmt"].(map[interface{}]interface{})
+	rawAuthData, _ := object["authData"].([]byte)
+	if format == "" || statement == nil {
+		return nil, InvalidAttestation
+	}
+
+	authData, err := parseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return nil, err
+	}
+	if err := rp.verifyAuthenticatorData(authData); err != nil {
+		return nil, err
+	}
+	if authData.Flags&FlagAttestedCredentialData == 0 {
+		return nil, InvalidAuthenticatorData
+	}
+
+	pub, alg, err := parsePublicKey(authData.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	attestationType, err := verifyAttestation(format, statement, authData, rawAuthData, clientDataHash[:], pub, alg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Credential{
+		ID:                authData.CredentialID,
+		PublicKey:         authData.PublicKey,
+		Algorithm:         alg,
+		SignCount:         authData.SignCount,
+		AAGUID:            authData.AAGUID,
+		AttestationFormat: format,
+		AttestationType:   attestationType,
+		UserVerified:      authData.Flags&FlagUserVerified != 0,
+		BackupEligible:    authData.Flags&FlagBackupEligible != 0,
+	}, nil
+}
+
+// Assertion is the result of a verified navigator.credentials.get() response.
+type Assertion struct {
+	// SignCount is the new signature counter, which must be stored.
+	SignCount uint32
+
+	// UserVerified is set if the authenticator verified the user, e.g. with a PIN or biometrics.
+	UserVerified bool
+}
+
+// VerifyAssertion checks the response of navigator.credentials.get() for the given challenge against the stored
+// public key and signature counter of the credential.
+//
+// Returns SignCountMismatch if the authenticator reports a counter which is not greater than the stored one.
+// Authenticators without counter always report 0.
+func (rp *RelyingParty) VerifyAssertion(challenge string, publicKey []byte, signCount uint32, clientDataJSON, authenticatorData, signature []byte) (*Assertion, error) {
+	if err := rp.verifyClientData(clientDataJSON, clientDataTypeGet, challenge); err != nil {
+		return nil, err
+	}
+
+	authData, err := parseAuthenticatorData(authenticatorData)
+	if err != nil {
+		return nil, err
+	}
+	if err := rp.verifyAuthenticatorData(authData); err != nil {
+		return nil, err
+	}
+
+	pub, alg, err := parsePublicKey(publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	signed := append(append([]byte{}, authenticatorData...), clientDataHash[:]...)
+	if err := verifySignature(pub, alg, signed, signature); err != nil {
+		return nil, err
+	}
+
+	if (authData.SignCount != 0 || signCount != 0) && authData.SignCount <= signCount {
+		return nil, SignCountMismatch
+	}
+	return &Assertion{
+		SignCount:    authData.SignCount,
+		UserVerified: authData.Flags&FlagUserVerified != 0,
+	}, nil
+}
+
+// -------------------------------------------------
+
+type clientData struct {
+	Type        string `json:"type"`
+	Challenge   string `json:"challenge"`
+	Origin      string `json:"origin"`
+	CrossOrigin bool   `json:"crossOrigin"`
+}
+
+func (rp *RelyingParty) verifyClientData(clientDataJSON []byte, expectedType, challenge string) error {
+	var data clientData
+	if err := json.Unmarshal(clientDataJSON, &data); err != nil {
+		return InvalidClientData
+	}
+	if data.Type != expectedType || data.CrossOrigin {
+		return InvalidClientData
+	}
+	if challenge == "" || strings.TrimRight(data.Challenge, "=") != strings.TrimRight(challenge, "=") {
+		return ChallengeMismatch
+	}
+	for _, origin := range rp.Origins {
+		if data.Origin == origin {
+			return nil
+		}
+	}
+	return OriginNotAllowed
+}
+
+type authenticatorData struct {
+	RPIDHash  []byte
+	Flags     byte
+	SignCount uint32
+
+	// Only set if FlagAttestedCredentialData is set
+	AAGUID       []byte
+	CredentialID []byte
+	PublicKey    []byte
+}
+
+func (rp *RelyingParty) verifyAuthenticatorData(authData *authenticatorData) error {
+	rpIDHash := sha256.Sum256([]byte(rp.ID))
+	if !bytes.Equal(authData.RPIDHash, rpIDHash[:]) {
+		return RPIDMismatch
+	}
+	if authData.Flags&FlagUserPresent == 0 {
+		return UserNotPresent
+	}
+	if rp.RequireUserVerification && authData.Flags&FlagUserVerified == 0 {
+		return UserNotVerified
+	}
+	return nil
+}
+
+func parseAuthenticatorData(data []byte) (*authenticatorData, error) {
+	if len(data) < 37 {
+		return nil, InvalidAuthenticatorData
+	}
+
+	result := &authenticatorData{
+		RPIDHash:  data[:32],
+		Flags:     data[32],
+		SignCount: binary.BigEndian.Uint32(data[33:37]),
+	}
+	rest := data[37:]
+
+	if result.Flags&FlagAttestedCredentialData != 0 {
+		if len(rest) < 18 {
+			return nil, InvalidAuthenticatorData
+		}
+		result.AAGUID = rest[:16]
+		idLength := int(binary.BigEndian.Uint16(rest[16:18]))
+		rest = rest[18:]
+		if idLength == 0 || idLength > maxCredentialIDLength || idLength > len(rest) {
+			return nil, InvalidAuthenticatorData
+		}
+		result.CredentialID = rest[:idLength]
+		rest = rest[idLength:]
+
+		_, n, err := decodeCBOR(rest)
+		if err != nil {
+			return nil, InvalidAuthenticatorData
+		}
+		result.PublicKey = rest[:n]
+		rest = rest[n:]
+	}
+
+	if result.Flags&FlagExtensionData != 0 {
+		value, n, err := decodeCBOR(rest)
+		if err != nil {
+			return nil, InvalidAuthenticatorData
+		}
+		if _, ok := value.(map[interface{}]interface{}); !ok {
+			return nil, InvalidAuthenticatorData
+		}
+		rest = rest[n:]
+	}
+
+	if len(rest) != 0 {
+		return nil, InvalidAuthenticatorData
+	}
+	return result, nil
+}
@@ -0,0 +1,216 @@
+package webauthn
+
+import (
+	"testing"
+	"time"
+)
+
+const (
+	testRPID   = "example.com"
+	testOrigin = "https://example.com"
+)
+
+func testRelyingParty() *RelyingParty {
+	return &RelyingParty{
+		ID:      testRPID,
+		Name:    "Example",
+		Origins: []string{testOrigin},
+		Timeout: time.Minute,
+	}
+}
+
+func register(t *testing.T, rp *RelyingParty, authenticator *SoftAuthenticator) *Credential {
+	challenge, err := NewChallenge()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	options := rp.CreationOptions(challenge, UserEntity{ID: "dXNlcg", Name: "user", DisplayName: "User"}, nil)
+	response, err := authenticator.Register(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	credential, err := rp.VerifyRegistration(challenge, decode(t, response.ClientDataJSON), decode(t, response.AttestationObject))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if Encode(credential.ID) != response.CredentialID {
+		t.Fatalf("Unexpected credential ID %s", Encode(credential.ID))
+	}
+	return credential
+}
+
+func authenticate(t *testing.T, rp *RelyingParty, authenticator *SoftAuthenticator, credential *Credential) (*Assertion, error) {
+	challenge, err := NewChallenge()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	response, err := authenticator.Authenticate(rp.RequestOptions(challenge, []string{Encode(credential.ID)}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return rp.VerifyAssertion(challenge, credential.PublicKey, credential.SignCount,
+		decode(t, response.ClientDataJSON), decode(t, response.AuthenticatorData), decode(t, response.Signature))
+}
+
+func decode(t *testing.T, s string) []byte {
+	data, err := Decode(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestRegistrationAttestationFormats(t *testing.T) {
+	rp := testRelyingParty()
+
+	for format, expectedType := range map[string]string{
+		SoftAttestationNone:      AttestationNone,
+		SoftAttestationPacked:    AttestationSelf,
+		SoftAttestationPackedX5C: AttestationBasic,
+	} {
+		authenticator := NewSoftAuthenticator(testRPID, testOrigin)
+		authenticator.Attestation = format
+
+		credential := register(t, rp, authenticator)
+		if credential.AttestationType != expectedType {
+			t.Errorf("%s: expected attestation type %s, got %s", format, expectedType, credential.AttestationType)
+		}
+		if credential.Algorithm != AlgES256 || !credential.UserVerified {
+			t.Errorf("%s: unexpected credential %#v", format, credential)
+		}
+	}
+}
+
+func TestRegistrationRejectsWrongChallengeAndOrigin(t *testing.T) {
+	rp := testRelyingParty()
+	challenge, _ := NewChallenge()
+	options := rp.CreationOptions(challenge, UserEntity{ID: "dXNlcg", Name: "user"}, nil)
+
+	response, err := NewSoftAuthenticator(testRPID, testOrigin).Register(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherChallenge, _ := NewChallenge()
+	if _, err := rp.VerifyRegistration(otherChallenge, decode(t, response.ClientDataJSON), decode(t, response.AttestationObject)); err != ChallengeMismatch {
+		t.Errorf("Expected ChallengeMismatch, got %v", err)
+	}
+
+	response, err = NewSoftAuthenticator(testRPID, "https://evil.example").Register(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rp.VerifyRegistration(challenge, decode(t, response.ClientDataJSON), decode(t, response.AttestationObject)); err != OriginNotAllowed {
+		t.Errorf("Expected OriginNotAllowed, got %v", err)
+	}
+
+	options.RelyingParty.ID = "evil.example"
+	evil := NewSoftAuthenticator("evil.example", testOrigin)
+	response, err = evil.Register(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rp.VerifyRegistration(challenge, decode(t, response.ClientDataJSON), decode(t, response.AttestationObject)); err != RPIDMismatch {
+		t.Errorf("Expected RPIDMismatch, got %v", err)
+	}
+}
+
+func TestRegistrationRequiresUserVerification(t *testing.T) {
+	rp := testRelyingParty()
+	rp.RequireUserVerification = true
+
+	challenge, _ := NewChallenge()
+	authenticator := NewSoftAuthenticator(testRPID, testOrigin)
+	authenticator.UserVerified = false
+
+	response, err := authenticator.Register(rp.CreationOptions(challenge, UserEntity{ID: "dXNlcg", Name: "user"}, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rp.VerifyRegistration(challenge, decode(t, response.ClientDataJSON), decode(t, response.AttestationObject)); err != UserNotVerified {
+		t.Errorf("Expected UserNotVerified, got %v", err)
+	}
+}
+
+func TestAssertionSignCount(t *testing.T) {
+	rp := testRelyingParty()
+	authenticator := NewSoftAuthenticator(testRPID, testOrigin)
+	credential := register(t, rp, authenticator)
+
+	clone := authenticator.Clone()
+
+	for i := uint32(1); i <= 2; i++ {
+		assertion, err := authenticate(t, rp, authenticator, credential)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if assertion.SignCount != i {
+			t.Errorf("Expected sign count %d, got %d", i, assertion.SignCount)
+		}
+		credential.SignCount = assertion.SignCount
+	}
+
+	// The clone still reports 1
+	if _, err := authenticate(t, rp, clone, credential); err != SignCountMismatch {
+		t.Errorf("Expected SignCountMismatch, got %v", err)
+	}
+}
+
+func TestAssertionUserVerified(t *testing.T) {
+	rp := testRelyingParty()
+	authenticator := NewSoftAuthenticator(testRPID, testOrigin)
+	credential := register(t, rp, authenticator)
+
+	for _, verified := range []bool{true, false} {
+		authenticator.UserVerified = verified
+		assertion, err := authenticate(t, rp, authenticator, credential)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if assertion.UserVerified != verified {
+			t.Errorf("Expected UserVerified %v, got %v", verified, assertion.UserVerified)
+		}
+		credential.SignCount = assertion.SignCount
+	}
+
+	rp.RequireUserVerification = true
+	if _, err := authenticate(t, rp, authenticator, credential); err != UserNotVerified {
+		t.Errorf("Expected UserNotVerified, got %v", err)
+	}
+}
+
+func TestAssertionRejectsWrongKey(t *testing.T) {
+	rp := testRelyingParty()
+	credential := register(t, rp, NewSoftAuthenticator(testRPID, testOrigin))
+
+	other := NewSoftAuthenticator(testRPID, testOrigin)
+	otherCredential := register(t, rp, other)
+	otherCredential.PublicKey = credential.PublicKey
+
+	if _, err := authenticate(t, rp, other, otherCredential); err != InvalidSignature {
+		t.Errorf("Expected InvalidSignature, got %v", err)
+	}
+}
+
+func TestCBORRoundTrip(t *testing.T) {
+	encoded := encodeCBOR([]cborPair{
+		{"b", []interface{}{int64(1), -500, "text", true}},
+		{1, []byte{1, 2, 3}},
+		{-70000, map[interface{}]interface{}{"x": int64(1 << 40)}},
+	})
+
+	value, n, err := decodeCBOR(encoded)
+	if err != nil || n != len(encoded) {
+		t.Fatalf("Decoding failed: %v", err)
+	}
+	if string(encodeCBOR(value)) != string(encoded) {
+		t.Errorf("Round trip changed the encoding")
+	}
+
+	if _, _, err := decodeCBOR(encoded[:len(encoded)-1]); err == nil {
+		t.Errorf("Expected an error for truncated data")
+	}
+}